@@ -0,0 +1,201 @@
+package wutbot
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Config is what New needs to set up a bot. Only Nick, Servers and
+// Channels are required; the zero values of the rest are the defaults.
+type Config struct {
+	Nick string
+	// host:port, or a comma-delimited list to fail over between
+	Servers  string
+	Channels []string
+
+	SASLLogin    string
+	SASLPassword string
+	// PLAIN by default, or SCRAM-SHA-256
+	SASLMech string
+	// client certificate and key files, for SASL EXTERNAL
+	TLSCert string
+	TLSKey  string
+
+	NickServPassword string
+	NickServNick     string
+	NickServCommand  string
+	NickServSuccess  string
+
+	WebIRCPassword string
+	WebIRCGateway  string
+	WebIRCHostname string
+	WebIRCIP       string
+
+	// the account whose owner commands are accepted
+	Owner     string
+	OwnerNick string
+	// accounts that may use moderation commands, besides the owner
+	Admins []string
+
+	Version            string
+	UserAgent          string
+	AcceptLanguage     string // for fetches, unless a channel has its own
+	InsecureSkipVerify bool
+	// the server certificates to trust instead of checking with the CAs
+	// (see parsePins)
+	TLSPins   []string
+	Plaintext bool
+	// for fetching links, feeds etc.; by default, one that refuses to
+	// connect to private addresses
+	FetchClient *http.Client
+	// for the default FetchClient, a DNS-over-HTTPS URL or tls:// DNS-over-TLS
+	// server to look hosts up with (see fetch.NewResolver)
+	DNSResolver string
+	// "ipv4" or "ipv6" to connect over first, or "race" (see netdial)
+	IPPreference string
+
+	Debug      bool
+	LogOutput  io.Writer // os.Stdout by default
+	LogFormat  string
+	LogLevel   string
+	LogModules string
+
+	DataDir      string
+	StoreBackend string
+	StoreURL     string
+	// the JSON file of per-channel settings etc., if any
+	ConfigFile string
+
+	LogDir      string
+	LogMaxSize  int64
+	LogRotation time.Duration
+
+	HTTPListen        string
+	Pprof             bool
+	DashboardUser     string
+	DashboardPassword string
+	GitHubSecret      string
+
+	NotifyPanics bool
+	SentryDSN    string
+	ErrorWebhook string
+
+	TwitterBearerToken string
+	GitHubToken        string
+	// a Discord bot token, for relaying Discord messages to IRC
+	DiscordToken string
+	LLMURL       string
+	LLMAPIKey    string
+	LLMModel     string
+	// for naming the places map links are of; the public instance by default
+	NominatimURL string
+	// for !movie and IMDb links: either will do
+	OMDBAPIKey string
+	TMDBAPIKey string
+
+	PollDuration  time.Duration
+	RejoinDelay   time.Duration
+	FloodBurst    int
+	FloodInterval time.Duration
+	// negative to answer messages however old they are
+	MaxMessageAge time.Duration
+
+	// programs to run as plugins
+	Plugins []string
+	// where Starlark scripts are loaded from ("scripts" by default)
+	ScriptsDir string
+
+	// a Matrix user to serve rooms as too (see matrix.go)
+	MatrixHomeserver  string
+	MatrixUserID      string
+	MatrixAccessToken string
+	MatrixRooms       []string
+
+	// an XMPP account for the owner to use the bot from (see xmpp.go)
+	XMPPJID      string
+	XMPPPassword string
+	XMPPServer   string
+	XMPPOwner    string
+}
+
+// Message is a channel message, as passed to a Handler.
+type Message struct {
+	Channel string
+	Nick    string
+	Account string // empty if the sender isn't logged in
+	MsgID   string
+	Text    string
+	Time    time.Time
+}
+
+// A Handler is called with each channel message that isn't a built-in
+// command, in the order they were registered. Returning true stops the
+// message going any further: to later handlers, triggers, link titles etc.
+type Handler func(ctx context.Context, bot *Bot, m Message) bool
+
+// RegisterHandler adds a handler for channel messages.
+func (irc *Bot) RegisterHandler(h Handler) {
+	irc.handlersMutex.Lock()
+	defer irc.handlersMutex.Unlock()
+	irc.handlers = append(irc.handlers, h)
+}
+
+func (irc *Bot) runHandlers(ctx context.Context, m Message) bool {
+	irc.handlersMutex.RLock()
+	handlers := irc.handlers
+	irc.handlersMutex.RUnlock()
+	for _, h := range handlers {
+		handled := false
+		irc.safely("handler", func() { handled = h(ctx, irc, m) })
+		if handled {
+			return true
+		}
+	}
+	return false
+}
+
+// Reply answers a message with a notice, threaded as a reply where the
+// server supports it.
+func (irc *Bot) Reply(m Message, text string) {
+	irc.sendReplyNotice(m.Channel, m.MsgID, text)
+}
+
+// Run connects (retrying with backoff) and handles events until ctx is
+// cancelled or the owner tells the bot to quit, then saves its state. A
+// Bot can only be run once.
+func (irc *Bot) Run(ctx context.Context) error {
+	stop := context.AfterFunc(ctx, func() { irc.shutdown("shutting down") })
+	defer stop()
+	irc.runWorkers(concurrencyLimit)
+	go irc.runSendQueue()
+	go irc.rotateTopics()
+	go irc.saveStats()
+	go irc.pollFeeds()
+	go irc.runSchedules()
+	go irc.pollFollows()
+	go irc.pollReleases()
+	go irc.pollDiscord()
+	go irc.runDiscordSender()
+	irc.startPlugins()
+	go irc.watchScripts()
+	if irc.matrix != nil {
+		go irc.runMatrix()
+	}
+	if irc.xmpp != nil {
+		go irc.runXMPP()
+	}
+	if irc.httpListen != "" {
+		irc.serveHTTP(irc.httpListen)
+	}
+	defer irc.saveState()
+	if err := irc.connectWithRetry(); err != nil {
+		if irc.stopping.ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	irc.Loop()
+	return nil
+}
@@ -0,0 +1,147 @@
+package wutbot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pratyush/wutbot/internal/commands"
+)
+
+const (
+	// privileged actions, keyed by time so that they sort in order
+	auditBucket = "audit"
+	// the oldest entries are dropped beyond this
+	maxAuditEntries  = 5000
+	defaultAuditList = 10
+
+	auditKeyFormat = "20060102T150405.000000000Z"
+)
+
+type auditEntry struct {
+	Time    time.Time `json:"time"`
+	Nick    string    `json:"nick"`
+	Account string    `json:"account,omitempty"`
+	// the channel, or "DCC", "XMPP" or "dashboard"
+	Channel string `json:"channel"`
+	Command string `json:"command"`
+	Denied  bool   `json:"denied,omitempty"`
+}
+
+// secretCommands are the commands, to the server or to services, whose
+// arguments are passwords or credentials.
+var secretCommands = map[string]bool{"IDENTIFY": true, "REGISTER": true, "PASS": true, "AUTHENTICATE": true}
+
+// redactCommand hides channel keys, whether set with the owner's "key
+// <channel> <key>" or as the "key" option of "config set <channel> key
+// <key>", and credentials, whether sent raw or in a message to services.
+func redactCommand(command string) string {
+	f := strings.Fields(command)
+	redact := func(keep int) string {
+		return strings.Join(append(f[:keep:keep], "<redacted>"), " ")
+	}
+	for i, field := range f {
+		word := strings.ToUpper(strings.TrimPrefix(field, ":"))
+		switch {
+		case word == "KEY":
+			secret := i + 1
+			if secret < len(f) && strings.ContainsAny(f[secret][:1], "#&") {
+				secret++
+			}
+			if secret < len(f) {
+				return redact(secret)
+			}
+		case secretCommands[word] && i+1 < len(f):
+			return redact(i + 1)
+		case (word == "PRIVMSG" || word == "NOTICE" || word == "MSG") && i+2 < len(f) && strings.HasSuffix(strings.ToLower(f[i+1]), "serv"):
+			// keep what's asked of the service, but none of its arguments
+			if i+3 < len(f) {
+				return redact(i + 3)
+			}
+			return redact(i + 2)
+		}
+	}
+	return command
+}
+
+// audit records a privileged action (or an attempt at one).
+func (irc *Bot) audit(entry auditEntry) {
+	entry.Time = time.Now()
+	entry.Command = redactCommand(entry.Command)
+	key := entry.Time.UTC().Format(auditKeyFormat)
+	if err := irc.store.Put(auditBucket, key, entry); err != nil {
+		irc.logger("audit").Error("couldn't save audit entry", "nick", entry.Nick, "command", entry.Command, "err", err)
+		return
+	}
+	if keys, err := irc.store.Keys(auditBucket); err == nil && len(keys) > maxAuditEntries {
+		for _, old := range keys[:len(keys)-maxAuditEntries] {
+			irc.store.Delete(auditBucket, old)
+		}
+	}
+}
+
+func (irc *Bot) auditCommand(cmd commands.Command, denied bool) {
+	irc.audit(auditEntry{
+		Nick: cmd.Nick, Account: cmd.Account, Channel: cmd.Target,
+		Command: commands.Prefix + cmd.Name + " " + strings.Join(cmd.Args, " "), Denied: denied,
+	})
+}
+
+// requireAdmin audits a command only admins may use, replying if the user
+// isn't one.
+func (irc *Bot) requireAdmin(cmd commands.Command) bool {
+	admin := irc.isAdmin(cmd.Account)
+	irc.auditCommand(cmd, !admin)
+	if !admin {
+		irc.replyf(cmd, "you're not allowed to do that")
+	}
+	return admin
+}
+
+// handleAuditCommand is the owner's "audit [<count>] [<account>]", which
+// shows the latest privileged actions, optionally only one account's.
+func (irc *Bot) handleAuditCommand(target string, args []string) {
+	count := defaultAuditList
+	if len(args) != 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil && n > 0 {
+			count, args = n, args[1:]
+		}
+	}
+	var account string
+	if len(args) != 0 {
+		account = args[0]
+	}
+	keys, err := irc.store.Keys(auditBucket)
+	if err != nil {
+		irc.Privmsg(target, fmt.Sprintf("couldn't read the audit log: %v", err))
+		return
+	}
+	var entries []auditEntry
+	for i := len(keys) - 1; i >= 0 && len(entries) < count; i-- {
+		var entry auditEntry
+		if found, _ := irc.store.Get(auditBucket, keys[i], &entry); !found {
+			continue
+		}
+		if account != "" && !strings.EqualFold(entry.Account, account) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if len(entries) == 0 {
+		irc.Privmsg(target, "no audit entries")
+		return
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		who := e.Nick
+		if e.Account != "" && !strings.EqualFold(e.Account, e.Nick) {
+			who += " (" + e.Account + ")"
+		}
+		line := fmt.Sprintf("%s %s in %s: %s", e.Time.UTC().Format("2006-01-02 15:04:05"), who, e.Channel, e.Command)
+		if e.Denied {
+			line += " [denied]"
+		}
+		irc.Privmsg(target, line)
+	}
+}
@@ -0,0 +1,26 @@
+package wutbot
+
+import (
+	"testing"
+)
+
+func TestRedactCommand(t *testing.T) {
+	tests := []struct{ command, want string }{
+		{"key #chan hunter2", "key #chan <redacted>"},
+		{"config set #chan key hunter2", "config set #chan key <redacted>"},
+		{"raw PASS hunter2", "raw PASS <redacted>"},
+		{"raw AUTHENTICATE d3V0Ym90AHd1dGJvdABodW50ZXIy", "raw AUTHENTICATE <redacted>"},
+		{"raw NS IDENTIFY wutbot hunter2", "raw NS IDENTIFY <redacted>"},
+		{"raw PRIVMSG NickServ :IDENTIFY hunter2", "raw PRIVMSG NickServ :IDENTIFY <redacted>"},
+		{"raw PRIVMSG NickServ :register hunter2 me@example.com", "raw PRIVMSG NickServ :register <redacted>"},
+		{"msg ChanServ SET #chan PASSWORD hunter2", "msg ChanServ SET <redacted>"},
+		{"raw PRIVMSG NickServ :hunter2", "raw PRIVMSG NickServ <redacted>"},
+		{"raw PRIVMSG #chan :hello there", "raw PRIVMSG #chan :hello there"},
+		{"mode #chan +o friend", "mode #chan +o friend"},
+	}
+	for _, tt := range tests {
+		if got := redactCommand(tt.command); got != tt.want {
+			t.Errorf("redactCommand(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
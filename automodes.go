@@ -0,0 +1,76 @@
+package wutbot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// followed by the casefolded channel; maps accounts to "o" or "v"
+	autoModesBucket = "automodes:"
+)
+
+// handleAutoModeJoin ops or voices users from the channel's list as they
+// join, going by their account (from extended-join or account-tag).
+func (irc *Bot) handleAutoModeJoin(j joinEvent) {
+	if j.self || j.account == "" || !irc.chanModes.hasOps(j.channel) {
+		return
+	}
+	var mode string
+	if found, _ := irc.store.Get(autoModesBucket+strings.ToLower(j.channel), j.account, &mode); found {
+		irc.Send("MODE", j.channel, "+"+mode, j.nick)
+	}
+}
+
+// handleAutoCommand is the owner's "auto <channel> [op|voice|remove <account>]";
+// with just a channel, it lists who gets what.
+func (irc *Bot) handleAutoCommand(target string, args []string) {
+	if len(args) == 0 || !irc.isChannel(args[0]) {
+		irc.Privmsg(target, "usage: auto <channel> [op|voice|remove <account>]")
+		return
+	}
+	bucket := autoModesBucket + strings.ToLower(args[0])
+	if len(args) == 1 {
+		accounts, err := irc.store.Keys(bucket)
+		if err != nil {
+			irc.Privmsg(target, fmt.Sprintf("couldn't read: %v", err))
+			return
+		}
+		var entries []string
+		for _, account := range accounts {
+			var mode string
+			if found, _ := irc.store.Get(bucket, account, &mode); found {
+				entries = append(entries, "+"+mode+" "+account)
+			}
+		}
+		sort.Strings(entries)
+		if len(entries) == 0 {
+			irc.Privmsg(target, fmt.Sprintf("nobody gets anything in %s", args[0]))
+		} else {
+			irc.Privmsg(target, fmt.Sprintf("%s: %s", args[0], strings.Join(entries, ", ")))
+		}
+		return
+	}
+	if len(args) != 3 {
+		irc.Privmsg(target, "usage: auto <channel> [op|voice|remove <account>]")
+		return
+	}
+	var err error
+	switch strings.ToLower(args[1]) {
+	case "op":
+		err = irc.store.Put(bucket, args[2], "o")
+	case "voice":
+		err = irc.store.Put(bucket, args[2], "v")
+	case "remove":
+		err = irc.store.Delete(bucket, args[2])
+	default:
+		irc.Privmsg(target, "usage: auto <channel> [op|voice|remove <account>]")
+		return
+	}
+	if err != nil {
+		irc.Privmsg(target, fmt.Sprintf("couldn't save: %v", err))
+		return
+	}
+	irc.Privmsg(target, "done")
+}
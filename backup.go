@@ -0,0 +1,128 @@
+package wutbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"pratyush/wutbot/internal/storage"
+)
+
+const (
+	backupVersion = 1
+)
+
+// data directory subdirectories that hold state outside the store
+var backupDirs = []string{"markov"}
+
+// backup is the whole persistent state, for moving between hosts or
+// storage backends.
+type backup struct {
+	Version int                                   `json:"version"`
+	Created time.Time                             `json:"created"`
+	Buckets map[string]map[string]json.RawMessage `json:"buckets"`
+	// relative to the data directory
+	Files map[string][]byte `json:"files"`
+}
+
+func writeBackup(w io.Writer, s storage.Store, dataDir string) error {
+	b := backup{
+		Version: backupVersion,
+		Created: time.Now().UTC(),
+		Buckets: make(map[string]map[string]json.RawMessage),
+		Files:   make(map[string][]byte),
+	}
+	buckets, err := s.Buckets()
+	if err != nil {
+		return fmt.Errorf("couldn't list buckets: %w", err)
+	}
+	for _, bucket := range buckets {
+		keys, err := s.Keys(bucket)
+		if err != nil {
+			return fmt.Errorf("couldn't list %s: %w", bucket, err)
+		}
+		values := make(map[string]json.RawMessage)
+		for _, key := range keys {
+			var value json.RawMessage
+			if found, err := s.Get(bucket, key, &value); err != nil {
+				return fmt.Errorf("couldn't read %s %s: %w", bucket, key, err)
+			} else if found {
+				values[key] = value
+			}
+		}
+		b.Buckets[bucket] = values
+	}
+	for _, dir := range backupDirs {
+		entries, err := os.ReadDir(filepath.Join(dataDir, dir))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			name := filepath.ToSlash(filepath.Join(dir, entry.Name()))
+			if b.Files[name], err = os.ReadFile(filepath.Join(dataDir, name)); err != nil {
+				return err
+			}
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
+
+// restoreBackup loads a backup into the store and data directory, first
+// clearing the store if clean is set; otherwise existing keys that aren't
+// in the backup are kept.
+func restoreBackup(r io.Reader, s storage.Store, dataDir string, clean bool) error {
+	var b backup
+	if err := json.NewDecoder(r).Decode(&b); err != nil {
+		return fmt.Errorf("couldn't parse backup: %w", err)
+	}
+	if b.Version < 1 || b.Version > backupVersion {
+		return fmt.Errorf("unsupported backup version %d", b.Version)
+	}
+	if clean {
+		buckets, err := s.Buckets()
+		if err != nil {
+			return fmt.Errorf("couldn't list buckets: %w", err)
+		}
+		for _, bucket := range buckets {
+			keys, err := s.Keys(bucket)
+			if err != nil {
+				return fmt.Errorf("couldn't list %s: %w", bucket, err)
+			}
+			for _, key := range keys {
+				if err := s.Delete(bucket, key); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for bucket, values := range b.Buckets {
+		for key, value := range values {
+			if err := s.Put(bucket, key, value); err != nil {
+				return fmt.Errorf("couldn't write %s %s: %w", bucket, key, err)
+			}
+		}
+	}
+	for name, data := range b.Files {
+		path := filepath.Join(dataDir, filepath.FromSlash(name))
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return fmt.Errorf("invalid file name %s in backup", name)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
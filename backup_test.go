@@ -0,0 +1,73 @@
+package wutbot
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"pratyush/wutbot/internal/storage"
+)
+
+// failingKeys is a store that can't list a bucket's keys.
+type failingKeys struct {
+	storage.Store
+}
+
+var errListing = errors.New("connection reset")
+
+func (failingKeys) Keys(bucket string) ([]string, error) {
+	return nil, errListing
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	from, err := storage.OpenSQLite(filepath.Join(dir, "from.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer from.Close()
+	from.Put("a", "one", 1)
+	from.Put("b", "two", "2")
+	var buf bytes.Buffer
+	if err := writeBackup(&buf, from, dir); err != nil {
+		t.Fatal(err)
+	}
+
+	to, err := storage.OpenSQLite(filepath.Join(dir, "to.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer to.Close()
+	to.Put("c", "stale", true)
+	if err := restoreBackup(&buf, to, dir, true); err != nil {
+		t.Fatal(err)
+	}
+	var one int
+	var two string
+	if found, _ := to.Get("a", "one", &one); !found || one != 1 {
+		t.Errorf("a one = %v, %v", one, found)
+	}
+	if found, _ := to.Get("b", "two", &two); !found || two != "2" {
+		t.Errorf("b two = %q, %v", two, found)
+	}
+	if found, _ := to.Get("c", "stale", new(bool)); found {
+		t.Error("a clean restore kept a key that wasn't in the backup")
+	}
+}
+
+func TestBackupFailsWhenTheStoreDoes(t *testing.T) {
+	dir := t.TempDir()
+	s, err := storage.OpenSQLite(filepath.Join(dir, "wutbot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Put("a", "one", 1)
+	if err := writeBackup(new(bytes.Buffer), failingKeys{s}, dir); !errors.Is(err, errListing) {
+		t.Errorf("writeBackup: %v, want %v", err, errListing)
+	}
+	if err := restoreBackup(bytes.NewReader([]byte(`{"version":1}`)), failingKeys{s}, dir, true); !errors.Is(err, errListing) {
+		t.Errorf("restoreBackup: %v, want %v", err, errListing)
+	}
+}
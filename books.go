@@ -0,0 +1,163 @@
+package wutbot
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	openLibraryAPI = "https://openlibrary.org"
+	// authors listed before "et al."
+	maxBookAuthors = 3
+)
+
+var (
+	// only numbers introduced as ISBNs, since plenty of others would pass the
+	// checksum; the run of digits can go on past the ISBN (see firstISBN)
+	isbnRegex          = regexp.MustCompile(`(?i)\bISBN(?:-1[03])?:?\s*([0-9][0-9X -]{8,24})\b`)
+	openLibraryWork    = regexp.MustCompile(`^/works/(OL\d+W)(?:/|$)`)
+	openLibraryEdition = regexp.MustCompile(`^/books/(OL\d+M)(?:/|$)`)
+	openLibraryISBN    = regexp.MustCompile(`^/isbn/([0-9Xx-]+)/?$`)
+	goodreadsBook      = regexp.MustCompile(`^/book/show/(\d+)`)
+)
+
+// extractISBNs returns the ISBNs in a message as OpenLibrary links, so
+// they're titled (and archived) like book links.
+func extractISBNs(message string) (result []string) {
+	for _, match := range isbnRegex.FindAllStringSubmatch(message, -1) {
+		if isbn, ok := firstISBN(match[1]); ok {
+			result = append(result, openLibraryAPI+"/isbn/"+isbn)
+		}
+	}
+	return
+}
+
+// firstISBN finds the ISBN at the start of a run of digits and separators
+// that can go on past it, as in "ISBN 0306406152 123": the 13 or 10 digits
+// that end at a separator (or the end) and have a valid check digit, the
+// 13 if both do.
+func firstISBN(run string) (string, bool) {
+	var candidates []string
+	digits := 0
+	for i := 0; i < len(run) && digits < 13; i++ {
+		c := run[i]
+		if c == ' ' || c == '-' {
+			if run[i-1] == ' ' || run[i-1] == '-' {
+				break
+			}
+			continue
+		}
+		digits++
+		if c == 'x' || c == 'X' {
+			// only ever the check digit of an ISBN-10
+			if digits == 10 {
+				candidates = append(candidates, run[:i+1])
+			}
+			break
+		}
+		if (digits == 10 || digits == 13) && (i+1 == len(run) || run[i+1] == ' ' || run[i+1] == '-') {
+			candidates = append(candidates, run[:i+1])
+		}
+	}
+	for i := len(candidates) - 1; i >= 0; i-- {
+		if isbn, ok := normalizeISBN(candidates[i]); ok {
+			return isbn, true
+		}
+	}
+	return "", false
+}
+
+// normalizeISBN strips an ISBN-10 or ISBN-13 of its separators, checking
+// its check digit.
+func normalizeISBN(s string) (string, bool) {
+	isbn := strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(s))
+	sum := 0
+	switch len(isbn) {
+	case 10:
+		for i, c := range isbn {
+			digit := int(c - '0')
+			if c == 'X' && i == 9 {
+				digit = 10
+			} else if c < '0' || c > '9' {
+				return "", false
+			}
+			sum += (10 - i) * digit
+		}
+		return isbn, sum%11 == 0
+	case 13:
+		for i, c := range isbn {
+			if c < '0' || c > '9' {
+				return "", false
+			}
+			digit := int(c - '0')
+			if i%2 == 1 {
+				digit *= 3
+			}
+			sum += digit
+		}
+		return isbn, sum%10 == 0
+	}
+	return "", false
+}
+
+// bookTitle titles OpenLibrary and Goodreads book links with the book's
+// title, authors and when it was first published, from OpenLibrary's
+// search. Books it doesn't know are left to their pages' titles.
+func bookTitle(ctx context.Context, irc *Bot, u *url.URL) (string, bool, error) {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	query := url.Values{"fields": {"title,author_name,first_publish_year"}, "limit": {"1"}}
+	switch host {
+	case "openlibrary.org":
+		if match := openLibraryWork.FindStringSubmatch(u.Path); match != nil {
+			query.Set("q", "key:/works/"+match[1])
+		} else if match := openLibraryEdition.FindStringSubmatch(u.Path); match != nil {
+			query.Set("q", "edition_key:"+match[1])
+		} else if match := openLibraryISBN.FindStringSubmatch(u.Path); match != nil {
+			isbn, ok := normalizeISBN(match[1])
+			if !ok {
+				return "", false, nil
+			}
+			query.Set("isbn", isbn)
+		} else {
+			return "", false, nil
+		}
+	case "goodreads.com":
+		match := goodreadsBook.FindStringSubmatch(u.Path)
+		if match == nil {
+			return "", false, nil
+		}
+		query.Set("q", "id_goodreads:"+match[1])
+	default:
+		return "", false, nil
+	}
+
+	var results struct {
+		Docs []struct {
+			Title            string   `json:"title"`
+			Authors          []string `json:"author_name"`
+			FirstPublishYear int      `json:"first_publish_year"`
+		} `json:"docs"`
+	}
+	if err := irc.getJSON(ctx, openLibraryAPI+"/search.json?"+query.Encode(), &results); err != nil {
+		return "", true, fmt.Errorf("OpenLibrary: %w", err)
+	}
+	if len(results.Docs) == 0 || results.Docs[0].Title == "" {
+		return "", false, nil
+	}
+	book := results.Docs[0]
+	title := book.Title
+	if authors := book.Authors; len(authors) != 0 {
+		if len(authors) > maxBookAuthors {
+			authors = append(authors[:maxBookAuthors:maxBookAuthors], "et al.")
+		}
+		title += " — " + strings.Join(authors, ", ")
+	}
+	if book.FirstPublishYear != 0 {
+		title += " (" + strconv.Itoa(book.FirstPublishYear) + ")"
+	}
+	return title, true, nil
+}
@@ -0,0 +1,31 @@
+package wutbot
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractISBNs(t *testing.T) {
+	link := func(isbn string) string { return openLibraryAPI + "/isbn/" + isbn }
+	tests := []struct {
+		message string
+		want    []string
+	}{
+		{"ISBN 0-306-40615-2", []string{link("0306406152")}},
+		{"isbn: 978-0-306-40615-7 is good", []string{link("9780306406157")}},
+		{"ISBN-10 080442957X", []string{link("080442957X")}},
+		// numbers after the ISBN aren't part of it
+		{"ISBN 0306406152 123 pages", []string{link("0306406152")}},
+		{"ISBN 978 0 306 40615 7 2nd edition", []string{link("9780306406157")}},
+		{"ISBN 0306406152, ISBN 9780306406157", []string{link("0306406152"), link("9780306406157")}},
+		{"ISBN 0306406153", nil},
+		{"ISBN 03064061521", nil},
+		{"ISBN 030640615X2", nil},
+		{"call 0306406152", nil},
+	}
+	for _, tt := range tests {
+		if got := extractISBNs(tt.message); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: %v, want %v", tt.message, got, tt.want)
+		}
+	}
+}
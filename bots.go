@@ -0,0 +1,124 @@
+package wutbot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+const (
+	botWhoxToken = "125"
+)
+
+// botTracker knows which nicks belong to other bots, so that we never
+// answer them (two title bots would otherwise answer each other forever).
+type botTracker struct {
+	sync.Mutex
+	patterns []*regexp.Regexp
+	nicks    map[string]bool // casefolded; learned from WHO
+}
+
+func newBotTracker(config *FileConfig) (*botTracker, error) {
+	bt := &botTracker{nicks: make(map[string]bool)}
+	for _, pattern := range config.Bots {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid bot pattern %s: %w", pattern, err)
+		}
+		bt.patterns = append(bt.patterns, re)
+	}
+	return bt, nil
+}
+
+func (bt *botTracker) set(nick string, isBot bool) {
+	bt.Lock()
+	defer bt.Unlock()
+	if isBot {
+		bt.nicks[strings.ToLower(nick)] = true
+	} else {
+		delete(bt.nicks, strings.ToLower(nick))
+	}
+}
+
+func (bt *botTracker) rename(oldNick, newNick string) {
+	bt.Lock()
+	defer bt.Unlock()
+	if bt.nicks[strings.ToLower(oldNick)] {
+		delete(bt.nicks, strings.ToLower(oldNick))
+		bt.nicks[strings.ToLower(newNick)] = true
+	}
+}
+
+// isBot reports whether a message came from another bot: it carries the
+// bot tag, the sender has bot mode set, or its nick matches the config.
+func (irc *Bot) isBot(e ircmsg.Message) bool {
+	if present, _ := e.GetTag("bot"); present {
+		return true
+	}
+	if present, _ := e.GetTag("draft/bot"); present {
+		return true
+	}
+	nick := e.Nick()
+	irc.bots.Lock()
+	defer irc.bots.Unlock()
+	if irc.bots.nicks[strings.ToLower(nick)] {
+		return true
+	}
+	for _, re := range irc.bots.patterns {
+		if re.MatchString(nick) {
+			return true
+		}
+	}
+	return false
+}
+
+// whoChannel asks who's in a channel we joined, to find the bots.
+func (irc *Bot) whoChannel(channel string) {
+	if irc.ISupport()["BOT"] == "" {
+		return
+	}
+	if _, ok := irc.ISupport()["WHOX"]; ok {
+		irc.Send("WHO", channel, "%tnf,"+botWhoxToken)
+	} else {
+		irc.Send("WHO", channel)
+	}
+}
+
+func (irc *Bot) handleBotWho(e ircmsg.Message) {
+	botMode := irc.ISupport()["BOT"]
+	if botMode == "" {
+		return
+	}
+	var nick, flags string
+	switch e.Command {
+	case ircevent.RPL_WHOREPLY:
+		// <me> <channel> <user> <host> <server> <nick> <flags> :<hopcount> <realname>
+		if len(e.Params) < 7 {
+			return
+		}
+		nick, flags = e.Params[5], e.Params[6]
+	case ircevent.RPL_WHOSPCRPL:
+		// <me> <token> <nick> <flags>
+		if len(e.Params) != 4 || e.Params[1] != botWhoxToken {
+			return
+		}
+		nick, flags = e.Params[2], e.Params[3]
+	}
+	if nick != irc.CurrentNick() {
+		irc.bots.set(nick, strings.Contains(flags, botMode))
+	}
+}
+
+func (irc *Bot) watchBots() {
+	irc.AddCallback(ircevent.RPL_WHOREPLY, irc.handleBotWho)
+	irc.AddCallback(ircevent.RPL_WHOSPCRPL, irc.handleBotWho)
+	irc.AddCallback("NICK", func(e ircmsg.Message) {
+		if len(e.Params) != 0 {
+			irc.bots.rename(e.Nick(), e.Params[0])
+		}
+	})
+}
@@ -0,0 +1,83 @@
+package wutbot
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+// capTracker follows CAP NEW/DEL after registration, which ircevent
+// doesn't: its view of the acknowledged caps is fixed at connect time.
+type capTracker struct {
+	sync.Mutex
+	acked   map[string]string // nil until we're registered
+	offered map[string]string // values from CAP NEW, for when they're acked
+}
+
+// AcknowledgedCaps shadows the ircevent method to include capabilities
+// negotiated (or lost) since we connected.
+func (irc *Bot) AcknowledgedCaps() map[string]string {
+	irc.caps.Lock()
+	defer irc.caps.Unlock()
+	if irc.caps.acked == nil {
+		return irc.Connection.AcknowledgedCaps()
+	}
+	result := make(map[string]string, len(irc.caps.acked))
+	for name, value := range irc.caps.acked {
+		result[name] = value
+	}
+	return result
+}
+
+func (irc *Bot) handleCapNotify(e ircmsg.Message) {
+	if len(e.Params) < 3 {
+		return
+	}
+	irc.caps.Lock()
+	defer irc.caps.Unlock()
+	if irc.caps.acked == nil {
+		// still registering; ircevent handles this part
+		return
+	}
+	var toRequest []string
+	for _, token := range strings.Fields(e.Params[len(e.Params)-1]) {
+		name, value, _ := strings.Cut(token, "=")
+		switch e.Params[1] {
+		case "NEW":
+			if _, ok := irc.caps.acked[name]; !ok && containsFold(irc.RequestCaps, name) {
+				irc.caps.offered[name] = value
+				toRequest = append(toRequest, name)
+			}
+		case "DEL":
+			delete(irc.caps.acked, name)
+		case "ACK":
+			if strings.HasPrefix(name, "-") {
+				delete(irc.caps.acked, name[1:])
+			} else {
+				irc.caps.acked[name] = irc.caps.offered[name]
+				delete(irc.caps.offered, name)
+			}
+		}
+	}
+	if len(toRequest) != 0 {
+		irc.logger("caps").Info("server offered caps, requesting", "caps", strings.Join(toRequest, " "))
+		irc.Send("CAP", "REQ", strings.Join(toRequest, " "))
+	}
+}
+
+func (irc *Bot) watchCaps() {
+	irc.AddConnectCallback(func(e ircmsg.Message) {
+		acked := irc.Connection.AcknowledgedCaps()
+		irc.caps.Lock()
+		irc.caps.acked = acked
+		irc.caps.offered = make(map[string]string)
+		irc.caps.Unlock()
+	})
+	irc.AddDisconnectCallback(func(e ircmsg.Message) {
+		irc.caps.Lock()
+		irc.caps.acked = nil
+		irc.caps.Unlock()
+	})
+	irc.AddCallback("CAP", irc.handleCapNotify)
+}
@@ -0,0 +1,104 @@
+package wutbot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+
+	"pratyush/wutbot/internal/commands"
+	"pratyush/wutbot/internal/fetch"
+)
+
+const (
+	// titles are marked when the site's certificate expires within this many
+	// days, unless the channel says otherwise
+	defaultCertWarningDays = 14
+	certCheckDeadline      = 30 * time.Second
+	certDateFormat         = "2006-01-02"
+)
+
+// certWarningDays is how soon a certificate has to expire for the
+// channel's titles to say so, or 0 if they shouldn't.
+func (irc *Bot) certWarningDays(channel string) int {
+	days := channelOption(irc.getConfig(), channel, func(c ChannelConfig) *int { return c.CertWarningDays })
+	switch {
+	case days < 0:
+		return 0
+	case days == 0:
+		return defaultCertWarningDays
+	}
+	return days
+}
+
+// certWarning is what to add to a title from a site whose certificate
+// expires soon, if anything.
+func (irc *Bot) certWarning(channel string, expires time.Time) string {
+	days := irc.certWarningDays(channel)
+	if days == 0 || expires.IsZero() {
+		return ""
+	}
+	left := time.Until(expires)
+	switch {
+	case left <= 0:
+		return irc.translate(channel, "⚠ certificate expired")
+	case left <= time.Duration(days)*24*time.Hour:
+		return fmt.Sprintf(irc.translate(channel, "⚠ certificate expires in %d days"), daysLeft(left))
+	}
+	return ""
+}
+
+func daysLeft(d time.Duration) int {
+	return int(math.Ceil(d.Hours() / 24))
+}
+
+// certProblemText says what fetch.CertProblem found.
+func (irc *Bot) certProblemText(channel, problem string) string {
+	switch problem {
+	case fetch.CertExpired:
+		return irc.translate(channel, "expired")
+	case fetch.CertNotYetValid:
+		return irc.translate(channel, "not valid yet")
+	case fetch.CertWrongHost:
+		return irc.translate(channel, "for a different host")
+	case fetch.CertUntrusted:
+		return irc.translate(channel, "not from a trusted authority")
+	}
+	return irc.translate(channel, "invalid")
+}
+
+// handleCertCheckCommand is !certcheck <host>, which says whose HTTPS
+// certificate a host has and until when.
+func (irc *Bot) handleCertCheckCommand(cmd commands.Command) {
+	if len(cmd.Args) != 1 {
+		irc.replyf(cmd, "usage: !certcheck <host>")
+		return
+	}
+	host := cmd.Args[0]
+	if strings.Contains(host, "://") {
+		u, err := url.Parse(host)
+		if err != nil || u.Host == "" {
+			irc.replyf(cmd, "usage: !certcheck <host>")
+			return
+		}
+		host = u.Host
+	}
+	shown := fetch.Sanitize(host)
+	err := irc.workers.submit(irc.connectionContext(), cmd.Target, "certcheck", certCheckDeadline, func(ctx context.Context) {
+		cert, err := irc.fetcher.CheckCertificate(irc.fetchContext(ctx, cmd.Target), host)
+		switch {
+		case err != nil:
+			irc.replyf(cmd, "couldn't check %s: %v", shown, err)
+		case cert.Problem != "":
+			irc.replyf(cmd, "%s: certificate %s (issued by %s, valid %s to %s)", shown, irc.certProblemText(cmd.Target, cert.Problem), cert.Issuer,
+				cert.NotBefore.UTC().Format(certDateFormat), cert.NotAfter.UTC().Format(certDateFormat))
+		default:
+			irc.replyf(cmd, "%s: valid until %s (%d days left), issued by %s", shown, cert.NotAfter.UTC().Format(certDateFormat), daysLeft(time.Until(cert.NotAfter)), cert.Issuer)
+		}
+	})
+	if err != nil {
+		irc.replyf(cmd, "too busy, try again later")
+	}
+}
@@ -0,0 +1,399 @@
+package wutbot
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"pratyush/wutbot/internal/fetch"
+)
+
+const (
+	defaultLogMaxSize  = 10 << 20
+	defaultLogRotation = 24 * time.Hour
+
+	logFormatText  = "text"
+	logFormatJSONL = "jsonl"
+	logFormatBoth  = "both"
+
+	logTimestampFormat = "2006-01-02 15:04:05"
+)
+
+// logFile is an append-only log that's rotated (and the old file gzipped)
+// once it reaches a size or age limit.
+type logFile struct {
+	path   string
+	file   *os.File
+	size   int64
+	opened time.Time
+}
+
+func (f *logFile) write(line []byte, maxSize int64, maxAge time.Duration) error {
+	if f.file != nil && (f.size+int64(len(line)) > maxSize || time.Since(f.opened) >= maxAge) {
+		f.rotate()
+	}
+	if f.file == nil {
+		if err := os.MkdirAll(filepath.Dir(f.path), 0700); err != nil {
+			return err
+		}
+		file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return err
+		}
+		info, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return err
+		}
+		f.file, f.size, f.opened = file, info.Size(), time.Now()
+		if f.size != 0 {
+			// continuing a file from before a restart: its age is that of
+			// its first line (not its modification time, which is its last)
+			if started, ok := firstLogTime(f.path); ok {
+				f.opened = started
+			}
+		}
+	}
+	n, err := f.file.Write(line)
+	f.size += int64(n)
+	return err
+}
+
+// firstLogTime returns when the first line of a text or JSON lines log was
+// logged.
+func firstLogTime(path string) (time.Time, bool) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer file.Close()
+	line, err := bufio.NewReader(file).ReadSlice('\n')
+	if err != nil && len(line) == 0 {
+		return time.Time{}, false
+	}
+	if len(line) >= len(logTimestampFormat) {
+		if t, err := time.Parse(logTimestampFormat, string(line[:len(logTimestampFormat)])); err == nil {
+			return t, true
+		}
+	}
+	var entry logEntry
+	if json.Unmarshal(line, &entry) == nil && !entry.Time.IsZero() {
+		return entry.Time, true
+	}
+	return time.Time{}, false
+}
+
+func (f *logFile) rotate() {
+	f.close()
+	ext := filepath.Ext(f.path)
+	stamp := strings.TrimSuffix(f.path, ext) + "-" + time.Now().UTC().Format("20060102-150405")
+	rotated := stamp + ext
+	for i := 1; fileExists(rotated) || fileExists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s.%d%s", stamp, i, ext)
+	}
+	if err := os.Rename(f.path, rotated); err == nil {
+		go compressLog(rotated)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+func (f *logFile) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+func compressLog(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err = io.Copy(zw, in); err == nil {
+		err = zw.Close()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	return os.Remove(path)
+}
+
+type logEntry struct {
+	Time    time.Time         `json:"time"`
+	Command string            `json:"command"`
+	Source  string            `json:"source,omitempty"`
+	Params  []string          `json:"params"`
+	Tags    map[string]string `json:"tags,omitempty"`
+}
+
+// channelLogger writes the traffic of channels with logging enabled to
+// per-channel files, as plain text and/or JSON lines with message tags.
+type channelLogger struct {
+	sync.Mutex
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+	files   map[string]*logFile        // keyed by path
+	members map[string]map[string]bool // casefolded channel -> casefolded nicks, for QUIT and NICK
+}
+
+func newChannelLogger(dir string, maxSize int64, maxAge time.Duration) *channelLogger {
+	if maxSize <= 0 {
+		maxSize = defaultLogMaxSize
+	}
+	if maxAge <= 0 {
+		maxAge = defaultLogRotation
+	}
+	return &channelLogger{
+		dir:     dir,
+		maxSize: maxSize,
+		maxAge:  maxAge,
+		files:   make(map[string]*logFile),
+		members: make(map[string]map[string]bool),
+	}
+}
+
+// logFileName makes a channel name safe to use as a file name.
+func logFileName(channel string) string {
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.ToLower(channel))
+}
+
+func (cl *channelLogger) write(path string, line []byte) error {
+	f := cl.files[path]
+	if f == nil {
+		f = &logFile{path: path}
+		cl.files[path] = f
+	}
+	return f.write(line, cl.maxSize, cl.maxAge)
+}
+
+func (cl *channelLogger) close() {
+	cl.Lock()
+	defer cl.Unlock()
+	for _, f := range cl.files {
+		f.close()
+	}
+}
+
+func (irc *Bot) logFormat(channel string) string {
+	return channelOption(irc.getConfig(), channel, func(c ChannelConfig) *string { return c.Log })
+}
+
+// logEvent logs e to a channel, if it's logged there.
+func (irc *Bot) logEvent(channel string, e ircmsg.Message) {
+	format := irc.logFormat(channel)
+	if format == "" {
+		return
+	}
+	t := messageTime(e)
+	cl := irc.chanLog
+	cl.Lock()
+	defer cl.Unlock()
+	base := filepath.Join(cl.dir, logFileName(channel))
+	var err error
+	if format == logFormatText || format == logFormatBoth {
+		if text := formatLogLine(e); text != "" {
+			err = cl.write(base+".log", []byte(t.UTC().Format(logTimestampFormat)+" "+fetch.Sanitize(text)+"\n"))
+		}
+	}
+	if err == nil && (format == logFormatJSONL || format == logFormatBoth) {
+		var line []byte
+		line, err = json.Marshal(logEntry{Time: t, Command: e.Command, Source: e.Source, Params: e.Params, Tags: e.AllTags()})
+		if err == nil {
+			err = cl.write(base+".jsonl", append(line, '\n'))
+		}
+	}
+	if err != nil {
+		irc.logger("chanlog").Error("couldn't write channel log", "channel", channel, "err", err)
+	}
+}
+
+// formatLogLine is the plain-text form of a logged message.
+func formatLogLine(e ircmsg.Message) string {
+	last := func() string { return e.Params[len(e.Params)-1] }
+	switch e.Command {
+	case "PRIVMSG":
+		if action, ok := strings.CutPrefix(last(), "\x01ACTION "); ok {
+			return fmt.Sprintf("* %s %s", e.Nick(), strings.TrimSuffix(action, "\x01"))
+		}
+		return fmt.Sprintf("<%s> %s", e.Nick(), last())
+	case "NOTICE":
+		return fmt.Sprintf("-%s- %s", e.Nick(), last())
+	case "JOIN":
+		return fmt.Sprintf("*** %s (%s) joined", e.Nick(), e.Source)
+	case "PART":
+		if len(e.Params) > 1 {
+			return fmt.Sprintf("*** %s left (%s)", e.Nick(), last())
+		}
+		return fmt.Sprintf("*** %s left", e.Nick())
+	case "KICK":
+		return fmt.Sprintf("*** %s was kicked by %s (%s)", e.Params[1], e.Nick(), last())
+	case "QUIT":
+		if len(e.Params) > 0 {
+			return fmt.Sprintf("*** %s quit (%s)", e.Nick(), last())
+		}
+		return fmt.Sprintf("*** %s quit", e.Nick())
+	case "NICK":
+		return fmt.Sprintf("*** %s is now known as %s", e.Nick(), last())
+	case "TOPIC":
+		return fmt.Sprintf("*** %s changed the topic to: %s", e.Nick(), last())
+	case "MODE":
+		return fmt.Sprintf("*** %s set mode %s", e.Nick(), strings.Join(e.Params[1:], " "))
+	}
+	return ""
+}
+
+func (cl *channelLogger) addMember(channel, nick string) {
+	cl.Lock()
+	defer cl.Unlock()
+	key := strings.ToLower(channel)
+	if cl.members[key] == nil {
+		cl.members[key] = make(map[string]bool)
+	}
+	cl.members[key][strings.ToLower(nick)] = true
+}
+
+func (cl *channelLogger) removeMember(channel, nick string) {
+	cl.Lock()
+	defer cl.Unlock()
+	delete(cl.members[strings.ToLower(channel)], strings.ToLower(nick))
+}
+
+func (cl *channelLogger) isMember(channel, nick string) bool {
+	cl.Lock()
+	defer cl.Unlock()
+	return cl.members[strings.ToLower(channel)][strings.ToLower(nick)]
+}
+
+// channelsOf returns the (casefolded) channels nick is in.
+func (cl *channelLogger) channelsOf(nick string) (channels []string) {
+	cl.Lock()
+	defer cl.Unlock()
+	for channel, members := range cl.members {
+		if members[strings.ToLower(nick)] {
+			channels = append(channels, channel)
+		}
+	}
+	return
+}
+
+// memberChannels returns the channels nick is in, and (with newNick set)
+// moves them to their new nick.
+func (cl *channelLogger) memberChannels(nick, newNick string) (channels []string) {
+	cl.Lock()
+	defer cl.Unlock()
+	for channel, members := range cl.members {
+		if members[strings.ToLower(nick)] {
+			channels = append(channels, channel)
+			delete(members, strings.ToLower(nick))
+			if newNick != "" {
+				members[strings.ToLower(newNick)] = true
+			}
+		}
+	}
+	return
+}
+
+func (irc *Bot) watchChannelLogs() {
+	cl := irc.chanLog
+	channelEvent := func(e ircmsg.Message) {
+		if len(e.Params) == 0 || !irc.isChannel(e.Params[0]) {
+			// private, or STATUSMSG: not for the whole channel, so not for its log
+			return
+		}
+		irc.logEvent(e.Params[0], e)
+	}
+	for _, command := range []string{"PRIVMSG", "NOTICE", "TOPIC", "MODE"} {
+		irc.AddCallback(command, channelEvent)
+	}
+	irc.AddCallback("JOIN", func(e ircmsg.Message) {
+		if len(e.Params) != 0 {
+			cl.addMember(e.Params[0], e.Nick())
+			irc.logEvent(e.Params[0], e)
+		}
+	})
+	irc.AddCallback("PART", func(e ircmsg.Message) {
+		if len(e.Params) == 0 {
+			return
+		}
+		irc.logEvent(e.Params[0], e)
+		if e.Nick() == irc.CurrentNick() {
+			cl.Lock()
+			delete(cl.members, strings.ToLower(e.Params[0]))
+			cl.Unlock()
+		} else {
+			cl.removeMember(e.Params[0], e.Nick())
+		}
+	})
+	irc.AddCallback("KICK", func(e ircmsg.Message) {
+		if len(e.Params) < 2 {
+			return
+		}
+		irc.logEvent(e.Params[0], e)
+		if e.Params[1] == irc.CurrentNick() {
+			cl.Lock()
+			delete(cl.members, strings.ToLower(e.Params[0]))
+			cl.Unlock()
+		} else {
+			cl.removeMember(e.Params[0], e.Params[1])
+		}
+	})
+	irc.AddCallback("QUIT", func(e ircmsg.Message) {
+		for _, channel := range cl.memberChannels(e.Nick(), "") {
+			irc.logEvent(channel, e)
+		}
+	})
+	irc.AddCallback("NICK", func(e ircmsg.Message) {
+		if len(e.Params) == 0 {
+			return
+		}
+		for _, channel := range cl.memberChannels(e.Nick(), e.Params[0]) {
+			irc.logEvent(channel, e)
+		}
+	})
+	irc.AddCallback(ircevent.RPL_NAMREPLY, func(e ircmsg.Message) {
+		// <me> <symbol> <channel> :<names>
+		if len(e.Params) < 4 {
+			return
+		}
+		_, prefixSymbols := irc.prefixModes()
+		for _, name := range strings.Fields(e.Params[3]) {
+			nick, _, _ := strings.Cut(strings.TrimLeft(name, prefixSymbols), "!")
+			cl.addMember(e.Params[2], nick)
+		}
+	})
+	irc.AddDisconnectCallback(func(e ircmsg.Message) {
+		cl.Lock()
+		cl.members = make(map[string]map[string]bool)
+		cl.Unlock()
+	})
+}
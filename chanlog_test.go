@@ -0,0 +1,46 @@
+package wutbot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogAgeAfterRestart(t *testing.T) {
+	old := time.Now().Add(-48 * time.Hour).UTC()
+	tests := []struct{ name, first string }{
+		{"text", old.Format(logTimestampFormat) + " <nick> hello\n"},
+		{"jsonl", `{"time":"` + old.Format(time.RFC3339Nano) + `","command":"PRIVMSG","params":["#chan","hello"]}` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "#chan."+tt.name)
+			// written to just now, though it was started two days ago
+			if err := os.WriteFile(path, []byte(tt.first), 0600); err != nil {
+				t.Fatal(err)
+			}
+			f := &logFile{path: path}
+			if err := f.write([]byte("line\n"), defaultLogMaxSize, 24*time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			if !f.opened.Equal(old.Truncate(time.Second)) && !f.opened.Equal(old) {
+				t.Errorf("opened %v, want %v", f.opened, old)
+			}
+			if err := f.write([]byte("next\n"), defaultLogMaxSize, 24*time.Hour); err != nil {
+				t.Fatal(err)
+			}
+			f.close()
+			if data, _ := os.ReadFile(path); string(data) != "next\n" {
+				t.Errorf("wasn't rotated: %q", data)
+			}
+			// before the directory's removed
+			for i := 0; i < 100; i++ {
+				if compressed, _ := filepath.Glob(filepath.Join(filepath.Dir(path), "*.gz")); len(compressed) != 0 {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
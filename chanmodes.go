@@ -0,0 +1,154 @@
+package wutbot
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+var errMuted = errors.New("can't speak in a moderated channel without voice")
+
+type channelState struct {
+	moderated bool
+	prefixes  string // our own membership prefixes, e.g. "@+"
+}
+
+// channelModes tracks the modes of the channels we're in that decide
+// whether we can speak there.
+type channelModes struct {
+	sync.Mutex
+	channels map[string]*channelState // keyed by casefolded channel
+}
+
+func newChannelModes() *channelModes {
+	return &channelModes{channels: make(map[string]*channelState)}
+}
+
+func (cm *channelModes) update(channel string, f func(*channelState)) {
+	cm.Lock()
+	defer cm.Unlock()
+	key := strings.ToLower(channel)
+	state := cm.channels[key]
+	if state == nil {
+		state = new(channelState)
+		cm.channels[key] = state
+	}
+	f(state)
+}
+
+func (cm *channelModes) remove(channel string) {
+	cm.Lock()
+	delete(cm.channels, strings.ToLower(channel))
+	cm.Unlock()
+}
+
+func (cm *channelModes) reset() {
+	cm.Lock()
+	cm.channels = make(map[string]*channelState)
+	cm.Unlock()
+}
+
+// canSpeak reports whether messages to a channel would get through:
+// not if it's +m and we have neither voice nor anything higher.
+func (cm *channelModes) canSpeak(channel string) bool {
+	cm.Lock()
+	defer cm.Unlock()
+	state := cm.channels[strings.ToLower(channel)]
+	return state == nil || !state.moderated || state.prefixes != ""
+}
+
+// hasOps reports whether we have halfop or better in a channel.
+func (cm *channelModes) hasOps(channel string) bool {
+	cm.Lock()
+	defer cm.Unlock()
+	state := cm.channels[strings.ToLower(channel)]
+	return state != nil && strings.Trim(state.prefixes, "+") != ""
+}
+
+func addPrefix(prefixes string, prefix byte) string {
+	if strings.IndexByte(prefixes, prefix) == -1 {
+		prefixes += string(prefix)
+	}
+	return prefixes
+}
+
+// applyModes applies a mode change (or RPL_CHANNELMODEIS) to a channel.
+func (irc *Bot) applyModes(channel string, modeString string, params []string) {
+	prefixModes, prefixSymbols := irc.prefixModes()
+	irc.chanModes.update(channel, func(state *channelState) {
+		adding := true
+		for i := 0; i < len(modeString); i++ {
+			mode := modeString[i]
+			switch mode {
+			case '+', '-':
+				adding = mode == '+'
+				continue
+			}
+			var param string
+			if irc.modeTakesParam(mode, adding) && len(params) != 0 {
+				param, params = params[0], params[1:]
+			}
+			if mode == 'm' {
+				state.moderated = adding
+			} else if j := strings.IndexByte(prefixModes, mode); j != -1 && strings.EqualFold(param, irc.CurrentNick()) {
+				if adding {
+					state.prefixes = addPrefix(state.prefixes, prefixSymbols[j])
+				} else {
+					state.prefixes = strings.ReplaceAll(state.prefixes, string(prefixSymbols[j]), "")
+				}
+			}
+		}
+	})
+}
+
+func (irc *Bot) watchChannelModes() {
+	irc.AddCallback("JOIN", func(e ircmsg.Message) {
+		if len(e.Params) != 0 && e.Nick() == irc.CurrentNick() {
+			irc.chanModes.update(e.Params[0], func(state *channelState) {})
+			irc.Send("MODE", e.Params[0])
+		}
+	})
+	irc.AddCallback("PART", func(e ircmsg.Message) {
+		if len(e.Params) != 0 && e.Nick() == irc.CurrentNick() {
+			irc.chanModes.remove(e.Params[0])
+		}
+	})
+	irc.AddCallback("KICK", func(e ircmsg.Message) {
+		if len(e.Params) > 1 && e.Params[1] == irc.CurrentNick() {
+			irc.chanModes.remove(e.Params[0])
+		}
+	})
+	irc.AddDisconnectCallback(func(e ircmsg.Message) {
+		irc.chanModes.reset()
+	})
+	irc.AddCallback("MODE", func(e ircmsg.Message) {
+		if len(e.Params) > 1 && irc.isChannel(e.Params[0]) {
+			irc.applyModes(e.Params[0], e.Params[1], e.Params[2:])
+		}
+	})
+	irc.AddCallback(ircevent.RPL_CHANNELMODEIS, func(e ircmsg.Message) {
+		// <me> <channel> <modes> <params>...
+		if len(e.Params) > 2 {
+			irc.chanModes.update(e.Params[1], func(state *channelState) { state.moderated = false })
+			irc.applyModes(e.Params[1], e.Params[2], e.Params[3:])
+		}
+	})
+	irc.AddCallback(ircevent.RPL_NAMREPLY, func(e ircmsg.Message) {
+		// <me> <symbol> <channel> :<names>
+		if len(e.Params) < 4 {
+			return
+		}
+		_, prefixSymbols := irc.prefixModes()
+		for _, name := range strings.Fields(e.Params[3]) {
+			nick := strings.TrimLeft(name, prefixSymbols)
+			nick, _, _ = strings.Cut(nick, "!") // userhost-in-names
+			if strings.EqualFold(nick, irc.CurrentNick()) {
+				prefixes := name[:len(name)-len(strings.TrimLeft(name, prefixSymbols))]
+				irc.chanModes.update(e.Params[2], func(state *channelState) { state.prefixes = prefixes })
+			}
+		}
+	})
+}
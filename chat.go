@@ -0,0 +1,117 @@
+package wutbot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"pratyush/wutbot/internal/fetch"
+)
+
+const (
+	defaultChatPrompt = "You are %s, a terse IRC bot in %s. Answer in one or two short sentences of plain text."
+
+	// how many previous lines of conversation we send along
+	chatMemoryLines = 10
+	// forget the conversation after this long without mentions
+	chatMemoryExpiry = 30 * time.Minute
+
+	chatChannelLimit  = 10
+	chatUserLimit     = 3
+	chatLimitWindow   = 10 * time.Minute
+	maxChatTokens     = 150
+	maxChatReplyRunes = 400
+	// a late answer would be out of context
+	chatDeadline = time.Minute
+)
+
+type chatMemory struct {
+	lines    []chatMessage
+	lastUsed time.Time
+}
+
+type chatManager struct {
+	sync.Mutex
+	memory         map[string]*chatMemory // keyed by casefolded channel
+	channelLimiter *rateLimiter
+	userLimiter    *rateLimiter
+}
+
+func newChatManager() *chatManager {
+	return &chatManager{
+		memory:         make(map[string]*chatMemory),
+		channelLimiter: newRateLimiter(chatChannelLimit, chatLimitWindow),
+		userLimiter:    newRateLimiter(chatUserLimit, chatLimitWindow),
+	}
+}
+
+// history returns a copy of the channel's recent conversation
+func (cm *chatManager) history(channel string) []chatMessage {
+	cm.Lock()
+	defer cm.Unlock()
+	mem := cm.memory[strings.ToLower(channel)]
+	if mem == nil || time.Since(mem.lastUsed) > chatMemoryExpiry {
+		return nil
+	}
+	return append([]chatMessage(nil), mem.lines...)
+}
+
+func (cm *chatManager) remember(channel string, lines ...chatMessage) {
+	cm.Lock()
+	defer cm.Unlock()
+	key := strings.ToLower(channel)
+	mem := cm.memory[key]
+	if mem == nil || time.Since(mem.lastUsed) > chatMemoryExpiry {
+		mem = new(chatMemory)
+		cm.memory[key] = mem
+	}
+	mem.lines = append(mem.lines, lines...)
+	if len(mem.lines) > chatMemoryLines {
+		mem.lines = mem.lines[len(mem.lines)-chatMemoryLines:]
+	}
+	mem.lastUsed = time.Now()
+}
+
+func (irc *Bot) chatEnabled(channel string) bool {
+	return irc.llm != nil && channelOption(irc.getConfig(), channel, func(c ChannelConfig) *bool { return c.Chat })
+}
+
+// handleChatMention answers a mention using the LLM backend.
+func (irc *Bot) handleChatMention(target, nick, msgid, message string) {
+	text := strings.TrimPrefix(message, irc.Nick)
+	text = strings.TrimSpace(strings.TrimLeft(text, ":,"))
+	if text == "" {
+		return
+	}
+	// both limits are charged, so that one user can't use up the channel's quota
+	if !irc.chat.userLimiter.allow(target+" "+nick) || !irc.chat.channelLimiter.allow(target) {
+		return
+	}
+	irc.workers.submit(irc.connectionContext(), target, "chat", chatDeadline, func(ctx context.Context) {
+		irc.withTyping(target, func() { irc.answerChat(ctx, target, nick, msgid, text) })
+	})
+}
+
+func (irc *Bot) answerChat(ctx context.Context, target, nick, msgid, text string) {
+	prompt := channelOption(irc.getConfig(), target, func(c ChannelConfig) *string { return c.ChatPrompt })
+	if prompt == "" {
+		prompt = fmt.Sprintf(defaultChatPrompt, irc.CurrentNick(), target)
+	}
+	question := chatMessage{Role: "user", Content: fmt.Sprintf("<%s> %s", nick, text)}
+	messages := []chatMessage{{Role: "system", Content: prompt}}
+	messages = append(messages, irc.chat.history(target)...)
+	messages = append(messages, question)
+	answer, err := irc.llm.complete(ctx, messages, maxChatTokens)
+	if err != nil {
+		irc.logger("chat").Warn("couldn't get chat response", "err", err)
+		return
+	}
+	answer = truncateRunes(fetch.CollapseWhitespace(answer), maxChatReplyRunes)
+	if answer == "" {
+		return
+	}
+	irc.chat.remember(target, question, chatMessage{Role: "assistant", Content: answer})
+	irc.sendReplyNotice(target, msgid, answer)
+}
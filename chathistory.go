@@ -0,0 +1,110 @@
+package wutbot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"pratyush/wutbot/internal/fetch"
+)
+
+const (
+	chathistoryCap       = "draft/chathistory"
+	chathistoryBatchType = "chathistory"
+
+	// how far back we look after a reconnect, and how many links we'll announce
+	maxCatchupMessages = 100
+	maxCatchupLinks    = 5
+)
+
+// historyTracker remembers the server-time of the last message we saw in
+// each channel, so that we can ask for what we missed while disconnected.
+type historyTracker struct {
+	sync.Mutex
+	lastSeen map[string]time.Time // keyed by casefolded channel
+}
+
+func newHistoryTracker() *historyTracker {
+	return &historyTracker{lastSeen: make(map[string]time.Time)}
+}
+
+func (h *historyTracker) Seen(channel string, t time.Time) {
+	key := strings.ToLower(channel)
+	h.Lock()
+	if t.After(h.lastSeen[key]) {
+		h.lastSeen[key] = t
+	}
+	h.Unlock()
+}
+
+func (h *historyTracker) LastSeen(channel string) (t time.Time, ok bool) {
+	h.Lock()
+	defer h.Unlock()
+	t, ok = h.lastSeen[strings.ToLower(channel)]
+	return
+}
+
+// messageTime returns the server-time of a message, or the current time.
+func messageTime(e ircmsg.Message) time.Time {
+	if present, value := e.GetTag("time"); present {
+		if t, err := time.Parse(IRCv3TimestampFormat, value); err == nil {
+			return t
+		}
+	}
+	return time.Now().UTC()
+}
+
+// requestCatchup asks for the history of a channel we just (re)joined,
+// since the last message we saw there.
+func (irc *Bot) requestCatchup(channel string) {
+	if _, ok := irc.AcknowledgedCaps()[chathistoryCap]; !ok {
+		return
+	}
+	since, ok := irc.history.LastSeen(channel)
+	if !ok {
+		return
+	}
+	limit := maxCatchupMessages
+	if serverLimit, err := strconv.Atoi(irc.ISupport()["CHATHISTORY"]); err == nil && serverLimit > 0 && serverLimit < limit {
+		limit = serverLimit
+	}
+	irc.Send("CHATHISTORY", "AFTER", channel, "timestamp="+since.Format(IRCv3TimestampFormat), strconv.Itoa(limit))
+}
+
+// handleHistoryBatch processes the links in a chathistory batch, marking
+// them as old. The batch's lines don't go through the normal callbacks.
+func (irc *Bot) handleHistoryBatch(batch *ircevent.Batch) bool {
+	if len(batch.Params) < 3 || batch.Params[1] != chathistoryBatchType {
+		return false
+	}
+	channel := batch.Params[2]
+	if !irc.isChannel(channel) || !irc.titlesEnabled(channel) || irc.isQuiet(channel) {
+		return true
+	}
+	announced := 0
+	for _, item := range batch.Items {
+		if item.Command != "PRIVMSG" || len(item.Params) < 2 {
+			continue
+		}
+		irc.history.Seen(channel, messageTime(item.Message))
+		_, account := item.GetTag("account")
+		_, msgid := item.GetTag("msgid")
+		if item.Nick() == irc.CurrentNick() || irc.isBot(item.Message) || irc.isIgnored(item.Message) || irc.optedOut(account) {
+			continue
+		}
+		for _, u := range fetch.ExtractURLs(item.Params[1]) {
+			if announced == maxCatchupLinks {
+				return true
+			}
+			announced++
+			link := archivedLink{Channel: channel, URL: u, Poster: item.Nick(), Account: account, Time: messageTime(item.Message), MsgID: msgid}
+			irc.announceLink(irc.connectionContext(), link, fmt.Sprintf(irc.translate(channel, "[old link from %s]"), item.Nick()))
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package wutbot
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/joho/godotenv"
+
+	"pratyush/wutbot/internal/storage"
+)
+
+// runSubcommand runs "wutbot <name> ...", for maintenance tasks that use the
+// bot's configuration but don't connect.
+func runSubcommand(name string, args []string) {
+	// unlike the bot itself, these work without a .env file
+	godotenv.Load(".env")
+	switch name {
+	case "links":
+		exportLinksCommand(args)
+	case "backup":
+		backupCommand(args)
+	case "restore":
+		restoreCommand(args)
+	case "secret":
+		secretCommand(args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %s\nusage: wutbot [links|backup|restore|secret]\n", name)
+		os.Exit(2)
+	}
+}
+
+func exportLinksCommand(args []string) {
+	flags := flag.NewFlagSet("links", flag.ExitOnError)
+	format := flags.String("format", "json", "json or csv")
+	from := flags.String("from", "", "only links posted from this date (YYYY-MM-DD or RFC 3339)")
+	to := flags.String("to", "", "only links posted up to this date")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: wutbot links [flags] <channel>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	fromTime, toTime, err := parseDateRange([]string{*from, *to})
+	if err != nil {
+		log.Fatalf("Invalid date: %v", err)
+	}
+	store, err := storage.OpenDir(storeSettings())
+	if err != nil {
+		log.Fatalf("Couldn't open state database: %v", err)
+	}
+	defer store.Close()
+	links, err := archivedLinks(store, flags.Arg(0), fromTime, toTime)
+	if err != nil {
+		log.Fatalf("Couldn't read the archive: %v", err)
+	}
+	if err := writeLinks(os.Stdout, *format, links); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func backupCommand(args []string) {
+	flags := flag.NewFlagSet("backup", flag.ExitOnError)
+	output := flags.String("o", "", "write the backup to this file instead of standard output")
+	flags.Parse(args)
+	dataDir, backend, location := storeSettings()
+	store, err := storage.OpenDir(dataDir, backend, location)
+	if err != nil {
+		log.Fatalf("Couldn't open state database: %v", err)
+	}
+	defer store.Close()
+	w := os.Stdout
+	if *output != "" {
+		if w, err = os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := writeBackup(w, store, dataDir); err != nil {
+		log.Fatalf("Couldn't back up: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func restoreCommand(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	clean := flags.Bool("clean", false, "delete the existing state first")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: wutbot restore [-clean] <file>\n(stop the bot first)")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	dataDir, backend, location := storeSettings()
+	store, err := storage.OpenDir(dataDir, backend, location)
+	if err != nil {
+		log.Fatalf("Couldn't open state database: %v", err)
+	}
+	defer store.Close()
+	if err := restoreBackup(f, store, dataDir, *clean); err != nil {
+		log.Fatalf("Couldn't restore: %v", err)
+	}
+}
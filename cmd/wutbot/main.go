@@ -0,0 +1,8 @@
+// Command wutbot is the IRC bot, configured from the environment (and .env).
+package main
+
+import "pratyush/wutbot"
+
+func main() {
+	wutbot.Main()
+}
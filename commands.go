@@ -0,0 +1,31 @@
+package wutbot
+
+import (
+	"pratyush/wutbot/internal/commands"
+)
+
+func (irc *Bot) reply(cmd commands.Command, text string) {
+	irc.sendReplyNotice(cmd.Target, cmd.MsgID, text)
+}
+
+// newCommandMux registers the channel commands.
+func (irc *Bot) newCommandMux() *commands.Mux {
+	mux := new(commands.Mux)
+	mux.HandleFunc(irc.handlePollCommand, "poll")
+	mux.HandleFunc(irc.handleVoteCommand, "vote")
+	mux.HandleFunc(irc.handleTriviaCommand, "trivia")
+	mux.HandleFunc(irc.handleTimeCommand, "time")
+	mux.HandleFunc(irc.handleSetTimezoneCommand, "settz")
+	mux.HandleFunc(irc.handleSummarizeCommand, "summarize")
+	mux.HandleFunc(irc.handleMoreCommand, "more")
+	mux.HandleFunc(irc.handleCertCheckCommand, "certcheck")
+	mux.HandleFunc(irc.handleMovieCommand, "movie")
+	mux.HandleFunc(irc.handleBabbleCommand, "babble")
+	mux.HandleFunc(irc.handleScheduleCommand, "schedule")
+	mux.HandleFunc(irc.handleReleasesCommand, "releases")
+	mux.HandleFunc(irc.handleStatsCommand, "stats")
+	mux.HandleFunc(irc.handleOptOutCommand, "optout")
+	mux.HandleFunc(irc.handleOptInCommand, "optin")
+	mux.HandleFunc(irc.handleModerationCommand, "kick", "ban", "unban", "quiet")
+	return mux
+}
@@ -0,0 +1,316 @@
+package wutbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"pratyush/wutbot/internal/cron"
+	"pratyush/wutbot/internal/fetch"
+)
+
+// FileConfig is the optional JSON configuration file (WUTBOT_CONFIG), used for
+// settings that don't fit in environment variables, e.g. per-channel ones.
+type FileConfig struct {
+	// keyed by channel name; the "*" entry applies to every channel
+	Channels map[string]ChannelConfig `json:"channels"`
+	// nick patterns (case-insensitive regexes) of other bots, which we ignore
+	// in addition to the ones that identify themselves
+	Bots []string `json:"bots"`
+	// GitHub repositories ("owner/repo", or "*" for any) to the channels that
+	// their webhook events are announced in
+	GitHub map[string][]string `json:"github"`
+	// incoming webhooks, keyed by route name (POST /hook/<name>)
+	Webhooks map[string]WebhookConfig `json:"webhooks"`
+	// announcements on a crontab schedule, besides those added with !schedule
+	Schedules []ScheduleConfig `json:"schedules"`
+	// channels (or Matrix rooms) whose messages are copied to each other
+	Relays []RelayConfig `json:"relays"`
+	// channels mirrored to Discord, keyed by channel name
+	Discord map[string]DiscordBridgeConfig `json:"discord"`
+	// Slack or Mattermost incoming webhooks that announcements are also
+	// posted to, keyed by name
+	Sinks map[string]SinkConfig `json:"sinks"`
+	// User-Agents and other headers to fetch links from some domains (and
+	// their subdomains) with, keyed by domain
+	Sites map[string]SiteConfig `json:"sites"`
+	// canned responses by kind ("mention", "abuse"; see responses.go), from
+	// the config and/or a file of the same shape, replacing the defaults
+	Responses     map[string][]ResponseConfig `json:"responses"`
+	ResponsesFile string                      `json:"responses-file"`
+}
+
+type ChannelConfig struct {
+	Triggers []TriggerConfig `json:"triggers"`
+	Trivia   *bool           `json:"trivia"` // opt in to !trivia
+	// answer mentions with the LLM backend, optionally with a custom system prompt
+	Chat       *bool   `json:"chat"`
+	ChatPrompt *string `json:"chat-prompt"`
+	// learn a markov model from channel traffic, for !babble
+	Markov *bool `json:"markov"`
+	// don't rejoin after being kicked or removed
+	NoRejoin *bool `json:"no-rejoin"`
+	// don't announce the titles of links
+	NoTitles *bool `json:"no-titles"`
+	// cut announced titles down to this many characters; !more shows the
+	// last link's whole title and description
+	MaxTitleLength *int `json:"max-title-length"`
+	// for image links, say which camera took them and when (from their EXIF),
+	// not just their size; off by default, as it can say more than posters meant
+	ImageDetails *bool `json:"image-details"`
+	// mark titles from sites whose HTTPS certificate expires within this many
+	// days (default 14), or is invalid; -1 not to
+	CertWarningDays *int `json:"cert-warning-days"`
+	// who's told about links that couldn't be fetched (see fetcherrors.go):
+	// nobody ("drop", the default), the channel ("report"), or the "poster"
+	FetchErrors *string `json:"fetch-errors"`
+	// log the channel to disk: "text", "jsonl" (with message tags) or "both"
+	Log *string `json:"log"`
+	// the channel key to join with (not taken from "*")
+	Key string `json:"key"`
+	// topics to cycle through while we have ops, one per interval (e.g. "12h",
+	// default a day); not taken from "*"
+	Topics        []string `json:"topics"`
+	TopicInterval string   `json:"topic-interval"`
+	// when not to announce titles, feeds, follows, releases, webhooks, GitHub
+	// events or scheduled messages; commands are still answered
+	QuietHours []QuietHoursConfig `json:"quiet-hours"`
+	// "privmsg" to announce things and answer commands with PRIVMSGs, for
+	// channels that don't like NOTICEs (default "notice")
+	Messages *string `json:"messages"`
+	// what to do with links another channel was just told about (see
+	// duplicates.go): "announce" (the default), "suppress" or "compress",
+	// within a window of e.g. "5m" (default 10m)
+	Duplicates      *string `json:"duplicates"`
+	DuplicateWindow *string `json:"duplicate-window"`
+	// what to answer commands in, e.g. "de" (see i18n.go; default English)
+	Language *string `json:"language"`
+	// the Accept-Language to fetch the channel's links with, by default its
+	// language if it has one (else WUTBOT_ACCEPT_LANGUAGE's)
+	AcceptLanguage *string `json:"accept-language"`
+}
+
+type WebhookConfig struct {
+	Token   string `json:"token"` // sent as "Authorization: Bearer <token>"
+	Channel string `json:"channel"`
+	// executed against the decoded JSON body, or the text of a plain text one;
+	// by default the text, or a JSON body's "text" or "message" field
+	Template string `json:"template"`
+	// messages per minute, default 10
+	RateLimit int `json:"rate-limit"`
+}
+
+type ScheduleConfig struct {
+	Channel  string `json:"channel"`
+	Cron     string `json:"cron"` // e.g. "0 9 * * mon-fri"
+	Text     string `json:"text"`
+	Timezone string `json:"timezone"` // default UTC
+}
+
+// QuietHoursConfig is quiet during the minutes its schedule matches.
+type QuietHoursConfig struct {
+	Cron     string `json:"cron"`     // e.g. "* 22-23,0-7 * * *"
+	Timezone string `json:"timezone"` // default UTC
+
+	// parsed when the config is loaded, by compileQuietHours
+	schedule *cron.Schedule
+	location *time.Location
+}
+
+type RelayConfig struct {
+	Channels []string `json:"channels"`
+	// a template of .Nick, .Channel (where it's from) and .Text, by
+	// default "<{{.Nick}}> {{.Text}}"
+	Format string `json:"format"`
+	// relay joins, parts and quits too
+	Joins bool `json:"joins"`
+	// don't break up relayed nicks, so that they can highlight people
+	Highlight bool `json:"highlight"`
+}
+
+type DiscordBridgeConfig struct {
+	// a Discord webhook URL, which the channel's messages are posted to as
+	// their senders
+	Webhook string `json:"webhook"`
+	// the Discord channel whose messages are relayed back to IRC (with
+	// WUTBOT_DISCORD_TOKEN)
+	ChannelID string `json:"channel-id"`
+}
+
+type SinkConfig struct {
+	URL      string `json:"url"`
+	Username string `json:"username"` // to post as, if the webhook allows it
+	// what to post: "feed", "release", "follow", "webhook", "github" and
+	// "owner" (notifications), or e.g. "webhook:<route>" for just one
+	Alerts []string `json:"alerts"`
+	// only announcements to these channels, if any are given
+	Channels []string `json:"channels"`
+}
+
+type SiteConfig struct {
+	UserAgent string            `json:"user-agent"` // instead of ours
+	Headers   map[string]string `json:"headers"`    // e.g. "Accept-Language"
+}
+
+type ResponseConfig struct {
+	Text   string `json:"text"`
+	Weight int    `json:"weight"` // relative chance of being picked, default 1
+}
+
+type TriggerConfig struct {
+	Pattern  string `json:"pattern"`
+	Response string `json:"response"`
+}
+
+func loadConfig(path string) (*FileConfig, error) {
+	config := new(FileConfig)
+	if path == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %w", path, err)
+	}
+	channels := make(map[string]ChannelConfig, len(config.Channels))
+	for name, chanConfig := range config.Channels {
+		channels[strings.ToLower(name)] = chanConfig
+	}
+	config.Channels = channels
+	for name, chanConfig := range config.Channels {
+		if err := validateChannelConfig(chanConfig); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	repos := make(map[string][]string, len(config.GitHub))
+	for name, targets := range config.GitHub {
+		repos[strings.ToLower(name)] = targets
+	}
+	config.GitHub = repos
+	bridges := make(map[string]DiscordBridgeConfig, len(config.Discord))
+	for name, bridge := range config.Discord {
+		bridges[strings.ToLower(name)] = bridge
+	}
+	config.Discord = bridges
+	if err := validateSinks(config.Sinks); err != nil {
+		return nil, err
+	}
+	for i, sc := range config.Schedules {
+		if _, err := cron.Parse(sc.Cron); err != nil {
+			return nil, fmt.Errorf("invalid schedule %d: %w", i+1, err)
+		}
+		if _, err := time.LoadLocation(sc.Timezone); err != nil {
+			return nil, fmt.Errorf("invalid schedule %d: %w", i+1, err)
+		}
+	}
+	return config, nil
+}
+
+// getConfig returns the current configuration, which the owner can change
+// at runtime; callers mustn't modify it.
+func (irc *Bot) getConfig() *FileConfig {
+	irc.configMutex.RLock()
+	defer irc.configMutex.RUnlock()
+	return irc.config
+}
+
+// setChannelOption changes one setting of a channel (or "*"), given as it
+// would appear in the JSON config file.
+func (irc *Bot) setChannelOption(channel, option, value string) error {
+	if option == "triggers" {
+		return fmt.Errorf("triggers can only be changed in the config file")
+	}
+	irc.configMutex.Lock()
+	defer irc.configMutex.Unlock()
+	key := strings.ToLower(channel)
+	data, err := json.Marshal(irc.config.Channels[key])
+	if err != nil {
+		return err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if _, ok := fields[option]; !ok {
+		return fmt.Errorf("no such option %s", option)
+	}
+	if !json.Valid([]byte(value)) {
+		// bare strings don't need quoting
+		quoted, _ := json.Marshal(value)
+		value = string(quoted)
+	}
+	fields[option] = json.RawMessage(value)
+	if data, err = json.Marshal(fields); err != nil {
+		return err
+	}
+	var chanConfig ChannelConfig
+	if err := json.Unmarshal(data, &chanConfig); err != nil {
+		return fmt.Errorf("invalid value for %s: %w", option, err)
+	}
+	if err := validateChannelConfig(chanConfig); err != nil {
+		return err
+	}
+	// copy on write, since readers don't hold the lock while using it
+	config := *irc.config
+	config.Channels = make(map[string]ChannelConfig, len(irc.config.Channels)+1)
+	for name, c := range irc.config.Channels {
+		config.Channels[name] = c
+	}
+	config.Channels[key] = chanConfig
+	irc.config = &config
+	return nil
+}
+
+// validateChannelConfig checks a channel's settings, and compiles its quiet
+// hours in place.
+func validateChannelConfig(c ChannelConfig) error {
+	switch messages := optional(c.Messages); messages {
+	case "", "notice", "privmsg":
+	default:
+		return fmt.Errorf("messages must be notice or privmsg, not %s", messages)
+	}
+	if err := validateDuplicates(c); err != nil {
+		return err
+	}
+	if err := validateLanguage(optional(c.Language)); err != nil {
+		return err
+	}
+	if err := validateFetchErrors(optional(c.FetchErrors)); err != nil {
+		return err
+	}
+	return compileQuietHours(c.QuietHours)
+}
+
+func fetchSites(config *FileConfig) map[string]fetch.Site {
+	sites := make(map[string]fetch.Site, len(config.Sites))
+	for domain, site := range config.Sites {
+		sites[strings.TrimSuffix(strings.ToLower(domain), ".")] = fetch.Site{UserAgent: site.UserAgent, Headers: site.Headers}
+	}
+	return sites
+}
+
+// channelOption returns the channel's own value for a setting if it's set
+// (even to false, 0 or ""), falling back to the wildcard entry's value.
+func channelOption[T any](c *FileConfig, channel string, get func(ChannelConfig) *T) (result T) {
+	if chanConfig, ok := c.Channels[strings.ToLower(channel)]; ok {
+		if value := get(chanConfig); value != nil {
+			return *value
+		}
+	}
+	if wildcard, ok := c.Channels["*"]; ok {
+		result = optional(get(wildcard))
+	}
+	return
+}
+
+// optional returns what a setting that may not be set is set to.
+func optional[T any](value *T) (result T) {
+	if value != nil {
+		result = *value
+	}
+	return
+}
@@ -0,0 +1,54 @@
+package wutbot
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestChannelOption(t *testing.T) {
+	var config FileConfig
+	err := json.Unmarshal([]byte(`{"channels": {
+		"*": {"no-titles": true, "max-title-length": 100, "language": "de"},
+		"#quiet": {},
+		"#loud": {"no-titles": false, "max-title-length": 0, "language": ""}
+	}}`), &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noTitles := func(c ChannelConfig) *bool { return c.NoTitles }
+	maxLength := func(c ChannelConfig) *int { return c.MaxTitleLength }
+	language := func(c ChannelConfig) *string { return c.Language }
+	for _, channel := range []string{"#quiet", "#elsewhere"} {
+		if !channelOption(&config, channel, noTitles) || channelOption(&config, channel, maxLength) != 100 || channelOption(&config, channel, language) != "de" {
+			t.Errorf("%s didn't get the wildcard's settings", channel)
+		}
+	}
+	if channelOption(&config, "#LOUD", noTitles) || channelOption(&config, "#loud", maxLength) != 0 || channelOption(&config, "#loud", language) != "" {
+		t.Error("#loud couldn't override the wildcard with zero values")
+	}
+}
+
+func TestSetChannelOption(t *testing.T) {
+	irc := &Bot{config: &FileConfig{}}
+	noTitles := func(c ChannelConfig) *bool { return c.NoTitles }
+	steps := []struct {
+		channel, value string
+		want           bool
+	}{
+		{"*", "true", true},
+		{"#chan", "false", false},
+		// unset, so the wildcard's applies again
+		{"#chan", "null", true},
+	}
+	for _, step := range steps {
+		if err := irc.setChannelOption(step.channel, "no-titles", step.value); err != nil {
+			t.Fatalf("%s no-titles %s: %v", step.channel, step.value, err)
+		}
+		if got := channelOption(irc.getConfig(), "#chan", noTitles); got != step.want {
+			t.Errorf("after %s no-titles %s: %v, want %v", step.channel, step.value, got, step.want)
+		}
+	}
+	if err := irc.setChannelOption("#chan", "messages", "shout"); err == nil {
+		t.Error("accepted an invalid value")
+	}
+}
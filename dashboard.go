@@ -0,0 +1,225 @@
+package wutbot
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var errNotAChannel = errors.New("not a channel")
+
+const (
+	dashboardLinks   = 10
+	dashboardLogTail = 50
+)
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>wutbot</title>
+<style>
+body { font-family: sans-serif; margin: 2em; max-width: 70em; }
+table { border-collapse: collapse; }
+td, th { border: 1px solid #ccc; padding: 0.2em 0.5em; text-align: left; vertical-align: top; }
+pre { background: #f4f4f4; padding: 0.5em; overflow: auto; max-height: 30em; }
+form { display: inline; }
+.bad { color: #b00; }
+</style>
+</head>
+<body>
+<h1>wutbot</h1>
+<p>
+{{if .Health.Registered}}connected to {{.Health.Server}} as {{.Health.Nick}}{{else if .Health.Connected}}registering{{else}}reconnecting{{end}},
+{{if not .Health.Healthy}}<span class="bad">unhealthy</span>,{{end}}
+up {{.Uptime}}
+</p>
+
+<h2>Channels</h2>
+<form method="post" action="/admin/join">
+<input name="channel" placeholder="#channel"> <button>join</button>
+</form>
+{{range .Channels}}{{$channel := .Name}}
+<h3>{{.Name}}</h3>
+<form method="post" action="/admin/part"><input type="hidden" name="channel" value="{{.Name}}"> <button>part</button></form>
+<table>
+{{range .Options}}
+<tr><th>{{.Name}}</th><td>
+<form method="post" action="/admin/config">
+<input type="hidden" name="channel" value="{{$channel}}">
+<input type="hidden" name="option" value="{{.Name}}">
+{{if .Bool}}<code>{{.Value}}</code> <input type="hidden" name="value" value="{{if eq .Value "true"}}false{{else}}true{{end}}"> <button>toggle</button>
+{{else}}<input name="value" value="{{.Value}}" size="40"> <button>set</button>{{end}}
+</form>
+</td></tr>
+{{end}}
+</table>
+{{with .Links}}
+<p>Recent links:</p>
+<ul>
+{{range .}}<li>{{.Time.UTC.Format "2006-01-02 15:04"}} {{.Poster}}: <a href="{{.URL}}" rel="noreferrer">{{if .Title}}{{.Title}}{{else}}{{.URL}}{{end}}</a> ({{.Status}})</li>
+{{end}}
+</ul>
+{{end}}
+{{end}}
+
+<h2>Log</h2>
+<pre id="log">{{range .Log}}{{.}}
+{{end}}</pre>
+<script>
+setInterval(function () {
+	fetch("/admin/log").then(function (r) { return r.text(); }).then(function (text) {
+		document.getElementById("log").textContent = text;
+	});
+}, 5000);
+</script>
+</body>
+</html>
+`))
+
+type dashboardOption struct {
+	Name  string
+	Value string
+	Bool  bool
+}
+
+type dashboardChannel struct {
+	Name    string
+	Options []dashboardOption
+	Links   []archivedLink
+}
+
+type dashboardPage struct {
+	Health   healthReport
+	Uptime   time.Duration
+	Channels []dashboardChannel
+	Log      []string
+}
+
+// channelOptions lists a channel's settings as setChannelOption sees them.
+func (irc *Bot) channelOptions(channel string) (options []dashboardOption) {
+	data, err := json.Marshal(irc.getConfig().Channels[strings.ToLower(channel)])
+	if err != nil {
+		return nil
+	}
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(data, &fields) != nil {
+		return nil
+	}
+	for _, name := range sortedKeys(fields) {
+		if name == "triggers" {
+			continue
+		}
+		value := string(fields[name])
+		var s string
+		if json.Unmarshal(fields[name], &s) == nil {
+			value = s
+		}
+		options = append(options, dashboardOption{
+			Name: name, Value: value, Bool: value == "true" || value == "false",
+		})
+	}
+	return
+}
+
+// handleDashboard serves the admin dashboard (with WUTBOT_DASHBOARD_PASSWORD),
+// which does what the owner's commands and the DCC console do.
+func (irc *Bot) handleDashboard(user, password string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/admin/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/admin/" {
+			http.NotFound(w, r)
+			return
+		}
+		page := &dashboardPage{
+			Health: irc.healthReport(),
+			Uptime: time.Since(irc.started).Round(time.Second),
+			Log:    irc.logTail.Tail(dashboardLogTail),
+		}
+		for _, channel := range irc.joined.List() {
+			links, _ := archivedLinks(irc.store, channel, time.Time{}, time.Time{})
+			if len(links) > dashboardLinks {
+				links = links[len(links)-dashboardLinks:]
+			}
+			for i, j := 0, len(links)-1; i < j; i, j = i+1, j-1 {
+				links[i], links[j] = links[j], links[i]
+			}
+			page.Channels = append(page.Channels, dashboardChannel{Name: channel, Options: irc.channelOptions(channel), Links: links})
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := dashboardTemplate.Execute(w, page); err != nil {
+			irc.logger("dashboard").Error("couldn't render dashboard", "err", err)
+		}
+	})
+	mux.HandleFunc("/admin/log", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, line := range irc.logTail.Tail(dashboardLogTail) {
+			w.Write([]byte(line + "\n"))
+		}
+	})
+	action := func(f func(r *http.Request) error) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "POST only", http.StatusMethodNotAllowed)
+				return
+			}
+			user, _, _ := r.BasicAuth()
+			command := strings.TrimPrefix(r.URL.Path, "/admin/")
+			for _, field := range []string{"channel", "option", "value"} {
+				if value := r.FormValue(field); value != "" {
+					command += " " + value
+				}
+			}
+			irc.audit(auditEntry{Nick: user, Channel: "dashboard", Command: command})
+			if err := f(r); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Redirect(w, r, "/admin/", http.StatusSeeOther)
+		}
+	}
+	mux.HandleFunc("/admin/join", action(func(r *http.Request) error {
+		channel := strings.TrimSpace(r.FormValue("channel"))
+		if !irc.isChannel(channel) {
+			return errNotAChannel
+		}
+		irc.joinChannel(channel)
+		// give the JOIN a moment, so the page shows the channel
+		time.Sleep(time.Second)
+		return nil
+	}))
+	mux.HandleFunc("/admin/part", action(func(r *http.Request) error {
+		channel := r.FormValue("channel")
+		if !irc.isChannel(channel) {
+			return errNotAChannel
+		}
+		irc.partChannel(channel)
+		time.Sleep(time.Second)
+		return nil
+	}))
+	mux.HandleFunc("/admin/config", action(func(r *http.Request) error {
+		return irc.setChannelOption(r.FormValue("channel"), r.FormValue("option"), r.FormValue("value"))
+	}))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 || subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="wutbot"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// browsers send basic auth along with cross-site form posts
+		if origin := r.Header.Get("Origin"); r.Method == http.MethodPost && origin != "" {
+			if o, err := url.Parse(origin); err != nil || o.Host != r.Host {
+				http.Error(w, "cross-origin request", http.StatusForbidden)
+				return
+			}
+		}
+		w.Header().Set("X-Frame-Options", "DENY")
+		mux.ServeHTTP(w, r)
+	})
+}
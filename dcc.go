@@ -0,0 +1,145 @@
+package wutbot
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dccDialTimeout = 30 * time.Second
+	// close the console after this long without input
+	dccIdleTimeout = 30 * time.Minute
+	dccMaxLine     = 4096
+	defaultLogTail = 20
+)
+
+// parseDCCChat parses a "DCC CHAT chat <ip> <port>" CTCP request, where
+// the IP is either a 32-bit integer (IPv4) or an IPv6 literal.
+func parseDCCChat(message string) (addr string, ok bool) {
+	if !strings.HasPrefix(message, "\x01") {
+		return "", false
+	}
+	f := strings.Fields(strings.Trim(message, "\x01"))
+	if len(f) < 5 || !strings.EqualFold(f[0], "DCC") || !strings.EqualFold(f[1], "CHAT") {
+		return "", false
+	}
+	ip := net.ParseIP(f[3])
+	if ip == nil {
+		n, err := strconv.ParseUint(f[3], 10, 32)
+		if err != nil {
+			return "", false
+		}
+		ip = net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+	}
+	port, err := strconv.Atoi(f[4])
+	if err != nil || port <= 0 || port > 65535 {
+		// port 0 is passive DCC, which would need us to be reachable
+		return "", false
+	}
+	return net.JoinHostPort(ip.String(), f[4]), true
+}
+
+// handleDCCChat connects back to the owner for an admin console.
+func (irc *Bot) handleDCCChat(nick, message string) bool {
+	addr, ok := parseDCCChat(message)
+	if !ok {
+		return false
+	}
+	go func() {
+		defer irc.recoverPanic("DCC CHAT")
+		conn, err := net.DialTimeout("tcp", addr, dccDialTimeout)
+		if err != nil {
+			irc.logger("dcc").Warn("couldn't open DCC CHAT", "nick", nick, "addr", addr, "err", err)
+			return
+		}
+		defer conn.Close()
+		irc.logger("dcc").Info("console opened", "nick", nick)
+		irc.runConsole(conn, nick)
+		irc.logger("dcc").Info("console closed", "nick", nick)
+	}()
+	return true
+}
+
+func (irc *Bot) runConsole(conn net.Conn, nick string) {
+	w := bufio.NewWriter(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(w, format+"\n", args...)
+	}
+	reply("wutbot admin console; type help for commands")
+	w.Flush()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, dccMaxLine), dccMaxLine)
+	for {
+		conn.SetReadDeadline(time.Now().Add(dccIdleTimeout))
+		if !scanner.Scan() {
+			return
+		}
+		f := strings.Fields(scanner.Text())
+		if len(f) == 0 {
+			continue
+		}
+		switch strings.ToLower(f[0]) {
+		case "config", "raw":
+			irc.audit(auditEntry{Nick: nick, Account: irc.Owner, Channel: "DCC", Command: scanner.Text()})
+		}
+		switch strings.ToLower(f[0]) {
+		case "help":
+			reply("stats | config get <channel> | config set <channel> <option> <value> | raw <line> | log [<lines>] | quit")
+		case "stats":
+			reply("nick %s on %s, up %v", irc.CurrentNick(), irc.servers.Current(), time.Since(irc.started).Round(time.Second))
+			reply("channels: %s", strings.Join(irc.joined.List(), " "))
+			reply("delivery: %s", irc.delivery.String())
+		case "config":
+			irc.consoleConfig(f[1:], reply)
+		case "raw":
+			line := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(scanner.Text()), f[0]))
+			if line == "" {
+				reply("usage: raw <line>")
+			} else if err := irc.SendRaw(line); err != nil {
+				reply("couldn't send: %v", err)
+			}
+		case "log":
+			n := defaultLogTail
+			if len(f) > 1 {
+				n, _ = strconv.Atoi(f[1])
+			}
+			for _, line := range irc.logTail.Tail(n) {
+				reply("%s", line)
+			}
+		case "quit", "exit":
+			reply("bye")
+			w.Flush()
+			return
+		default:
+			reply("unknown command %s; type help for commands", f[0])
+		}
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
+
+func (irc *Bot) consoleConfig(args []string, reply func(string, ...interface{})) {
+	switch {
+	case len(args) == 2 && args[0] == "get":
+		data, err := json.Marshal(irc.getConfig().Channels[strings.ToLower(args[1])])
+		if err != nil {
+			reply("couldn't show config: %v", err)
+			return
+		}
+		reply("%s", data)
+	case len(args) >= 4 && args[0] == "set":
+		if err := irc.setChannelOption(args[1], args[2], strings.Join(args[3:], " ")); err != nil {
+			reply("couldn't set %s: %v", args[2], err)
+			return
+		}
+		reply("set %s for %s", args[2], args[1])
+	default:
+		reply("usage: config get <channel> | config set <channel> <option> <value>")
+	}
+}
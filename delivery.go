@@ -0,0 +1,73 @@
+package wutbot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+// deliveryStats tracks the echoes of our labeled messages: a message is
+// confirmed once the server echoes it back, and the round trip is its latency.
+type deliveryStats struct {
+	sync.Mutex
+	confirmed   uint64
+	unconfirmed uint64
+	lastLatency time.Duration
+	avgLatency  time.Duration // exponentially weighted
+}
+
+func (d *deliveryStats) record(latency time.Duration, ok bool) {
+	d.Lock()
+	defer d.Unlock()
+	if !ok {
+		d.unconfirmed++
+		return
+	}
+	d.confirmed++
+	d.lastLatency = latency
+	if d.avgLatency == 0 {
+		d.avgLatency = latency
+	} else {
+		d.avgLatency = (d.avgLatency*7 + latency) / 8
+	}
+}
+
+func (d *deliveryStats) String() string {
+	d.Lock()
+	defer d.Unlock()
+	return fmt.Sprintf("%d confirmed, %d unconfirmed, last latency %v, average %v",
+		d.confirmed, d.unconfirmed, d.lastLatency.Round(time.Millisecond), d.avgLatency.Round(time.Millisecond))
+}
+
+func (irc *Bot) echoNegotiated() bool {
+	acked := irc.AcknowledgedCaps()
+	_, echo := acked["echo-message"]
+	_, label := acked["labeled-response"]
+	return echo && label
+}
+
+// sendTracked sends a message, labeling it if possible so that the
+// server's echo confirms delivery.
+func (irc *Bot) sendTracked(msg ircmsg.Message) error {
+	if !irc.echoNegotiated() || (msg.Command != "PRIVMSG" && msg.Command != "NOTICE" && msg.Command != "BATCH") {
+		return irc.Connection.SendIRCMessage(msg)
+	}
+	// only the opening BATCH line of a multiline message can be labeled: the
+	// server echoes the whole batch as the answer to it
+	if inBatch, _ := msg.GetTag("batch"); inBatch || len(msg.Params) == 0 || (msg.Command == "BATCH" && !strings.HasPrefix(msg.Params[0], "+")) {
+		return irc.Connection.SendIRCMessage(msg)
+	}
+	sent := time.Now()
+	target := msg.Params[0]
+	return irc.SendWithLabel(func(echo *ircevent.Batch) {
+		// nil means the server never answered
+		irc.delivery.record(time.Since(sent), echo != nil)
+		if echo == nil {
+			irc.logger("delivery").Debug("delivery was not confirmed", "command", msg.Command, "target", target)
+		}
+	}, msg.AllTags(), msg.Command, msg.Params...)
+}
@@ -0,0 +1,179 @@
+package wutbot
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"pratyush/wutbot/internal/fetch"
+	"pratyush/wutbot/internal/integrations"
+)
+
+const (
+	// Discord's messages are polled for this often
+	discordPollInterval = 3 * time.Second
+	// Discord's limit for webhook usernames, in characters
+	maxDiscordUsername = 80
+	// mirrored messages waiting to be posted, beyond which they're dropped
+	discordQueueSize   = 100
+	maxDiscordAttempts = 3
+)
+
+// discordBridge remembers the newest message we've seen in each Discord
+// channel that's relayed to IRC, and queues what's mirrored the other way.
+type discordBridge struct {
+	api *integrations.Discord
+	sync.Mutex
+	last  map[string]string // Discord channel ID -> message ID
+	posts chan discordPost
+}
+
+type discordPost struct {
+	channel string // the IRC channel it's from
+	webhook string
+	body    map[string]interface{}
+}
+
+func newDiscordBridge(api *integrations.Discord) *discordBridge {
+	return &discordBridge{api: api, last: make(map[string]string), posts: make(chan discordPost, discordQueueSize)}
+}
+
+// discordBridges returns the config's bridges, keyed by IRC channel.
+func (irc *Bot) discordBridges() map[string]DiscordBridgeConfig {
+	return irc.getConfig().Discord
+}
+
+// mirrorToDiscord posts a channel message to its Discord webhook, as the
+// sender.
+func (irc *Bot) mirrorToDiscord(m messageEvent) {
+	bridge, ok := irc.discordBridges()[strings.ToLower(m.channel)]
+	if !ok || bridge.Webhook == "" {
+		return
+	}
+	const suffix = " (IRC)"
+	nick := m.nick
+	if limit := maxDiscordUsername - len(suffix); utf8.RuneCountInString(nick) > limit {
+		nick = string([]rune(nick)[:limit])
+	}
+	post := discordPost{channel: m.channel, webhook: bridge.Webhook, body: map[string]interface{}{
+		"content":  m.text,
+		"username": nick + suffix,
+		// nobody on IRC gets to ping @everyone
+		"allowed_mentions": map[string]interface{}{"parse": []string{}},
+	}}
+	select {
+	case irc.discord.posts <- post:
+	default:
+		irc.logger("discord").Warn("too many messages to post to Discord, dropping one", "channel", m.channel)
+	}
+}
+
+// runDiscordSender posts the mirrored messages one at a time, waiting as
+// long as Discord says to when it rate limits us.
+func (irc *Bot) runDiscordSender() {
+	defer irc.recoverPanic("discord webhook")
+	ctx := irc.stopping.ctx
+	for {
+		var post discordPost
+		select {
+		case post = <-irc.discord.posts:
+		case <-ctx.Done():
+			return
+		}
+		for attempt := 1; ; attempt++ {
+			wait, err := irc.discord.api.PostWebhook(ctx, post.webhook, post.body)
+			retry := err != nil && wait != 0 && attempt < maxDiscordAttempts
+			if err != nil && !retry {
+				irc.logger("discord").Warn("couldn't post to Discord", "channel", post.channel, "err", err)
+			}
+			if wait != 0 {
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					return
+				}
+			}
+			if !retry {
+				break
+			}
+		}
+	}
+}
+
+// pollDiscord relays new messages from the bridged Discord channels to
+// IRC, running the links and attachments in them through the title
+// pipeline.
+func (irc *Bot) pollDiscord() {
+	if irc.discord.api.Token == "" {
+		return
+	}
+	ticker := time.NewTicker(discordPollInterval)
+	defer ticker.Stop()
+	for irc.tick(ticker) {
+		if !irc.Connected() {
+			continue
+		}
+		for channel, bridge := range irc.discordBridges() {
+			if bridge.ChannelID == "" {
+				continue
+			}
+			irc.safely("discord poll", func() {
+				if err := irc.relayFromDiscord(irc.connectionContext(), channel, bridge.ChannelID); err != nil {
+					irc.logger("discord").Warn("couldn't read Discord messages", "channel", channel, "err", err)
+				}
+			})
+		}
+	}
+}
+
+func (irc *Bot) relayFromDiscord(ctx context.Context, channel, channelID string) error {
+	irc.discord.Lock()
+	last, started := irc.discord.last[channelID]
+	irc.discord.Unlock()
+	var messages []integrations.DiscordMessage
+	var err error
+	if !started {
+		// what's already there isn't news
+		messages, err = irc.discord.api.Messages(ctx, channelID, "", 1)
+	} else {
+		messages, err = irc.discord.api.Messages(ctx, channelID, last, 50)
+	}
+	if err != nil {
+		return err
+	}
+	if len(messages) != 0 {
+		last = messages[len(messages)-1].ID
+	}
+	irc.discord.Lock()
+	irc.discord.last[channelID] = last
+	irc.discord.Unlock()
+	if !started {
+		return nil
+	}
+	for _, msg := range messages {
+		if msg.WebhookID != "" || msg.Author.Bot {
+			continue
+		}
+		text := msg.Content
+		for _, mention := range msg.Mentions {
+			text = strings.NewReplacer("<@"+mention.ID+">", "@"+mention.Username, "<@!"+mention.ID+">", "@"+mention.Username).Replace(text)
+		}
+		for _, attachment := range msg.Attachments {
+			text += " " + attachment.URL
+		}
+		text = fetch.Sanitize(text)
+		if text == "" {
+			continue
+		}
+		nick := msg.Author.GlobalName
+		if nick == "" {
+			nick = msg.Author.Username
+		}
+		irc.Privmsg(channel, fmt.Sprintf("<%s> %s", fetch.Sanitize(nick), text))
+		irc.publishLinks(messageEvent{ctx: ctx, channel: channel, nick: nick, text: text, time: msg.Timestamp, source: sourceDiscord})
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package wutbot
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"pratyush/wutbot/internal/integrations"
+)
+
+func TestMirrorToDiscord(t *testing.T) {
+	posts := make(chan map[string]interface{}, 10)
+	limited := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limited {
+			limited = true
+			w.Header().Set("Retry-After", "0.05")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		posts <- body
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	irc := &Bot{
+		config:     &FileConfig{Discord: map[string]DiscordBridgeConfig{"#chan": {Webhook: server.URL}}},
+		discord:    newDiscordBridge(&integrations.Discord{Client: server.Client()}),
+		stopping:   newShutdownState(),
+		baseLogger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	defer irc.stopping.cancel()
+	go irc.runDiscordSender()
+
+	// multibyte characters either side of where the limit falls
+	nick := strings.Repeat("é", 100)
+	irc.mirrorToDiscord(messageEvent{channel: "#Chan", nick: nick, text: "hello"})
+	select {
+	case body := <-posts:
+		username, _ := body["username"].(string)
+		if !utf8.ValidString(username) || utf8.RuneCountInString(username) != maxDiscordUsername || !strings.HasSuffix(username, " (IRC)") {
+			t.Errorf("username %q", username)
+		}
+		if body["content"] != "hello" {
+			t.Errorf("content %v", body["content"])
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wasn't retried after the 429")
+	}
+}
@@ -0,0 +1,134 @@
+package wutbot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pratyush/wutbot/internal/fetch"
+)
+
+// When a link is posted in several channels at once (say, breaking news),
+// it's fetched once, and each channel's "duplicates" policy decides what
+// it's told if another channel already had it announced within its
+// "duplicate-window": "announce" it as usual, "suppress" it, or "compress"
+// it to a short line saying where else it was.
+
+const (
+	defaultDuplicateWindow = 10 * time.Minute
+	maxDuplicateWindow     = time.Hour
+	// compressed announcements cut titles down to this many characters
+	compressedTitleRunes = 80
+)
+
+type sharedFetches struct {
+	sync.Mutex
+	fetches map[string]*sharedFetch // by URL (without its fragment) and languages
+}
+
+type sharedFetch struct {
+	started time.Time
+	done    chan struct{} // closed once page and err are set
+	page    *fetch.Page
+	err     error
+	// guarded by sharedFetches' mutex
+	announced map[string]announcement // by casefolded channel
+}
+
+type announcement struct {
+	channel string
+	time    time.Time
+}
+
+func validateDuplicates(c ChannelConfig) error {
+	switch duplicates := optional(c.Duplicates); duplicates {
+	case "", "announce", "suppress", "compress":
+	default:
+		return fmt.Errorf("duplicates must be announce, suppress or compress, not %s", duplicates)
+	}
+	if c.DuplicateWindow != nil && *c.DuplicateWindow != "" {
+		window, err := time.ParseDuration(*c.DuplicateWindow)
+		if err != nil {
+			return fmt.Errorf("invalid duplicate-window: %w", err)
+		}
+		if window <= 0 || window > maxDuplicateWindow {
+			return fmt.Errorf("duplicate-window must be positive and at most %v", maxDuplicateWindow)
+		}
+	}
+	return nil
+}
+
+func (irc *Bot) duplicateWindow(channel string) time.Duration {
+	window, err := time.ParseDuration(channelOption(irc.getConfig(), channel, func(c ChannelConfig) *string { return c.DuplicateWindow }))
+	if err != nil || window <= 0 {
+		return defaultDuplicateWindow
+	}
+	return window
+}
+
+// fetchShared fetches a link, or waits for the fetch another channel
+// (asking for the same languages) started within the window, unless that
+// one failed.
+func (irc *Bot) fetchShared(ctx context.Context, link archivedLink, window time.Duration) *sharedFetch {
+	key, _, _ := strings.Cut(link.URL, "#")
+	key += " " + irc.fetcher.AcceptLanguage(ctx)
+	s := irc.sharedFetches
+	s.Lock()
+	for k, f := range s.fetches {
+		if time.Since(f.started) > maxDuplicateWindow {
+			delete(s.fetches, k)
+		}
+	}
+	f, ok := s.fetches[key]
+	if ok && time.Since(f.started) > window {
+		ok = false
+	}
+	if ok {
+		select {
+		case <-f.done:
+			ok = f.err == nil
+		default:
+		}
+	}
+	if !ok {
+		f = &sharedFetch{started: time.Now(), done: make(chan struct{}), announced: make(map[string]announcement)}
+		s.fetches[key] = f
+		s.Unlock()
+		func() {
+			// even if the fetch panics, so that nobody waits forever
+			defer close(f.done)
+			f.page, f.err = irc.fetchLink(ctx, link)
+		}()
+		return f
+	}
+	s.Unlock()
+	select {
+	case <-f.done:
+		return f
+	case <-ctx.Done():
+		return &sharedFetch{err: ctx.Err()}
+	}
+}
+
+// announcedElsewhere returns the other channels the fetch was announced in
+// within the window, and records that it's being announced in channel.
+func (irc *Bot) announcedElsewhere(f *sharedFetch, channel string, window time.Duration) (channels []string) {
+	s := irc.sharedFetches
+	s.Lock()
+	defer s.Unlock()
+	if f.announced == nil {
+		return nil
+	}
+	key := strings.ToLower(channel)
+	for c, a := range f.announced {
+		if c != key && time.Since(a.time) <= window {
+			channels = append(channels, a.channel)
+		}
+	}
+	sort.Strings(channels)
+	f.announced[key] = announcement{channel: channel, time: time.Now()}
+	return
+}
@@ -0,0 +1,203 @@
+package wutbot_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"pratyush/wutbot"
+	"pratyush/wutbot/internal/httpfixture"
+	"pratyush/wutbot/internal/irctest"
+)
+
+const (
+	channel = "#e2e"
+	timeout = 10 * time.Second
+	// other sites' responses, replayed so that their titles are checked
+	// without the network; to refresh one, delete its file and run the bot
+	// with WUTBOT_HTTP_FIXTURES=testdata/fixtures WUTBOT_HTTP_FIXTURE_MODE=record
+	fixtures = "testdata/fixtures"
+)
+
+// recordedTitles are the titles we expect from the fixtures.
+var recordedTitles = []struct{ url, notice string }{
+	{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", "Title: Rick Astley - Never Gonna Give You Up (Official Music Video) (www.youtube.com)"},
+	// redirected to the one above
+	{"https://youtu.be/dQw4w9WgXcQ", "Title: Rick Astley - Never Gonna Give You Up (Official Music Video) (www.youtube.com)"},
+	{"https://www.reddit.com/r/golang/comments/1ai3bdk/go_122_is_released/", "Title: From the golang community on Reddit: Go 1.22 is released! (www.reddit.com)"},
+	{"https://github.com/ergochat/irc-go", "Title: GitHub - ergochat/irc-go: Libraries to help with IRC development in Go. (github.com)"},
+}
+
+// harness is the bot, connected to an in-process IRC server, with a page
+// server for it to fetch from.
+type harness struct {
+	server *irctest.Server
+	pages  string // base URL
+	bot    *wutbot.Bot
+	stop   context.CancelFunc
+	done   chan error // Run's result
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+	server, err := irctest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	pages := irctest.ServePages(map[string]string{
+		"/article":  `<html><head><title>A test article</title></head><body><p>Some text.</p></body></html>`,
+		"/untitled": `<html><body><p>No title here.</p></body></html>`,
+	})
+	t.Cleanup(pages.Close)
+
+	logs := new(lockedBuffer)
+	dataDir := t.TempDir()
+	bot, err := wutbot.New(wutbot.Config{
+		Nick:       "e2ebot",
+		Servers:    server.Addr(),
+		Channels:   []string{channel},
+		Plaintext:  true,
+		DataDir:    dataDir,
+		ScriptsDir: dataDir,
+		LogOutput:  logs,
+		// the page server is on loopback, which the default client refuses
+		FetchClient: &http.Client{Timeout: timeout, Transport: &pageRouter{
+			pages:    strings.TrimPrefix(pages.URL, "http://"),
+			fixtures: &httpfixture.Transport{Dir: fixtures, Mode: httpfixture.Replay},
+		}},
+		FloodBurst: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bot.RegisterHandler(func(ctx context.Context, bot *wutbot.Bot, m wutbot.Message) bool {
+		text, ok := strings.CutPrefix(m.Text, "!echo ")
+		if ok {
+			bot.Reply(m, text)
+		}
+		return ok
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	h := &harness{server: server, pages: pages.URL, bot: bot, stop: cancel, done: make(chan error, 1)}
+	go func() { h.done <- bot.Run(ctx) }()
+	t.Cleanup(func() {
+		cancel()
+		if t.Failed() {
+			t.Logf("bot log:\n%s", logs)
+			for _, line := range server.Received() {
+				t.Log(">", line)
+			}
+		}
+	})
+	return h
+}
+
+// expectNotice waits for the bot's next notice to the channel.
+func (h *harness) expectNotice(t *testing.T) string {
+	t.Helper()
+	line, err := h.server.Expect(`^NOTICE `+regexp.QuoteMeta(channel)+` :`, timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimPrefix(line, "NOTICE "+channel+" :")
+}
+
+func TestEndToEnd(t *testing.T) {
+	h := newHarness(t)
+
+	t.Run("joins its channels", func(t *testing.T) {
+		if _, err := h.server.Expect(`^JOIN `+regexp.QuoteMeta(channel), timeout); err != nil {
+			t.Fatal(err)
+		}
+	})
+	t.Run("announces link titles", func(t *testing.T) {
+		h.server.Privmsg("alice", channel, "have a look: "+h.pages+"/article")
+		if got, want := h.expectNotice(t), "Title: A test article (127.0.0.1)"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("ignores pages without a title", func(t *testing.T) {
+		h.server.Privmsg("alice", channel, h.pages+"/untitled and then "+h.pages+"/article")
+		// the second link's title comes, but nothing for the first
+		if got := h.expectNotice(t); !strings.Contains(got, "A test article") {
+			t.Errorf("unexpected %q", got)
+		}
+	})
+	t.Run("extracts titles from recorded pages", func(t *testing.T) {
+		for _, r := range recordedTitles {
+			h.server.Privmsg("alice", channel, r.url)
+			if got := h.expectNotice(t); got != r.notice {
+				t.Errorf("%s: got %q, want %q", r.url, got, r.notice)
+			}
+		}
+	})
+	t.Run("doesn't announce errors", func(t *testing.T) {
+		h.server.Privmsg("alice", channel, "https://example.com/gone "+h.pages+"/article")
+		if got := h.expectNotice(t); !strings.Contains(got, "A test article") {
+			t.Errorf("unexpected %q", got)
+		}
+	})
+	t.Run("runs registered handlers", func(t *testing.T) {
+		h.server.Privmsg("alice", channel, "!echo hello there")
+		if got, want := h.expectNotice(t), "hello there"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("answers mentions", func(t *testing.T) {
+		h.server.Privmsg("alice", channel, "e2ebot: hi")
+		if got, want := h.expectNotice(t), "don't @ me, mortal"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+	t.Run("quits when stopped", func(t *testing.T) {
+		h.stop()
+		if _, err := h.server.Expect(`^QUIT`, timeout); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-h.done:
+			if err != nil {
+				t.Errorf("Run: %v", err)
+			}
+		case <-time.After(timeout):
+			t.Error("Run didn't return")
+		}
+	})
+}
+
+// pageRouter sends requests for the page server there, and replays the rest.
+type pageRouter struct {
+	pages    string // host:port
+	fixtures http.RoundTripper
+}
+
+func (r *pageRouter) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Host == r.pages {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	return r.fixtures.RoundTrip(req)
+}
+
+// lockedBuffer is the bot's log, written from its goroutines.
+type lockedBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.Lock()
+	defer b.Unlock()
+	return b.buf.String()
+}
@@ -0,0 +1,208 @@
+package wutbot
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the same error is reported at most once in this window
+	errorReportDedupWindow = time.Hour
+	// and at most this many errors altogether
+	errorReportLimit  = 20
+	errorReportWindow = time.Hour
+	// a feed, account or repository is reported after failing this many checks in a row
+	fetchFailureThreshold = 3
+)
+
+// errorReport is what's sent to the generic webhook.
+type errorReport struct {
+	Kind    string            `json:"kind"` // "panic" or "fetch"
+	Message string            `json:"message"`
+	Context map[string]string `json:"context,omitempty"`
+	Stack   string            `json:"stack,omitempty"`
+	Time    time.Time         `json:"time"`
+	// occurrences since it was last reported
+	Count int `json:"count"`
+}
+
+// errorReporter sends panics and repeated fetch errors to Sentry and/or a
+// webhook, deduplicated and rate limited.
+type errorReporter struct {
+	sync.Mutex
+	webhookURL string
+	sentry     *sentryDSN
+	limiter    *rateLimiter
+	reported   map[string]time.Time // fingerprint -> last reported
+	suppressed map[string]int       // fingerprint -> occurrences since
+	failures   map[string]int       // fetch source -> consecutive failures
+}
+
+func newErrorReporter(sentryDSN, webhookURL string) (*errorReporter, error) {
+	if sentryDSN == "" && webhookURL == "" {
+		return nil, nil
+	}
+	r := &errorReporter{
+		webhookURL: webhookURL,
+		limiter:    newRateLimiter(errorReportLimit, errorReportWindow),
+		reported:   make(map[string]time.Time),
+		suppressed: make(map[string]int),
+		failures:   make(map[string]int),
+	}
+	if sentryDSN != "" {
+		dsn, err := parseSentryDSN(sentryDSN)
+		if err != nil {
+			return nil, err
+		}
+		r.sentry = dsn
+	}
+	return r, nil
+}
+
+// shouldReport records an occurrence of the error, returning whether to
+// report it now, and how many times it's happened since it last was.
+func (r *errorReporter) shouldReport(fingerprint string) (count int, ok bool) {
+	r.Lock()
+	defer r.Unlock()
+	r.suppressed[fingerprint]++
+	if time.Since(r.reported[fingerprint]) < errorReportDedupWindow || !r.limiter.allow("") {
+		return 0, false
+	}
+	count = r.suppressed[fingerprint]
+	r.reported[fingerprint] = time.Now()
+	delete(r.suppressed, fingerprint)
+	return count, true
+}
+
+// reportError sends a report in the background, if error reporting is set up.
+func (irc *Bot) reportError(report errorReport, fingerprint string) {
+	r := irc.errorReports
+	if r == nil {
+		return
+	}
+	count, ok := r.shouldReport(report.Kind + " " + fingerprint)
+	if !ok {
+		return
+	}
+	report.Count, report.Time = count, time.Now()
+	go func() {
+		if r.webhookURL != "" {
+			if err := irc.postJSON(r.webhookURL, nil, report); err != nil {
+				irc.logger("errors").Warn("couldn't send error report", "err", err)
+			}
+		}
+		if r.sentry != nil {
+			if err := irc.postJSON(r.sentry.storeURL, map[string]string{"X-Sentry-Auth": r.sentry.auth()}, sentryEvent(report)); err != nil {
+				irc.logger("errors").Warn("couldn't send error report to Sentry", "err", err)
+			}
+		}
+	}()
+}
+
+// fetchFailed counts a failed check of source (e.g. "feed <url>"),
+// reporting it once it has failed several times in a row.
+func (irc *Bot) fetchFailed(source string, err error, details map[string]string) {
+	r := irc.errorReports
+	// cancelled by a disconnect or shutdown: not the source's fault
+	if r == nil || errors.Is(err, context.Canceled) {
+		return
+	}
+	r.Lock()
+	r.failures[source]++
+	failures := r.failures[source]
+	r.Unlock()
+	if failures >= fetchFailureThreshold {
+		message := fmt.Sprintf("%s failed %d times in a row: %v", source, failures, err)
+		irc.reportError(errorReport{Kind: "fetch", Message: message, Context: details}, source)
+	}
+}
+
+func (irc *Bot) fetchSucceeded(source string) {
+	if r := irc.errorReports; r != nil {
+		r.Lock()
+		delete(r.failures, source)
+		r.Unlock()
+	}
+}
+
+func (irc *Bot) postJSON(url string, headers map[string]string, body interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", irc.userAgent)
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	resp, err := irc.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// sentryDSN is a parsed Sentry DSN, https://<key>@<host>/<project>.
+type sentryDSN struct {
+	storeURL string
+	key      string
+}
+
+func parseSentryDSN(dsn string) (*sentryDSN, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, err
+	}
+	project := path.Base(u.Path)
+	if u.User == nil || u.User.Username() == "" || u.Host == "" || project == "/" || project == "." {
+		return nil, fmt.Errorf("invalid Sentry DSN")
+	}
+	store := url.URL{Scheme: u.Scheme, Host: u.Host, Path: strings.TrimSuffix(path.Dir(u.Path), "/") + "/api/" + project + "/store/"}
+	return &sentryDSN{storeURL: store.String(), key: u.User.Username()}, nil
+}
+
+func (dsn *sentryDSN) auth() string {
+	return fmt.Sprintf("Sentry sentry_version=7, sentry_client=wutbot/1.0, sentry_key=%s", dsn.key)
+}
+
+func sentryEvent(report errorReport) map[string]interface{} {
+	id := make([]byte, 16)
+	rand.Read(id)
+	tags := map[string]string{"kind": report.Kind}
+	for key, value := range report.Context {
+		tags[key] = value
+	}
+	extra := map[string]interface{}{"count": report.Count}
+	if report.Stack != "" {
+		extra["stack"] = report.Stack
+	}
+	return map[string]interface{}{
+		"event_id":  hex.EncodeToString(id),
+		"timestamp": report.Time.UTC().Format(time.RFC3339),
+		"level":     "error",
+		"platform":  "go",
+		"logger":    "wutbot",
+		"message":   map[string]string{"formatted": report.Message},
+		"tags":      tags,
+		"extra":     extra,
+	}
+}
@@ -0,0 +1,205 @@
+package wutbot
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"pratyush/wutbot/internal/fetch"
+)
+
+// where messages relayed from elsewhere were sent
+const (
+	sourceMatrix  = "matrix"
+	sourceDiscord = "discord"
+)
+
+// messageEvent is a channel message, published once any command it was has
+// run.
+type messageEvent struct {
+	ctx     context.Context
+	channel string
+	nick    string
+	account string
+	msgid   string
+	text    string
+	time    time.Time
+	source  string // sourceMatrix or sourceDiscord if it wasn't sent on IRC
+	command string // the built-in command it ran, if any
+	handled bool   // whether a command or Handler took it
+}
+
+// linkEvent is a link posted to a channel, before it's fetched.
+type linkEvent struct {
+	ctx  context.Context
+	link archivedLink
+}
+
+// titleEvent is a link that was fetched, or that we failed to fetch.
+type titleEvent struct {
+	link archivedLink
+	page *fetch.Page // nil if the fetch failed
+	err  error
+}
+
+// joinEvent is someone (maybe us) joining a channel.
+type joinEvent struct {
+	channel string
+	nick    string
+	account string // empty if they aren't logged in, or we don't know
+	self    bool
+}
+
+// partEvent is someone (maybe us) leaving a channel, or quitting while
+// in it.
+type partEvent struct {
+	channel string
+	nick    string
+	reason  string
+	quit    bool
+	self    bool
+}
+
+// topic delivers one kind of event to its subscribers, in the order they
+// subscribed, before publish returns.
+type topic[T any] struct {
+	sync.RWMutex
+	name        string
+	subscribers []func(T)
+}
+
+func (t *topic[T]) subscribe(f func(T)) {
+	t.Lock()
+	defer t.Unlock()
+	t.subscribers = append(t.subscribers, f)
+}
+
+// publish runs each subscriber, so that a panic in one doesn't keep the
+// event from the rest.
+func publish[T any](irc *Bot, t *topic[T], event T) {
+	t.RLock()
+	subscribers := t.subscribers
+	t.RUnlock()
+	for _, f := range subscribers {
+		irc.safely(t.name+" subscriber", func() { f(event) })
+	}
+}
+
+type eventBus struct {
+	messages topic[messageEvent]
+	links    topic[linkEvent]
+	titles   topic[titleEvent]
+	joins    topic[joinEvent]
+	parts    topic[partEvent]
+}
+
+func newEventBus() *eventBus {
+	bus := new(eventBus)
+	bus.messages.name = "message"
+	bus.links.name = "link"
+	bus.titles.name = "title"
+	bus.joins.name = "join"
+	bus.parts.name = "part"
+	return bus
+}
+
+// subscribeModules wires up the features that react to what happens in
+// channels.
+func (irc *Bot) subscribeModules() {
+	events := irc.events
+	events.messages.subscribe(func(m messageEvent) {
+		irc.history.Seen(m.channel, m.time)
+		irc.nickAccounts.Set(m.nick, m.account)
+	})
+	events.messages.subscribe(irc.recordMessageStats)
+	events.messages.subscribe(irc.handleOwnerWatches)
+	events.messages.subscribe(irc.mirrorToDiscord)
+	events.messages.subscribe(irc.relayMessage)
+	events.messages.subscribe(func(m messageEvent) {
+		if m.handled {
+			return
+		}
+		irc.handleTriviaAnswer(m.channel, m.nick, m.account, m.text)
+		irc.handleTriggers(m.channel, m.nick, m.msgid, m.text)
+		irc.handleMarkovLearn(m.channel, m.text)
+		irc.publishLinks(m)
+		irc.handleOwnerHighlight(m.channel, m.nick, m.text)
+	})
+	events.links.subscribe(func(l linkEvent) {
+		if irc.titlesEnabled(l.link.Channel) && !irc.isQuiet(l.link.Channel) {
+			irc.announceLink(l.ctx, l.link, "")
+		}
+	})
+	events.titles.subscribe(func(t titleEvent) {
+		irc.archiveLink(t.link)
+	})
+	events.joins.subscribe(func(j joinEvent) {
+		if j.self {
+			irc.joined.Add(j.channel)
+			irc.pendingJoins.remove(j.channel)
+			irc.requestCatchup(j.channel)
+			irc.whoChannel(j.channel)
+		}
+	})
+	events.joins.subscribe(irc.handleAutoModeJoin)
+	events.joins.subscribe(irc.relayJoin)
+	events.parts.subscribe(irc.relayPart)
+}
+
+// publishJoins turns JOINs into join events.
+func (irc *Bot) publishJoins() {
+	irc.AddCallback("JOIN", func(e ircmsg.Message) {
+		if len(e.Params) == 0 {
+			return
+		}
+		var account string
+		if len(e.Params) > 1 {
+			// extended-join
+			account = e.Params[1]
+		} else {
+			_, account = e.GetTag("account")
+		}
+		if account == "*" {
+			account = ""
+		}
+		publish(irc, &irc.events.joins, joinEvent{
+			channel: e.Params[0], nick: e.Nick(), account: account, self: e.Nick() == irc.CurrentNick(),
+		})
+	})
+}
+
+// publishParts turns PARTs, KICKs and QUITs into part events; it has to
+// come before the channel logger's callbacks, which forget who quit.
+func (irc *Bot) publishParts() {
+	irc.AddCallback("PART", func(e ircmsg.Message) {
+		if len(e.Params) == 0 {
+			return
+		}
+		var reason string
+		if len(e.Params) > 1 {
+			reason = e.Params[1]
+		}
+		publish(irc, &irc.events.parts, partEvent{channel: e.Params[0], nick: e.Nick(), reason: reason, self: e.Nick() == irc.CurrentNick()})
+	})
+	irc.AddCallback("KICK", func(e ircmsg.Message) {
+		if len(e.Params) < 2 {
+			return
+		}
+		reason := "kicked by " + e.Nick()
+		if len(e.Params) > 2 {
+			reason += ": " + e.Params[2]
+		}
+		publish(irc, &irc.events.parts, partEvent{channel: e.Params[0], nick: e.Params[1], reason: reason, self: e.Params[1] == irc.CurrentNick()})
+	})
+	irc.AddCallback("QUIT", func(e ircmsg.Message) {
+		var reason string
+		if len(e.Params) > 0 {
+			reason = e.Params[0]
+		}
+		for _, channel := range irc.chanLog.channelsOf(e.Nick()) {
+			publish(irc, &irc.events.parts, partEvent{channel: channel, nick: e.Nick(), reason: reason, quit: true})
+		}
+	})
+}
@@ -0,0 +1,274 @@
+package wutbot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pratyush/wutbot/internal/feed"
+	"pratyush/wutbot/internal/fetch"
+)
+
+const (
+	// subscriptions, keyed by "<casefolded channel> <url>"
+	feedsBucket = "feeds"
+	// followed by the subscription key; maps entry IDs to when we first saw them
+	feedSeenBucket = "feed-seen:"
+
+	feedCheckInterval   = time.Minute
+	defaultFeedInterval = 30 * time.Minute
+	minFeedInterval     = 5 * time.Minute
+	// don't flood a channel when a feed publishes a lot at once
+	maxFeedAnnouncements = 5
+	// forget entries this long after they drop out of the feed
+	feedSeenRetention = 30 * 24 * time.Hour
+)
+
+type feedSubscription struct {
+	Channel      string        `json:"channel"`
+	URL          string        `json:"url"`
+	Interval     time.Duration `json:"interval"`
+	ETag         string        `json:"etag,omitempty"`
+	LastModified string        `json:"last-modified,omitempty"`
+	LastChecked  time.Time     `json:"last-checked"`
+	Title        string        `json:"title,omitempty"`
+}
+
+func (sub *feedSubscription) key() string {
+	return strings.ToLower(sub.Channel) + " " + sub.URL
+}
+
+// feedPoller serializes checks, so that a slow feed isn't checked twice at once.
+type feedPoller struct {
+	sync.Mutex
+}
+
+// fetchFeed does a conditional GET, returning nil entries if the feed
+// hasn't changed.
+func (irc *Bot) fetchFeed(ctx context.Context, sub *feedSubscription) (entries []feed.Entry, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", sub.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml;q=0.9, */*;q=0.8")
+	if sub.ETag != "" {
+		req.Header.Set("If-None-Match", sub.ETag)
+	}
+	if sub.LastModified != "" {
+		req.Header.Set("If-Modified-Since", sub.LastModified)
+	}
+	resp, err := irc.fetcher.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	title, entries, err := feed.Parse(io.LimitReader(resp.Body, fetch.MaxPageBytes))
+	if err != nil {
+		return nil, err
+	}
+	sub.ETag, sub.LastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	sub.Title = fetch.Sanitize(fetch.CollapseWhitespace(title))
+	return entries, nil
+}
+
+// newFeedEntries records the entries as seen, returning the ones that
+// weren't, oldest first. Entries must be the whole, non-empty feed, since
+// seen entries missing from it are forgotten once they're old enough.
+func (irc *Bot) newFeedEntries(sub *feedSubscription, entries []feed.Entry) (result []feed.Entry) {
+	bucket := feedSeenBucket + sub.key()
+	now := time.Now()
+	current := make(map[string]bool)
+	for _, entry := range entries {
+		current[entry.ID] = true
+		var seen time.Time
+		if found, _ := irc.store.Get(bucket, entry.ID, &seen); found {
+			continue
+		}
+		if err := irc.store.Put(bucket, entry.ID, now); err != nil {
+			irc.logger("feeds").Error("couldn't save feed entry", "url", sub.URL, "err", err)
+			continue
+		}
+		result = append(result, entry)
+	}
+	ids, err := irc.store.Keys(bucket)
+	if err != nil {
+		irc.logger("feeds").Error("couldn't list seen feed entries", "url", sub.URL, "err", err)
+	}
+	for _, id := range ids {
+		var seen time.Time
+		if found, _ := irc.store.Get(bucket, id, &seen); found && !current[id] && now.Sub(seen) > feedSeenRetention {
+			irc.store.Delete(bucket, id)
+		}
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return
+}
+
+func (irc *Bot) checkFeed(ctx context.Context, sub feedSubscription, announce bool) error {
+	entries, err := irc.fetchFeed(ctx, &sub)
+	sub.LastChecked = time.Now()
+	if putErr := irc.store.Put(feedsBucket, sub.key(), sub); putErr != nil {
+		irc.logger("feeds").Error("couldn't save feed", "url", sub.URL, "err", putErr)
+	}
+	if err != nil {
+		return err
+	}
+	// unchanged (304), or empty, which would look like every entry we've
+	// seen dropped out of it
+	if len(entries) == 0 {
+		return nil
+	}
+	fresh := irc.newFeedEntries(&sub, entries)
+	if !announce {
+		return nil
+	}
+	if len(fresh) > maxFeedAnnouncements {
+		fresh = fresh[len(fresh)-maxFeedAnnouncements:]
+	}
+	for _, entry := range fresh {
+		text := fetch.Sanitize(fetch.CollapseWhitespace(entry.Title))
+		if entry.Link != "" {
+			text += " <" + fetch.Sanitize(entry.Link) + ">"
+		}
+		if sub.Title != "" {
+			text = "[" + sub.Title + "] " + text
+		}
+		irc.Notice(sub.Channel, text)
+		irc.alert(alertFeed, sub.URL, sub.Channel, text)
+	}
+	return nil
+}
+
+// pollFeeds checks each subscription whose interval is up.
+func (irc *Bot) pollFeeds() {
+	ticker := time.NewTicker(feedCheckInterval)
+	defer ticker.Stop()
+	for irc.tick(ticker) {
+		if !irc.Connected() {
+			continue
+		}
+		irc.feeds.Lock()
+		keys, err := irc.store.Keys(feedsBucket)
+		if err != nil {
+			irc.logger("feeds").Error("couldn't list feeds", "err", err)
+		}
+		for _, key := range keys {
+			var sub feedSubscription
+			if found, err := irc.store.Get(feedsBucket, key, &sub); !found || err != nil {
+				continue
+			}
+			// new entries wait for the quiet hours to end
+			if time.Since(sub.LastChecked) < sub.Interval || irc.isQuiet(sub.Channel) {
+				continue
+			}
+			irc.safely("feed check", func() {
+				if err := irc.checkFeed(irc.connectionContext(), sub, true); err != nil {
+					irc.logger("feeds").Warn("couldn't check feed", "url", sub.URL, "err", err)
+					irc.fetchFailed("feed "+sub.URL, err, map[string]string{"channel": sub.Channel, "url": sub.URL})
+				} else {
+					irc.fetchSucceeded("feed " + sub.URL)
+				}
+			})
+		}
+		irc.feeds.Unlock()
+	}
+}
+
+// handleFeedCommand is the owner's "feed add <channel> <url> [<interval>]",
+// "feed del <channel> <url>" and "feed list [<channel>]".
+func (irc *Bot) handleFeedCommand(target string, args []string) {
+	usage := "usage: feed add <channel> <url> [<interval>] | feed del <channel> <url> | feed list [<channel>]"
+	if len(args) == 0 {
+		irc.Privmsg(target, usage)
+		return
+	}
+	switch strings.ToLower(args[0]) {
+	case "add":
+		if len(args) < 3 || !irc.isChannel(args[1]) {
+			irc.Privmsg(target, usage)
+			return
+		}
+		sub := feedSubscription{Channel: args[1], URL: args[2], Interval: defaultFeedInterval}
+		if len(args) > 3 {
+			interval, err := time.ParseDuration(args[3])
+			if err != nil || interval < minFeedInterval {
+				irc.Privmsg(target, fmt.Sprintf("the interval must be a duration of at least %v", minFeedInterval))
+				return
+			}
+			sub.Interval = interval
+		}
+		go func() {
+			irc.feeds.Lock()
+			defer irc.feeds.Unlock()
+			defer irc.recoverPanic("feed add")
+			// what's already in the feed isn't news
+			if err := irc.checkFeed(irc.connectionContext(), sub, false); err != nil {
+				irc.store.Delete(feedsBucket, sub.key())
+				irc.Privmsg(target, fmt.Sprintf("couldn't read %s: %v", sub.URL, err))
+				return
+			}
+			irc.Privmsg(target, fmt.Sprintf("subscribed %s to %s", sub.Channel, sub.URL))
+		}()
+	case "del":
+		if len(args) != 3 {
+			irc.Privmsg(target, usage)
+			return
+		}
+		sub := feedSubscription{Channel: args[1], URL: args[2]}
+		irc.feeds.Lock()
+		defer irc.feeds.Unlock()
+		if found, _ := irc.store.Get(feedsBucket, sub.key(), new(feedSubscription)); !found {
+			irc.Privmsg(target, fmt.Sprintf("%s isn't subscribed to %s", sub.Channel, sub.URL))
+			return
+		}
+		irc.store.Delete(feedsBucket, sub.key())
+		seenBucket := feedSeenBucket + sub.key()
+		ids, err := irc.store.Keys(seenBucket)
+		if err != nil {
+			irc.logger("feeds").Error("couldn't list seen feed entries", "url", sub.URL, "err", err)
+		}
+		for _, id := range ids {
+			irc.store.Delete(seenBucket, id)
+		}
+		irc.Privmsg(target, "unsubscribed")
+	case "list":
+		keys, err := irc.store.Keys(feedsBucket)
+		if err != nil {
+			irc.Privmsg(target, fmt.Sprintf("couldn't list feeds: %v", err))
+			return
+		}
+		var entries []string
+		for _, key := range keys {
+			var sub feedSubscription
+			if found, _ := irc.store.Get(feedsBucket, key, &sub); !found {
+				continue
+			}
+			if len(args) > 1 && !strings.EqualFold(sub.Channel, args[1]) {
+				continue
+			}
+			entries = append(entries, fmt.Sprintf("%s %s (every %v)", sub.Channel, sub.URL, sub.Interval))
+		}
+		sort.Strings(entries)
+		if len(entries) == 0 {
+			irc.Privmsg(target, "no feeds")
+		}
+		for _, entry := range entries {
+			irc.Privmsg(target, entry)
+		}
+	default:
+		irc.Privmsg(target, usage)
+	}
+}
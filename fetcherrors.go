@@ -0,0 +1,84 @@
+package wutbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"pratyush/wutbot/internal/fetch"
+)
+
+// Each channel's "fetch-errors" policy decides who hears about links that
+// couldn't be fetched: nobody ("drop", the default), the channel
+// ("report"), or just whoever posted the link, in a notice ("poster").
+// Posters relayed from Matrix or Discord aren't told, since we can only
+// notice people on IRC.
+
+func validateFetchErrors(policy string) error {
+	switch policy {
+	case "", "drop", "report", "poster":
+		return nil
+	}
+	return fmt.Errorf("fetch-errors must be drop, report or poster, not %s", policy)
+}
+
+// reportFetchError tells whoever the channel's policy says that a link
+// couldn't be fetched.
+func (irc *Bot) reportFetchError(link archivedLink, err error) {
+	// not failures, just nothing to say (or shutting down)
+	if errors.Is(err, fetch.ErrNotHTML) || errors.Is(err, fetch.ErrTooLarge) || errors.Is(err, context.Canceled) {
+		return
+	}
+	switch channelOption(irc.getConfig(), link.Channel, func(c ChannelConfig) *string { return c.FetchErrors }) {
+	case "report":
+		text := fmt.Sprintf(irc.translate(link.Channel, "couldn't fetch %s: %s"), linkHost(link.URL), irc.describeFetchError(link.Channel, err))
+		irc.sendReplyNotice(link.Channel, link.MsgID, text)
+	case "poster":
+		// a notice would go to whoever has their nick on IRC, if anyone
+		if link.Poster == "" || link.Source != "" {
+			return
+		}
+		text := fmt.Sprintf(irc.translate(link.Channel, "couldn't fetch your link in %s (%s): %s"), link.Channel, fetch.Sanitize(link.URL), irc.describeFetchError(link.Channel, err))
+		irc.Notice(link.Poster, text)
+	}
+}
+
+// describeFetchError says why a fetch failed, briefly, in the channel's
+// language, or in English for "".
+func (irc *Bot) describeFetchError(channel string, err error) string {
+	translate := func(text string) string {
+		if channel == "" {
+			return text
+		}
+		return irc.translate(channel, text)
+	}
+	var status *fetch.StatusError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &status):
+		switch status.Code {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusUnavailableForLegalReasons:
+			return fmt.Sprintf(translate("blocked by site (%s)"), fetch.Sanitize(status.Status))
+		}
+		return fetch.Sanitize(status.Status)
+	case errors.Is(err, fetch.ErrRateLimited):
+		return translate("rate limited by site")
+	case errors.Is(err, fetch.ErrBackingOff):
+		return translate("site keeps failing")
+	case errors.Is(err, fetch.ErrForbiddenAddress):
+		return translate("not a public address")
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return translate("timed out")
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		return translate("no such host")
+	case errors.As(err, &dnsErr):
+		return translate("couldn't look up host")
+	case errors.As(err, &opErr):
+		return translate("couldn't connect")
+	}
+	return translate("unexpected error")
+}
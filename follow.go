@@ -0,0 +1,293 @@
+package wutbot
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"pratyush/wutbot/internal/fetch"
+)
+
+const (
+	// followed accounts, keyed by "<casefolded channel> <service>:<account>"
+	followsBucket = "follows"
+
+	followPollInterval = 5 * time.Minute
+	// posts announced per account per poll
+	maxFollowAnnouncements = 3
+	maxPostLength          = 300
+
+	serviceMastodon = "mastodon"
+	serviceTwitter  = "twitter"
+
+	twitterAPI = "https://api.twitter.com/2"
+)
+
+type followSubscription struct {
+	Channel string `json:"channel"`
+	Service string `json:"service"`
+	Account string `json:"account"` // user@instance for Mastodon, the username for Twitter
+	UserID  string `json:"user-id"`
+	LastID  string `json:"last-id,omitempty"` // the newest post we've seen
+}
+
+func (sub *followSubscription) key() string {
+	return strings.ToLower(sub.Channel) + " " + sub.Service + ":" + strings.ToLower(sub.Account)
+}
+
+type socialPost struct {
+	id   string
+	text string
+	url  string
+}
+
+// parseFollowAccount parses "user@instance" (Mastodon, with or without a
+// leading @) or "twitter:user".
+func parseFollowAccount(spec string) (service, account string, err error) {
+	if name, ok := strings.CutPrefix(strings.ToLower(spec), "twitter:"); ok {
+		name = strings.TrimPrefix(name, "@")
+		if name == "" {
+			return "", "", fmt.Errorf("no Twitter username given")
+		}
+		return serviceTwitter, name, nil
+	}
+	spec = strings.TrimPrefix(spec, "@")
+	user, instance, ok := strings.Cut(spec, "@")
+	if !ok || user == "" || instance == "" || strings.ContainsAny(instance, "/?#") {
+		return "", "", fmt.Errorf("accounts look like user@instance (Mastodon) or twitter:user")
+	}
+	return serviceMastodon, user + "@" + strings.ToLower(instance), nil
+}
+
+// mastodonText converts a post's HTML to a line of text.
+func mastodonText(content string) string {
+	doc, err := html.Parse(strings.NewReader(strings.NewReplacer("<br", " <br", "</p>", " </p>").Replace(content)))
+	if err != nil {
+		return ""
+	}
+	return fetch.CollapseWhitespace(fetch.NodeText(doc))
+}
+
+func (irc *Bot) lookupFollowedUser(ctx context.Context, sub *followSubscription) error {
+	switch sub.Service {
+	case serviceMastodon:
+		user, instance, _ := strings.Cut(sub.Account, "@")
+		var account struct {
+			ID string `json:"id"`
+		}
+		if err := irc.getJSON(ctx, fmt.Sprintf("https://%s/api/v1/accounts/lookup?acct=%s", instance, url.QueryEscape(user)), &account); err != nil {
+			return err
+		}
+		sub.UserID = account.ID
+	case serviceTwitter:
+		if irc.twitterToken == "" {
+			return fmt.Errorf("following Twitter accounts needs WUTBOT_TWITTER_BEARER_TOKEN")
+		}
+		var response struct {
+			Data struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		}
+		if err := irc.getJSONWithToken(ctx, twitterAPI+"/users/by/username/"+url.PathEscape(sub.Account), irc.twitterToken, &response); err != nil {
+			return err
+		}
+		sub.UserID = response.Data.ID
+	}
+	if sub.UserID == "" {
+		return fmt.Errorf("no such account %s", sub.Account)
+	}
+	return nil
+}
+
+// fetchPosts returns the account's posts since sub.LastID (leaving out
+// replies and boosts/retweets), newest first.
+func (irc *Bot) fetchPosts(ctx context.Context, sub *followSubscription) (posts []socialPost, err error) {
+	switch sub.Service {
+	case serviceMastodon:
+		_, instance, _ := strings.Cut(sub.Account, "@")
+		query := url.Values{"exclude_replies": {"true"}, "exclude_reblogs": {"true"}, "limit": {"10"}}
+		if sub.LastID != "" {
+			query.Set("since_id", sub.LastID)
+		}
+		var statuses []struct {
+			ID          string `json:"id"`
+			URL         string `json:"url"`
+			Content     string `json:"content"`
+			SpoilerText string `json:"spoiler_text"`
+		}
+		if err = irc.getJSON(ctx, fmt.Sprintf("https://%s/api/v1/accounts/%s/statuses?%s", instance, url.PathEscape(sub.UserID), query.Encode()), &statuses); err != nil {
+			return
+		}
+		for _, s := range statuses {
+			text := mastodonText(s.Content)
+			if s.SpoilerText != "" {
+				// don't show what's behind a content warning
+				text = "CW: " + s.SpoilerText
+			}
+			posts = append(posts, socialPost{id: s.ID, text: text, url: s.URL})
+		}
+	case serviceTwitter:
+		query := url.Values{"exclude": {"replies,retweets"}, "max_results": {"10"}}
+		if sub.LastID != "" {
+			query.Set("since_id", sub.LastID)
+		}
+		var response struct {
+			Data []struct {
+				ID   string `json:"id"`
+				Text string `json:"text"`
+			} `json:"data"`
+		}
+		if err = irc.getJSONWithToken(ctx, twitterAPI+"/users/"+url.PathEscape(sub.UserID)+"/tweets?"+query.Encode(), irc.twitterToken, &response); err != nil {
+			return
+		}
+		for _, t := range response.Data {
+			posts = append(posts, socialPost{id: t.ID, text: fetch.CollapseWhitespace(t.Text), url: "https://twitter.com/" + sub.Account + "/status/" + t.ID})
+		}
+	}
+	return
+}
+
+func (irc *Bot) announcePost(sub *followSubscription, post socialPost) {
+	text := fetch.Sanitize(post.text)
+	if runes := []rune(text); len(runes) > maxPostLength {
+		text = string(runes[:maxPostLength]) + "…"
+	}
+	host := "twitter.com"
+	if u, err := url.Parse(post.url); err == nil && u.Hostname() != "" {
+		host = u.Hostname()
+	}
+	// like link titles
+	text = fmt.Sprintf("@%s: %s (%s) %s", sub.Account, text, fetch.Sanitize(host), fetch.Sanitize(post.url))
+	irc.Notice(sub.Channel, text)
+	irc.alert(alertFollow, sub.Account, sub.Channel, text)
+}
+
+// checkFollow announces an account's new posts, or with announce unset,
+// just catches up to them.
+func (irc *Bot) checkFollow(ctx context.Context, sub followSubscription, announce bool) error {
+	posts, err := irc.fetchPosts(ctx, &sub)
+	if err != nil {
+		return err
+	}
+	if len(posts) == 0 {
+		return nil
+	}
+	newest := posts[0].id
+	if announce {
+		if len(posts) > maxFollowAnnouncements {
+			posts = posts[:maxFollowAnnouncements]
+		}
+		for i := len(posts) - 1; i >= 0; i-- {
+			irc.announcePost(&sub, posts[i])
+		}
+	}
+	sub.LastID = newest
+	return irc.store.Put(followsBucket, sub.key(), sub)
+}
+
+func (irc *Bot) pollFollows() {
+	ticker := time.NewTicker(followPollInterval)
+	defer ticker.Stop()
+	for irc.tick(ticker) {
+		if !irc.Connected() {
+			continue
+		}
+		keys, err := irc.store.Keys(followsBucket)
+		if err != nil {
+			irc.logger("follow").Error("couldn't list follows", "err", err)
+		}
+		for _, key := range keys {
+			var sub followSubscription
+			if found, err := irc.store.Get(followsBucket, key, &sub); !found || err != nil || irc.isQuiet(sub.Channel) {
+				continue
+			}
+			irc.safely("follow check", func() {
+				if err := irc.checkFollow(irc.connectionContext(), sub, true); err != nil {
+					irc.logger("follow").Warn("couldn't check posts", "account", sub.Account, "err", err)
+					irc.fetchFailed("follow "+sub.Account, err, map[string]string{"channel": sub.Channel, "account": sub.Account})
+				} else {
+					irc.fetchSucceeded("follow " + sub.Account)
+				}
+			})
+		}
+	}
+}
+
+// handleFollowCommand is the owner's "follow add <channel> <account>",
+// "follow del <channel> <account>" and "follow list [<channel>]".
+func (irc *Bot) handleFollowCommand(target string, args []string) {
+	usage := "usage: follow add|del <channel> <user@instance|twitter:user> | follow list [<channel>]"
+	if len(args) == 0 {
+		irc.Privmsg(target, usage)
+		return
+	}
+	switch strings.ToLower(args[0]) {
+	case "add", "del":
+		if len(args) != 3 || !irc.isChannel(args[1]) {
+			irc.Privmsg(target, usage)
+			return
+		}
+		service, account, err := parseFollowAccount(args[2])
+		if err != nil {
+			irc.Privmsg(target, err.Error())
+			return
+		}
+		sub := followSubscription{Channel: args[1], Service: service, Account: account}
+		if strings.ToLower(args[0]) == "del" {
+			if found, _ := irc.store.Get(followsBucket, sub.key(), new(followSubscription)); !found {
+				irc.Privmsg(target, fmt.Sprintf("%s doesn't follow %s", sub.Channel, args[2]))
+				return
+			}
+			irc.store.Delete(followsBucket, sub.key())
+			irc.Privmsg(target, "unfollowed")
+			return
+		}
+		go func() {
+			defer irc.recoverPanic("follow add")
+			if err := irc.lookupFollowedUser(irc.connectionContext(), &sub); err != nil {
+				irc.Privmsg(target, fmt.Sprintf("couldn't find %s: %v", args[2], err))
+				return
+			}
+			if err := irc.store.Put(followsBucket, sub.key(), sub); err != nil {
+				irc.Privmsg(target, fmt.Sprintf("couldn't save: %v", err))
+				return
+			}
+			// what's already posted isn't news
+			if err := irc.checkFollow(irc.connectionContext(), sub, false); err != nil {
+				irc.logger("follow").Warn("couldn't check posts", "account", sub.Account, "err", err)
+			}
+			irc.Privmsg(target, fmt.Sprintf("%s now follows %s", sub.Channel, args[2]))
+		}()
+	case "list":
+		keys, err := irc.store.Keys(followsBucket)
+		if err != nil {
+			irc.Privmsg(target, fmt.Sprintf("couldn't list follows: %v", err))
+			return
+		}
+		var entries []string
+		for _, key := range keys {
+			var sub followSubscription
+			if found, _ := irc.store.Get(followsBucket, key, &sub); !found {
+				continue
+			}
+			if len(args) > 1 && !strings.EqualFold(sub.Channel, args[1]) {
+				continue
+			}
+			entries = append(entries, fmt.Sprintf("%s %s:%s", sub.Channel, sub.Service, sub.Account))
+		}
+		sort.Strings(entries)
+		if len(entries) == 0 {
+			irc.Privmsg(target, "not following anyone")
+		}
+		for _, entry := range entries {
+			irc.Privmsg(target, entry)
+		}
+	default:
+		irc.Privmsg(target, usage)
+	}
+}
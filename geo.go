@@ -0,0 +1,185 @@
+package wutbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultNominatimURL = "https://nominatim.openstreetmap.org"
+	// Nominatim's usage policy allows one request a second
+	geocodeInterval = time.Second
+	// the detail we ask for when a link is of a point, not a map view
+	pointZoom = 18
+)
+
+var (
+	// geo: URIs (RFC 5870), which ExtractURLs doesn't find
+	geoURIRegex = regexp.MustCompile(`(?i)\bgeo:(-?\d{1,2}(?:\.\d+)?),(-?\d{1,3}(?:\.\d+)?)`)
+	// Google Maps: a place's pin in the data parameter, or the map's center
+	googlePinRegex    = regexp.MustCompile(`!3d(-?\d+(?:\.\d+)?)!4d(-?\d+(?:\.\d+)?)`)
+	googleCenterRegex = regexp.MustCompile(`/@(-?\d+(?:\.\d+)?),(-?\d+(?:\.\d+)?)(?:,(\d+(?:\.\d+)?)z)?`)
+)
+
+// geocoder reverse-geocodes with Nominatim, keeping to its rate limit.
+type geocoder struct {
+	sync.Mutex
+	url  string
+	next time.Time
+}
+
+func newGeocoder(nominatimURL string) *geocoder {
+	if nominatimURL == "" {
+		nominatimURL = defaultNominatimURL
+	}
+	return &geocoder{url: strings.TrimSuffix(nominatimURL, "/")}
+}
+
+// wait waits for our turn to make a request.
+func (g *geocoder) wait(ctx context.Context) error {
+	g.Lock()
+	now := time.Now()
+	turn := g.next
+	if turn.Before(now) {
+		turn = now
+	}
+	g.next = turn.Add(geocodeInterval)
+	g.Unlock()
+	select {
+	case <-time.After(time.Until(turn)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// extractGeoURIs returns the geo: URIs in a message as OpenStreetMap links
+// to the same points, so they're titled (and archived) like any other map
+// link.
+func extractGeoURIs(message string) (result []string) {
+	for _, match := range geoURIRegex.FindAllStringSubmatch(message, -1) {
+		lat, lon, ok := parseCoordinates(match[1], match[2])
+		if !ok {
+			continue
+		}
+		result = append(result, osmPointURL(lat, lon))
+	}
+	return
+}
+
+func osmPointURL(lat, lon float64) string {
+	query := url.Values{"mlat": {formatCoordinate(lat)}, "mlon": {formatCoordinate(lon)}}
+	return "https://www.openstreetmap.org/?" + query.Encode()
+}
+
+func formatCoordinate(c float64) string {
+	return strconv.FormatFloat(c, 'f', -1, 64)
+}
+
+func parseCoordinates(latitude, longitude string) (lat, lon float64, ok bool) {
+	lat, err := strconv.ParseFloat(latitude, 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, false
+	}
+	lon, err = strconv.ParseFloat(longitude, 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// mapCoordinates returns the point an OpenStreetMap or Google Maps link is
+// of, or the center of the map it shows, and how far it's zoomed in.
+func mapCoordinates(u *url.URL) (lat, lon float64, zoom int, ok bool) {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	query := u.Query()
+	switch {
+	case host == "openstreetmap.org" || host == "osm.org":
+		// not the pages of objects, searches, etc., which have their own map views
+		if u.Path != "" && u.Path != "/" {
+			return 0, 0, 0, false
+		}
+		if lat, lon, ok = parseCoordinates(query.Get("mlat"), query.Get("mlon")); ok {
+			return lat, lon, pointZoom, true
+		}
+		// #map=<zoom>/<lat>/<lon>
+		fragment, _ := url.ParseQuery(u.Fragment)
+		parts := strings.Split(fragment.Get("map"), "/")
+		if len(parts) != 3 {
+			return 0, 0, 0, false
+		}
+		zoom, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return 0, 0, 0, false
+		}
+		lat, lon, ok = parseCoordinates(parts[1], parts[2])
+		return lat, lon, zoom, ok
+	case (isGoogleHost(host) && strings.HasPrefix(u.Path, "/maps")) || (strings.HasPrefix(host, "maps.") && isGoogleHost(strings.TrimPrefix(host, "maps."))):
+		if match := googlePinRegex.FindStringSubmatch(u.Path); match != nil {
+			lat, lon, ok = parseCoordinates(match[1], match[2])
+			return lat, lon, pointZoom, ok
+		}
+		if match := googleCenterRegex.FindStringSubmatch(u.Path); match != nil {
+			zoom = pointZoom
+			if z, err := strconv.ParseFloat(match[3], 64); err == nil {
+				zoom = int(z)
+			}
+			lat, lon, ok = parseCoordinates(match[1], match[2])
+			return lat, lon, zoom, ok
+		}
+		for _, key := range []string{"q", "ll", "query"} {
+			if latitude, longitude, found := strings.Cut(query.Get(key), ","); found {
+				if lat, lon, ok = parseCoordinates(strings.TrimSpace(latitude), strings.TrimSpace(longitude)); ok {
+					return lat, lon, pointZoom, true
+				}
+			}
+		}
+	}
+	return 0, 0, 0, false
+}
+
+// geoTitle titles map links with the name of the place they're of.
+func geoTitle(ctx context.Context, irc *Bot, u *url.URL) (string, bool, error) {
+	lat, lon, zoom, ok := mapCoordinates(u)
+	if !ok {
+		return "", false, nil
+	}
+	name, err := irc.reverseGeocode(ctx, lat, lon, zoom)
+	return name, true, err
+}
+
+// reverseGeocode returns the name of the place at a point, in as much
+// detail as a map at the zoom level shows, or "" if there's nothing there
+// (like the open sea).
+func (irc *Bot) reverseGeocode(ctx context.Context, lat, lon float64, zoom int) (string, error) {
+	if err := irc.geocoder.wait(ctx); err != nil {
+		return "", err
+	}
+	query := url.Values{
+		"format": {"jsonv2"},
+		"lat":    {formatCoordinate(lat)},
+		"lon":    {formatCoordinate(lon)},
+		"zoom":   {strconv.Itoa(max(3, min(zoom, pointZoom)))},
+	}
+	if languages := irc.fetcher.AcceptLanguage(ctx); languages != "" {
+		query.Set("accept-language", languages)
+	}
+	var place struct {
+		DisplayName string `json:"display_name"`
+		Error       string `json:"error"`
+	}
+	if err := irc.getJSON(ctx, irc.geocoder.url+"/reverse?"+query.Encode(), &place); err != nil {
+		return "", fmt.Errorf("reverse geocoding: %w", err)
+	}
+	if place.DisplayName == "" && place.Error != "" && !strings.Contains(strings.ToLower(place.Error), "unable to geocode") {
+		return "", errors.New("reverse geocoding: " + place.Error)
+	}
+	return place.DisplayName, nil
+}
@@ -0,0 +1,204 @@
+package wutbot
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"pratyush/wutbot/internal/fetch"
+)
+
+const (
+	// GitHub's own limit is 25 MB, but pushes that big aren't worth announcing in full
+	maxWebhookPayload = 10 << 20
+	// commits listed per push
+	maxPushCommits = 3
+)
+
+type githubUser struct {
+	Login string `json:"login"`
+}
+
+// githubEvent has the fields of the webhook payloads we announce.
+type githubEvent struct {
+	Action     string `json:"action"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+	Sender githubUser `json:"sender"`
+	// push
+	Ref     string `json:"ref"`
+	Created bool   `json:"created"`
+	Deleted bool   `json:"deleted"`
+	Forced  bool   `json:"forced"`
+	Compare string `json:"compare"`
+	Commits []struct {
+		ID      string `json:"id"`
+		Message string `json:"message"`
+		Author  struct {
+			Name string `json:"name"`
+		} `json:"author"`
+	} `json:"commits"`
+	// issues
+	Issue struct {
+		Number  int    `json:"number"`
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+	} `json:"issue"`
+	// pull_request
+	PullRequest struct {
+		Number  int    `json:"number"`
+		Title   string `json:"title"`
+		HTMLURL string `json:"html_url"`
+		Merged  bool   `json:"merged"`
+	} `json:"pull_request"`
+	// release
+	Release struct {
+		TagName string `json:"tag_name"`
+		Name    string `json:"name"`
+		HTMLURL string `json:"html_url"`
+	} `json:"release"`
+}
+
+// validGitHubSignature checks the X-Hub-Signature-256 header, an HMAC of
+// the body keyed with the webhook's secret.
+func validGitHubSignature(secret, header string, body []byte) bool {
+	signature, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return false
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+// formatGitHubEvent returns the lines announcing an event, or nil if it
+// isn't one we announce.
+func formatGitHubEvent(kind string, e *githubEvent) (lines []string) {
+	prefix := "[" + e.Repository.FullName + "] " + e.Sender.Login
+	switch kind {
+	case "push":
+		if tag, ok := strings.CutPrefix(e.Ref, "refs/tags/"); ok {
+			if e.Deleted {
+				return []string{fmt.Sprintf("%s deleted tag %s", prefix, tag)}
+			}
+			return []string{fmt.Sprintf("%s pushed tag %s", prefix, tag)}
+		}
+		branch := strings.TrimPrefix(e.Ref, "refs/heads/")
+		switch {
+		case e.Deleted:
+			return []string{fmt.Sprintf("%s deleted branch %s", prefix, branch)}
+		case len(e.Commits) == 0 && e.Created:
+			return []string{fmt.Sprintf("%s created branch %s", prefix, branch)}
+		case len(e.Commits) == 0:
+			return nil
+		}
+		verb := "pushed"
+		if e.Forced {
+			verb = "force-pushed"
+		}
+		plural := "s"
+		if len(e.Commits) == 1 {
+			plural = ""
+		}
+		lines = append(lines, fmt.Sprintf("%s %s %d commit%s to %s: %s", prefix, verb, len(e.Commits), plural, branch, e.Compare))
+		commits := e.Commits
+		if len(commits) > maxPushCommits {
+			commits = commits[len(commits)-maxPushCommits:]
+		}
+		for _, c := range commits {
+			id := c.ID
+			if len(id) > 7 {
+				id = id[:7]
+			}
+			subject, _, _ := strings.Cut(c.Message, "\n")
+			lines = append(lines, fmt.Sprintf("  %s %s (%s)", id, subject, c.Author.Name))
+		}
+		return
+	case "issues":
+		switch e.Action {
+		case "opened", "closed", "reopened":
+			return []string{fmt.Sprintf("%s %s issue #%d: %s %s", prefix, e.Action, e.Issue.Number, e.Issue.Title, e.Issue.HTMLURL)}
+		}
+	case "pull_request":
+		action := e.Action
+		if action == "closed" && e.PullRequest.Merged {
+			action = "merged"
+		}
+		switch action {
+		case "opened", "closed", "reopened", "merged":
+			return []string{fmt.Sprintf("%s %s pull request #%d: %s %s", prefix, action, e.PullRequest.Number, e.PullRequest.Title, e.PullRequest.HTMLURL)}
+		}
+	case "release":
+		if e.Action == "published" {
+			name := e.Release.Name
+			if name == "" {
+				name = e.Release.TagName
+			}
+			return []string{fmt.Sprintf("%s published release %s %s", prefix, name, e.Release.HTMLURL)}
+		}
+	}
+	return nil
+}
+
+// githubChannels returns the channels a repository's events go to.
+func (irc *Bot) githubChannels(repo string) []string {
+	repos := irc.getConfig().GitHub
+	if channels, ok := repos[strings.ToLower(repo)]; ok {
+		return channels
+	}
+	return repos["*"]
+}
+
+// handleGitHubWebhook receives GitHub webhooks at /github, if
+// WUTBOT_GITHUB_SECRET is set.
+func (irc *Bot) handleGitHubWebhook(secret string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookPayload))
+		if err != nil {
+			http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if !validGitHubSignature(secret, r.Header.Get("X-Hub-Signature-256"), body) {
+			http.Error(w, "invalid signature", http.StatusUnauthorized)
+			return
+		}
+		kind := r.Header.Get("X-GitHub-Event")
+		if kind == "ping" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		var event githubEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			http.Error(w, "invalid payload", http.StatusBadRequest)
+			return
+		}
+		lines := formatGitHubEvent(kind, &event)
+		for i := range lines {
+			lines[i] = fetch.Sanitize(lines[i])
+		}
+		for _, channel := range irc.githubChannels(event.Repository.FullName) {
+			if irc.isQuiet(channel) {
+				continue
+			}
+			for _, line := range lines {
+				irc.Notice(channel, line)
+			}
+		}
+		irc.alert(alertGitHub, event.Repository.FullName, "", lines...)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
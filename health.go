@@ -0,0 +1,108 @@
+package wutbot
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+const (
+	// stuck connecting or registering for this long counts as wedged
+	maxUnregistered = 10 * time.Minute
+)
+
+// healthState tracks registration and server PONGs, for /healthz and /readyz.
+type healthState struct {
+	sync.Mutex
+	registered bool
+	changed    time.Time // when registered last changed
+	lastPong   time.Time
+}
+
+type healthReport struct {
+	Connected  bool     `json:"connected"`
+	Registered bool     `json:"registered"`
+	Server     string   `json:"server,omitempty"`
+	Nick       string   `json:"nick,omitempty"`
+	SincePong  *float64 `json:"seconds-since-pong,omitempty"`
+	Healthy    bool     `json:"healthy"`
+}
+
+func newHealthState() *healthState {
+	return &healthState{changed: time.Now()}
+}
+
+func (irc *Bot) watchHealth() {
+	h := irc.health
+	irc.AddConnectCallback(func(e ircmsg.Message) {
+		h.Lock()
+		h.registered, h.changed, h.lastPong = true, time.Now(), time.Time{}
+		h.Unlock()
+	})
+	irc.AddDisconnectCallback(func(e ircmsg.Message) {
+		h.Lock()
+		h.registered, h.changed = false, time.Now()
+		h.Unlock()
+	})
+	irc.AddCallback("PONG", func(e ircmsg.Message) {
+		h.Lock()
+		h.lastPong = time.Now()
+		h.Unlock()
+	})
+}
+
+func (irc *Bot) healthReport() (report healthReport) {
+	report.Connected = irc.Connected()
+	h := irc.health
+	h.Lock()
+	report.Registered = h.registered
+	changed, lastPong := h.changed, h.lastPong
+	h.Unlock()
+	if report.Registered {
+		report.Server, report.Nick = irc.servers.Current(), irc.CurrentNick()
+	}
+	if !lastPong.IsZero() {
+		since := time.Since(lastPong).Seconds()
+		report.SincePong = &since
+	}
+	// the library pings every KeepAlive and gives up after Timeout more; if it
+	// hasn't heard from the server for longer than that, it's stopped noticing
+	maxQuiet := irc.KeepAlive + 2*irc.Timeout
+	switch {
+	case report.Registered:
+		if lastPong.IsZero() {
+			lastPong = changed
+		}
+		report.Healthy = time.Since(lastPong) < maxQuiet
+	case report.Connected:
+		report.Healthy = time.Since(changed) < maxUnregistered
+	default:
+		// reconnecting, with backoff: restarting wouldn't help
+		report.Healthy = true
+	}
+	return
+}
+
+func writeHealth(w http.ResponseWriter, ok bool, report healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// handleHealthz fails if the connection looks wedged, so that the bot
+// gets restarted.
+func (irc *Bot) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	report := irc.healthReport()
+	writeHealth(w, report.Healthy, report)
+}
+
+// handleReadyz fails unless we're registered with a server.
+func (irc *Bot) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := irc.healthReport()
+	writeHealth(w, report.Registered && report.Healthy, report)
+}
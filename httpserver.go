@@ -0,0 +1,37 @@
+package wutbot
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+const (
+	httpReadTimeout = 30 * time.Second
+)
+
+// serveHTTP runs the optional HTTP listener (WUTBOT_HTTP_LISTEN), for
+// metrics, health checks and webhooks.
+func (irc *Bot) serveHTTP(addr string) {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           irc.httpMux,
+		ReadHeaderTimeout: httpReadTimeout,
+		ReadTimeout:       httpReadTimeout,
+	}
+	go func() {
+		if err := server.ListenAndServe(); err != nil {
+			irc.logger("http").Error("HTTP listener stopped", "err", err)
+		}
+	}()
+}
+
+// handlePprof adds the net/http/pprof handlers to mux (importing the package
+// only adds them to http.DefaultServeMux, which isn't served).
+func handlePprof(mux *http.ServeMux) {
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+}
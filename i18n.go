@@ -0,0 +1,80 @@
+package wutbot
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"pratyush/wutbot/internal/commands"
+)
+
+// Translations are catalogs in locales/<language>.json, mapping the bot's
+// English messages (format strings included, verbs and all) to the
+// language's. Anything missing from a catalog stays in English, so a
+// catalog can be contributed a few messages at a time.
+
+//go:embed locales/*.json
+var localeFiles embed.FS
+
+var (
+	catalogsOnce sync.Once
+	catalogs     map[string]map[string]string
+)
+
+func loadCatalogs() map[string]map[string]string {
+	catalogsOnce.Do(func() {
+		catalogs = make(map[string]map[string]string)
+		files, _ := localeFiles.ReadDir("locales")
+		for _, file := range files {
+			data, err := localeFiles.ReadFile(path.Join("locales", file.Name()))
+			if err != nil {
+				panic(err)
+			}
+			var catalog map[string]string
+			if err := json.Unmarshal(data, &catalog); err != nil {
+				panic(fmt.Sprintf("invalid catalog %s: %v", file.Name(), err))
+			}
+			catalogs[strings.TrimSuffix(file.Name(), ".json")] = catalog
+		}
+	})
+	return catalogs
+}
+
+// languages returns the languages there are catalogs for, and English.
+func languages() []string {
+	result := []string{"en"}
+	for language := range loadCatalogs() {
+		result = append(result, language)
+	}
+	sort.Strings(result[1:])
+	return result
+}
+
+func validateLanguage(language string) error {
+	if language == "" || language == "en" {
+		return nil
+	}
+	if _, ok := loadCatalogs()[language]; !ok {
+		return fmt.Errorf("no translations for %s (have %s)", language, strings.Join(languages(), ", "))
+	}
+	return nil
+}
+
+// translate returns text in the channel's language, if it's been
+// translated.
+func (irc *Bot) translate(channel, text string) string {
+	language := channelOption(irc.getConfig(), channel, func(c ChannelConfig) *string { return c.Language })
+	if translated, ok := loadCatalogs()[language][text]; ok && translated != "" {
+		return translated
+	}
+	return text
+}
+
+// replyf replies to a command in the channel's language.
+func (irc *Bot) replyf(cmd commands.Command, format string, args ...interface{}) {
+	irc.reply(cmd, fmt.Sprintf(irc.translate(cmd.Target, format), args...))
+}
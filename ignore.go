@@ -0,0 +1,228 @@
+package wutbot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"pratyush/wutbot/internal/storage"
+)
+
+const (
+	// keyed by the casefolded account or nick!user@host glob
+	ignoreBucket = "ignores"
+)
+
+type ignoreEntry struct {
+	Pattern string    `json:"pattern"`
+	Added   time.Time `json:"added"`
+	Expires time.Time `json:"expires,omitempty"` // zero for never
+}
+
+// ignoreList is the ignore bucket, kept in memory since every message is
+// checked against it.
+type ignoreList struct {
+	sync.RWMutex
+	entries map[string]ignoreEntry // keyed as in the bucket
+}
+
+func loadIgnoreList(store storage.Store) (*ignoreList, error) {
+	keys, err := store.Keys(ignoreBucket)
+	if err != nil {
+		return nil, err
+	}
+	l := &ignoreList{entries: make(map[string]ignoreEntry, len(keys))}
+	for _, key := range keys {
+		var entry ignoreEntry
+		if found, err := store.Get(ignoreBucket, key, &entry); err != nil {
+			return nil, err
+		} else if found {
+			l.entries[key] = entry
+		}
+	}
+	return l, nil
+}
+
+// match reports whether a source or account is ignored, and which entries
+// have expired.
+func (l *ignoreList) match(source, account string, now time.Time) (ignored bool, expired []string) {
+	l.RLock()
+	defer l.RUnlock()
+	for key, entry := range l.entries {
+		if !entry.Expires.IsZero() && now.After(entry.Expires) {
+			expired = append(expired, key)
+			continue
+		}
+		if isHostmask(entry.Pattern) {
+			if globMatch(entry.Pattern, source) {
+				ignored = true
+			}
+		} else if account != "" && strings.EqualFold(entry.Pattern, account) {
+			ignored = true
+		}
+	}
+	return
+}
+
+func (l *ignoreList) get(key string) (entry ignoreEntry, found bool) {
+	l.RLock()
+	defer l.RUnlock()
+	entry, found = l.entries[key]
+	return
+}
+
+func (l *ignoreList) list() (entries []ignoreEntry) {
+	l.RLock()
+	defer l.RUnlock()
+	for _, entry := range l.entries {
+		entries = append(entries, entry)
+	}
+	return
+}
+
+// addIgnore saves an entry, then ignores it.
+func (irc *Bot) addIgnore(entry ignoreEntry) error {
+	key := strings.ToLower(entry.Pattern)
+	if err := irc.store.Put(ignoreBucket, key, entry); err != nil {
+		return err
+	}
+	irc.ignores.Lock()
+	defer irc.ignores.Unlock()
+	irc.ignores.entries[key] = entry
+	return nil
+}
+
+// removeIgnore deletes an entry, then stops ignoring it.
+func (irc *Bot) removeIgnore(key string) error {
+	if err := irc.store.Delete(ignoreBucket, key); err != nil {
+		return err
+	}
+	irc.ignores.Lock()
+	defer irc.ignores.Unlock()
+	delete(irc.ignores.entries, key)
+	return nil
+}
+
+// isHostmask reports whether an ignore pattern is a hostmask rather than
+// an account.
+func isHostmask(pattern string) bool {
+	return strings.ContainsAny(pattern, "!@")
+}
+
+// globMatch matches s against a pattern where * is any run of characters
+// and ? is any one, ignoring case.
+func globMatch(pattern, s string) bool {
+	pattern, s = strings.ToLower(pattern), strings.ToLower(s)
+	// where to resume after the last *, if the rest doesn't match
+	star, resume := -1, 0
+	p, i := 0, 0
+	for i < len(s) {
+		switch {
+		// before the literal match, as s can have a * in it too
+		case p < len(pattern) && pattern[p] == '*':
+			star, resume = p, i
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			p, i = p+1, i+1
+		case star != -1:
+			resume++
+			p, i = star+1, resume
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// isIgnored reports whether a message's sender is on the ignore list,
+// going by its account tag or its source. The owner never is.
+func (irc *Bot) isIgnored(e ircmsg.Message) bool {
+	if ownerMatches(e, irc.Owner) {
+		return false
+	}
+	_, account := e.GetTag("account")
+	ignored, expired := irc.ignores.match(e.Source, account, time.Now())
+	for _, key := range expired {
+		if err := irc.removeIgnore(key); err != nil {
+			irc.logger("ignore").Error("couldn't delete expired ignore", "pattern", key, "err", err)
+		}
+	}
+	return ignored
+}
+
+// handleIgnoreCommand is the owner's "ignore <account|nick!user@host> [<duration>]";
+// with no arguments, it lists who's ignored.
+func (irc *Bot) handleIgnoreCommand(target string, args []string) {
+	if len(args) == 0 {
+		irc.listIgnores(target)
+		return
+	}
+	if len(args) > 2 {
+		irc.Privmsg(target, "usage: ignore [<account|nick!user@host> [<duration>]]")
+		return
+	}
+	entry := ignoreEntry{Pattern: args[0], Added: time.Now()}
+	if len(args) == 2 {
+		d, err := time.ParseDuration(args[1])
+		if err != nil || d <= 0 {
+			irc.Privmsg(target, fmt.Sprintf("invalid duration: %s", args[1]))
+			return
+		}
+		entry.Expires = entry.Added.Add(d)
+	}
+	if err := irc.addIgnore(entry); err != nil {
+		irc.Privmsg(target, fmt.Sprintf("couldn't save: %v", err))
+		return
+	}
+	if entry.Expires.IsZero() {
+		irc.Privmsg(target, fmt.Sprintf("ignoring %s", entry.Pattern))
+	} else {
+		irc.Privmsg(target, fmt.Sprintf("ignoring %s until %s", entry.Pattern, entry.Expires.UTC().Format(time.RFC3339)))
+	}
+}
+
+// handleUnignoreCommand is the owner's "unignore <account|nick!user@host>".
+func (irc *Bot) handleUnignoreCommand(target string, args []string) {
+	if len(args) != 1 {
+		irc.Privmsg(target, "usage: unignore <account|nick!user@host>")
+		return
+	}
+	key := strings.ToLower(args[0])
+	if _, found := irc.ignores.get(key); !found {
+		irc.Privmsg(target, fmt.Sprintf("%s isn't ignored", args[0]))
+		return
+	}
+	if err := irc.removeIgnore(key); err != nil {
+		irc.Privmsg(target, fmt.Sprintf("couldn't delete: %v", err))
+		return
+	}
+	irc.Privmsg(target, "done")
+}
+
+func (irc *Bot) listIgnores(target string) {
+	var lines []string
+	now := time.Now()
+	for _, entry := range irc.ignores.list() {
+		if !entry.Expires.IsZero() && now.After(entry.Expires) {
+			continue
+		}
+		if entry.Expires.IsZero() {
+			lines = append(lines, entry.Pattern)
+		} else {
+			lines = append(lines, fmt.Sprintf("%s (for %v)", entry.Pattern, entry.Expires.Sub(now).Round(time.Minute)))
+		}
+	}
+	sort.Strings(lines)
+	if len(lines) == 0 {
+		irc.Privmsg(target, "nobody is ignored")
+		return
+	}
+	irc.Privmsg(target, strings.Join(lines, ", "))
+}
@@ -0,0 +1,78 @@
+package wutbot
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"pratyush/wutbot/internal/storage"
+)
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"*!*@example.com", "nick!user@example.com", true},
+		{"*!*@example.com", "nick!user@example.org", false},
+		{"NICK!?ser@*", "nick!user@host", true},
+		{"*a", "*ba", true},
+		{"*!*@*.example.com", "*!*@host.example.com", true},
+		{"a*", "*a", false},
+		{"*", "", true},
+		{"?", "", false},
+	}
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestIgnoreList(t *testing.T) {
+	store, err := storage.OpenSQLite(filepath.Join(t.TempDir(), "wutbot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	store.Put(ignoreBucket, "*!*@spam.example", ignoreEntry{Pattern: "*!*@spam.example"})
+	store.Put(ignoreBucket, "lapsed", ignoreEntry{Pattern: "lapsed", Expires: time.Now().Add(-time.Minute)})
+	ignores, err := loadIgnoreList(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	irc := &Bot{store: store, ignores: ignores, baseLogger: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	message := func(source, account string) ircmsg.Message {
+		tags := map[string]string{}
+		if account != "" {
+			tags["account"] = account
+		}
+		return ircmsg.MakeMessage(tags, source, "PRIVMSG", "#chan", "hi")
+	}
+
+	if !irc.isIgnored(message("bot!bot@spam.example", "")) {
+		t.Error("a loaded hostmask wasn't ignored")
+	}
+	if irc.isIgnored(message("nick!user@host", "lapsed")) {
+		t.Error("an expired account was ignored")
+	}
+	if found, _ := store.Get(ignoreBucket, "lapsed", new(ignoreEntry)); found {
+		t.Error("the expired entry wasn't deleted")
+	}
+	if err := irc.addIgnore(ignoreEntry{Pattern: "Troll"}); err != nil {
+		t.Fatal(err)
+	}
+	if !irc.isIgnored(message("nick!user@host", "troll")) {
+		t.Error("an added account wasn't ignored")
+	}
+	if err := irc.removeIgnore("troll"); err != nil {
+		t.Fatal(err)
+	}
+	if irc.isIgnored(message("nick!user@host", "troll")) {
+		t.Error("a removed account was still ignored")
+	}
+}
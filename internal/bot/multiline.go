@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+const (
+	MultilineCap       = "draft/multiline"
+	multilineBatchType = "draft/multiline"
+	multilineConcatTag = "draft/multiline-concat"
+)
+
+// MultilineLimits are the limits a server puts on draft/multiline batches.
+type MultilineLimits struct {
+	MaxBytes int
+	MaxLines int // 0 if there's no limit
+}
+
+// ParseMultilineLimits returns the draft/multiline limits from the acked
+// caps, or ok=false if the cap isn't available.
+func ParseMultilineLimits(acked map[string]string) (limits MultilineLimits, ok bool) {
+	value, present := acked[MultilineCap]
+	if !present {
+		return
+	}
+	if _, hasBatch := acked["batch"]; !hasBatch {
+		return
+	}
+	for _, token := range strings.Split(value, ",") {
+		key, val, _ := strings.Cut(token, "=")
+		n, err := strconv.Atoi(val)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "max-bytes":
+			limits.MaxBytes = n
+		case "max-lines":
+			limits.MaxLines = n
+		}
+	}
+	// max-bytes is mandatory
+	return limits, limits.MaxBytes != 0
+}
+
+// Batch wraps the pieces of a long message in a draft/multiline batch
+// with the given ID, returning nil if it won't fit within the limits.
+// Pieces after the first are marked for concatenation, since they're
+// split from a single line of text.
+func (l MultilineLimits) Batch(batchID string, tags map[string]string, command, target string, pieces []string) []ircmsg.Message {
+	total := 0
+	for i, piece := range pieces {
+		total += len(piece)
+		if i != 0 {
+			// the space it's sent with
+			total++
+		}
+	}
+	if total > l.MaxBytes || (l.MaxLines != 0 && len(pieces) > l.MaxLines) {
+		return nil
+	}
+
+	messages := []ircmsg.Message{ircmsg.MakeMessage(tags, "", "BATCH", "+"+batchID, multilineBatchType, target)}
+	for i, piece := range pieces {
+		lineTags := map[string]string{"batch": batchID}
+		if i != 0 {
+			lineTags[multilineConcatTag] = ""
+			// the concatenated text needs the whitespace we split on
+			piece = " " + piece
+		}
+		messages = append(messages, ircmsg.MakeMessage(lineTags, "", command, target, piece))
+	}
+	return append(messages, ircmsg.MakeMessage(nil, "", "BATCH", "-"+batchID))
+}
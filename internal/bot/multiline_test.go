@@ -0,0 +1,56 @@
+package bot
+
+import (
+	"testing"
+)
+
+func TestParseMultilineLimits(t *testing.T) {
+	tests := []struct {
+		acked  map[string]string
+		limits MultilineLimits
+		ok     bool
+	}{
+		{map[string]string{"batch": "", MultilineCap: "max-bytes=4096,max-lines=24"}, MultilineLimits{4096, 24}, true},
+		{map[string]string{"batch": "", MultilineCap: "max-bytes=4096"}, MultilineLimits{4096, 0}, true},
+		{map[string]string{"batch": "", MultilineCap: "max-lines=24"}, MultilineLimits{0, 24}, false},
+		// it needs batches too
+		{map[string]string{MultilineCap: "max-bytes=4096"}, MultilineLimits{}, false},
+		{map[string]string{"batch": ""}, MultilineLimits{}, false},
+	}
+	for _, tt := range tests {
+		if limits, ok := ParseMultilineLimits(tt.acked); limits != tt.limits || ok != tt.ok {
+			t.Errorf("%v: got %+v, %v", tt.acked, limits, ok)
+		}
+	}
+}
+
+func TestMultilineBatch(t *testing.T) {
+	limits := MultilineLimits{MaxBytes: 10, MaxLines: 2}
+	batch := limits.Batch("b1", map[string]string{"+draft/reply": "id"}, "PRIVMSG", "#chan", []string{"01234", "5678"})
+	if len(batch) != 4 {
+		t.Fatalf("%d messages", len(batch))
+	}
+	if open := batch[0]; open.Command != "BATCH" || open.Params[0] != "+b1" || open.Params[2] != "#chan" {
+		t.Errorf("opened with %v", open)
+	} else if _, reply := open.GetTag("+draft/reply"); reply != "id" {
+		t.Error("the opening BATCH doesn't have the tags")
+	}
+	if concat, _ := batch[1].GetTag(multilineConcatTag); concat {
+		t.Error("the first line is marked for concatenation")
+	}
+	if second := batch[2]; second.Params[1] != " 5678" {
+		t.Errorf("second line %q", second.Params[1])
+	} else if concat, _ := second.GetTag(multilineConcatTag); !concat {
+		t.Error("the second line isn't marked for concatenation")
+	}
+	if close := batch[3]; close.Command != "BATCH" || close.Params[0] != "-b1" {
+		t.Errorf("closed with %v", close)
+	}
+
+	if batch := limits.Batch("b2", nil, "PRIVMSG", "#chan", []string{"01234", "56789"}); batch != nil {
+		t.Error("batched more than max-bytes")
+	}
+	if batch := limits.Batch("b3", nil, "PRIVMSG", "#chan", []string{"0", "1", "2"}); batch != nil {
+		t.Error("batched more than max-lines")
+	}
+}
@@ -0,0 +1,188 @@
+// Package bot is the bot's IRC plumbing that doesn't need a connection:
+// pacing what it sends, and fitting long messages into IRC lines.
+package bot
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+const (
+	// defaults are conservative enough for traditional ircd flood limits
+	// (roughly one line every two seconds after a short burst)
+	DefaultFloodBurst    = 5
+	DefaultFloodInterval = 2 * time.Second
+
+	sendQueueSize = 256
+)
+
+// RateLimitTokens are the ISUPPORT tokens a server can advertise its flood
+// limit with, as <lines>/<seconds>, e.g. RATELIMIT=5/10.
+var RateLimitTokens = []string{"RATELIMIT", "draft/RATELIMIT"}
+
+// A Sender writes a message to the connection.
+type Sender interface {
+	Send(msg ircmsg.Message) error
+}
+
+// SenderFunc lets a function be a Sender.
+type SenderFunc func(msg ircmsg.Message) error
+
+func (f SenderFunc) Send(msg ircmsg.Message) error {
+	return f(msg)
+}
+
+type empty struct{}
+
+// SendQueue paces outgoing messages with a token bucket, so that a burst
+// of replies doesn't get the bot disconnected for excess flood.
+type SendQueue struct {
+	// a multiline batch is queued (and paced) as a single unit
+	messages chan []ircmsg.Message
+	flush    chan empty
+	pending  int32 // units queued or being sent
+
+	mu sync.Mutex
+	// what the config asks for, which overrides what the server advertises
+	configBurst    int
+	configInterval time.Duration
+	burst          int
+	interval       time.Duration // time to regain one token
+}
+
+// NewSendQueue makes a queue allowing burst lines at once, then one every
+// interval; either can be 0 to use the server's limit or the default.
+func NewSendQueue(burst int, interval time.Duration) *SendQueue {
+	q := &SendQueue{
+		messages:       make(chan []ircmsg.Message, sendQueueSize),
+		flush:          make(chan empty, 1),
+		configBurst:    burst,
+		configInterval: interval,
+	}
+	q.SetServerRate(0, 0)
+	return q
+}
+
+// SetServerRate applies the server's advertised flood limit, or forgets
+// it if burst is 0.
+func (q *SendQueue) SetServerRate(burst int, interval time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.burst, q.interval = q.configBurst, q.configInterval
+	if q.burst <= 0 {
+		q.burst = burst
+	}
+	if q.interval <= 0 {
+		q.interval = interval
+	}
+	if q.burst <= 0 {
+		q.burst = DefaultFloodBurst
+	}
+	if q.interval <= 0 {
+		q.interval = DefaultFloodInterval
+	}
+}
+
+// Rate is the current burst, and the time it takes to regain each line.
+func (q *SendQueue) Rate() (burst int, interval time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.burst, q.interval
+}
+
+// ParseRateLimit parses a rate limit token's <lines>/<seconds> value into
+// a burst of lines, and the time it takes to regain each.
+func ParseRateLimit(value string) (burst int, interval time.Duration, ok bool) {
+	lines, seconds, found := strings.Cut(value, "/")
+	if !found {
+		return 0, 0, false
+	}
+	burst, err := strconv.Atoi(lines)
+	if err != nil || burst <= 0 {
+		return 0, 0, false
+	}
+	period, err := strconv.ParseFloat(seconds, 64)
+	if err != nil || period <= 0 {
+		return 0, 0, false
+	}
+	return burst, time.Duration(period * float64(time.Second) / float64(burst)), true
+}
+
+// Enqueue queues a unit of messages to be sent together. It never blocks,
+// since it's called from ircevent callbacks.
+func (q *SendQueue) Enqueue(unit []ircmsg.Message) error {
+	select {
+	case q.messages <- unit:
+		atomic.AddInt32(&q.pending, 1)
+		return nil
+	default:
+		return fmt.Errorf("send queue is full, dropping %s %s", unit[0].Command, strings.Join(unit[0].Params, " "))
+	}
+}
+
+// Discard drops any queued messages, e.g. after a disconnect.
+func (q *SendQueue) Discard() {
+	select {
+	case q.flush <- empty{}:
+	default:
+	}
+}
+
+// Wait waits up to timeout for everything queued to be sent.
+func (q *SendQueue) Wait(timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+	for atomic.LoadInt32(&q.pending) > 0 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Run sends what's queued through s, at the queue's rate, forever.
+func (q *SendQueue) Run(s Sender, logger *slog.Logger) {
+	tokens, _ := q.Rate()
+	lastRefill := time.Now()
+	for {
+		var unit []ircmsg.Message
+		select {
+		case unit = <-q.messages:
+		case <-q.flush:
+			for drained := false; !drained; {
+				select {
+				case <-q.messages:
+					atomic.AddInt32(&q.pending, -1)
+				default:
+					drained = true
+				}
+			}
+			continue
+		}
+		// the server's limit can change under us when we reconnect
+		burst, interval := q.Rate()
+		if gained := int(time.Since(lastRefill) / interval); gained > 0 {
+			tokens += gained
+			lastRefill = lastRefill.Add(time.Duration(gained) * interval)
+		}
+		if tokens >= burst {
+			tokens = burst
+			lastRefill = time.Now()
+		}
+		if tokens == 0 {
+			time.Sleep(time.Until(lastRefill.Add(interval)))
+			lastRefill = lastRefill.Add(interval)
+		} else {
+			tokens--
+		}
+		for _, msg := range unit {
+			if err := s.Send(msg); err != nil {
+				logger.Debug("couldn't send queued message", "err", err)
+			}
+		}
+		atomic.AddInt32(&q.pending, -1)
+	}
+}
@@ -0,0 +1,107 @@
+package bot
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+func TestParseRateLimit(t *testing.T) {
+	tests := []struct {
+		value    string
+		burst    int
+		interval time.Duration
+		ok       bool
+	}{
+		{"5/10", 5, 2 * time.Second, true},
+		{"4/1", 4, 250 * time.Millisecond, true},
+		{"10/2.5", 10, 250 * time.Millisecond, true},
+		{"5", 0, 0, false},
+		{"0/10", 0, 0, false},
+		{"5/0", 0, 0, false},
+		{"five/10", 0, 0, false},
+	}
+	for _, tt := range tests {
+		burst, interval, ok := ParseRateLimit(tt.value)
+		if burst != tt.burst || interval != tt.interval || ok != tt.ok {
+			t.Errorf("%q: got %d, %v, %v; want %d, %v, %v", tt.value, burst, interval, ok, tt.burst, tt.interval, tt.ok)
+		}
+	}
+}
+
+// recorder is a Sender that keeps what it's sent, and when.
+type recorder struct {
+	sync.Mutex
+	sent  []string
+	times []time.Time
+}
+
+func (r *recorder) Send(msg ircmsg.Message) error {
+	line, err := msg.LineBytesStrict(false, 512)
+	r.Lock()
+	defer r.Unlock()
+	r.sent = append(r.sent, strings.TrimSpace(string(line)))
+	r.times = append(r.times, time.Now())
+	return err
+}
+
+func (r *recorder) lines() []string {
+	r.Lock()
+	defer r.Unlock()
+	return append([]string(nil), r.sent...)
+}
+
+func TestSendQueuePacing(t *testing.T) {
+	q := NewSendQueue(2, 50*time.Millisecond)
+	r := new(recorder)
+	go q.Run(r, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	for _, text := range []string{"one", "two", "three"} {
+		if err := q.Enqueue([]ircmsg.Message{ircmsg.MakeMessage(nil, "", "PRIVMSG", "#chan", text)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a batch goes out together, for a single token
+	batch := MultilineLimits{MaxBytes: 100}.Batch("1", nil, "PRIVMSG", "#chan", []string{"four", "five"})
+	if err := q.Enqueue(batch); err != nil {
+		t.Fatal(err)
+	}
+	q.Wait(5 * time.Second)
+
+	lines := r.lines()
+	if len(lines) != 7 || lines[0] != "PRIVMSG #chan one" || lines[2] != "PRIVMSG #chan three" {
+		t.Fatalf("sent %q", lines)
+	}
+	r.Lock()
+	defer r.Unlock()
+	if burst := r.times[1].Sub(r.times[0]); burst > 25*time.Millisecond {
+		t.Errorf("the burst took %v", burst)
+	}
+	if waited := r.times[2].Sub(r.times[1]); waited < 40*time.Millisecond {
+		t.Errorf("the third line was sent after %v, with no tokens left", waited)
+	}
+	if waited := r.times[3].Sub(r.times[2]); waited < 40*time.Millisecond {
+		t.Errorf("the batch was sent after %v", waited)
+	}
+	if together := r.times[6].Sub(r.times[3]); together > 25*time.Millisecond {
+		t.Errorf("the batch was spread over %v", together)
+	}
+}
+
+func TestSendQueueFull(t *testing.T) {
+	q := NewSendQueue(0, 0)
+	msg := []ircmsg.Message{ircmsg.MakeMessage(nil, "", "PRIVMSG", "#chan", "hello")}
+	for i := 0; i < sendQueueSize; i++ {
+		if err := q.Enqueue(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.Enqueue(msg); err == nil {
+		t.Error("enqueued past the queue's size")
+	}
+}
@@ -0,0 +1,88 @@
+package bot
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// RFC 1459 line limit, including the trailing CRLF (tags don't count)
+	maxLineBytes = 512
+	// the server prepends our :nick!user@host when relaying; we don't know
+	// the exact user@host, so assume the longest usual lengths
+	maxUserLen = 10
+	maxHostLen = 63
+
+	// MaxSplitLines is how many lines SplitForSending keeps; longer outputs
+	// are truncated rather than flooding the channel
+	MaxSplitLines = 4
+)
+
+// MaxMessageBytes is how much text fits in a single PRIVMSG or NOTICE to
+// target once the server relays it with nick's source prefix.
+func MaxMessageBytes(nick, command, target string) int {
+	prefix := len(":") + len(nick) + len("!") + maxUserLen + len("@") + maxHostLen + len(" ")
+	overhead := prefix + len(command) + len(" ") + len(target) + len(" :") + len("\r\n")
+	return maxLineBytes - overhead
+}
+
+// SplitMessage splits text into lines of at most maxBytes bytes, breaking at
+// whitespace where possible and never inside a UTF-8 sequence. Invalid
+// UTF-8 is replaced first, so there's always somewhere to break.
+func SplitMessage(text string, maxBytes int) (lines []string) {
+	if maxBytes <= 0 {
+		return []string{text}
+	}
+	text = strings.ToValidUTF8(text, "\uFFFD")
+	var line strings.Builder
+	flush := func() {
+		if line.Len() != 0 {
+			lines = append(lines, line.String())
+			line.Reset()
+		}
+	}
+	for _, word := range strings.Fields(text) {
+		for len(word) > maxBytes {
+			// a single word that can't fit on any line: hard-wrap it
+			flush()
+			cut := maxBytes
+			for cut > 0 && !utf8.RuneStart(word[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				// a rune longer than a line: it goes on one by itself
+				_, cut = utf8.DecodeRuneInString(word)
+			}
+			lines = append(lines, word[:cut])
+			word = word[cut:]
+		}
+		if line.Len() != 0 && line.Len()+1+len(word) > maxBytes {
+			flush()
+		}
+		if line.Len() != 0 {
+			line.WriteByte(' ')
+		}
+		line.WriteString(word)
+	}
+	flush()
+	return
+}
+
+// SplitForSending splits text into lines of at most maxBytes, truncating
+// it to MaxSplitLines.
+func SplitForSending(text string, maxBytes int) []string {
+	if len(text) <= maxBytes {
+		return []string{text}
+	}
+	lines := SplitMessage(text, maxBytes)
+	if len(lines) > MaxSplitLines {
+		lines = lines[:MaxSplitLines]
+		last := lines[MaxSplitLines-1]
+		for len(last)+len("…") > maxBytes {
+			_, size := utf8.DecodeLastRuneInString(last)
+			last = last[:len(last)-size]
+		}
+		lines[MaxSplitLines-1] = last + "…"
+	}
+	return lines
+}
@@ -0,0 +1,51 @@
+package bot
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	tests := []struct {
+		text     string
+		maxBytes int
+		want     []string
+	}{
+		{"hello world", 20, []string{"hello world"}},
+		{"hello  there world", 11, []string{"hello there", "world"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		// never inside a rune
+		{"ééé", 3, []string{"é", "é", "é"}},
+		{"x\xffy", 3, []string{"x", "�", "y"}},
+		{"text", 0, []string{"text"}},
+	}
+	for _, tt := range tests {
+		if got := SplitMessage(tt.text, tt.maxBytes); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitMessage(%q, %d) = %q, want %q", tt.text, tt.maxBytes, got, tt.want)
+		}
+	}
+}
+
+func TestSplitForSending(t *testing.T) {
+	if lines := SplitForSending("short", 10); !reflect.DeepEqual(lines, []string{"short"}) {
+		t.Errorf("short: %q", lines)
+	}
+	lines := SplitForSending(strings.Repeat("word ", 50), 12)
+	if len(lines) != MaxSplitLines {
+		t.Fatalf("%d lines", len(lines))
+	}
+	last := lines[len(lines)-1]
+	if !strings.HasSuffix(last, "…") || len(last) > 12 || !utf8.ValidString(last) {
+		t.Errorf("last line %q", last)
+	}
+}
+
+func TestMaxMessageBytes(t *testing.T) {
+	// :wutbot!<10>@<63> PRIVMSG #chan :<text>\r\n
+	want := 512 - (1 + 6 + 1 + 10 + 1 + 63 + 1) - (7 + 1 + 5 + 2 + 2)
+	if got := MaxMessageBytes("wutbot", "PRIVMSG", "#chan"); got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+}
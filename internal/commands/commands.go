@@ -0,0 +1,82 @@
+// Package commands parses the `!command arg1 arg2` messages sent to
+// channels, and dispatches them to handlers by name.
+package commands
+
+import (
+	"strings"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+// Prefix starts a command.
+const Prefix = "!"
+
+// Command is a parsed command sent to a channel.
+type Command struct {
+	Name    string
+	Args    []string
+	Target  string
+	Nick    string
+	Account string // empty if the sender isn't logged in
+	MsgID   string
+}
+
+// Split returns the lowercased name and the arguments of the command in
+// text, if it is one.
+func Split(text string) (name string, args []string, ok bool) {
+	if !strings.HasPrefix(text, Prefix) {
+		return "", nil, false
+	}
+	args = SplitArgs(strings.TrimPrefix(text, Prefix))
+	if len(args) == 0 {
+		return "", nil, false
+	}
+	return strings.ToLower(args[0]), args[1:], true
+}
+
+// Parse parses message, sent to target by e's source, if it's a command.
+func Parse(e ircmsg.Message, target, msgid, message string) (cmd Command, ok bool) {
+	name, args, ok := Split(message)
+	if !ok {
+		return
+	}
+	_, account := e.GetTag("account")
+	if account == "*" {
+		account = ""
+	}
+	return Command{
+		Name:    name,
+		Args:    args,
+		Target:  target,
+		Nick:    e.Nick(),
+		Account: account,
+		MsgID:   msgid,
+	}, true
+}
+
+// SplitArgs splits on whitespace, except that double-quoted strings
+// are kept together (without the quotes).
+func SplitArgs(s string) (result []string) {
+	var buf strings.Builder
+	inQuotes, inArg := false, false
+	for _, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+			inArg = true
+		case !inQuotes && (r == ' ' || r == '\t'):
+			if inArg {
+				result = append(result, buf.String())
+				buf.Reset()
+				inArg = false
+			}
+		default:
+			buf.WriteRune(r)
+			inArg = true
+		}
+	}
+	if inArg {
+		result = append(result, buf.String())
+	}
+	return
+}
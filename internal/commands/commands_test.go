@@ -0,0 +1,72 @@
+package commands
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"", nil},
+		{"poll  yes\tno ", []string{"poll", "yes", "no"}},
+		{`poll "pizza or pasta?" "yes, pizza" no`, []string{"poll", "pizza or pasta?", "yes, pizza", "no"}},
+		{`say ""`, []string{"say", ""}},
+		{`say "unterminated quote`, []string{"say", "unterminated quote"}},
+	}
+	for _, tt := range tests {
+		if got := SplitArgs(tt.s); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("SplitArgs(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	e, err := ircmsg.ParseLine("@account=alice :alice!a@example.com PRIVMSG #chan :!Trivia start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, ok := Parse(e, "#chan", "id1", "!Trivia start")
+	want := Command{Name: "trivia", Args: []string{"start"}, Target: "#chan", Nick: "alice", Account: "alice", MsgID: "id1"}
+	if !ok || !reflect.DeepEqual(cmd, want) {
+		t.Errorf("Parse = %+v, %v, want %+v", cmd, ok, want)
+	}
+
+	// logged out
+	e.SetTag("account", "*")
+	if cmd, _ := Parse(e, "#chan", "", "!time"); cmd.Account != "" {
+		t.Errorf("account %q", cmd.Account)
+	}
+	for _, message := range []string{"trivia", "!", "! ", ""} {
+		if _, ok := Parse(e, "#chan", "", message); ok {
+			t.Errorf("%q parsed as a command", message)
+		}
+	}
+}
+
+func TestMux(t *testing.T) {
+	var mux Mux
+	var ran []string
+	mux.HandleFunc(func(cmd Command) { ran = append(ran, "poll "+cmd.Args[0]) }, "poll")
+	mux.HandleFunc(func(cmd Command) { ran = append(ran, cmd.Name) }, "kick", "ban")
+
+	for _, cmd := range []Command{{Name: "poll", Args: []string{"close"}}, {Name: "ban"}, {Name: "unknown"}} {
+		if ok := mux.Dispatch(cmd); ok != (cmd.Name != "unknown") {
+			t.Errorf("Dispatch(%s) = %v", cmd.Name, ok)
+		}
+	}
+	if !reflect.DeepEqual(ran, []string{"poll close", "ban"}) {
+		t.Errorf("ran %q", ran)
+	}
+
+	// a later registration replaces an earlier one
+	mux.HandleFunc(func(cmd Command) { ran = append(ran, "replaced") }, "kick")
+	mux.Dispatch(Command{Name: "kick"})
+	if ran[len(ran)-1] != "replaced" {
+		t.Errorf("ran %q", ran)
+	}
+}
@@ -0,0 +1,45 @@
+package commands
+
+// A Handler runs the commands it's registered for.
+type Handler interface {
+	HandleCommand(cmd Command)
+}
+
+// HandlerFunc lets a function be a Handler.
+type HandlerFunc func(cmd Command)
+
+func (f HandlerFunc) HandleCommand(cmd Command) {
+	f(cmd)
+}
+
+// Mux dispatches commands to the handlers registered for their names. The
+// zero value is ready to use; register everything before dispatching.
+type Mux struct {
+	handlers map[string]Handler
+}
+
+// Handle registers h for each of names, replacing any handler registered
+// for them before.
+func (m *Mux) Handle(h Handler, names ...string) {
+	if m.handlers == nil {
+		m.handlers = make(map[string]Handler)
+	}
+	for _, name := range names {
+		m.handlers[name] = h
+	}
+}
+
+// HandleFunc registers f for each of names.
+func (m *Mux) HandleFunc(f func(cmd Command), names ...string) {
+	m.Handle(HandlerFunc(f), names...)
+}
+
+// Dispatch runs cmd's handler, returning false if there isn't one.
+func (m *Mux) Dispatch(cmd Command) bool {
+	h, ok := m.handlers[cmd.Name]
+	if !ok {
+		return false
+	}
+	h.HandleCommand(cmd)
+	return true
+}
@@ -0,0 +1,128 @@
+// Package cron parses and matches crontab-style schedules.
+package cron
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	months   = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// Schedule is a parsed five-field crontab schedule, each field a bitset.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// as in cron, if both day fields are restricted, either may match
+	domStar, dowStar bool
+}
+
+// Parse parses a crontab schedule ("minute hour day month weekday"), with
+// names for months and weekdays, and macros like "@daily".
+func Parse(spec string) (*Schedule, error) {
+	if macro, ok := macros[strings.ToLower(spec)]; ok {
+		spec = macro
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("a schedule needs five fields (minute hour day month weekday)")
+	}
+	s := new(Schedule)
+	var err error
+	if s.minute, err = parseField(fields[0], 0, 59, nil); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(fields[1], 0, 23, nil); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(fields[2], 1, 31, nil); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(fields[3], 1, 12, months); err != nil {
+		return nil, err
+	}
+	// 7 is also Sunday
+	if s.dow, err = parseField(fields[4], 0, 7, weekdays); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	s.domStar, s.dowStar = fields[2] == "*", fields[4] == "*"
+	return s, nil
+}
+
+// parseField parses a comma-separated list of values, ranges ("1-5")
+// and steps ("*/15", "0-30/10"); names are values from min.
+func parseField(field string, min, max int, names []string) (bits uint64, err error) {
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(s, name) {
+				return min + i, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("invalid value %q in schedule (%d-%d)", s, min, max)
+		}
+		return n, nil
+	}
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			if step, err = strconv.Atoi(stepPart); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q in schedule", stepPart)
+			}
+		}
+		lo, hi := min, max
+		if rangePart != "*" {
+			first, last, isRange := strings.Cut(rangePart, "-")
+			if lo, err = value(first); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = value(last); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// "5/15" means from 5 to the end
+				hi = max
+			}
+			if hi < lo {
+				return 0, fmt.Errorf("invalid range %q in schedule", rangePart)
+			}
+		}
+		for i := lo; i <= hi; i += step {
+			bits |= 1 << i
+		}
+	}
+	return bits, nil
+}
+
+// Matches reports whether the schedule fires at t's minute.
+func (s *Schedule) Matches(t time.Time) bool {
+	has := func(bits uint64, n int) bool { return bits&(1<<n) != 0 }
+	if !has(s.minute, t.Minute()) || !has(s.hour, t.Hour()) || !has(s.month, int(t.Month())) {
+		return false
+	}
+	dom, dow := has(s.dom, t.Day()), has(s.dow, int(t.Weekday()))
+	if !s.domStar && !s.dowStar {
+		return dom || dow
+	}
+	return dom && dow
+}
@@ -0,0 +1,72 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"* * * foo *",
+		"@sometimes",
+	} {
+		if _, err := Parse(spec); err == nil {
+			t.Errorf("Parse(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	// a Monday
+	monday := time.Date(2024, time.January, 15, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		t    time.Time
+		want bool
+	}{
+		{"* * * * *", monday, true},
+		{"30 9 * * *", monday, true},
+		{"31 9 * * *", monday, false},
+		{"*/15 * * * *", monday, true},
+		{"*/20 * * * *", monday, false},
+		{"0-30/10 9-17 * * *", monday, true},
+		{"5/25 * * * *", monday, true}, // 5, 30, 55
+		{"30 9 * * mon-fri", monday, true},
+		{"30 9 * * sat,sun", monday, false},
+		{"30 9 * jan *", monday, true},
+		{"30 9 * FEB *", monday, false},
+		{"30 9 * * 7", monday.AddDate(0, 0, 6), true}, // 7 is Sunday too
+		// with both day fields restricted, either matches
+		{"30 9 1 * mon", monday, true},
+		{"30 9 15 * sun", monday, true},
+		{"30 9 1 * sun", monday, false},
+		// with one, it alone decides
+		{"30 9 1 * *", monday, false},
+		{"30 9 * * 1", monday, true},
+		{"@hourly", monday, false},
+		{"@hourly", monday.Add(30 * time.Minute), true},
+		{"@daily", time.Date(2024, time.March, 3, 0, 0, 0, 0, time.UTC), true},
+		{"@yearly", time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC), true},
+		{"@yearly", time.Date(2025, time.January, 2, 0, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.spec)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := s.Matches(tt.t); got != tt.want {
+			t.Errorf("%q matches %v = %v, want %v", tt.spec, tt.t, got, tt.want)
+		}
+	}
+}
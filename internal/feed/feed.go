@@ -0,0 +1,84 @@
+// Package feed parses RSS and Atom feeds.
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// Entry is an item of an RSS feed or an entry of an Atom feed.
+type Entry struct {
+	ID    string
+	Title string
+	Link  string
+}
+
+// Parse reads an RSS (0.9x, 1.0 or 2.0) or Atom feed, returning its
+// entries in the feed's order (usually newest first).
+func Parse(r io.Reader) (title string, entries []Entry, err error) {
+	var doc struct {
+		XMLName xml.Name
+		// RSS 2.0
+		Channel struct {
+			Title string    `xml:"title"`
+			Items []rssItem `xml:"item"`
+		} `xml:"channel"`
+		// RSS 1.0 puts the items beside the channel
+		Items []rssItem `xml:"item"`
+		// Atom
+		Title   string `xml:"title"`
+		Entries []struct {
+			ID    string `xml:"id"`
+			Title string `xml:"title"`
+			Links []struct {
+				Href string `xml:"href,attr"`
+				Rel  string `xml:"rel,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	dec := xml.NewDecoder(r)
+	dec.CharsetReader = charset.NewReaderLabel
+	dec.Strict = false
+	if err = dec.Decode(&doc); err != nil {
+		return
+	}
+	switch strings.ToLower(doc.XMLName.Local) {
+	case "rss", "rdf":
+		title = doc.Channel.Title
+		for _, item := range append(doc.Channel.Items, doc.Items...) {
+			entry := Entry{ID: item.GUID, Title: item.Title, Link: item.Link}
+			if entry.ID == "" {
+				entry.ID = item.Link + " " + item.Title
+			}
+			entries = append(entries, entry)
+		}
+	case "feed":
+		title = doc.Title
+		for _, e := range doc.Entries {
+			entry := Entry{ID: e.ID, Title: e.Title}
+			for _, link := range e.Links {
+				if link.Rel == "" || link.Rel == "alternate" {
+					entry.Link = link.Href
+					break
+				}
+			}
+			if entry.ID == "" {
+				entry.ID = entry.Link + " " + entry.Title
+			}
+			entries = append(entries, entry)
+		}
+	default:
+		err = fmt.Errorf("not a feed: <%s>", doc.XMLName.Local)
+	}
+	return
+}
+
+type rssItem struct {
+	GUID  string `xml:"guid"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
@@ -0,0 +1,61 @@
+package feed
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name, doc string
+		title     string
+		entries   []Entry
+	}{
+		{"RSS 2.0", `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>News</title>
+<item><guid>1</guid><title>First</title><link>https://example.com/1</link></item>
+<item><title>Second</title><link>https://example.com/2</link></item>
+</channel></rss>`, "News", []Entry{
+			{ID: "1", Title: "First", Link: "https://example.com/1"},
+			{ID: "https://example.com/2 Second", Title: "Second", Link: "https://example.com/2"},
+		}},
+		{"RSS 1.0", `<?xml version="1.0"?>
+<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/">
+<channel><title>Old news</title></channel>
+<item><title>Item</title><link>https://example.com/item</link></item>
+</rdf:RDF>`, "Old news", []Entry{
+			{ID: "https://example.com/item Item", Title: "Item", Link: "https://example.com/item"},
+		}},
+		{"Atom", `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom"><title>Blog</title>
+<entry><id>tag:example.com,2024:1</id><title>Post</title>
+<link rel="edit" href="https://example.com/edit/1"/><link href="https://example.com/post"/></entry>
+</feed>`, "Blog", []Entry{
+			{ID: "tag:example.com,2024:1", Title: "Post", Link: "https://example.com/post"},
+		}},
+		{"Latin-1", "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n<rss><channel><title>Caf\xe9</title></channel></rss>", "Café", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			title, entries, err := Parse(strings.NewReader(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if title != tt.title {
+				t.Errorf("title = %q, want %q", title, tt.title)
+			}
+			if !reflect.DeepEqual(entries, tt.entries) {
+				t.Errorf("entries = %+v, want %+v", entries, tt.entries)
+			}
+		})
+	}
+}
+
+func TestParseNotAFeed(t *testing.T) {
+	for _, doc := range []string{"<html><body>hi</body></html>", "not even XML", ""} {
+		if _, _, err := Parse(strings.NewReader(doc)); err == nil {
+			t.Errorf("Parse(%q) succeeded", doc)
+		}
+	}
+}
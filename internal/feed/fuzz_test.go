@@ -0,0 +1,27 @@
+package feed
+
+import (
+	"bytes"
+	"testing"
+)
+
+// FuzzParse checks that whatever feed a server sends, its entries can be
+// told apart. To fuzz it:
+//
+//	go test -fuzz FuzzParse ./internal/feed
+func FuzzParse(f *testing.F) {
+	f.Add([]byte(`<rss><channel><title>T</title><item><title>I</title><link>https://example.com/</link></item></channel></rss>`))
+	f.Add([]byte(`<feed xmlns="http://www.w3.org/2005/Atom"><entry><link href="x"/></entry></feed>`))
+	f.Add([]byte(`<rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#"><item/></rdf:RDF>`))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, entries, err := Parse(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		for _, entry := range entries {
+			if entry.ID == "" {
+				t.Fatalf("entry without an ID: %+v", entry)
+			}
+		}
+	})
+}
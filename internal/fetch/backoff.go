@@ -0,0 +1,127 @@
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// how long a 429 (or 503) without a Retry-After holds off its host
+	defaultRetryAfter = time.Minute
+	maxRetryAfter     = time.Hour
+	// a host that fails this many times in a row is given a rest, doubling
+	// with each further failure
+	failuresBeforeBackoff = 3
+	minFailureBackoff     = time.Minute
+	maxFailureBackoff     = 30 * time.Minute
+	// how many hosts we keep track of; a failure that's been forgotten
+	// about for this long is too
+	maxBackoffHosts   = 4096
+	backoffForgetting = time.Hour
+)
+
+var (
+	ErrRateLimited = errors.New("rate limited by site")
+	ErrBackingOff  = errors.New("site keeps failing, not trying it for now")
+)
+
+// hostBackoff is what we know about the hosts that have been failing or
+// rate limiting us.
+type hostBackoff struct {
+	sync.Mutex
+	hosts map[string]*hostState
+}
+
+type hostState struct {
+	failures    int
+	until       time.Time
+	rateLimited bool // whether until is from the site, rather than failures
+	last        time.Time
+}
+
+// check returns an error if host shouldn't be tried yet.
+func (b *hostBackoff) check(host string) error {
+	b.Lock()
+	defer b.Unlock()
+	state := b.hosts[host]
+	if state == nil {
+		return nil
+	}
+	wait := time.Until(state.until)
+	if wait <= 0 {
+		return nil
+	}
+	err := ErrBackingOff
+	if state.rateLimited {
+		err = ErrRateLimited
+	}
+	return fmt.Errorf("%w (retry in %v)", err, wait.Round(time.Second))
+}
+
+// record updates host's state with the outcome of a request: a response,
+// or the error it failed with.
+func (b *hostBackoff) record(host string, resp *http.Response, err error) {
+	b.Lock()
+	defer b.Unlock()
+	now := time.Now()
+	state := b.hosts[host]
+	if state == nil && len(b.hosts) >= maxBackoffHosts {
+		b.prune(now)
+		if len(b.hosts) >= maxBackoffHosts {
+			return
+		}
+	}
+	switch {
+	case err == nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable && resp.Header.Get("Retry-After") != ""):
+		if state == nil {
+			state = new(hostState)
+		}
+		state.until, state.rateLimited = now.Add(retryAfter(resp.Header.Get("Retry-After"))), true
+	case err == nil && resp.StatusCode < http.StatusInternalServerError:
+		delete(b.hosts, host)
+		return
+	default:
+		if state == nil {
+			state = new(hostState)
+		}
+		state.failures++
+		if state.failures >= failuresBeforeBackoff {
+			wait := minFailureBackoff << min(state.failures-failuresBeforeBackoff, 5)
+			state.until, state.rateLimited = now.Add(min(wait, maxFailureBackoff)), false
+		}
+	}
+	state.last = now
+	if b.hosts == nil {
+		b.hosts = make(map[string]*hostState)
+	}
+	b.hosts[host] = state
+}
+
+// prune forgets the hosts that have had their rest, and haven't failed in a
+// while. Call with the lock held.
+func (b *hostBackoff) prune(now time.Time) {
+	for host, state := range b.hosts {
+		if now.After(state.until) && now.Sub(state.last) > backoffForgetting {
+			delete(b.hosts, host)
+		}
+	}
+}
+
+// retryAfter parses a Retry-After header: seconds, or an HTTP date.
+func retryAfter(header string) time.Duration {
+	wait := defaultRetryAfter
+	if seconds, err := strconv.Atoi(strings.TrimSpace(header)); err == nil {
+		wait = time.Duration(seconds) * time.Second
+	} else if when, err := http.ParseTime(header); err == nil {
+		wait = time.Until(when)
+	}
+	if wait <= 0 {
+		return defaultRetryAfter
+	}
+	return min(wait, maxRetryAfter)
+}
@@ -0,0 +1,62 @@
+package fetch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBackoffFollowsRedirects(t *testing.T) {
+	limited := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer limited.Close()
+	// the same server, under another name
+	elsewhere := strings.Replace(limited.URL, "127.0.0.1", "localhost", 1)
+	shortener := httptest.NewServer(http.RedirectHandler(elsewhere+"/page", http.StatusFound))
+	defer shortener.Close()
+
+	f := &Fetcher{Client: &http.Client{}}
+	req, _ := http.NewRequest("GET", shortener.URL, nil)
+	resp, err := f.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if err := f.backoff.check("localhost"); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("the site we were redirected to: %v, want %v", err, ErrRateLimited)
+	}
+	if err := f.backoff.check("127.0.0.1"); err != nil {
+		t.Errorf("the site that redirected us: %v", err)
+	}
+}
+
+func TestBackoffForgetsOldHosts(t *testing.T) {
+	var b hostBackoff
+	failed := errors.New("connection refused")
+	for i := 0; i < maxBackoffHosts; i++ {
+		b.record(fmt.Sprintf("host%d.example", i), nil, failed)
+	}
+	// long enough ago that they're forgotten, apart from one still resting
+	for _, state := range b.hosts {
+		state.last = time.Now().Add(-2 * backoffForgetting)
+	}
+	b.hosts["host0.example"].until = time.Now().Add(time.Minute)
+	b.record("new.example", nil, failed)
+	if len(b.hosts) != 2 || b.hosts["new.example"] == nil || b.hosts["host0.example"] == nil {
+		t.Errorf("kept %d hosts, want the resting one and the new one", len(b.hosts))
+	}
+
+	for i := 0; len(b.hosts) < maxBackoffHosts; i++ {
+		b.record(fmt.Sprintf("recent%d.example", i), nil, failed)
+	}
+	b.record("one-too-many.example", nil, failed)
+	if len(b.hosts) > maxBackoffHosts {
+		t.Errorf("kept %d hosts, more than %d", len(b.hosts), maxBackoffHosts)
+	}
+}
@@ -0,0 +1,116 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// what's wrong with a certificate, for CertProblem
+const (
+	CertExpired     = "expired"
+	CertNotYetValid = "not-yet-valid"
+	CertWrongHost   = "wrong-host"
+	CertUntrusted   = "untrusted"
+	CertInvalid     = "invalid"
+)
+
+// Certificate is the leaf certificate a host presented.
+type Certificate struct {
+	Subject   string
+	Issuer    string // the issuing CA's organization or name
+	NotBefore time.Time
+	NotAfter  time.Time
+	Problem   string // why it isn't valid, if it isn't (see CertProblem)
+}
+
+// CertProblem returns what's wrong with the certificate a request failed
+// on, or "" if it didn't fail on one.
+func CertProblem(err error) string {
+	problem, _ := certProblem(err)
+	return problem
+}
+
+func certProblem(err error) (string, *x509.Certificate) {
+	var invalid x509.CertificateInvalidError
+	var hostname x509.HostnameError
+	var unknown x509.UnknownAuthorityError
+	var verification *tls.CertificateVerificationError
+	switch {
+	case errors.As(err, &invalid):
+		if invalid.Reason == x509.Expired && invalid.Cert != nil && time.Now().Before(invalid.Cert.NotBefore) {
+			return CertNotYetValid, invalid.Cert
+		} else if invalid.Reason == x509.Expired {
+			return CertExpired, invalid.Cert
+		}
+		return CertInvalid, invalid.Cert
+	case errors.As(err, &hostname):
+		return CertWrongHost, hostname.Certificate
+	case errors.As(err, &unknown):
+		return CertUntrusted, unknown.Cert
+	case errors.As(err, &verification):
+		if len(verification.UnverifiedCertificates) != 0 {
+			return CertInvalid, verification.UnverifiedCertificates[0]
+		}
+		return CertInvalid, nil
+	}
+	return "", nil
+}
+
+// CheckCertificate connects to an HTTPS host ("example.com", or with a
+// port) as fetches do, and returns the certificate it presents, even if
+// it's no good.
+func (f *Fetcher) CheckCertificate(ctx context.Context, host string) (*Certificate, error) {
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "443")
+	}
+	req, err := http.NewRequestWithContext(ctx, "HEAD", "https://"+host+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+	f.setHeaders(req)
+	client := *f.Client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Do(req)
+	if err != nil {
+		problem, cert := certProblem(err)
+		if cert == nil {
+			return nil, err
+		}
+		c := newCertificate(cert)
+		c.Problem = problem
+		return c, nil
+	}
+	resp.Body.Close()
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return nil, errors.New("no certificate")
+	}
+	return newCertificate(resp.TLS.PeerCertificates[0]), nil
+}
+
+func newCertificate(cert *x509.Certificate) *Certificate {
+	issuer := cert.Issuer.CommonName
+	if len(cert.Issuer.Organization) != 0 {
+		issuer = strings.Join(cert.Issuer.Organization, ", ")
+	}
+	return &Certificate{
+		Subject:   Sanitize(cert.Subject.CommonName),
+		Issuer:    Sanitize(issuer),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+	}
+}
+
+// certExpiry returns when the certificate a response came with expires, or
+// the zero time if it wasn't over TLS.
+func certExpiry(resp *http.Response) time.Time {
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return time.Time{}
+	}
+	return resp.TLS.PeerCertificates[0].NotAfter
+}
@@ -0,0 +1,101 @@
+package fetch
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// some CDNs only serve brotli to browsers, and Go only decodes gzip itself
+const acceptEncoding = "br, zstd, gzip"
+
+// zstd frames can ask for a window this big at most
+const maxZstdWindow = 8 << 20
+
+// acceptEncodings asks for compressed responses, unless the request asks
+// for something else (or a range, of which the encoding would be taken).
+func acceptEncodings(req *http.Request) bool {
+	if req.Header.Get("Accept-Encoding") != "" || req.Header.Get("Range") != "" {
+		return false
+	}
+	req.Header.Set("Accept-Encoding", acceptEncoding)
+	return true
+}
+
+// decodeBody replaces a response's body with its decoded contents.
+// Responses without a body (to HEAD, 204s and 304s) are left alone, even
+// though they keep the Content-Encoding the body would have had.
+func decodeBody(resp *http.Response) error {
+	header := resp.Header.Get("Content-Encoding")
+	if header == "" || !hasBody(resp) {
+		return nil
+	}
+	body := resp.Body
+	closers := []io.Closer{resp.Body}
+	var reader io.Reader = body
+	// encodings are listed in the order they were applied
+	encodings := strings.Split(header, ",")
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch encoding := strings.ToLower(strings.TrimSpace(encodings[i])); encoding {
+		case "", "identity":
+		case "gzip", "x-gzip":
+			r, err := gzip.NewReader(reader)
+			if err != nil {
+				body.Close()
+				return fmt.Errorf("invalid gzip response: %w", err)
+			}
+			reader = r
+			closers = append(closers, r)
+		case "br":
+			reader = brotli.NewReader(reader)
+		case "zstd":
+			r, err := zstd.NewReader(reader, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxWindow(maxZstdWindow))
+			if err != nil {
+				body.Close()
+				return err
+			}
+			reader = r
+			closers = append(closers, closerFunc(func() error { r.Close(); return nil }))
+		default:
+			body.Close()
+			return fmt.Errorf("unsupported content encoding: %s", encoding)
+		}
+	}
+	resp.Body = &decodedBody{Reader: reader, closers: closers}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+func hasBody(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified || resp.ContentLength == 0 {
+		return false
+	}
+	return resp.Request == nil || resp.Request.Method != "HEAD"
+}
+
+type decodedBody struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (b *decodedBody) Close() error {
+	var err error
+	for i := len(b.closers) - 1; i >= 0; i-- {
+		if closeErr := b.closers[i].Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
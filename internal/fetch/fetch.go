@@ -0,0 +1,465 @@
+// Package fetch fetches user-supplied URLs safely and extracts what's worth
+// announcing from them.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+
+	"pratyush/wutbot/internal/netdial"
+)
+
+const (
+	Timeout = 10 * time.Second
+
+	// we only read this much of any page, and don't start on pages that
+	// say they're bigger
+	MaxPageBytes = 2 << 20
+
+	maxRedirects = 5
+)
+
+var (
+	ErrForbiddenAddress = errors.New("refusing to connect to a non-public address")
+	ErrNotHTML          = errors.New("not an HTML page")
+	ErrTooLarge         = errors.New("page too large")
+)
+
+// StatusError is a page failing with an HTTP status other than 200.
+type StatusError struct {
+	Code   int
+	Status string // e.g. "404 Not Found"
+}
+
+func (e *StatusError) Error() string {
+	return e.Status
+}
+
+// the media types we extract titles from
+var pageTypes = map[string]bool{
+	"text/html":             true,
+	"application/xhtml+xml": true,
+}
+
+// pageExtensions are those of pages that mime doesn't know.
+var pageExtensions = map[string]bool{
+	".php": true, ".asp": true, ".aspx": true, ".jsp": true, ".cgi": true, ".cfm": true, ".shtml": true,
+}
+
+// Page is what we extracted from a fetched URL.
+type Page struct {
+	URL         *url.URL // after redirects
+	ContentType string
+	Title       string
+	Description string
+	Text        string // readable article text, if any
+	// as the response said, or -1 if it didn't
+	ContentLength int64
+	Image         *Image // for images, instead of a title
+	Media         *Media // and for audio and video
+	// for plain text, its first line, and for JSON, what's in it
+	TextPreview string
+	JSONPreview *JSONPreview
+	// when the HTTPS certificate expires, if it was fetched over HTTPS
+	CertExpires time.Time
+}
+
+// NewClient returns a client for fetching user-supplied URLs, which
+// refuses to connect to loopback, private, or link-local addresses.
+func NewClient() *http.Client {
+	return NewClientWithOptions(ClientOptions{})
+}
+
+type ClientOptions struct {
+	// looks hosts up instead of the system resolver, if set
+	Resolver Resolver
+	// which of a host's addresses to try first, or whether to race them
+	// (by default, Go races them itself)
+	IPPreference netdial.Preference
+}
+
+// NewClientWithOptions is NewClient, with how it looks up and connects to
+// hosts changed by the options.
+func NewClientWithOptions(options ClientOptions) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: Timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+				return ErrForbiddenAddress
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	if options.Resolver != nil || options.IPPreference != netdial.System {
+		resolver := options.Resolver
+		if resolver == nil {
+			resolver = systemResolver{}
+		}
+		transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+			return dialResolved(ctx, dialer, resolver, options.IPPreference, network, address)
+		}
+	}
+	transport.Proxy = nil
+	return &http.Client{
+		Timeout:   Timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return nil
+		},
+	}
+}
+
+func IsPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
+
+// Fetcher fetches pages with Client, identifying itself as UserAgent.
+type Fetcher struct {
+	Client    *http.Client
+	UserAgent string
+	Languages string          // the default Accept-Language, if any
+	Sites     map[string]Site // by lowercase domain
+	backoff   hostBackoff
+}
+
+// Fetch fetches an http(s) URL and extracts its title, description and text.
+// Pages that only redirect elsewhere, with a meta refresh or a script, are
+// followed like HTTP redirects.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (result *Page, err error) {
+	ctx, span := tracer.Start(ctx, "fetch")
+	defer func() { endSpan(span, err) }()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	redirects := 0
+	for {
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return nil, fmt.Errorf("unsupported URL scheme: %s", u.Scheme)
+		}
+		var doc *html.Node
+		var hops int
+		result, doc, hops, err = f.fetchDocument(ctx, u.String())
+		if err != nil {
+			return result, err
+		}
+		redirects += hops
+		if doc == nil {
+			// an image or a text file: nothing to extract
+			return result, nil
+		}
+		_, extractSpan := tracer.Start(ctx, "extract")
+		ExtractPage(doc, result)
+		next := documentRedirect(doc, result)
+		extractSpan.End()
+		if next == nil {
+			return result, nil
+		}
+		if redirects >= maxRedirects {
+			return nil, fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		redirects++
+		u = next
+	}
+}
+
+// fetchDocument fetches and parses an HTML page, returning how many HTTP
+// redirects led to it too. For an image, there's no document, just what
+// the start of the file says about it.
+func (f *Fetcher) fetchDocument(ctx context.Context, rawURL string) (result *Page, doc *html.Node, redirects int, err error) {
+	head, err := f.precheck(ctx, rawURL)
+	if err != nil {
+		return head, nil, 0, err
+	}
+	httpCtx, httpSpan := tracer.Start(ctx, "http")
+	req, err := http.NewRequestWithContext(withHTTPSpans(httpCtx), "GET", rawURL, nil)
+	if err != nil {
+		endSpan(httpSpan, err)
+		return nil, nil, 0, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.8")
+	if head != nil {
+		if n := probeBytes(mediaType(head.ContentType)); n != 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", n-1))
+		}
+	}
+	resp, err := f.Do(req)
+	if err != nil {
+		endSpan(httpSpan, err)
+		return nil, nil, 0, err
+	}
+	defer resp.Body.Close()
+	httpSpan.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode == http.StatusTooManyRequests {
+		err = ErrRateLimited
+		endSpan(httpSpan, err)
+		return nil, nil, 0, err
+	}
+	if resp.StatusCode != http.StatusOK && (resp.StatusCode != http.StatusPartialContent || req.Header.Get("Range") == "") {
+		err = &StatusError{Code: resp.StatusCode, Status: resp.Status}
+		endSpan(httpSpan, err)
+		return nil, nil, 0, err
+	}
+	for r := resp.Request; r.Response != nil; r = r.Response.Request {
+		redirects++
+	}
+
+	result = &Page{
+		URL:           resp.Request.URL,
+		ContentType:   resp.Header.Get("Content-Type"),
+		ContentLength: resp.ContentLength,
+		CertExpires:   certExpiry(resp),
+	}
+	switch mediaType := mediaType(result.ContentType); {
+	case isImage(mediaType):
+		result.Image = decodeImageHeader(resp.Body)
+		endSpan(httpSpan, nil)
+		if result.Image == nil {
+			return result, nil, redirects, ErrNotHTML
+		}
+		return result, nil, redirects, nil
+	case isMedia(mediaType):
+		result.Media = f.probeMedia(ctx, resp)
+		endSpan(httpSpan, nil)
+		if result.Media == nil {
+			return result, nil, redirects, ErrNotHTML
+		}
+		return result, nil, redirects, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		err = &StatusError{Code: resp.StatusCode, Status: resp.Status}
+		endSpan(httpSpan, err)
+		return nil, nil, 0, err
+	}
+	if err := checkPage(result); err != nil {
+		endSpan(httpSpan, nil)
+		return result, nil, redirects, err
+	}
+	body, err := charset.NewReader(io.LimitReader(resp.Body, MaxPageBytes), result.ContentType)
+	if err != nil {
+		endSpan(httpSpan, err)
+		return nil, nil, 0, err
+	}
+	switch mediaType := mediaType(result.ContentType); {
+	case isText(mediaType):
+		result.TextPreview = firstLine(body)
+		endSpan(httpSpan, nil)
+		return result, nil, redirects, nil
+	case isJSON(mediaType):
+		if result.JSONPreview = previewJSON(body); result.JSONPreview == nil {
+			err = errors.New("invalid JSON")
+		}
+		endSpan(httpSpan, err)
+		return result, nil, redirects, err
+	}
+	// parsing reads the body, so it's part of the HTTP span
+	doc, err = html.Parse(body)
+	endSpan(httpSpan, err)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return result, doc, redirects, nil
+}
+
+// precheck asks for just the headers of a URL that looks like a file first,
+// so that files we wouldn't read aren't downloaded: it returns the page the
+// headers describe, if any, and why not to fetch it. Other URLs, and servers
+// that don't answer HEAD properly, are fetched regardless, and checked by
+// the GET's headers.
+func (f *Fetcher) precheck(ctx context.Context, rawURL string) (_ *Page, err error) {
+	if u, err := url.Parse(rawURL); err != nil || !looksLikeFile(u) {
+		return nil, nil
+	}
+	ctx, span := tracer.Start(ctx, "head")
+	defer func() { endSpan(span, err) }()
+	req, err := http.NewRequestWithContext(withHTTPSpans(ctx), "HEAD", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.8")
+	// not through Do: a site failing HEAD says nothing about its pages
+	if f.backoff.check(strings.ToLower(req.URL.Hostname())) != nil {
+		return nil, nil
+	}
+	f.setHeaders(req)
+	// so that the length is of what a GET would get
+	acceptEncodings(req)
+	resp, err := f.client().Do(req)
+	if err != nil {
+		if errors.Is(err, ErrForbiddenAddress) || ctx.Err() != nil {
+			return nil, err
+		}
+		span.RecordError(err)
+		return nil, nil
+	}
+	resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil
+	}
+	page := &Page{URL: resp.Request.URL, ContentType: resp.Header.Get("Content-Type"), ContentLength: resp.ContentLength}
+	// only the start of an image or video is needed, however big it is
+	if probeBytes(mediaType(page.ContentType)) != 0 {
+		return page, nil
+	}
+	return page, checkPage(page)
+}
+
+// checkPage returns an error if a response isn't worth reading, by its
+// headers.
+func checkPage(p *Page) error {
+	if mediaType := mediaType(p.ContentType); !pageTypes[mediaType] && !isText(mediaType) && !isJSON(mediaType) {
+		return ErrNotHTML
+	}
+	if p.ContentLength > MaxPageBytes {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// looksLikeFile reports whether a URL's path ends in the extension of
+// something other than a page, like .zip or .mp4.
+func looksLikeFile(u *url.URL) bool {
+	ext := strings.ToLower(path.Ext(u.Path))
+	if ext == "" || pageExtensions[ext] {
+		return false
+	}
+	if mediaType := mediaType(mime.TypeByExtension(ext)); mediaType != "" {
+		return !pageTypes[mediaType] && !isText(mediaType) && !isJSON(mediaType)
+	}
+	return true
+}
+
+// probeBytes is how much of the start of a file of this type we read, if
+// not the whole page.
+func probeBytes(mediaType string) int {
+	switch {
+	case isImage(mediaType):
+		return maxImageHeaderBytes
+	case isMedia(mediaType):
+		return maxMediaHeadBytes
+	}
+	return 0
+}
+
+func mediaType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType
+}
+
+// ExtractPage fills in the title and description from the document head,
+// and the text from the element holding the most paragraph text.
+func ExtractPage(doc *html.Node, p *Page) {
+	var ogTitle, ogDescription string
+	paragraphText := make(map[*html.Node]int)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "script", "style", "noscript", "nav", "header", "footer", "aside", "form":
+				return
+			case "title":
+				if p.Title == "" {
+					p.Title = CollapseWhitespace(NodeText(n))
+				}
+			case "meta":
+				content := CollapseWhitespace(attr(n, "content"))
+				switch strings.ToLower(attr(n, "property") + attr(n, "name")) {
+				case "og:title":
+					ogTitle = content
+				case "og:description":
+					ogDescription = content
+				case "description":
+					if p.Description == "" {
+						p.Description = content
+					}
+				}
+			case "p":
+				if n.Parent != nil {
+					paragraphText[n.Parent] += len(NodeText(n))
+				}
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	if ogTitle != "" {
+		p.Title = ogTitle
+	}
+	if p.Description == "" {
+		p.Description = ogDescription
+	}
+	p.Title, p.Description = Sanitize(p.Title), Sanitize(p.Description)
+	var best *html.Node
+	for n, length := range paragraphText {
+		if best == nil || length > paragraphText[best] {
+			best = n
+		}
+	}
+	if best != nil {
+		var paragraphs []string
+		for c := best.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && c.Data == "p" {
+				if text := CollapseWhitespace(NodeText(c)); text != "" {
+					paragraphs = append(paragraphs, text)
+				}
+			}
+		}
+		p.Text = strings.Join(paragraphs, "\n\n")
+	}
+}
+
+// NodeText is the text in n, leaving out scripts and styles.
+func NodeText(n *html.Node) string {
+	var buf strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			buf.WriteString(n.Data)
+		} else if n.Type == html.ElementNode && (n.Data == "script" || n.Data == "style") {
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return buf.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,60 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPrecheck(t *testing.T) {
+	var mu sync.Mutex
+	var heads []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "HEAD" {
+			mu.Lock()
+			heads = append(heads, r.URL.Path)
+			mu.Unlock()
+		}
+		switch r.URL.Path {
+		case "/big":
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Length", strconv.Itoa(MaxPageBytes+1))
+			if r.Method == "GET" {
+				w.Write([]byte(strings.Repeat(" ", MaxPageBytes+1)))
+			}
+		case "/release.zip":
+			w.Header().Set("Content-Type", "application/zip")
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<title>A page</title>"))
+		}
+	}))
+	defer server.Close()
+
+	f := &Fetcher{Client: &http.Client{}}
+	tests := []struct {
+		path, title string
+		err         error
+	}{
+		{"/article", "A page", nil},
+		{"/index.php", "A page", nil},
+		{"/big", "", ErrTooLarge},
+		{"/release.zip", "", ErrNotHTML},
+	}
+	for _, tt := range tests {
+		page, err := f.Fetch(context.Background(), server.URL+tt.path)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: %v, want %v", tt.path, err, tt.err)
+		} else if err == nil && page.Title != tt.title {
+			t.Errorf("%s: title %q, want %q", tt.path, page.Title, tt.title)
+		}
+	}
+	if len(heads) != 1 || heads[0] != "/release.zip" {
+		t.Errorf("sent HEAD for %v, want just the file", heads)
+	}
+}
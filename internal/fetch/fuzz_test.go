@@ -0,0 +1,124 @@
+package fetch
+
+// Fuzz tests for the code that reads what arbitrary channels and web
+// servers send us. go test runs their seeds; to fuzz one, e.g.
+//
+//	go test -fuzz FuzzExtractPage ./internal/fetch
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+func FuzzExtractURLs(f *testing.F) {
+	for _, seed := range []string{
+		"see https://example.com/a and http://example.org.",
+		"(https://en.wikipedia.org/wiki/Go_(programming_language))",
+		`<a href="https://example.com/q">https://example.com/q</a>`,
+		"HTTPS://X.Y/?!\"'",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, message string) {
+		seen := make(map[string]bool)
+		for _, u := range ExtractURLs(message) {
+			if !strings.Contains(message, u) {
+				t.Fatalf("extracted a URL that isn't in the message: %q", u)
+			}
+			if lower := strings.ToLower(u); !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+				t.Fatalf("extracted a URL that isn't http(s): %q", u)
+			}
+			if strings.ContainsAny(u, " \t\r\n<>\"") {
+				t.Fatalf("extracted a URL with a delimiter in it: %q", u)
+			}
+			if trimURLPunctuation(u) != u {
+				t.Fatalf("punctuation left on %q", u)
+			}
+			if seen[u] {
+				t.Fatalf("extracted a URL twice: %q", u)
+			}
+			seen[u] = true
+		}
+	})
+}
+
+func FuzzExtractPage(f *testing.F) {
+	for _, seed := range []string{
+		`<html><head><title>A title</title><meta name="description" content="About it"></head><body><p>Text</p></body></html>`,
+		`<meta property="og:title" content="OG &amp; title"><title>  spaced
+		out </title>`,
+		"<title>\x02bold\x02 ‮evil</title>",
+		`<svg><title>not the page's</title></svg><title>the page's</title>`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		doc, err := html.Parse(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		var p Page
+		ExtractPage(doc, &p)
+		for _, s := range []string{p.Title, p.Description} {
+			if Sanitize(s) != s {
+				t.Fatalf("unsanitized title or description: %q", s)
+			}
+		}
+	})
+}
+
+func FuzzImageHeader(f *testing.F) {
+	f.Add([]byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR\x00\x00\x00\x10\x00\x00\x00\x10\x08\x02\x00\x00\x00"))
+	f.Add([]byte("GIF89a\x10\x00\x10\x00\x00\x00\x00"))
+	f.Add([]byte("RIFF\x00\x00\x00\x00WEBPVP8X\x0a\x00\x00\x00\x00\x00\x00\x00\x0f\x00\x00\x0f\x00\x00"))
+	f.Add([]byte("\xff\xd8\xff\xe1\x00\x1cExif\x00\x00MM\x00*\x00\x00\x00\x08\x00\x01\x01\x0f\x00\x02\x00\x00\x00\x04Foo\x00"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		img := decodeImageHeader(bytes.NewReader(data))
+		if img != nil && Sanitize(img.Camera) != img.Camera {
+			t.Fatalf("unsanitized camera: %q", img.Camera)
+		}
+	})
+}
+
+func FuzzMediaHeader(f *testing.F) {
+	f.Add([]byte("\x00\x00\x00\x10ftypisom\x00\x00\x02\x00\x00\x00\x00\x08moov"))
+	f.Add([]byte("\x1a\x45\xdf\xa3\x84\x42\x82\x84webm"))
+	f.Add([]byte("\x00\x00\x00\x01ftyp\xff\xff\xff\xff\xff\xff\xff\xff"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var m Media
+		if _, found := parseMP4(data, &m); !found {
+			parseEBML(data, &m)
+		}
+		if m.Duration < 0 || m.Width < 0 || m.Height < 0 {
+			t.Fatalf("negative duration or dimensions: %+v", m)
+		}
+	})
+}
+
+func FuzzSanitize(f *testing.F) {
+	for _, seed := range []string{"A title", "  lots \t of\n\nspace  ", "\x02\x03\x0f\x16\x1d\x1f", "bad \xff utf-8", "evil‮gnp.exe", " \u0085"} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, in string) {
+		s := Sanitize(in)
+		if !utf8.ValidString(s) {
+			t.Fatalf("invalid UTF-8: %q", s)
+		}
+		for _, r := range s {
+			if unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r) {
+				t.Fatalf("control character %U left in %q", r, s)
+			}
+		}
+		if s != strings.TrimSpace(s) || strings.Contains(s, "  ") {
+			t.Fatalf("whitespace isn't collapsed: %q", s)
+		}
+		if Sanitize(s) != s {
+			t.Fatalf("not idempotent: %q", s)
+		}
+	})
+}
@@ -0,0 +1,184 @@
+package fetch
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strings"
+	"time"
+)
+
+// we only read the start of images, where their dimensions and EXIF are
+const maxImageHeaderBytes = 128 << 10
+
+// Image is what the start of an image file says about it. Where it was
+// taken (EXIF GPS) is deliberately left out.
+type Image struct {
+	Format        string // e.g. "jpeg"
+	Width, Height int
+	Camera        string    // EXIF make and model, if any
+	Taken         time.Time // EXIF original time, if any, in the camera's (unknown) time zone
+}
+
+func isImage(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "image/")
+}
+
+// decodeImageHeader reads what it can about an image from the start of it.
+func decodeImageHeader(r io.Reader) *Image {
+	data, err := io.ReadAll(io.LimitReader(r, maxImageHeaderBytes))
+	if err != nil && len(data) == 0 {
+		return nil
+	}
+	var img Image
+	if config, format, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		img = Image{Format: format, Width: config.Width, Height: config.Height}
+	} else if width, height, ok := webpSize(data); ok {
+		img = Image{Format: "webp", Width: width, Height: height}
+	} else {
+		return nil
+	}
+	if img.Format == "jpeg" {
+		if tiff := jpegExif(data); tiff != nil {
+			img.Camera, img.Taken = parseExif(tiff)
+		}
+	}
+	return &img
+}
+
+// webpSize reads a WebP's dimensions from its first chunk.
+func webpSize(data []byte) (width, height int, ok bool) {
+	if len(data) < 30 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return 0, 0, false
+	}
+	switch string(data[12:16]) {
+	case "VP8X":
+		return int(uint24(data[24:27])) + 1, int(uint24(data[27:30])) + 1, true
+	case "VP8 ":
+		if !bytes.Equal(data[23:26], []byte{0x9d, 0x01, 0x2a}) {
+			return 0, 0, false
+		}
+		return int(binary.LittleEndian.Uint16(data[26:28]) & 0x3fff), int(binary.LittleEndian.Uint16(data[28:30]) & 0x3fff), true
+	case "VP8L":
+		if data[20] != 0x2f {
+			return 0, 0, false
+		}
+		bits := binary.LittleEndian.Uint32(data[21:25])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, true
+	}
+	return 0, 0, false
+}
+
+func uint24(b []byte) uint32 {
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16
+}
+
+// jpegExif returns the TIFF data of a JPEG's EXIF segment, if it has one
+// in the data we read.
+func jpegExif(data []byte) []byte {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return nil
+		}
+		marker := data[i+1]
+		// start of scan: the image data, past any metadata
+		if marker == 0xda {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2 : i+4]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil
+		}
+		segment := data[i+4 : end]
+		if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		i = end
+	}
+	return nil
+}
+
+const (
+	exifMake             = 0x010f
+	exifModel            = 0x0110
+	exifDateTime         = 0x0132
+	exifIFDPointer       = 0x8769
+	exifDateTimeOriginal = 0x9003
+)
+
+// parseExif reads the camera and when the picture was taken from EXIF's
+// TIFF structure.
+func parseExif(tiff []byte) (camera string, taken time.Time) {
+	if len(tiff) < 8 {
+		return "", time.Time{}
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return "", time.Time{}
+	}
+	tags := make(map[uint16]string)
+	var exifIFD uint32
+	readIFD := func(offset uint32) {
+		if uint64(offset)+2 > uint64(len(tiff)) {
+			return
+		}
+		count := int(order.Uint16(tiff[offset:]))
+		for i := 0; i < count; i++ {
+			entry := int(offset) + 2 + 12*i
+			if entry+12 > len(tiff) {
+				return
+			}
+			tag, kind := order.Uint16(tiff[entry:]), order.Uint16(tiff[entry+2:])
+			n, value := order.Uint32(tiff[entry+4:]), order.Uint32(tiff[entry+8:])
+			switch {
+			case tag == exifIFDPointer && kind == 4:
+				exifIFD = value
+			case kind == 2: // ASCII
+				s := tiff[entry+8 : entry+12]
+				if n > 4 {
+					if uint64(value)+uint64(n) > uint64(len(tiff)) {
+						continue
+					}
+					s = tiff[value : value+n]
+				} else {
+					s = s[:n]
+				}
+				tags[tag] = Sanitize(strings.TrimRight(string(s), "\x00 "))
+			}
+		}
+	}
+	readIFD(order.Uint32(tiff[4:]))
+	if exifIFD != 0 {
+		readIFD(exifIFD)
+	}
+
+	maker, model := tags[exifMake], tags[exifModel]
+	switch {
+	case maker == "" || strings.HasPrefix(strings.ToLower(model), strings.ToLower(maker)):
+		// models often include the make already
+		camera = model
+	case model == "":
+		camera = maker
+	default:
+		camera = maker + " " + model
+	}
+	date := tags[exifDateTimeOriginal]
+	if date == "" {
+		date = tags[exifDateTime]
+	}
+	taken, _ = time.Parse("2006:01:02 15:04:05", date)
+	return camera, taken
+}
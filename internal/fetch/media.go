@@ -0,0 +1,365 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	// we read this much of the start of audio and video files, and if their
+	// metadata isn't there (MP4s that aren't "fast start"), this much from
+	// where it is, at the end
+	maxMediaHeadBytes = 256 << 10
+	maxMediaTailBytes = 512 << 10
+)
+
+// Media is what an audio or video file's container says about it: MP4 (and
+// M4A etc.), or Matroska and WebM.
+type Media struct {
+	Format        string // "mp4", "webm" or "matroska"
+	Duration      time.Duration
+	Video, Audio  string // the first track's codec of each, e.g. "H.264" and "AAC"
+	Width, Height int
+}
+
+func isMedia(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "video/") || strings.HasPrefix(mediaType, "audio/")
+}
+
+var codecNames = map[string]string{
+	// MP4 sample entries
+	"avc1": "H.264", "avc3": "H.264", "hvc1": "H.265", "hev1": "H.265", "av01": "AV1", "vp09": "VP9", "vp08": "VP8",
+	"mp4a": "AAC", "Opus": "Opus", "fLaC": "FLAC", "ac-3": "AC-3", "ec-3": "E-AC-3", ".mp3": "MP3",
+	// Matroska codec IDs
+	"V_MPEG4/ISO/AVC": "H.264", "V_MPEGH/ISO/HEVC": "H.265", "V_AV1": "AV1", "V_VP9": "VP9", "V_VP8": "VP8",
+	"A_AAC": "AAC", "A_OPUS": "Opus", "A_VORBIS": "Vorbis", "A_FLAC": "FLAC", "A_AC3": "AC-3", "A_MPEG/L3": "MP3",
+}
+
+func codecName(id string) string {
+	if name, ok := codecNames[id]; ok {
+		return name
+	}
+	// e.g. "A_AAC/MPEG4/LC"
+	if base, _, ok := strings.Cut(id, "/"); ok {
+		if name, ok := codecNames[base]; ok {
+			return name
+		}
+	}
+	return Sanitize(id)
+}
+
+// probeMedia reads the metadata of the audio or video file resp is the
+// start of, fetching the end of it as well if that's where an MP4 keeps it.
+func (f *Fetcher) probeMedia(ctx context.Context, resp *http.Response) *Media {
+	head, err := io.ReadAll(io.LimitReader(resp.Body, maxMediaHeadBytes))
+	if err != nil && len(head) == 0 {
+		return nil
+	}
+	var m Media
+	switch {
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		m.Format = "mp4"
+		next, ok := parseMP4(head, &m)
+		if ok || next <= int64(len(head)) || resp.StatusCode != http.StatusPartialContent {
+			break
+		}
+		// the metadata is after the media data: fetch (the start of) it
+		if tail := f.fetchRange(ctx, resp.Request.URL.String(), next, maxMediaTailBytes); tail != nil {
+			parseMP4(tail, &m)
+		}
+	case len(head) >= 4 && binary.BigEndian.Uint32(head) == ebmlHeader:
+		m.Format = "matroska"
+		parseEBML(head, &m)
+	default:
+		return nil
+	}
+	if m.Duration == 0 && m.Video == "" && m.Audio == "" {
+		return nil
+	}
+	return &m
+}
+
+// fetchRange fetches up to n bytes of a URL from offset.
+func (f *Fetcher) fetchRange(ctx context.Context, rawURL string, offset, n int64) []byte {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return nil
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+n-1))
+	resp, err := f.Do(req)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	// not the whole file again, if the server ignored the range
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, n))
+	return data
+}
+
+// mp4Track is what we've read of a trak box so far.
+type mp4Track struct {
+	handler       string // "vide" or "soun"
+	codec         string
+	width, height int
+}
+
+// parseMP4 reads the metadata from data, the top-level boxes of an MP4
+// starting at a box. It returns whether it found the moov box, or if not,
+// the offset of the box after those in data.
+func parseMP4(data []byte, m *Media) (next int64, found bool) {
+	var offset int64
+	for offset <= int64(len(data))-8 {
+		size, kind, header := mp4Box(data[offset:])
+		if size == 0 {
+			size = int64(len(data)) - offset
+		}
+		if size < int64(header) || size > math.MaxInt64-offset {
+			return 0, false
+		}
+		if kind == "moov" {
+			// however much of it we have
+			end := min(offset+size, int64(len(data)))
+			parseMP4Boxes(data[offset+int64(header):end], m, nil)
+			return 0, true
+		}
+		offset += size
+	}
+	return offset, false
+}
+
+// mp4Box reads a box header: the box's size (0 for the rest of the file),
+// type, and the header's length.
+func mp4Box(data []byte) (size int64, kind string, header int) {
+	size, kind, header = int64(binary.BigEndian.Uint32(data)), string(data[4:8]), 8
+	if size == 1 {
+		if len(data) < 16 {
+			return -1, kind, 16
+		}
+		size, header = int64(binary.BigEndian.Uint64(data[8:16])), 16
+	}
+	return size, kind, header
+}
+
+func parseMP4Boxes(data []byte, m *Media, track *mp4Track) {
+	for len(data) >= 8 {
+		size, kind, header := mp4Box(data)
+		if size == 0 || size > int64(len(data)) {
+			// truncated: read what there is
+			size = int64(len(data))
+		}
+		if size < int64(header) {
+			return
+		}
+		body := data[header:size]
+		data = data[size:]
+		switch kind {
+		case "trak":
+			t := new(mp4Track)
+			parseMP4Boxes(body, m, t)
+			switch {
+			case t.handler == "vide" && m.Video == "":
+				m.Video, m.Width, m.Height = t.codec, t.width, t.height
+			case t.handler == "soun" && m.Audio == "":
+				m.Audio = t.codec
+			}
+		case "mdia", "minf", "stbl":
+			parseMP4Boxes(body, m, track)
+		case "mvhd":
+			// version 1 has 64-bit times and durations
+			if len(body) >= 32 && body[0] == 1 {
+				scale, duration := binary.BigEndian.Uint32(body[20:24]), binary.BigEndian.Uint64(body[24:32])
+				m.Duration = scaledDuration(float64(duration), scale)
+			} else if len(body) >= 20 {
+				scale, duration := binary.BigEndian.Uint32(body[12:16]), binary.BigEndian.Uint32(body[16:20])
+				m.Duration = scaledDuration(float64(duration), scale)
+			}
+		case "tkhd":
+			// the 16.16 fixed point dimensions end the box
+			if track != nil && (len(body) == 84 || len(body) == 96) {
+				sizes := body[len(body)-8:]
+				track.width, track.height = int(binary.BigEndian.Uint32(sizes[:4])>>16), int(binary.BigEndian.Uint32(sizes[4:])>>16)
+			}
+		case "hdlr":
+			if track != nil && len(body) >= 12 {
+				track.handler = string(body[8:12])
+			}
+		case "stsd":
+			// the first sample entry's type is its codec
+			if track != nil && len(body) >= 16 {
+				track.codec = codecName(string(body[12:16]))
+			}
+		}
+	}
+}
+
+func scaledDuration(duration float64, timescale uint32) time.Duration {
+	if timescale == 0 || duration == math.MaxUint32 || duration == math.MaxUint64 {
+		return 0
+	}
+	return seconds(duration / float64(timescale))
+}
+
+// seconds converts to a duration, or 0 if it's nonsense.
+func seconds(s float64) time.Duration {
+	if !(s > 0 && s < float64(math.MaxInt64/time.Second)) {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+// Matroska element IDs
+const (
+	ebmlHeader     = 0x1a45dfa3
+	ebmlDocType    = 0x4282
+	mkvSegment     = 0x18538067
+	mkvInfo        = 0x1549a966
+	mkvTimecode    = 0x2ad7b1
+	mkvDuration    = 0x4489
+	mkvTracks      = 0x1654ae6b
+	mkvTrackEntry  = 0xae
+	mkvTrackType   = 0x83
+	mkvCodecID     = 0x86
+	mkvVideo       = 0xe0
+	mkvPixelWidth  = 0xb0
+	mkvPixelHeight = 0xba
+	mkvCluster     = 0x1f43b675
+
+	mkvVideoTrack = 1
+	mkvAudioTrack = 2
+)
+
+// mkvTrack is what we've read of a TrackEntry so far.
+type mkvTrack struct {
+	kind          uint64
+	codec         string
+	width, height int
+}
+
+type mkvState struct {
+	timecodeScale uint64
+	duration      float64
+}
+
+// parseEBML reads the metadata from the start of a Matroska (or WebM)
+// file, which is all before the first cluster.
+func parseEBML(data []byte, m *Media) {
+	state := mkvState{timecodeScale: 1000000}
+	parseEBMLElements(data, m, &state, nil)
+	m.Duration = seconds(state.duration * float64(state.timecodeScale) / float64(time.Second))
+}
+
+func parseEBMLElements(data []byte, m *Media, state *mkvState, track *mkvTrack) bool {
+	for len(data) > 0 {
+		id, idLength := ebmlVint(data, true)
+		if idLength == 0 {
+			return false
+		}
+		size, sizeLength := ebmlVint(data[idLength:], false)
+		if sizeLength == 0 {
+			return false
+		}
+		start := idLength + sizeLength
+		// unknown (all ones) or truncated: read what there is
+		if size > uint64(len(data)-start) {
+			size = uint64(len(data) - start)
+		}
+		body := data[start : start+int(size)]
+		data = data[start+int(size):]
+		switch id {
+		case mkvCluster:
+			// the media itself: nothing more to read
+			return false
+		case ebmlHeader, mkvSegment, mkvInfo, mkvTracks, mkvVideo:
+			if !parseEBMLElements(body, m, state, track) {
+				return false
+			}
+		case mkvTrackEntry:
+			t := new(mkvTrack)
+			if !parseEBMLElements(body, m, state, t) {
+				return false
+			}
+			switch {
+			case t.kind == mkvVideoTrack && m.Video == "":
+				m.Video, m.Width, m.Height = t.codec, t.width, t.height
+			case t.kind == mkvAudioTrack && m.Audio == "":
+				m.Audio = t.codec
+			}
+		case ebmlDocType:
+			if string(body) == "webm" {
+				m.Format = "webm"
+			}
+		case mkvTimecode:
+			if scale := ebmlUint(body); scale != 0 {
+				state.timecodeScale = scale
+			}
+		case mkvDuration:
+			switch len(body) {
+			case 4:
+				state.duration = float64(math.Float32frombits(binary.BigEndian.Uint32(body)))
+			case 8:
+				state.duration = math.Float64frombits(binary.BigEndian.Uint64(body))
+			}
+		case mkvTrackType:
+			if track != nil {
+				track.kind = ebmlUint(body)
+			}
+		case mkvCodecID:
+			if track != nil {
+				track.codec = codecName(string(bytes.TrimRight(body, "\x00")))
+			}
+		case mkvPixelWidth:
+			if track != nil {
+				track.width = int(ebmlUint(body))
+			}
+		case mkvPixelHeight:
+			if track != nil {
+				track.height = int(ebmlUint(body))
+			}
+		}
+	}
+	return true
+}
+
+// ebmlVint reads a variable-length integer, keeping its length marker for
+// element IDs; an all-ones size (unknown) is returned as the maximum. It
+// returns a length of 0 if it's invalid or truncated.
+func ebmlVint(data []byte, keepMarker bool) (value uint64, length int) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0
+	}
+	for length = 1; data[0]&(0x80>>(length-1)) == 0; length++ {
+	}
+	if length > 8 || length > len(data) {
+		return 0, 0
+	}
+	value = uint64(data[0])
+	if !keepMarker {
+		value &= 0xff >> length
+	}
+	allOnes := value == 0xff>>length
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+		allOnes = allOnes && b == 0xff
+	}
+	if !keepMarker && allOnes {
+		return math.MaxUint64, length
+	}
+	return value, length
+}
+
+func ebmlUint(data []byte) (value uint64) {
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
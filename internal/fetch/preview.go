@@ -0,0 +1,135 @@
+package fetch
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+const (
+	// plain text previews are cut down to this many characters
+	maxPreviewRunes = 300
+	// JSON previews list this many keys at most
+	maxPreviewKeys = 8
+)
+
+// JSONPreview summarizes a JSON document by its top level.
+type JSONPreview struct {
+	Kind string // "object", "array", or for anything else, "value"
+	// an object's keys, or those of an array's first element if it's an
+	// object, in their order (up to maxPreviewKeys)
+	Keys []string
+	// how many keys or elements there are, or at least, if Partial (the
+	// document was cut short)
+	Count   int
+	Partial bool
+	Value   string // a value's JSON
+}
+
+func isJSON(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func isText(mediaType string) bool {
+	return mediaType == "text/plain"
+}
+
+// firstLine returns a text's first non-blank line.
+func firstLine(r io.Reader) string {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 4096), MaxPageBytes)
+	// a line too long to scan whole still has a start worth showing
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if advance == 0 && token == nil && len(data) >= 64<<10 {
+			return len(data), data, nil
+		}
+		return advance, token, err
+	})
+	for scanner.Scan() {
+		if line := Sanitize(scanner.Text()); line != "" {
+			return cutRunes(line, maxPreviewRunes)
+		}
+	}
+	return ""
+}
+
+func cutRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+// previewJSON reads a JSON document's top level, or returns nil if it isn't
+// JSON.
+func previewJSON(r io.Reader) *JSONPreview {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil
+	}
+	p := new(JSONPreview)
+	switch token {
+	case json.Delim('{'):
+		p.Kind = "object"
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				p.Partial = true
+				break
+			}
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				p.Partial = true
+				break
+			}
+			if len(p.Keys) < maxPreviewKeys {
+				p.Keys = append(p.Keys, Sanitize(key.(string)))
+			}
+			p.Count++
+		}
+	case json.Delim('['):
+		p.Kind = "array"
+		for decoder.More() {
+			var value json.RawMessage
+			if err := decoder.Decode(&value); err != nil {
+				p.Partial = true
+				break
+			}
+			if p.Count == 0 {
+				p.Keys = objectKeys(value)
+			}
+			p.Count++
+		}
+	default:
+		p.Kind = "value"
+		value, _ := json.Marshal(token)
+		p.Value = cutRunes(Sanitize(string(value)), maxPreviewRunes)
+	}
+	return p
+}
+
+// objectKeys returns the first keys of a JSON object, or nil if it isn't
+// one.
+func objectKeys(data json.RawMessage) (keys []string) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil
+	}
+	for decoder.More() && len(keys) < maxPreviewKeys {
+		key, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		keys = append(keys, Sanitize(key.(string)))
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			break
+		}
+	}
+	return keys
+}
@@ -0,0 +1,95 @@
+package fetch
+
+import (
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	// a longer refresh is a page reloading itself, not a redirect
+	maxRefreshDelay = 10
+	// a page with more text than this is worth announcing, whatever its
+	// scripts do
+	maxInterstitialText = 200
+)
+
+// trivial scripted redirects: location = "...", location.href = "...",
+// location.replace("...") and the like
+var scriptRedirect = regexp.MustCompile(`(?:^|[^\w.])(?:(?:window|document|top|self)\.)?location(?:\.href\s*=\s*|\s*=\s*|\.(?:replace|assign)\(\s*)["']([^"'\s]+)["']`)
+
+// documentRedirect returns where a page redirects to with a meta refresh
+// or, if it has next to no text of its own, a script; or nil if it
+// doesn't, or only to itself.
+func documentRedirect(doc *html.Node, p *Page) *url.URL {
+	var refresh, script string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "meta":
+				if refresh == "" && strings.EqualFold(attr(n, "http-equiv"), "refresh") {
+					refresh = refreshURL(attr(n, "content"))
+				}
+			case "script":
+				if script == "" && attr(n, "src") == "" {
+					if c := n.FirstChild; c != nil && c.Type == html.TextNode {
+						if m := scriptRedirect.FindStringSubmatch(c.Data); m != nil {
+							script = strings.ReplaceAll(m[1], `\/`, "/")
+						}
+					}
+				}
+				return
+			case "noscript":
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	target := refresh
+	if target == "" && len(p.Text) <= maxInterstitialText {
+		target = script
+	}
+	if target == "" {
+		return nil
+	}
+	next, err := p.URL.Parse(html.UnescapeString(target))
+	if err != nil || (next.Scheme != "http" && next.Scheme != "https") {
+		return nil
+	}
+	here, there := *p.URL, *next
+	here.Fragment, there.Fragment = "", ""
+	if here.String() == there.String() {
+		return nil
+	}
+	return next
+}
+
+// refreshURL parses a meta refresh, "<seconds>; url=<URL>", returning the
+// URL if it's soon enough to be a redirect.
+func refreshURL(content string) string {
+	delay, target, ok := strings.Cut(content, ";")
+	if !ok {
+		delay, target, ok = strings.Cut(content, ",")
+	}
+	if !ok {
+		return ""
+	}
+	if seconds, err := strconv.ParseFloat(strings.TrimSpace(delay), 64); err != nil || seconds > maxRefreshDelay {
+		return ""
+	}
+	target = strings.TrimSpace(target)
+	if len(target) > 3 && strings.EqualFold(target[:3], "url") {
+		if rest := strings.TrimSpace(target[3:]); strings.HasPrefix(rest, "=") {
+			target = strings.TrimSpace(rest[1:])
+		}
+	}
+	return strings.Trim(target, `"'`)
+}
@@ -0,0 +1,46 @@
+package fetch
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func TestDocumentRedirect(t *testing.T) {
+	tests := []struct {
+		name, page, text, want string
+	}{
+		{"meta refresh", `<meta http-equiv="refresh" content="0; url=/next">`, "", "https://example.com/next"},
+		{"quoted refresh", `<meta http-equiv="Refresh" content="2;URL='https://example.org/'">`, "", "https://example.org/"},
+		{"refresh without url=", `<meta http-equiv="refresh" content="1, https://example.org/x">`, "", "https://example.org/x"},
+		{"slow refresh", `<meta http-equiv="refresh" content="30; url=/next">`, "", ""},
+		{"reload", `<meta http-equiv="refresh" content="5">`, "", ""},
+		{"to itself", `<meta http-equiv="refresh" content="0; url=/page#top">`, "", ""},
+		{"not http", `<meta http-equiv="refresh" content="0; url=javascript:alert(1)">`, "", ""},
+		{"script", `<script>window.location.href = "https:\/\/example.org\/js";</script>`, "", "https://example.org/js"},
+		{"location.replace", `<script>location.replace('/replaced')</script>`, "Redirecting…", "https://example.com/replaced"},
+		{"script on a real page", `<script>location = "/elsewhere"</script>`, strings.Repeat("words ", 50), ""},
+		{"external script", `<script src="/app.js">location = "/elsewhere"</script>`, "", ""},
+		{"noscript", `<noscript><meta http-equiv="refresh" content="0; url=/nojs"></noscript>`, "", ""},
+		{"nothing", `<p>Hello</p>`, "Hello", ""},
+		{"not location", `<script>mylocation = "/x"; foo.location = "/y"</script>`, "", ""},
+	}
+	base, _ := url.Parse("https://example.com/page")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := html.Parse(strings.NewReader("<html><head>" + tt.page + "</head><body></body></html>"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := ""
+			if next := documentRedirect(doc, &Page{URL: base, Text: tt.text}); next != nil {
+				got = next.String()
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package fetch
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	"pratyush/wutbot/internal/netdial"
+)
+
+const (
+	// answers are cached for their TTL, within these bounds
+	minResolverTTL = 30 * time.Second
+	maxResolverTTL = time.Hour
+	// DNS over TLS doesn't tell us TTLs
+	dotCacheTTL    = 5 * time.Minute
+	maxDNSResponse = 64 << 10
+)
+
+// Resolver looks up the addresses to fetch a host's pages from, instead of
+// the system resolver, so that lookups of user-supplied links aren't
+// leaked to (or poisoned by) it.
+type Resolver interface {
+	LookupIP(ctx context.Context, host string) (ips []net.IP, ttl time.Duration, err error)
+}
+
+// NewResolver returns a caching resolver for a DNS-over-HTTPS URL
+// ("https://dns.example/dns-query") or a DNS-over-TLS server
+// ("tls://dns.example", port 853 by default).
+func NewResolver(server string) (Resolver, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+	var r Resolver
+	switch u.Scheme {
+	case "https":
+		r = &dohResolver{url: u.String(), client: &http.Client{Timeout: Timeout}}
+	case "tls":
+		addr := u.Host
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), "853")
+		}
+		dialer := &tls.Dialer{Config: &tls.Config{ServerName: u.Hostname()}}
+		r = &dotResolver{&net.Resolver{
+			PreferGo: true,
+			// a stream rather than a PacketConn, so the resolver frames
+			// its queries for TCP
+			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+				return dialer.DialContext(ctx, "tcp", addr)
+			},
+		}}
+	default:
+		return nil, fmt.Errorf("resolver must be an https:// (DNS over HTTPS) or tls:// (DNS over TLS) URL, not %s", server)
+	}
+	return &cachingResolver{resolver: r, cache: make(map[string]cachedIPs)}, nil
+}
+
+type dohResolver struct {
+	url    string
+	client *http.Client
+}
+
+func (d *dohResolver) LookupIP(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	var ips []net.IP
+	ttl := maxResolverTTL
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		answers, answerTTL, err := d.query(ctx, host, qtype)
+		if err != nil {
+			return nil, 0, err
+		}
+		ips = append(ips, answers...)
+		if len(answers) != 0 {
+			ttl = min(ttl, answerTTL)
+		}
+	}
+	if len(ips) == 0 {
+		return nil, 0, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return ips, ttl, nil
+}
+
+func (d *dohResolver) query(ctx context.Context, host string, qtype dnsmessage.Type) (ips []net.IP, ttl time.Duration, err error) {
+	name, err := dnsmessage.NewName(strings.TrimSuffix(host, ".") + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", d.url, bytes.NewReader(packed))
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("DNS over HTTPS: %s", resp.Status)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDNSResponse))
+	if err != nil {
+		return nil, 0, err
+	}
+	var p dnsmessage.Parser
+	header, err := p.Start(body)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch header.RCode {
+	case dnsmessage.RCodeSuccess:
+	case dnsmessage.RCodeNameError:
+		return nil, 0, nil
+	default:
+		return nil, 0, fmt.Errorf("DNS over HTTPS: %v", header.RCode)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, 0, err
+	}
+	ttl = maxResolverTTL
+	for {
+		answer, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			return ips, ttl, nil
+		} else if err != nil {
+			return nil, 0, err
+		}
+		switch answer.Type {
+		case dnsmessage.TypeA:
+			r, err := p.AResource()
+			if err != nil {
+				return nil, 0, err
+			}
+			ips = append(ips, net.IP(r.A[:]))
+		case dnsmessage.TypeAAAA:
+			r, err := p.AAAAResource()
+			if err != nil {
+				return nil, 0, err
+			}
+			ips = append(ips, net.IP(r.AAAA[:]))
+		default:
+			// e.g. the CNAMEs leading to them
+			if err := p.SkipAnswer(); err != nil {
+				return nil, 0, err
+			}
+			continue
+		}
+		ttl = min(ttl, time.Duration(answer.TTL)*time.Second)
+	}
+}
+
+type dotResolver struct {
+	resolver *net.Resolver
+}
+
+func (d *dotResolver) LookupIP(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	addrs, err := d.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, 0, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips, dotCacheTTL, nil
+}
+
+type cachingResolver struct {
+	resolver Resolver
+	sync.Mutex
+	cache map[string]cachedIPs
+}
+
+type cachedIPs struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+func (c *cachingResolver) LookupIP(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	host = strings.ToLower(host)
+	c.Lock()
+	cached, ok := c.cache[host]
+	c.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.ips, time.Until(cached.expires), nil
+	}
+	ips, ttl, err := c.resolver.LookupIP(ctx, host)
+	if err != nil {
+		return nil, 0, err
+	}
+	ttl = min(max(ttl, minResolverTTL), maxResolverTTL)
+	c.Lock()
+	defer c.Unlock()
+	for h, entry := range c.cache {
+		if time.Now().After(entry.expires) {
+			delete(c.cache, h)
+		}
+	}
+	c.cache[host] = cachedIPs{ips: ips, expires: time.Now().Add(ttl)}
+	return ips, ttl, nil
+}
+
+// systemResolver is the system resolver, for when we only need to choose
+// between the addresses it gives.
+type systemResolver struct{}
+
+func (systemResolver) LookupIP(ctx context.Context, host string) ([]net.IP, time.Duration, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, 0, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips, 0, nil
+}
+
+// dialResolved dials one of a host's public addresses, as looked up with
+// the resolver, in the order of the preference.
+func dialResolved(ctx context.Context, dialer *net.Dialer, resolver Resolver, preference netdial.Preference, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, address)
+	}
+	ips, _, err := resolver.LookupIP(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var public []net.IP
+	for _, ip := range ips {
+		if IsPublicIP(ip) && (network != "tcp4" || ip.To4() != nil) && (network != "tcp6" || ip.To4() == nil) {
+			public = append(public, ip)
+		}
+	}
+	if len(public) == 0 {
+		return nil, ErrForbiddenAddress
+	}
+	conn, _, err := preference.Dial(ctx, dialer.DialContext, network, public, port)
+	return conn, err
+}
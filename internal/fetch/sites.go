@@ -0,0 +1,133 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Site overrides what's sent to a domain and its subdomains, for sites that
+// block the default User-Agent or want particular headers.
+type Site struct {
+	UserAgent string
+	Headers   map[string]string
+}
+
+// site returns the most specific override for host.
+func (f *Fetcher) site(host string) (Site, bool) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for host != "" {
+		if site, ok := f.Sites[host]; ok {
+			return site, true
+		}
+		_, host, _ = strings.Cut(host, ".")
+	}
+	return Site{}, false
+}
+
+type acceptLanguageKey struct{}
+
+// WithAcceptLanguage has fetches made with ctx ask for these languages (an
+// Accept-Language value, e.g. "de, en;q=0.5") rather than the Fetcher's.
+func WithAcceptLanguage(ctx context.Context, languages string) context.Context {
+	if languages == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, acceptLanguageKey{}, languages)
+}
+
+// AcceptLanguage returns what fetches made with ctx ask for.
+func (f *Fetcher) AcceptLanguage(ctx context.Context) string {
+	if languages, ok := ctx.Value(acceptLanguageKey{}).(string); ok {
+		return languages
+	}
+	return f.Languages
+}
+
+func (f *Fetcher) setHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", f.UserAgent)
+	if languages := f.AcceptLanguage(req.Context()); languages != "" {
+		req.Header.Set("Accept-Language", languages)
+	}
+	site, ok := f.site(req.URL.Hostname())
+	if !ok {
+		return
+	}
+	if site.UserAgent != "" {
+		req.Header.Set("User-Agent", site.UserAgent)
+	}
+	for name, value := range site.Headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// Do sends a request with Client, as UserAgent or as its site says, with
+// the Accept-Language of its context and its site's headers; redirects get
+// those of the site they go to. Responses are decoded from brotli, zstd or
+// gzip. Hosts that rate limit us, or keep failing, aren't tried again until
+// they've had a rest.
+func (f *Fetcher) Do(req *http.Request) (*http.Response, error) {
+	host := strings.ToLower(req.URL.Hostname())
+	if err := f.backoff.check(host); err != nil {
+		return nil, err
+	}
+	f.setHeaders(req)
+	decode := acceptEncodings(req)
+	resp, err := f.client().Do(req)
+	// our own deadlines and refusals aren't the site's fault
+	if req.Context().Err() == nil && !errors.Is(err, ErrForbiddenAddress) {
+		f.backoff.record(respondingHost(host, resp, err), resp, err)
+	}
+	if err == nil && decode {
+		if err = decodeBody(resp); err != nil {
+			return nil, err
+		}
+	}
+	return resp, err
+}
+
+// respondingHost is the host a request was redirected to, if it was, which
+// is the one the response or error came from.
+func respondingHost(host string, resp *http.Response, err error) string {
+	var urlErr *url.Error
+	if resp != nil && resp.Request != nil {
+		return strings.ToLower(resp.Request.URL.Hostname())
+	} else if errors.As(err, &urlErr) {
+		if u, parseErr := url.Parse(urlErr.URL); parseErr == nil && u.Hostname() != "" {
+			return strings.ToLower(u.Hostname())
+		}
+	}
+	return host
+}
+
+func (f *Fetcher) client() *http.Client {
+	if len(f.Sites) == 0 {
+		return f.Client
+	}
+	client := *f.Client
+	checkRedirect := client.CheckRedirect
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if checkRedirect != nil {
+			if err := checkRedirect(req, via); err != nil {
+				return err
+			}
+		} else if len(via) >= maxRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxRedirects)
+		}
+		// the client copies the first request's headers to every hop, so
+		// drop those that were for the sites we've been redirected from
+		for _, hop := range via {
+			if site, ok := f.site(hop.URL.Hostname()); ok {
+				for name := range site.Headers {
+					req.Header.Del(name)
+				}
+			}
+		}
+		f.setHeaders(req)
+		return nil
+	}
+	return &client
+}
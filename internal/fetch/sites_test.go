@@ -0,0 +1,43 @@
+package fetch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSiteHeadersStayOnTheirSite(t *testing.T) {
+	var got http.Header
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+	}))
+	defer other.Close()
+	// the same server, under a name that isn't the site's
+	elsewhere := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	site := httptest.NewServer(http.RedirectHandler(elsewhere+"/landed", http.StatusFound))
+	defer site.Close()
+
+	f := &Fetcher{
+		Client:    &http.Client{},
+		UserAgent: "default/1.0",
+		Sites: map[string]Site{
+			"127.0.0.1": {UserAgent: "site/1.0", Headers: map[string]string{"X-Api-Key": "secret"}},
+		},
+	}
+	req, _ := http.NewRequest("GET", site.URL+"/start", nil)
+	resp, err := f.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got == nil {
+		t.Fatal("wasn't redirected")
+	}
+	if key := got.Get("X-Api-Key"); key != "" {
+		t.Errorf("the site's header followed the redirect: X-Api-Key: %s", key)
+	}
+	if ua := got.Get("User-Agent"); ua != "default/1.0" {
+		t.Errorf("User-Agent %q, want the default", ua)
+	}
+}
@@ -0,0 +1,28 @@
+package fetch
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Sanitize makes untrusted text (e.g. page titles) safe to send: no
+// invalid UTF-8, no control characters (which includes IRC formatting
+// and anything that could end the line), and no bidi overrides that could
+// make it look like someone else said something.
+func Sanitize(s string) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	return CollapseWhitespace(strings.Map(func(r rune) rune {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+			return ' '
+		case unicode.IsControl(r), unicode.Is(unicode.Bidi_Control, r):
+			return -1
+		}
+		return r
+	}, s))
+}
+
+// CollapseWhitespace replaces each run of whitespace with a single space.
+func CollapseWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,21 @@
+package fetch
+
+import "testing"
+
+func TestSanitize(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"A title", "A title"},
+		{"  lots \t of\n\nspace  ", "lots of space"},
+		{"line\r\nPRIVMSG #x :hi", "line PRIVMSG #x :hi"},
+		{"\x02bold\x02 \x0304red\x03 \x1ditalic\x0f", "bold 04red italic"},
+		{"nul\x00byte", "nulbyte"},
+		{"bad \xff utf-8", "bad � utf-8"},
+		{"evil‮gnp.exe", "evilgnp.exe"},
+		{"ünïcödé 日本語", "ünïcödé 日本語"},
+	}
+	for _, tt := range tests {
+		if got := Sanitize(tt.in); got != tt.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package fetch
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http/httptrace"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer uses whatever provider the program set up; it's a no-op otherwise.
+var tracer = otel.Tracer("wutbot")
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// httpSpans are the spans open for a request's connections; with happy
+// eyeballs, several addresses can be dialled at once.
+type httpSpans struct {
+	sync.Mutex
+	dns, handshake trace.Span
+	connects       map[string]trace.Span // by network and address
+}
+
+// withHTTPSpans adds spans for the DNS lookup, connection and TLS handshake
+// of the requests made with ctx.
+func withHTTPSpans(ctx context.Context) context.Context {
+	spans := &httpSpans{connects: make(map[string]trace.Span)}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		DNSStart: func(info httptrace.DNSStartInfo) {
+			_, dns := tracer.Start(ctx, "dns", trace.WithAttributes(attribute.String("net.host.name", info.Host)))
+			spans.Lock()
+			spans.dns = dns
+			spans.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			spans.Lock()
+			dns := spans.dns
+			spans.dns = nil
+			spans.Unlock()
+			if dns != nil {
+				endSpan(dns, info.Err)
+			}
+		},
+		ConnectStart: func(network, addr string) {
+			_, connect := tracer.Start(ctx, "connect", trace.WithAttributes(attribute.String("net.peer.addr", addr)))
+			spans.Lock()
+			spans.connects[network+" "+addr] = connect
+			spans.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			spans.Lock()
+			connect := spans.connects[network+" "+addr]
+			delete(spans.connects, network+" "+addr)
+			spans.Unlock()
+			if connect != nil {
+				endSpan(connect, err)
+			}
+		},
+		TLSHandshakeStart: func() {
+			_, handshake := tracer.Start(ctx, "tls")
+			spans.Lock()
+			spans.handshake = handshake
+			spans.Unlock()
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			spans.Lock()
+			handshake := spans.handshake
+			spans.handshake = nil
+			spans.Unlock()
+			if handshake != nil {
+				endSpan(handshake, err)
+			}
+		},
+	})
+}
@@ -0,0 +1,72 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// spanRecorder records the package's spans; the global provider can only
+// be set once for tracer.
+var spanRecorder = sync.OnceValue(func() *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+})
+
+func TestConcurrentConnectSpans(t *testing.T) {
+	recorder := spanRecorder()
+	ct := httptrace.ContextClientTrace(withHTTPSpans(context.Background()))
+	addrs := []string{"[2001:db8::1]:443", "192.0.2.1:443"}
+	var wg sync.WaitGroup
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ct.ConnectStart("tcp", addr)
+		}()
+	}
+	wg.Wait()
+	// the IPv4 attempt wins; the IPv6 one is cancelled after it
+	ct.ConnectDone("tcp", addrs[1], nil)
+	ct.ConnectDone("tcp", addrs[0], errors.New("operation was canceled"))
+
+	failed := make(map[string]bool)
+	for _, span := range recorder.Ended() {
+		for _, attr := range span.Attributes() {
+			if attr.Key == "net.peer.addr" {
+				failed[attr.Value.AsString()] = span.Status().Code == codes.Error
+			}
+		}
+	}
+	if len(failed) != 2 || !failed[addrs[0]] || failed[addrs[1]] {
+		t.Errorf("ended connect spans, by whether they failed: %v", failed)
+	}
+}
+
+func TestSpansEndWithoutADocument(t *testing.T) {
+	recorder := spanRecorder()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("just text"))
+	}))
+	defer server.Close()
+	f := &Fetcher{Client: &http.Client{}}
+	if _, err := f.Fetch(context.Background(), server.URL); err != nil {
+		t.Fatal(err)
+	}
+	for _, span := range recorder.Started() {
+		if span.EndTime().IsZero() {
+			t.Errorf("%s span wasn't ended", span.Name())
+		}
+	}
+}
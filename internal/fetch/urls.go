@@ -0,0 +1,38 @@
+package fetch
+
+import (
+	"regexp"
+	"strings"
+)
+
+var urlRegex = regexp.MustCompile(`(?i)\bhttps?://[^\s<>"]+`)
+
+// ExtractURLs returns the distinct http(s) URLs in a message.
+func ExtractURLs(message string) (result []string) {
+	seen := make(map[string]bool)
+	for _, u := range urlRegex.FindAllString(message, -1) {
+		u = trimURLPunctuation(u)
+		if !seen[u] {
+			seen[u] = true
+			result = append(result, u)
+		}
+	}
+	return
+}
+
+// trimURLPunctuation removes trailing punctuation that more likely belongs
+// to the surrounding sentence, keeping balanced parentheses (e.g. Wikipedia).
+func trimURLPunctuation(u string) string {
+	for len(u) != 0 {
+		last := u[len(u)-1]
+		switch {
+		case strings.IndexByte(".,;:!?'\"]}>", last) != -1:
+			u = u[:len(u)-1]
+		case last == ')' && strings.Count(u, "(") < strings.Count(u, ")"):
+			u = u[:len(u)-1]
+		default:
+			return u
+		}
+	}
+	return u
+}
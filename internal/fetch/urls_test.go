@@ -0,0 +1,29 @@
+package fetch
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractURLs(t *testing.T) {
+	tests := []struct {
+		message string
+		want    []string
+	}{
+		{"no links here", nil},
+		{"see https://example.com/a and http://example.org.", []string{"https://example.com/a", "http://example.org"}},
+		{"HTTPS://EXAMPLE.COM/Path?q=1", []string{"HTTPS://EXAMPLE.COM/Path?q=1"}},
+		{"twice: https://example.com https://example.com", []string{"https://example.com"}},
+		{"(at https://example.com/x)", []string{"https://example.com/x"}},
+		{"https://en.wikipedia.org/wiki/Go_(programming_language), it says", []string{"https://en.wikipedia.org/wiki/Go_(programming_language)"}},
+		{`<a href="https://example.com/q">`, []string{"https://example.com/q"}},
+		{"is it https://example.com/?!", []string{"https://example.com/"}},
+		{"ftp://example.com and example.com aren't", nil},
+		{"https://", nil},
+	}
+	for _, tt := range tests {
+		if got := ExtractURLs(tt.message); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ExtractURLs(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Package httpfixture records HTTP responses to files and replays them, so
+// that fetching and title extraction can be exercised without the network.
+package httpfixture
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Mode string
+
+const (
+	// Record makes real requests, saving each response
+	Record Mode = "record"
+	// Replay answers from the saved responses only
+	Replay Mode = "replay"
+
+	// bodies are cut short past this, more than the fetchers ever read
+	maxBodyBytes = 4 << 20
+)
+
+var ErrNoFixture = errors.New("no fixture")
+
+// Fixture is a saved response, one per JSON file.
+type Fixture struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// ParseMode parses "record" or "replay" (the default, if s is empty).
+func ParseMode(s string) (Mode, error) {
+	switch Mode(s) {
+	case "", Replay:
+		return Replay, nil
+	case Record:
+		return Record, nil
+	}
+	return "", fmt.Errorf("unknown fixture mode %q", s)
+}
+
+// FileName is where a request's fixture is kept: named after the host, so
+// the directory is easy to browse, and a hash of the method and URL.
+func FileName(method, rawURL string) string {
+	sum := sha256.Sum256([]byte(method + " " + rawURL))
+	host := rawURL
+	if _, rest, ok := strings.Cut(host, "://"); ok {
+		host = rest
+	}
+	host, _, _ = strings.Cut(host, "/")
+	host = strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' || ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.ToLower(host))
+	return host + "-" + hex.EncodeToString(sum[:6]) + ".json"
+}
+
+// Transport records or replays responses in Dir. Redirects are followed by
+// the client, so each hop gets its own fixture.
+type Transport struct {
+	Dir  string
+	Mode Mode
+	// makes the real requests when recording; http.DefaultTransport if nil
+	Next http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := filepath.Join(t.Dir, FileName(req.Method, req.URL.String()))
+	if t.Mode == Record {
+		return t.record(req, path)
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w for %s %s", ErrNoFixture, req.Method, req.URL)
+	} else if err != nil {
+		return nil, err
+	}
+	var f Fixture
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f.response(req), nil
+}
+
+func (t *Transport) record(req *http.Request, path string) (*http.Response, error) {
+	next := t.Next
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	resp, err := next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodyBytes))
+	if err != nil {
+		return nil, err
+	}
+	header := resp.Header.Clone()
+	// cookies and the like are no use in a replay, and may be private
+	for _, name := range []string{"Set-Cookie", "Date", "Expires", "Age", "Content-Length"} {
+		header.Del(name)
+	}
+	f := Fixture{Method: req.Method, URL: req.URL.String(), Status: resp.StatusCode, Header: header, Body: string(body)}
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	// keep the HTML readable
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(f); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, data.Bytes(), 0644); err != nil {
+		return nil, err
+	}
+	return f.response(req), nil
+}
+
+func (f *Fixture) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", f.Status, http.StatusText(f.Status)),
+		StatusCode:    f.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        f.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader([]byte(f.Body))),
+		ContentLength: int64(len(f.Body)),
+		Request:       req,
+	}
+}
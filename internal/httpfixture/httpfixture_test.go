@@ -0,0 +1,88 @@
+package httpfixture
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRecordReplay(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Set-Cookie", "session=secret")
+		w.WriteHeader(http.StatusTeapot)
+		io.WriteString(w, "<title>Recorded</title>")
+	}))
+	defer server.Close()
+	dir := t.TempDir()
+
+	get := func(mode Mode) *http.Response {
+		t.Helper()
+		client := &http.Client{Transport: &Transport{Dir: dir, Mode: mode}}
+		resp, err := client.Get(server.URL + "/page?q=1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	check := func(resp *http.Response) {
+		t.Helper()
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != http.StatusTeapot || string(body) != "<title>Recorded</title>" || resp.Header.Get("Content-Type") != "text/html" {
+			t.Errorf("got %d %q %v", resp.StatusCode, body, resp.Header)
+		}
+		if resp.Header.Get("Set-Cookie") != "" {
+			t.Error("cookie was recorded")
+		}
+	}
+	check(get(Record))
+	check(get(Replay))
+	if requests != 1 {
+		t.Errorf("%d requests, want 1", requests)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, FileName("GET", server.URL+"/page?q=1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// kept readable
+	if !strings.Contains(string(data), "<title>Recorded</title>") {
+		t.Errorf("fixture is %s", data)
+	}
+}
+
+func TestReplayMissing(t *testing.T) {
+	client := &http.Client{Transport: &Transport{Dir: t.TempDir(), Mode: Replay}}
+	if _, err := client.Get("https://example.com/"); !errors.Is(err, ErrNoFixture) {
+		t.Errorf("got %v, want ErrNoFixture", err)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	name := FileName("GET", "https://Www.Example.com:8443/a?b")
+	if !strings.HasPrefix(name, "www.example.com_8443-") || !strings.HasSuffix(name, ".json") {
+		t.Errorf("FileName = %q", name)
+	}
+	if name == FileName("HEAD", "https://Www.Example.com:8443/a?b") {
+		t.Error("methods share a fixture")
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for s, want := range map[string]Mode{"": Replay, "replay": Replay, "record": Record} {
+		if got, err := ParseMode(s); err != nil || got != want {
+			t.Errorf("ParseMode(%q) = %q, %v", s, got, err)
+		}
+	}
+	if _, err := ParseMode("rewind"); err == nil {
+		t.Error(`ParseMode("rewind") succeeded`)
+	}
+}
@@ -0,0 +1,137 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DiscordAPI = "https://discord.com/api/v10"
+	// how long to wait out a 429 without a usable Retry-After, and at most
+	defaultDiscordRetryAfter = time.Second
+	maxDiscordRetryAfter     = time.Minute
+)
+
+// Discord reads channels through the API, as a bot user, and posts to
+// webhooks.
+type Discord struct {
+	Token     string // the bot user's; only needed to read channels
+	UserAgent string
+	Client    *http.Client
+	// DiscordAPI if empty
+	API string
+}
+
+type DiscordMessage struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+	// set for messages posted by webhooks, including our own
+	WebhookID string `json:"webhook_id"`
+	Author    struct {
+		ID         string `json:"id"`
+		Username   string `json:"username"`
+		GlobalName string `json:"global_name"`
+		Bot        bool   `json:"bot"`
+	} `json:"author"`
+	Mentions []struct {
+		ID       string `json:"id"`
+		Username string `json:"username"`
+	} `json:"mentions"`
+	Attachments []struct {
+		URL string `json:"url"`
+	} `json:"attachments"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// discordIDLess compares snowflakes, which are decimal numbers.
+func discordIDLess(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) < len(b)
+	}
+	return a < b
+}
+
+// Messages returns up to limit of a channel's newest messages, after the
+// message ID after if it isn't empty, oldest first.
+func (d *Discord) Messages(ctx context.Context, channelID, after string, limit int) ([]DiscordMessage, error) {
+	path := "/channels/" + channelID + "/messages?limit=" + strconv.Itoa(limit)
+	if after != "" {
+		path += "&after=" + after
+	}
+	var messages []DiscordMessage
+	if err := d.get(ctx, path, &messages); err != nil {
+		return nil, err
+	}
+	sort.Slice(messages, func(i, j int) bool { return discordIDLess(messages[i].ID, messages[j].ID) })
+	return messages, nil
+}
+
+// get calls the API as our bot user.
+func (d *Discord) get(ctx context.Context, path string, result interface{}) error {
+	api := d.API
+	if api == "" {
+		api = DiscordAPI
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", api+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", d.UserAgent)
+	req.Header.Set("Authorization", "Bot "+d.Token)
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("discord returned %s", resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(result)
+}
+
+// PostWebhook posts body to a webhook, returning how long to wait before
+// the next post: to retry this one if err is set, or because we've used up
+// the webhook's rate limit.
+func (d *Discord) PostWebhook(ctx context.Context, webhook string, body interface{}) (wait time.Duration, err error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", webhook, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", d.UserAgent)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return discordRetryAfter(resp.Header.Get("Retry-After")), fmt.Errorf("%s", resp.Status)
+	case resp.StatusCode/100 != 2:
+		return 0, fmt.Errorf("%s", resp.Status)
+	case resp.Header.Get("X-RateLimit-Remaining") == "0":
+		return discordRetryAfter(resp.Header.Get("X-RateLimit-Reset-After")), nil
+	}
+	return 0, nil
+}
+
+// discordRetryAfter parses a number of seconds, which can be fractional.
+func discordRetryAfter(header string) time.Duration {
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(header), 64)
+	if err != nil || seconds <= 0 {
+		return defaultDiscordRetryAfter
+	}
+	return min(time.Duration(seconds*float64(time.Second)), maxDiscordRetryAfter)
+}
@@ -0,0 +1,98 @@
+package integrations
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDiscordMessages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bot token" || r.URL.Path != "/channels/123/messages" {
+			http.Error(w, "no", http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Query().Get("after") != "99" || r.URL.Query().Get("limit") != "50" {
+			t.Errorf("queried %s", r.URL.RawQuery)
+		}
+		// newest first, as Discord has them
+		w.Write([]byte(`[{"id":"1000","content":"third"},{"id":"998","content":"second"},{"id":"100","content":"first"}]`))
+	}))
+	defer server.Close()
+
+	d := &Discord{Token: "token", Client: server.Client(), API: server.URL}
+	messages, err := d.Messages(context.Background(), "123", "99", 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents []string
+	for _, msg := range messages {
+		contents = append(contents, msg.Content)
+	}
+	if len(contents) != 3 || contents[0] != "first" || contents[2] != "third" {
+		t.Errorf("in the order %q", contents)
+	}
+
+	d.Token = "wrong"
+	if _, err := d.Messages(context.Background(), "123", "99", 50); err == nil {
+		t.Error("no error for a 401")
+	}
+}
+
+func TestDiscordPostWebhook(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/limited":
+			w.Header().Set("Retry-After", "0.5")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/last":
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset-After", "2")
+			w.WriteHeader(http.StatusNoContent)
+		case "/gone":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	defer server.Close()
+
+	d := &Discord{Client: server.Client()}
+	tests := []struct {
+		path string
+		wait time.Duration
+		ok   bool
+	}{
+		{"/ok", 0, true},
+		{"/limited", 500 * time.Millisecond, false},
+		{"/last", 2 * time.Second, true},
+		{"/gone", 0, false},
+	}
+	for _, tt := range tests {
+		wait, err := d.PostWebhook(context.Background(), server.URL+tt.path, map[string]string{"content": "hi"})
+		if wait != tt.wait || (err == nil) != tt.ok {
+			t.Errorf("%s: wait %v, err %v", tt.path, wait, err)
+		}
+	}
+}
+
+func TestDiscordRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		want   time.Duration
+	}{
+		{"1.5", 1500 * time.Millisecond},
+		{" 3 ", 3 * time.Second},
+		{"", defaultDiscordRetryAfter},
+		{"-1", defaultDiscordRetryAfter},
+		{"soon", defaultDiscordRetryAfter},
+		{"3600", maxDiscordRetryAfter},
+	}
+	for _, tt := range tests {
+		if got := discordRetryAfter(tt.header); got != tt.want {
+			t.Errorf("discordRetryAfter(%q) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
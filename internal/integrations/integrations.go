@@ -0,0 +1,15 @@
+// Package integrations are clients for the chat networks the bot bridges
+// to besides IRC: Matrix, XMPP and Discord. They don't know about the bot;
+// what they receive goes to the handler they're run with.
+package integrations
+
+import (
+	"time"
+)
+
+const (
+	// for each request, except for Matrix syncs, which wait longer
+	requestTimeout = 15 * time.Second
+	// longer API responses are cut off
+	maxResponseBytes = 1 << 20
+)
@@ -0,0 +1,313 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The Matrix client logs in as a regular user (with an access token), and
+// joins the rooms it's configured with by name (e.g. "#room:example.org" or
+// "!id:example.org").
+
+const (
+	matrixSyncTimeout = 30 * time.Second
+	// outgoing messages are dropped once this many are waiting
+	matrixQueueSize   = 256
+	minMatrixRetry    = time.Second
+	maxMatrixRetry    = 5 * time.Minute
+	matrixSendRetries = 3
+	// all we want from the first sync is where it leaves off
+	matrixInitialFilter = `{"room":{"timeline":{"limit":1}}}`
+)
+
+// MatrixMessage is a message to send to a room.
+type MatrixMessage struct {
+	RoomID  string
+	Text    string
+	Notice  bool
+	ReplyTo string // event ID
+}
+
+// A MatrixHandler handles the messages sent to the rooms, by the name
+// each room is configured as.
+type MatrixHandler interface {
+	HandleMatrixMessage(room string, ev *MatrixEvent)
+}
+
+// MatrixHandlerFunc lets a function be a MatrixHandler.
+type MatrixHandlerFunc func(room string, ev *MatrixEvent)
+
+func (f MatrixHandlerFunc) HandleMatrixMessage(room string, ev *MatrixEvent) {
+	f(room, ev)
+}
+
+type Matrix struct {
+	homeserver string
+	userID     string
+	token      string
+	configured []string
+	client     *http.Client
+	outgoing   chan MatrixMessage
+	txnID      uint64
+
+	mu    sync.Mutex
+	rooms map[string]string // room ID -> the name it's configured as
+	ids   map[string]string // casefolded name -> room ID
+}
+
+// NewMatrix returns nil if there's no homeserver configured.
+func NewMatrix(homeserver, userID, token string, rooms []string) (*Matrix, error) {
+	if homeserver == "" {
+		return nil, nil
+	}
+	if userID == "" || token == "" {
+		return nil, errors.New("Matrix needs a user ID and an access token")
+	}
+	m := &Matrix{
+		homeserver: strings.TrimSuffix(homeserver, "/"),
+		userID:     userID,
+		token:      token,
+		client:     &http.Client{Timeout: matrixSyncTimeout + requestTimeout},
+		outgoing:   make(chan MatrixMessage, matrixQueueSize),
+		rooms:      make(map[string]string),
+		ids:        make(map[string]string),
+	}
+	for _, room := range rooms {
+		if room = strings.TrimSpace(room); room != "" {
+			m.configured = append(m.configured, room)
+		}
+	}
+	return m, nil
+}
+
+// RoomID returns the ID of a room by its configured name: empty if we
+// haven't joined it yet, and with isRoom false if it isn't one of ours.
+// It's nil-safe, for when Matrix isn't configured.
+func (m *Matrix) RoomID(name string) (id string, isRoom bool) {
+	if m == nil {
+		return "", false
+	}
+	for _, room := range m.configured {
+		if strings.EqualFold(room, name) {
+			isRoom = true
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.ids[strings.ToLower(name)], isRoom
+}
+
+func (m *Matrix) roomName(id string) (name string, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name, ok = m.rooms[id]
+	return
+}
+
+// call makes a client-server API request, decoding the response into
+// result if it isn't nil.
+func (m *Matrix) call(ctx context.Context, method, path string, body, result interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, m.homeserver+"/_matrix/client/v3"+path, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var matrixErr struct {
+			Code       string `json:"errcode"`
+			Error      string `json:"error"`
+			RetryAfter int64  `json:"retry_after_ms"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&matrixErr)
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return &matrixRateLimited{time.Duration(matrixErr.RetryAfter) * time.Millisecond}
+		}
+		return fmt.Errorf("matrix: %s: %s %s", resp.Status, matrixErr.Code, matrixErr.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+type matrixRateLimited struct {
+	retryAfter time.Duration
+}
+
+func (e *matrixRateLimited) Error() string {
+	return fmt.Sprintf("matrix: rate limited for %v", e.retryAfter)
+}
+
+// joinRooms joins (or confirms we're in) the configured rooms.
+func (m *Matrix) joinRooms(ctx context.Context) error {
+	for _, name := range m.configured {
+		var joined struct {
+			RoomID string `json:"room_id"`
+		}
+		if err := m.call(ctx, "POST", "/join/"+url.PathEscape(name), struct{}{}, &joined); err != nil {
+			return fmt.Errorf("couldn't join %s: %w", name, err)
+		}
+		m.mu.Lock()
+		m.rooms[joined.RoomID] = name
+		m.ids[strings.ToLower(name)] = joined.RoomID
+		m.mu.Unlock()
+	}
+	return nil
+}
+
+func (m *Matrix) send(ctx context.Context, msg MatrixMessage) error {
+	content := map[string]interface{}{"msgtype": "m.text", "body": msg.Text}
+	if msg.Notice {
+		content["msgtype"] = "m.notice"
+	}
+	if msg.ReplyTo != "" {
+		content["m.relates_to"] = map[string]interface{}{"m.in_reply_to": map[string]string{"event_id": msg.ReplyTo}}
+	}
+	txnID := strconv.FormatInt(time.Now().UnixNano(), 36) + "." + strconv.FormatUint(atomic.AddUint64(&m.txnID, 1), 36)
+	path := "/rooms/" + url.PathEscape(msg.RoomID) + "/send/m.room.message/" + txnID
+	for attempt := 1; ; attempt++ {
+		err := m.call(ctx, "PUT", path, content, nil)
+		var limited *matrixRateLimited
+		if !errors.As(err, &limited) || attempt == matrixSendRetries {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(max(limited.retryAfter, minMatrixRetry)):
+		}
+	}
+}
+
+// Queue queues a message to be sent, without blocking.
+func (m *Matrix) Queue(msg MatrixMessage) error {
+	select {
+	case m.outgoing <- msg:
+		return nil
+	default:
+		return errors.New("matrix send queue is full")
+	}
+}
+
+type matrixSync struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []MatrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+	} `json:"rooms"`
+}
+
+// MatrixEvent is a room event, as the client-server API has it.
+type MatrixEvent struct {
+	Type      string `json:"type"`
+	EventID   string `json:"event_id"`
+	Sender    string `json:"sender"`
+	Timestamp int64  `json:"origin_server_ts"`
+	Content   struct {
+		MsgType   string `json:"msgtype"`
+		Body      string `json:"body"`
+		RelatesTo struct {
+			RelType string `json:"rel_type"`
+		} `json:"m.relates_to"`
+	} `json:"content"`
+}
+
+// Run joins the rooms and passes their messages to h until ctx is done,
+// retrying with a backoff, and sends what's queued meanwhile.
+func (m *Matrix) Run(ctx context.Context, h MatrixHandler, logger *slog.Logger) {
+	go m.runSender(ctx, logger)
+	delay := minMatrixRetry
+	var since string
+	for ctx.Err() == nil {
+		err := m.joinRooms(ctx)
+		for err == nil {
+			var result matrixSync
+			query := url.Values{"timeout": {strconv.FormatInt(matrixSyncTimeout.Milliseconds(), 10)}}
+			if since != "" {
+				query.Set("since", since)
+			} else {
+				query.Set("filter", matrixInitialFilter)
+			}
+			if err = m.call(ctx, "GET", "/sync?"+query.Encode(), nil, &result); err != nil {
+				break
+			}
+			// the first sync is the rooms' history, which isn't news
+			if since != "" {
+				m.handleSync(&result, h)
+			}
+			since, delay = result.NextBatch, minMatrixRetry
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("matrix sync failed", "err", err, "retry", delay)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxMatrixRetry)
+	}
+}
+
+func (m *Matrix) handleSync(result *matrixSync, h MatrixHandler) {
+	for roomID, room := range result.Rooms.Join {
+		name, ok := m.roomName(roomID)
+		if !ok {
+			continue
+		}
+		for i := range room.Timeline.Events {
+			ev := &room.Timeline.Events[i]
+			// notices are from bots, which we don't answer, and edits aren't new
+			if ev.Type != "m.room.message" || ev.Sender == m.userID || ev.Content.MsgType != "m.text" || ev.Content.RelatesTo.RelType == "m.replace" {
+				continue
+			}
+			h.HandleMatrixMessage(name, ev)
+		}
+	}
+}
+
+func (m *Matrix) runSender(ctx context.Context, logger *slog.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-m.outgoing:
+			sendCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+			if err := m.send(sendCtx, msg); err != nil {
+				logger.Warn("couldn't send", "room", msg.RoomID, "err", err)
+			}
+			cancel()
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMatrix(t *testing.T) {
+	var mu sync.Mutex
+	var syncs int
+	sent := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch path := strings.TrimPrefix(r.URL.Path, "/_matrix/client/v3"); {
+		case path == "/join/#room:example.org":
+			w.Write([]byte(`{"room_id":"!abc:example.org"}`))
+		case path == "/sync":
+			mu.Lock()
+			syncs++
+			first := syncs == 1
+			mu.Unlock()
+			if first {
+				// history, which isn't passed on
+				w.Write([]byte(`{"next_batch":"s1","rooms":{"join":{"!abc:example.org":{"timeline":{"events":[
+					{"type":"m.room.message","event_id":"$old","sender":"@alice:example.org","content":{"msgtype":"m.text","body":"old"}}]}}}}}`))
+				return
+			}
+			if r.URL.Query().Get("since") != "s1" {
+				w.Write([]byte(`{"next_batch":"s2"}`))
+				return
+			}
+			w.Write([]byte(`{"next_batch":"s2","rooms":{"join":{"!abc:example.org":{"timeline":{"events":[
+				{"type":"m.room.message","event_id":"$notice","sender":"@bot:example.org","content":{"msgtype":"m.notice","body":"beep"}},
+				{"type":"m.room.message","event_id":"$self","sender":"@wutbot:example.org","content":{"msgtype":"m.text","body":"from us"}},
+				{"type":"m.room.message","event_id":"$edit","sender":"@alice:example.org","content":{"msgtype":"m.text","body":"* hi","m.relates_to":{"rel_type":"m.replace"}}},
+				{"type":"m.room.message","event_id":"$new","sender":"@alice:example.org","content":{"msgtype":"m.text","body":"hello"}}]}}}}}`))
+		case strings.HasPrefix(path, "/rooms/!abc:example.org/send/m.room.message/"):
+			var content map[string]interface{}
+			json.NewDecoder(r.Body).Decode(&content)
+			sent <- content
+			w.Write([]byte(`{"event_id":"$sent"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	m, err := NewMatrix(server.URL+"/", "@wutbot:example.org", "token", []string{" #room:example.org", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, isRoom := m.RoomID("#Room:example.org"); id != "" || !isRoom {
+		t.Errorf("before joining: %q, %v", id, isRoom)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	received := make(chan string, 10)
+	go m.Run(ctx, MatrixHandlerFunc(func(room string, ev *MatrixEvent) {
+		received <- room + " " + ev.EventID + " " + ev.Content.Body
+	}), slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	select {
+	case got := <-received:
+		if got != "#room:example.org $new hello" {
+			t.Errorf("received %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing received")
+	}
+	if id, _ := m.RoomID("#room:example.org"); id != "!abc:example.org" {
+		t.Errorf("joined %q", id)
+	}
+
+	if err := m.Queue(MatrixMessage{RoomID: "!abc:example.org", Text: "hi", Notice: true, ReplyTo: "$new"}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case content := <-sent:
+		relatesTo, _ := content["m.relates_to"].(map[string]interface{})
+		if content["msgtype"] != "m.notice" || content["body"] != "hi" || relatesTo["m.in_reply_to"] == nil {
+			t.Errorf("sent %v", content)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing sent")
+	}
+}
+
+func TestNewMatrix(t *testing.T) {
+	if m, err := NewMatrix("", "", "", nil); m != nil || err != nil {
+		t.Errorf("unconfigured: %v, %v", m, err)
+	}
+	if _, err := NewMatrix("https://example.org", "@wutbot:example.org", "", nil); err == nil {
+		t.Error("no error without a token")
+	}
+	var m *Matrix
+	if _, isRoom := m.RoomID("#room:example.org"); isRoom {
+		t.Error("a nil client has rooms")
+	}
+}
@@ -0,0 +1,377 @@
+package integrations
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircfmt"
+)
+
+// The XMPP client logs in as its own account, and takes chat messages from
+// the owner (by bare JID, which their server vouches for). It's a minimal
+// client: STARTTLS, SASL PLAIN, and chat messages.
+
+const (
+	xmppDialTimeout = 30 * time.Second
+	// whitespace is sent this often, so that dead connections are noticed
+	xmppKeepalive = 2 * time.Minute
+	minXMPPRetry  = time.Second
+	maxXMPPRetry  = 5 * time.Minute
+
+	nsXMPPStream = "http://etherx.jabber.org/streams"
+	nsXMPPTLS    = "urn:ietf:params:xml:ns:xmpp-tls"
+	nsXMPPSASL   = "urn:ietf:params:xml:ns:xmpp-sasl"
+	nsXMPPBind   = "urn:ietf:params:xml:ns:xmpp-bind"
+)
+
+type XMPP struct {
+	local, domain, resource string
+	password                string
+	server                  string // host:port, if not found with SRV
+	owner                   string // bare JID
+
+	mu   sync.Mutex
+	conn net.Conn // nil while disconnected
+}
+
+// NewXMPP returns nil if there's no JID configured.
+func NewXMPP(jid, password, server, owner string) (*XMPP, error) {
+	if jid == "" {
+		return nil, nil
+	}
+	local, domain, _ := strings.Cut(jid, "@")
+	domain, resource, _ := strings.Cut(domain, "/")
+	if local == "" || domain == "" || password == "" || owner == "" {
+		return nil, errors.New("XMPP needs a JID (user@domain), a password and the owner's JID")
+	}
+	if resource == "" {
+		resource = "wutbot"
+	}
+	return &XMPP{local: local, domain: domain, resource: resource, password: password, server: server, owner: bareJID(owner)}, nil
+}
+
+// bareJID strips the resource, and casefolds what's left closely enough.
+func bareJID(jid string) string {
+	jid, _, _ = strings.Cut(jid, "/")
+	return strings.ToLower(jid)
+}
+
+// Owner is the owner's bare JID.
+func (x *XMPP) Owner() string {
+	return x.owner
+}
+
+// IsOwner returns whether target is the owner's JID (bare or full). It's
+// nil-safe, for when XMPP isn't configured.
+func (x *XMPP) IsOwner(target string) bool {
+	return x != nil && strings.Contains(target, "@") && bareJID(target) == x.owner
+}
+
+// Connected is nil-safe too.
+func (x *XMPP) Connected() bool {
+	if x == nil {
+		return false
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.conn != nil
+}
+
+type xmppFeatures struct {
+	StartTLS   *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-tls starttls"`
+	Mechanisms []string  `xml:"urn:ietf:params:xml:ns:xmpp-sasl mechanisms>mechanism"`
+	Bind       *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+}
+
+type xmppStanza struct {
+	XMLName xml.Name
+	ID      string    `xml:"id,attr"`
+	From    string    `xml:"from,attr"`
+	Type    string    `xml:"type,attr"`
+	Body    string    `xml:"body"`
+	Ping    *struct{} `xml:"urn:xmpp:ping ping"`
+}
+
+// xmppEscape escapes text for XML, dropping IRC formatting and anything
+// XML can't carry.
+func xmppEscape(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' || r == 0xFFFE || r == 0xFFFF {
+			return -1
+		}
+		return r
+	}, ircfmt.Strip(strings.ToValidUTF8(text, "\uFFFD")))
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
+
+// nextElement skips to the next element, returning io.EOF at the end of
+// the stream.
+func nextElement(dec *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			return t, nil
+		case xml.EndElement:
+			if t.Name.Space == nsXMPPStream && t.Name.Local == "stream" {
+				return xml.StartElement{}, io.EOF
+			}
+		}
+	}
+}
+
+// openStream (re)starts the stream over conn, returning the server's
+// features.
+func (x *XMPP) openStream(conn net.Conn) (*xml.Decoder, *xmppFeatures, error) {
+	_, err := fmt.Fprintf(conn, "<?xml version='1.0'?><stream:stream to='%s' xmlns='jabber:client' xmlns:stream='%s' version='1.0'>", xmppEscape(x.domain), nsXMPPStream)
+	if err != nil {
+		return nil, nil, err
+	}
+	dec := xml.NewDecoder(conn)
+	var features xmppFeatures
+	for {
+		start, err := nextElement(dec)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch start.Name.Local {
+		case "stream":
+			continue
+		case "features":
+			err = dec.DecodeElement(&features, &start)
+			return dec, &features, err
+		default:
+			return nil, nil, fmt.Errorf("xmpp: expected stream features, got %s", start.Name.Local)
+		}
+	}
+}
+
+// expect reads the next element, failing unless it's one of names.
+func expect(dec *xml.Decoder, names ...string) (xml.StartElement, error) {
+	start, err := nextElement(dec)
+	if err != nil {
+		return start, err
+	}
+	for _, name := range names {
+		if start.Name.Local == name {
+			return start, dec.Skip()
+		}
+	}
+	return start, fmt.Errorf("xmpp: %s, expected %s", start.Name.Local, strings.Join(names, " or "))
+}
+
+// dial connects, negotiates TLS, logs in and binds a resource.
+func (x *XMPP) dial(ctx context.Context) (net.Conn, *xml.Decoder, error) {
+	addr := x.server
+	if addr == "" {
+		addr = net.JoinHostPort(x.domain, "5222")
+		if _, srvs, err := net.DefaultResolver.LookupSRV(ctx, "xmpp-client", "tcp", x.domain); err == nil && len(srvs) != 0 && srvs[0].Target != "." {
+			addr = net.JoinHostPort(strings.TrimSuffix(srvs[0].Target, "."), fmt.Sprint(srvs[0].Port))
+		}
+	}
+	dialer := net.Dialer{Timeout: xmppDialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Now().Add(xmppDialTimeout))
+	conn, dec, err := x.negotiate(conn)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, dec, nil
+}
+
+func (x *XMPP) negotiate(conn net.Conn) (net.Conn, *xml.Decoder, error) {
+	dec, features, err := x.openStream(conn)
+	if err != nil {
+		return conn, nil, err
+	}
+	// never send the password in the clear
+	if features.StartTLS == nil {
+		return conn, nil, errors.New("xmpp: server doesn't offer STARTTLS")
+	}
+	fmt.Fprintf(conn, "<starttls xmlns='%s'/>", nsXMPPTLS)
+	if _, err := expect(dec, "proceed"); err != nil {
+		return conn, nil, err
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: x.domain})
+	if err := tlsConn.Handshake(); err != nil {
+		return conn, nil, err
+	}
+	conn = tlsConn
+	if dec, features, err = x.openStream(conn); err != nil {
+		return conn, nil, err
+	}
+	plain := false
+	for _, mechanism := range features.Mechanisms {
+		plain = plain || mechanism == "PLAIN"
+	}
+	if !plain {
+		return conn, nil, errors.New("xmpp: server doesn't offer SASL PLAIN")
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte("\x00" + x.local + "\x00" + x.password))
+	fmt.Fprintf(conn, "<auth xmlns='%s' mechanism='PLAIN'>%s</auth>", nsXMPPSASL, auth)
+	if start, err := expect(dec, "success"); err != nil {
+		if start.Name.Local == "failure" {
+			err = errors.New("xmpp: login failed")
+		}
+		return conn, nil, err
+	}
+	if dec, features, err = x.openStream(conn); err != nil {
+		return conn, nil, err
+	}
+	if features.Bind == nil {
+		return conn, nil, errors.New("xmpp: server doesn't offer resource binding")
+	}
+	fmt.Fprintf(conn, "<iq type='set' id='bind'><bind xmlns='%s'><resource>%s</resource></bind></iq>", nsXMPPBind, xmppEscape(x.resource))
+	var bound xmppStanza
+	if start, err := nextElement(dec); err != nil {
+		return conn, nil, err
+	} else if err := dec.DecodeElement(&bound, &start); err != nil {
+		return conn, nil, err
+	}
+	if bound.Type != "result" {
+		return conn, nil, errors.New("xmpp: couldn't bind a resource")
+	}
+	_, err = fmt.Fprint(conn, "<presence/>")
+	return conn, dec, err
+}
+
+// write sends a raw stanza, if we're connected.
+func (x *XMPP) write(stanza string) error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.conn == nil {
+		return errors.New("xmpp: not connected")
+	}
+	x.conn.SetWriteDeadline(time.Now().Add(requestTimeout))
+	_, err := io.WriteString(x.conn, stanza)
+	if err != nil {
+		// the read loop will notice, and reconnect
+		x.conn.Close()
+	}
+	return err
+}
+
+// Send sends a chat message.
+func (x *XMPP) Send(to, text string) error {
+	return x.write(fmt.Sprintf("<message to='%s' type='chat'><body>%s</body></message>", xmppEscape(to), xmppEscape(text)))
+}
+
+// An XMPPHandler handles the owner's chat messages.
+type XMPPHandler interface {
+	HandleXMPPMessage(from, body string)
+}
+
+// XMPPHandlerFunc lets a function be an XMPPHandler.
+type XMPPHandlerFunc func(from, body string)
+
+func (f XMPPHandlerFunc) HandleXMPPMessage(from, body string) {
+	f(from, body)
+}
+
+// Run keeps the client connected until ctx is done, retrying with a
+// backoff, and passes the owner's messages to h.
+func (x *XMPP) Run(ctx context.Context, h XMPPHandler, logger *slog.Logger) {
+	delay := minXMPPRetry
+	for ctx.Err() == nil {
+		conn, dec, err := x.dial(ctx)
+		if err == nil {
+			logger.Info("connected", "jid", x.local+"@"+x.domain)
+			delay = minXMPPRetry
+			err = x.serve(ctx, conn, dec, h)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Warn("xmpp connection failed", "err", err, "retry", delay)
+		select {
+		case <-ctx.Done():
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxXMPPRetry)
+	}
+}
+
+func (x *XMPP) serve(ctx context.Context, conn net.Conn, dec *xml.Decoder, h XMPPHandler) error {
+	x.mu.Lock()
+	x.conn = conn
+	x.mu.Unlock()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	keepalive := time.NewTicker(xmppKeepalive)
+	done := make(chan struct{})
+	defer func() {
+		stop()
+		keepalive.Stop()
+		close(done)
+		x.mu.Lock()
+		x.conn = nil
+		x.mu.Unlock()
+		conn.Close()
+	}()
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-keepalive.C:
+				x.write(" ")
+			}
+		}
+	}()
+	for {
+		start, err := nextElement(dec)
+		if err != nil {
+			return err
+		}
+		var stanza xmppStanza
+		if err := dec.DecodeElement(&stanza, &start); err != nil {
+			return err
+		}
+		x.handleStanza(&stanza, h)
+	}
+}
+
+func (x *XMPP) handleStanza(stanza *xmppStanza, h XMPPHandler) {
+	fromOwner := stanza.From != "" && bareJID(stanza.From) == x.owner
+	switch stanza.XMLName.Local {
+	case "iq":
+		// servers ping us; anything else we don't do
+		if stanza.Type == "get" || stanza.Type == "set" {
+			if stanza.Ping != nil {
+				x.write(fmt.Sprintf("<iq type='result' id='%s' to='%s'/>", xmppEscape(stanza.ID), xmppEscape(stanza.From)))
+			} else {
+				x.write(fmt.Sprintf("<iq type='error' id='%s' to='%s'><error type='cancel'><service-unavailable xmlns='urn:ietf:params:xml:ns:xmpp-stanzas'/></error></iq>", xmppEscape(stanza.ID), xmppEscape(stanza.From)))
+			}
+		}
+	case "presence":
+		// let the owner see whether we're online
+		if fromOwner && stanza.Type == "subscribe" {
+			x.write(fmt.Sprintf("<presence to='%s' type='subscribed'/>", xmppEscape(x.owner)))
+		}
+	case "message":
+		body := strings.TrimSpace(stanza.Body)
+		if !fromOwner || body == "" || stanza.Type == "error" || stanza.Type == "groupchat" {
+			return
+		}
+		h.HandleXMPPMessage(stanza.From, body)
+	}
+}
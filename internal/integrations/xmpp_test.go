@@ -0,0 +1,125 @@
+package integrations
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestNewXMPP(t *testing.T) {
+	x, err := NewXMPP("wutbot@example.org", "hunter2", "", "Owner@example.org/phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x.resource != "wutbot" || x.Owner() != "owner@example.org" {
+		t.Errorf("resource %q, owner %q", x.resource, x.Owner())
+	}
+	for _, target := range []string{"owner@example.org", "OWNER@example.org/laptop"} {
+		if !x.IsOwner(target) {
+			t.Errorf("%s isn't the owner", target)
+		}
+	}
+	for _, target := range []string{"#chan", "other@example.org", "owner"} {
+		if x.IsOwner(target) {
+			t.Errorf("%s is the owner", target)
+		}
+	}
+	if x, err := NewXMPP("", "", "", ""); x != nil || err != nil {
+		t.Errorf("unconfigured: %v, %v", x, err)
+	}
+	if _, err := NewXMPP("wutbot", "hunter2", "", "owner@example.org"); err == nil {
+		t.Error("no error for a JID without a domain")
+	}
+	var unconfigured *XMPP
+	if unconfigured.IsOwner("owner@example.org") || unconfigured.Connected() {
+		t.Error("a nil client has an owner, or is connected")
+	}
+}
+
+func TestXMPPEscape(t *testing.T) {
+	if got := xmppEscape("\x02bold\x02 <b> & 'q'\x00"); got != "bold &lt;b&gt; &amp; &#39;q&#39;" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestXMPPServe(t *testing.T) {
+	x, err := NewXMPP("wutbot@example.org", "hunter2", "", "owner@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ours, theirs := net.Pipe()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	messages := make(chan string, 10)
+	served := make(chan error, 1)
+	go func() {
+		dec := xml.NewDecoder(ours)
+		// negotiate would have read the stream's start
+		if _, err := nextElement(dec); err != nil {
+			served <- err
+			return
+		}
+		served <- x.serve(ctx, ours, dec, XMPPHandlerFunc(func(from, body string) {
+			messages <- from + ": " + body
+		}))
+	}()
+	go io.WriteString(theirs, "<stream:stream xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams'>"+
+		"<iq type='get' id='p1' from='example.org'><ping xmlns='urn:xmpp:ping'/></iq>"+
+		"<message from='stranger@example.org' type='chat'><body>quit</body></message>"+
+		"<message from='owner@example.org/phone' type='chat'><body> status </body></message>")
+
+	// each of our writes, as it happens: the pipe has no buffer
+	writes := make(chan string, 10)
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			n, err := theirs.Read(buf)
+			if err != nil {
+				return
+			}
+			writes <- string(buf[:n])
+		}
+	}()
+	next := func() string {
+		select {
+		case w := <-writes:
+			return w
+		case <-time.After(5 * time.Second):
+			return ""
+		}
+	}
+	if reply := next(); reply != "<iq type='result' id='p1' to='example.org'/>" {
+		t.Errorf("answered the ping with %q", reply)
+	}
+	select {
+	case got := <-messages:
+		if got != "owner@example.org/phone: status" {
+			t.Errorf("handled %q", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the owner's message wasn't handled")
+	}
+	if !x.Connected() {
+		t.Error("not connected while serving")
+	}
+	if err := x.Send("owner@example.org", "hi <3"); err != nil {
+		t.Fatal(err)
+	}
+	if reply := next(); reply != "<message to='owner@example.org' type='chat'><body>hi &lt;3</body></message>" {
+		t.Errorf("sent %q", reply)
+	}
+
+	cancel()
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("still serving after the context was done")
+	}
+	if x.Connected() {
+		t.Error("still connected")
+	}
+}
@@ -0,0 +1,21 @@
+package irctest
+
+import (
+	"net/http"
+	"net/http/httptest"
+)
+
+// ServePages serves HTML pages, keyed by path, for the bot to fetch.
+// Note that the bot has to be given a fetch client that allows loopback
+// addresses.
+func ServePages(pages map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	}))
+}
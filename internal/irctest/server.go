@@ -0,0 +1,228 @@
+// Package irctest is a minimal IRC server for driving a bot end to end. It
+// registers clients, lets them join channels, and records every line they
+// send, so that a test can inject messages and wait for the replies.
+package irctest
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const serverName = "irctest"
+
+var ErrTimeout = errors.New("timed out")
+
+// Server accepts any number of clients on a loopback port.
+type Server struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	clients  map[*client]bool
+	received []string // from every client, in order
+	next     int      // the first line Expect hasn't looked at
+	notify   chan struct{}
+}
+
+type client struct {
+	conn net.Conn
+	w    *bufio.Writer
+	mu   sync.Mutex
+	nick string
+	user bool
+}
+
+// NewServer starts a server, listening on an ephemeral loopback port.
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{listener: listener, clients: make(map[*client]bool), notify: make(chan struct{})}
+	go s.accept()
+	return s, nil
+}
+
+// Addr is the host:port to connect to.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops listening and disconnects every client.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	return err
+}
+
+func (s *Server) accept() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		c := &client{conn: conn, w: bufio.NewWriter(conn)}
+		s.mu.Lock()
+		s.clients[c] = true
+		s.mu.Unlock()
+		go s.serve(c)
+	}
+}
+
+func (s *Server) serve(c *client) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+		c.conn.Close()
+	}()
+	scanner := bufio.NewScanner(c.conn)
+	for scanner.Scan() {
+		line := scanner.Text()
+		s.record(line)
+		if !s.handle(c, line) {
+			return
+		}
+	}
+}
+
+func (s *Server) record(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.received = append(s.received, line)
+	close(s.notify)
+	s.notify = make(chan struct{})
+}
+
+func (c *client) send(format string, args ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(c.w, format+"\r\n", args...)
+	c.w.Flush()
+}
+
+// handle answers what registration and channels need; it returns false
+// once the client quits.
+func (s *Server) handle(c *client, line string) bool {
+	// tags don't matter here
+	if strings.HasPrefix(line, "@") {
+		if _, rest, ok := strings.Cut(line, " "); ok {
+			line = rest
+		}
+	}
+	command, params, _ := strings.Cut(line, " ")
+	var args []string
+	if trailing, ok := strings.CutPrefix(params, ":"); ok {
+		args = []string{trailing}
+	} else {
+		middle, trailing, hasTrailing := strings.Cut(params, " :")
+		args = strings.Fields(middle)
+		if hasTrailing {
+			args = append(args, trailing)
+		}
+	}
+	arg := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+		return ""
+	}
+	switch strings.ToUpper(command) {
+	case "CAP":
+		if strings.EqualFold(arg(0), "LS") {
+			// no capabilities: plain RFC 1459 is easiest to assert on
+			c.send(":%s CAP * LS :", serverName)
+		}
+	case "NICK":
+		registered := c.nick != "" && c.user
+		old := c.nick
+		c.nick = arg(0)
+		if registered {
+			c.send(":%s!bot@%s NICK %s", old, serverName, c.nick)
+		} else if c.user {
+			s.welcome(c)
+		}
+	case "USER":
+		c.user = true
+		if c.nick != "" {
+			s.welcome(c)
+		}
+	case "PING":
+		c.send(":%s PONG %s :%s", serverName, serverName, arg(0))
+	case "JOIN":
+		for _, channel := range strings.Split(arg(0), ",") {
+			c.send(":%s!bot@%s JOIN %s", c.nick, serverName, channel)
+			c.send(":%s 353 %s = %s :%s", serverName, c.nick, channel, c.nick)
+			c.send(":%s 366 %s %s :End of /NAMES list", serverName, c.nick, channel)
+		}
+	case "PART":
+		c.send(":%s!bot@%s PART %s", c.nick, serverName, arg(0))
+	case "QUIT":
+		c.send("ERROR :Quit")
+		return false
+	}
+	return true
+}
+
+func (s *Server) welcome(c *client) {
+	c.send(":%s 001 %s :Welcome to %s", serverName, c.nick, serverName)
+	c.send(":%s 005 %s CHANTYPES=# PREFIX=(ov)@+ NICKLEN=32 :are supported by this server", serverName, c.nick)
+	c.send(":%s 422 %s :MOTD File is missing", serverName, c.nick)
+}
+
+// Send sends a raw line to every client.
+func (s *Server) Send(line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.send("%s", line)
+	}
+}
+
+// Privmsg sends every client a PRIVMSG from nick.
+func (s *Server) Privmsg(nick, target, text string) {
+	s.Send(fmt.Sprintf(":%s!%s@%s PRIVMSG %s :%s", nick, nick, serverName, target, text))
+}
+
+// Expect waits for a line from a client matching pattern, skipping
+// anything before it, and returns it.
+func (s *Server) Expect(pattern string, timeout time.Duration) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	deadline := time.After(timeout)
+	for {
+		s.mu.Lock()
+		for ; s.next < len(s.received); s.next++ {
+			if line := s.received[s.next]; re.MatchString(line) {
+				s.next++
+				s.mu.Unlock()
+				return line, nil
+			}
+		}
+		notify := s.notify
+		s.mu.Unlock()
+		select {
+		case <-notify:
+		case <-deadline:
+			return "", fmt.Errorf("no line matching %q: %w", pattern, ErrTimeout)
+		}
+	}
+}
+
+// Received is every line received so far.
+func (s *Server) Received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.received...)
+}
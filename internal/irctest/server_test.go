@@ -0,0 +1,95 @@
+package irctest
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dial(t *testing.T, s *Server) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, bufio.NewReader(conn)
+}
+
+// readUntil reads lines from the server until one starts with prefix.
+func readUntil(t *testing.T, conn net.Conn, r *bufio.Reader, prefix string) string {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("waiting for %q: %v", prefix, err)
+		}
+		if line = strings.TrimRight(line, "\r\n"); strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+}
+
+func TestServer(t *testing.T) {
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	conn, r := dial(t, s)
+
+	io.WriteString(conn, "CAP LS 302\r\nNICK wutbot\r\nUSER wutbot 0 * :wutbot\r\n")
+	readUntil(t, conn, r, ":irctest CAP * LS")
+	readUntil(t, conn, r, ":irctest 001 wutbot ")
+	readUntil(t, conn, r, ":irctest 005 wutbot ")
+
+	io.WriteString(conn, "JOIN #a,#b\r\n")
+	readUntil(t, conn, r, ":wutbot!bot@irctest JOIN #a")
+	readUntil(t, conn, r, ":irctest 366 wutbot #b ")
+
+	s.Privmsg("friend", "#a", "hello")
+	if line := readUntil(t, conn, r, ":friend!"); line != ":friend!friend@irctest PRIVMSG #a :hello" {
+		t.Errorf("got %q", line)
+	}
+
+	io.WriteString(conn, "@label=1 PRIVMSG #a :first\r\nPRIVMSG #a :second\r\n")
+	if line, err := s.Expect(`^PRIVMSG #a :second$`, 5*time.Second); err != nil || line != "PRIVMSG #a :second" {
+		t.Errorf("Expect = %q, %v", line, err)
+	}
+	// it's already been skipped
+	if _, err := s.Expect(`:first$`, 50*time.Millisecond); !errors.Is(err, ErrTimeout) {
+		t.Errorf("Expect of a skipped line: %v", err)
+	}
+	if received := s.Received(); len(received) != 6 || received[4] != "@label=1 PRIVMSG #a :first" {
+		t.Errorf("received %q", received)
+	}
+
+	io.WriteString(conn, "NICK wutbot2\r\n")
+	readUntil(t, conn, r, ":wutbot!bot@irctest NICK wutbot2")
+	io.WriteString(conn, "PING :token\r\n")
+	readUntil(t, conn, r, ":irctest PONG irctest :token")
+	io.WriteString(conn, "QUIT :bye\r\n")
+	readUntil(t, conn, r, "ERROR ")
+}
+
+func TestServePages(t *testing.T) {
+	server := ServePages(map[string]string{"/page": "<title>A page</title>"})
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "<title>A page</title>" || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/html") {
+		t.Errorf("%s %q %q", resp.Status, resp.Header.Get("Content-Type"), body)
+	}
+	if resp, err := http.Get(server.URL + "/missing"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("missing page: %v, %v", resp, err)
+	}
+}
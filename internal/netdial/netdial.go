@@ -0,0 +1,152 @@
+// Package netdial dials hosts with several addresses in the order of an IPv4
+// or IPv6 preference, or races them (Happy Eyeballs), for hosts whose
+// broken IPv6 (or IPv4) would otherwise hold up connecting until it times
+// out.
+package netdial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+type Preference string
+
+const (
+	// System dials the addresses in the order they were looked up in
+	System Preference = ""
+	// PreferIPv4 and PreferIPv6 try the preferred family's addresses first
+	PreferIPv4 Preference = "ipv4"
+	PreferIPv6 Preference = "ipv6"
+	// Race alternates between the families, starting another attempt
+	// whenever the last one has been trying for FallbackDelay
+	Race Preference = "race"
+
+	FallbackDelay = 250 * time.Millisecond
+)
+
+var ErrNoAddresses = errors.New("no addresses to dial")
+
+// ParsePreference parses "ipv4", "ipv6" or "race", or "" for System.
+func ParsePreference(s string) (Preference, error) {
+	switch p := Preference(s); p {
+	case System, PreferIPv4, PreferIPv6, Race:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown IP preference %q (want ipv4, ipv6 or race)", s)
+}
+
+// Sort orders ips for dialing: the preferred family first, keeping the
+// order within each, or for Race, alternating families from the first
+// address's.
+func (p Preference) Sort(ips []net.IP) []net.IP {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	switch p {
+	case PreferIPv4:
+		return append(v4, v6...)
+	case PreferIPv6:
+		return append(v6, v4...)
+	case Race:
+		first, second := v4, v6
+		if len(ips) != 0 && ips[0].To4() == nil {
+			first, second = v6, v4
+		}
+		sorted := make([]net.IP, 0, len(ips))
+		for i := 0; i < max(len(first), len(second)); i++ {
+			if i < len(first) {
+				sorted = append(sorted, first[i])
+			}
+			if i < len(second) {
+				sorted = append(sorted, second[i])
+			}
+		}
+		return sorted
+	}
+	return ips
+}
+
+// Dial connects to one of ips at port with dial, in the preference's
+// order, returning the address it connected to. Only Race has several
+// attempts going at once; the first to connect wins, and the others are
+// closed.
+func (p Preference) Dial(ctx context.Context, dial func(ctx context.Context, network, address string) (net.Conn, error), network string, ips []net.IP, port string) (net.Conn, net.IP, error) {
+	ips = p.Sort(ips)
+	if len(ips) == 0 {
+		return nil, nil, ErrNoAddresses
+	}
+	if p != Race {
+		var err error
+		for _, ip := range ips {
+			var conn net.Conn
+			if conn, err = dial(ctx, network, net.JoinHostPort(ip.String(), port)); err == nil {
+				return conn, ip, nil
+			}
+			if ctx.Err() != nil {
+				break
+			}
+		}
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		conn net.Conn
+		ip   net.IP
+		err  error
+	}
+	results := make(chan result, len(ips))
+	attempt := func(ip net.IP) {
+		conn, err := dial(ctx, network, net.JoinHostPort(ip.String(), port))
+		results <- result{conn, ip, err}
+	}
+	go attempt(ips[0])
+	next, pending := 1, 1
+	timer := time.NewTimer(FallbackDelay)
+	defer timer.Stop()
+	var firstErr error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// the rest are cancelled, but may connect before they notice
+				go func() {
+					for ; pending > 0; pending-- {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}
+				}()
+				return r.conn, r.ip, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			// a failure doesn't need to wait for the delay
+			if next < len(ips) && ctx.Err() == nil {
+				go attempt(ips[next])
+				next++
+				pending++
+				timer.Reset(FallbackDelay)
+			}
+		case <-timer.C:
+			if next < len(ips) {
+				go attempt(ips[next])
+				next++
+				pending++
+				timer.Reset(FallbackDelay)
+			}
+		}
+	}
+	return nil, nil, firstErr
+}
@@ -0,0 +1,40 @@
+package netdial
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestSort(t *testing.T) {
+	a4, b4 := net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2")
+	a6, b6 := net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")
+	tests := []struct {
+		preference Preference
+		ips, want  []net.IP
+	}{
+		{System, []net.IP{a6, a4, b6, b4}, []net.IP{a6, a4, b6, b4}},
+		{PreferIPv4, []net.IP{a6, a4, b6, b4}, []net.IP{a4, b4, a6, b6}},
+		{PreferIPv6, []net.IP{a4, a6, b4, b6}, []net.IP{a6, b6, a4, b4}},
+		{Race, []net.IP{a6, b6, a4, b4}, []net.IP{a6, a4, b6, b4}},
+		{Race, []net.IP{a4, b4, a6}, []net.IP{a4, a6, b4}},
+		{Race, []net.IP{a4, b4}, []net.IP{a4, b4}},
+		{Race, nil, []net.IP{}},
+	}
+	for _, tt := range tests {
+		if got := tt.preference.Sort(tt.ips); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q.Sort(%v) = %v, want %v", tt.preference, tt.ips, got, tt.want)
+		}
+	}
+}
+
+func TestParsePreference(t *testing.T) {
+	for _, s := range []string{"", "ipv4", "ipv6", "race"} {
+		if p, err := ParsePreference(s); err != nil || string(p) != s {
+			t.Errorf("ParsePreference(%q) = %q, %v", s, p, err)
+		}
+	}
+	if _, err := ParsePreference("ipv5"); err == nil {
+		t.Error("ParsePreference(\"ipv5\") succeeded")
+	}
+}
@@ -0,0 +1,22 @@
+package secrets
+
+import (
+	"context"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Keyring reads secrets from the OS keyring (the Secret Service on Linux,
+// the Keychain on macOS, the Credential Manager on Windows), stored under
+// Service with the secret's name as the user.
+type Keyring struct {
+	Service string
+}
+
+func (k Keyring) Get(ctx context.Context, name string) (string, error) {
+	return keyring.Get(k.Service, name)
+}
+
+func (k Keyring) Set(name, secret string) error {
+	return keyring.Set(k.Service, name, secret)
+}
@@ -0,0 +1,26 @@
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestKeyring(t *testing.T) {
+	keyring.MockInit()
+	k := Keyring{Service: "wutbot"}
+	if _, err := k.Get(context.Background(), "sasl"); err == nil {
+		t.Error("no error for a secret that isn't set")
+	}
+	if err := k.Set("sasl", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if secret, err := k.Get(context.Background(), "sasl"); err != nil || secret != "hunter2" {
+		t.Errorf("Get = %q, %v", secret, err)
+	}
+	// kept under the service, not shared with other programs
+	if _, err := (Keyring{Service: "other"}).Get(context.Background(), "sasl"); err == nil {
+		t.Error("found under another service")
+	}
+}
@@ -0,0 +1,39 @@
+// Package secrets looks up credentials in a secrets store, so that they
+// don't have to be kept in the environment or in files.
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// A Provider looks up a secret by a name whose form depends on the store.
+type Provider interface {
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// Resolver maps reference schemes to providers; a nil provider is a store
+// that isn't configured.
+type Resolver map[string]Provider
+
+// Resolve returns value, or if it's a reference like "vault:secret/data/wutbot#token"
+// to one of the resolver's schemes, that provider's secret.
+func (r Resolver) Resolve(ctx context.Context, value string) (string, error) {
+	scheme, name, ok := strings.Cut(value, ":")
+	if !ok {
+		return value, nil
+	}
+	provider, ok := r[scheme]
+	if !ok {
+		return value, nil
+	}
+	if provider == nil {
+		return "", fmt.Errorf("%s secret %s: %s isn't configured", scheme, name, scheme)
+	}
+	secret, err := provider.Get(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("couldn't get %s secret %s: %w", scheme, name, err)
+	}
+	return secret, nil
+}
@@ -0,0 +1,45 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fakeProvider map[string]string
+
+func (p fakeProvider) Get(ctx context.Context, name string) (string, error) {
+	secret, ok := p[name]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return secret, nil
+}
+
+func TestResolve(t *testing.T) {
+	r := Resolver{
+		"vault":   fakeProvider{"secret/data/wutbot#token": "hunter2"},
+		"keyring": nil,
+	}
+	tests := []struct {
+		value, want, err string
+	}{
+		{"plain", "plain", ""},
+		// not one of the resolver's schemes
+		{"https://example.com/", "https://example.com/", ""},
+		{"vault:secret/data/wutbot#token", "hunter2", ""},
+		{"vault:secret/data/wutbot#missing", "", "couldn't get vault secret"},
+		{"keyring:sasl", "", "keyring isn't configured"},
+	}
+	for _, tt := range tests {
+		got, err := r.Resolve(context.Background(), tt.value)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Resolve(%q): error %v, want %q", tt.value, err, tt.err)
+			}
+		} else if err != nil || got != tt.want {
+			t.Errorf("Resolve(%q) = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
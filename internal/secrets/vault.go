@@ -0,0 +1,93 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Vault reads secrets from HashiCorp Vault's KV engine, by names like
+// "secret/data/wutbot#sasl_password": the API path (under /v1/) of a
+// secret, and which of its fields to use.
+type Vault struct {
+	Address string
+	Token   string
+	// to talk to Vault through; http.DefaultClient if nil
+	Client *http.Client
+}
+
+// VaultFromEnv configures Vault the way its own CLI does, with VAULT_ADDR
+// and VAULT_TOKEN, returning nil if VAULT_ADDR isn't set.
+func VaultFromEnv() (*Vault, error) {
+	address := os.Getenv("VAULT_ADDR")
+	if address == "" {
+		return nil, nil
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		home, err := os.UserHomeDir()
+		if err == nil {
+			// where `vault login` leaves it
+			b, _ := os.ReadFile(filepath.Join(home, ".vault-token"))
+			token = strings.TrimSpace(string(b))
+		}
+	}
+	if token == "" {
+		return nil, errors.New("VAULT_ADDR is set, but there's no VAULT_TOKEN")
+	}
+	return &Vault{Address: strings.TrimSuffix(address, "/"), Token: token}, nil
+}
+
+func (v *Vault) Get(ctx context.Context, name string) (string, error) {
+	path, field, ok := strings.Cut(name, "#")
+	if !ok || field == "" {
+		return "", errors.New("no field given (<path>#<field>)")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", v.Address+"/v1/"+strings.TrimPrefix(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", v.Token)
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault: %s", resp.Status)
+	}
+	var body struct {
+		Data map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	data := body.Data
+	// version 2 of the KV engine nests the secret, beside its metadata
+	if nested, ok := data["data"]; ok {
+		if _, isMetadata := data["metadata"]; isMetadata {
+			data = nil
+			if err := json.Unmarshal(nested, &data); err != nil {
+				return "", err
+			}
+		}
+	}
+	raw, ok := data[field]
+	if !ok {
+		return "", fmt.Errorf("no field %s", field)
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return "", fmt.Errorf("field %s isn't a string", field)
+	}
+	return value, nil
+}
@@ -0,0 +1,79 @@
+package secrets
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVaultGet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "token" {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/secret/data/wutbot":
+			// version 2 of the KV engine
+			w.Write([]byte(`{"data":{"data":{"sasl_password":"hunter2","port":6697},"metadata":{"version":3}}}`))
+		case "/v1/kv/wutbot":
+			w.Write([]byte(`{"data":{"sasl_password":"hunter3"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	v := &Vault{Address: server.URL, Token: "token", Client: server.Client()}
+	tests := []struct {
+		name, want string
+		ok         bool
+	}{
+		{"secret/data/wutbot#sasl_password", "hunter2", true},
+		{"/secret/data/wutbot#sasl_password", "hunter2", true},
+		{"kv/wutbot#sasl_password", "hunter3", true},
+		{"secret/data/wutbot", "", false},
+		{"secret/data/wutbot#missing", "", false},
+		{"secret/data/wutbot#port", "", false},
+		{"secret/data/other#sasl_password", "", false},
+	}
+	for _, tt := range tests {
+		got, err := v.Get(context.Background(), tt.name)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("Get(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	v.Token = "wrong"
+	if _, err := v.Get(context.Background(), "secret/data/wutbot#sasl_password"); err == nil {
+		t.Error("no error with the wrong token")
+	}
+}
+
+func TestVaultFromEnv(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("VAULT_ADDR", "")
+	t.Setenv("VAULT_TOKEN", "")
+	if v, err := VaultFromEnv(); v != nil || err != nil {
+		t.Errorf("without VAULT_ADDR: %v, %v", v, err)
+	}
+
+	t.Setenv("VAULT_ADDR", "https://vault.example.com/")
+	if _, err := VaultFromEnv(); err == nil {
+		t.Error("no error without a token")
+	}
+	if err := os.WriteFile(filepath.Join(home, ".vault-token"), []byte("from-login\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := VaultFromEnv(); err != nil || v.Token != "from-login" || v.Address != "https://vault.example.com" {
+		t.Errorf("with a token file: %+v, %v", v, err)
+	}
+	t.Setenv("VAULT_TOKEN", "from-env")
+	if v, err := VaultFromEnv(); err != nil || v.Token != "from-env" {
+		t.Errorf("with VAULT_TOKEN: %+v, %v", v, err)
+	}
+}
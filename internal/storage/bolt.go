@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bolt stores state in an embedded bbolt file, with a bolt bucket per bucket.
+type Bolt struct {
+	db *bolt.DB
+}
+
+func OpenBolt(path string) (*Bolt, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	// the timeout is for another process holding the file lock
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	return &Bolt{db: db}, nil
+}
+
+func (b *Bolt) Get(bucket, key string, value interface{}) (found bool, err error) {
+	var raw []byte
+	b.db.View(func(tx *bolt.Tx) error {
+		if bb := tx.Bucket([]byte(bucket)); bb != nil {
+			// only valid during the transaction
+			raw = append([]byte(nil), bb.Get([]byte(key))...)
+		}
+		return nil
+	})
+	if len(raw) == 0 {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, value)
+}
+
+func (b *Bolt) Put(bucket, key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return b.db.Update(func(tx *bolt.Tx) error {
+		bb, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return bb.Put([]byte(key), raw)
+	})
+}
+
+func (b *Bolt) Delete(bucket, key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		if bb := tx.Bucket([]byte(bucket)); bb != nil {
+			return bb.Delete([]byte(key))
+		}
+		return nil
+	})
+}
+
+func (b *Bolt) Keys(bucket string) (keys []string, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		bb := tx.Bucket([]byte(bucket))
+		if bb == nil {
+			return nil
+		}
+		// bolt keeps keys in byte order already
+		return bb.ForEach(func(k, v []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	return
+}
+
+func (b *Bolt) Buckets() (buckets []string, err error) {
+	err = b.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, bb *bolt.Bucket) error {
+			// deleting the last key leaves an empty bucket behind
+			if k, _ := bb.Cursor().First(); k != nil {
+				buckets = append(buckets, string(name))
+			}
+			return nil
+		})
+	})
+	return
+}
+
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// OpenDir opens a backend the way Open does, keeping a sqlite or bolt file
+// in dataDir if location is empty, and imports the JSON state file that
+// older versions kept in dataDir, if there is one.
+func OpenDir(dataDir, backend, location string) (Store, error) {
+	if location == "" {
+		switch backend {
+		case "", "sqlite":
+			location = filepath.Join(dataDir, "state.db")
+		case "bolt":
+			location = filepath.Join(dataDir, "state.bolt")
+		}
+	}
+	s, err := Open(backend, location)
+	if err != nil {
+		return nil, err
+	}
+	if err := importJSONState(s, filepath.Join(dataDir, "state.json")); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("couldn't import old state: %w", err)
+	}
+	return s, nil
+}
+
+func importJSONState(s Store, path string) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var buckets map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(data, &buckets); err != nil {
+		return err
+	}
+	for bucket, values := range buckets {
+		for key, value := range values {
+			if err := s.Put(bucket, key, value); err != nil {
+				return err
+			}
+		}
+	}
+	// keep it around, but don't import it again
+	return os.Rename(path, path+".imported")
+}
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisKeyPrefix = "wutbot:"
+	redisTimeout   = 5 * time.Second
+)
+
+// Redis stores state in a Redis server, with a hash per bucket.
+type Redis struct {
+	client *redis.Client
+}
+
+func OpenRedis(url string) (*Redis, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, err
+	}
+	r := &Redis{client: redis.NewClient(options)}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := r.client.Ping(ctx).Err(); err != nil {
+		r.client.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Redis) Get(bucket, key string, value interface{}) (found bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	raw, err := r.client.HGet(ctx, redisKeyPrefix+bucket, key).Bytes()
+	if err == redis.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal(raw, value)
+}
+
+func (r *Redis) Put(bucket, key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return r.client.HSet(ctx, redisKeyPrefix+bucket, key, raw).Err()
+}
+
+func (r *Redis) Delete(bucket, key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	return r.client.HDel(ctx, redisKeyPrefix+bucket, key).Err()
+}
+
+func (r *Redis) Keys(bucket string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	keys, err := r.client.HKeys(ctx, redisKeyPrefix+bucket).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (r *Redis) Buckets() (buckets []string, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	// redis deletes hashes once they're empty
+	iter := r.client.Scan(ctx, 0, redisKeyPrefix+"*", 0).Iterator()
+	for iter.Next(ctx) {
+		buckets = append(buckets, strings.TrimPrefix(iter.Val(), redisKeyPrefix))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(buckets)
+	return buckets, nil
+}
+
+func (r *Redis) Close() error {
+	return r.client.Close()
+}
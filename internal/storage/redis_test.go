@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeRedis speaks enough RESP2 for the commands the Redis backend sends,
+// keeping hashes in memory.
+type fakeRedis struct {
+	listener net.Listener
+	mu       sync.Mutex
+	hashes   map[string]map[string]string
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{listener: listener, hashes: make(map[string]map[string]string)}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) URL() string {
+	return "redis://" + f.listener.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		f.reply(w, args)
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
+
+// readCommand reads an array of bulk strings.
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func writeArray(w *bufio.Writer, values []string) {
+	fmt.Fprintf(w, "*%d\r\n", len(values))
+	for _, v := range values {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	}
+}
+
+func (f *fakeRedis) reply(w *bufio.Writer, args []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		w.WriteString("+PONG\r\n")
+	case "HSET":
+		hash := f.hashes[args[1]]
+		if hash == nil {
+			hash = make(map[string]string)
+			f.hashes[args[1]] = hash
+		}
+		added := 0
+		for i := 2; i+1 < len(args); i += 2 {
+			if _, ok := hash[args[i]]; !ok {
+				added++
+			}
+			hash[args[i]] = args[i+1]
+		}
+		fmt.Fprintf(w, ":%d\r\n", added)
+	case "HGET":
+		value, ok := f.hashes[args[1]][args[2]]
+		if !ok {
+			w.WriteString("$-1\r\n")
+			return
+		}
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(value), value)
+	case "HDEL":
+		deleted := 0
+		for _, field := range args[2:] {
+			if _, ok := f.hashes[args[1]][field]; ok {
+				delete(f.hashes[args[1]], field)
+				deleted++
+			}
+		}
+		// like redis, an emptied hash is gone
+		if len(f.hashes[args[1]]) == 0 {
+			delete(f.hashes, args[1])
+		}
+		fmt.Fprintf(w, ":%d\r\n", deleted)
+	case "HKEYS":
+		var keys []string
+		for k := range f.hashes[args[1]] {
+			keys = append(keys, k)
+		}
+		writeArray(w, keys)
+	case "SCAN":
+		pattern := "*"
+		for i := 2; i+1 < len(args); i += 2 {
+			if strings.EqualFold(args[i], "MATCH") {
+				pattern = args[i+1]
+			}
+		}
+		var keys []string
+		for k := range f.hashes {
+			if ok, _ := path.Match(pattern, k); ok {
+				keys = append(keys, k)
+			}
+		}
+		// in no particular order, as redis does
+		sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+		w.WriteString("*2\r\n$1\r\n0\r\n")
+		writeArray(w, keys)
+	default:
+		// HELLO included, so the client falls back to RESP2
+		fmt.Fprintf(w, "-ERR unknown command '%s'\r\n", args[0])
+	}
+}
+
+func TestRedis(t *testing.T) {
+	server := newFakeRedis(t)
+	s, err := OpenRedis(server.URL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+	// everything's kept under the prefix
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	for key := range server.hashes {
+		if !strings.HasPrefix(key, redisKeyPrefix) {
+			t.Errorf("stored under %q", key)
+		}
+	}
+}
+
+func TestRedisUnreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "redis://" + listener.Addr().String()
+	listener.Close()
+	if _, err := OpenRedis(url); err == nil {
+		t.Error("opened a server that isn't there")
+	}
+}
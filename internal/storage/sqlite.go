@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite"
+)
+
+// migrations are applied in order, each exactly once; the database's
+// user_version records how many have been applied. Only ever append.
+var migrations = []string{
+	`CREATE TABLE kv (
+		bucket TEXT NOT NULL,
+		key TEXT NOT NULL,
+		value TEXT NOT NULL,
+		PRIMARY KEY (bucket, key)
+	)`,
+}
+
+// SQLite stores state in a SQLite database, using a pure-Go driver.
+type SQLite struct {
+	db *sql.DB
+}
+
+func OpenSQLite(path string) (*SQLite, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite", path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// one connection, so that writes are serialized rather than failing with SQLITE_BUSY
+	db.SetMaxOpenConns(1)
+	s := &SQLite{db: db}
+	if err := s.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SQLite) migrate() error {
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	for ; version < len(migrations); version++ {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version+1, err)
+		}
+		// PRAGMA doesn't take parameters
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get unmarshals the stored value into value, returning false if there is none.
+func (s *SQLite) Get(bucket, key string, value interface{}) (found bool, err error) {
+	var raw string
+	err = s.db.QueryRow(`SELECT value FROM kv WHERE bucket = ? AND key = ?`, bucket, key).Scan(&raw)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, json.Unmarshal([]byte(raw), value)
+}
+
+func (s *SQLite) Put(bucket, key string, value interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(`INSERT INTO kv (bucket, key, value) VALUES (?, ?, ?)
+		ON CONFLICT (bucket, key) DO UPDATE SET value = excluded.value`, bucket, key, string(raw))
+	return err
+}
+
+func (s *SQLite) Delete(bucket, key string) error {
+	_, err := s.db.Exec(`DELETE FROM kv WHERE bucket = ? AND key = ?`, bucket, key)
+	return err
+}
+
+// Keys returns the keys in a bucket, in sorted order.
+func (s *SQLite) Keys(bucket string) ([]string, error) {
+	return s.strings(`SELECT key FROM kv WHERE bucket = ? ORDER BY key`, bucket)
+}
+
+func (s *SQLite) Buckets() ([]string, error) {
+	return s.strings(`SELECT DISTINCT bucket FROM kv ORDER BY bucket`)
+}
+
+// strings returns a query's single column.
+func (s *SQLite) strings(query string, args ...interface{}) (result []string, err error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+	}
+	return result, rows.Err()
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
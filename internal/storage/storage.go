@@ -0,0 +1,35 @@
+// Package storage is wutbot's persistent state: a key-value store, grouped
+// into buckets, with values encoded as JSON.
+package storage
+
+import (
+	"fmt"
+)
+
+// Store is implemented by each storage backend.
+type Store interface {
+	// Get unmarshals the stored value into value, returning false if there is none.
+	Get(bucket, key string, value interface{}) (found bool, err error)
+	Put(bucket, key string, value interface{}) error
+	Delete(bucket, key string) error
+	// Keys returns the keys in a bucket, in sorted order.
+	Keys(bucket string) ([]string, error)
+	// Buckets returns the names of the non-empty buckets, in sorted order.
+	Buckets() ([]string, error)
+	Close() error
+}
+
+// Open opens a backend: "sqlite" (the default) or "bolt", with location a
+// file path, or "redis", with location a redis:// URL.
+func Open(backend, location string) (Store, error) {
+	switch backend {
+	case "", "sqlite":
+		return OpenSQLite(location)
+	case "bolt":
+		return OpenBolt(location)
+	case "redis":
+		return OpenRedis(location)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %s", backend)
+	}
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// testStore is what every backend has to do the same way.
+func testStore(t *testing.T, s Store) {
+	t.Helper()
+	type score struct {
+		Nick   string
+		Points int
+	}
+	var got score
+	if found, err := s.Get("trivia", "nick", &got); err != nil || found {
+		t.Fatalf("Get before Put: found %v, err %v", found, err)
+	}
+	for _, put := range []struct {
+		bucket, key string
+		value       score
+	}{
+		{"trivia", "nick", score{"nick", 1}},
+		{"trivia", "alice", score{"alice", 3}},
+		{"karma", "bob", score{"bob", -2}},
+		{"trivia", "nick", score{"nick", 2}},
+	} {
+		if err := s.Put(put.bucket, put.key, put.value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if found, err := s.Get("trivia", "nick", &got); err != nil || !found || got != (score{"nick", 2}) {
+		t.Errorf("Get: %+v, found %v, err %v", got, found, err)
+	}
+	if keys, err := s.Keys("trivia"); err != nil || !reflect.DeepEqual(keys, []string{"alice", "nick"}) {
+		t.Errorf("Keys: %v, err %v", keys, err)
+	}
+	if keys, err := s.Keys("missing"); err != nil || len(keys) != 0 {
+		t.Errorf("Keys of a missing bucket: %v, err %v", keys, err)
+	}
+	if buckets, err := s.Buckets(); err != nil || !reflect.DeepEqual(buckets, []string{"karma", "trivia"}) {
+		t.Errorf("Buckets: %v, err %v", buckets, err)
+	}
+
+	if err := s.Delete("karma", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("karma", "nobody"); err != nil {
+		t.Errorf("Delete of a missing key: %v", err)
+	}
+	if found, err := s.Get("karma", "bob", &got); err != nil || found {
+		t.Errorf("Get after Delete: found %v, err %v", found, err)
+	}
+	// the emptied bucket isn't listed
+	if buckets, err := s.Buckets(); err != nil || !reflect.DeepEqual(buckets, []string{"trivia"}) {
+		t.Errorf("Buckets after Delete: %v, err %v", buckets, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSQLite(t *testing.T) {
+	s, err := OpenSQLite(filepath.Join(t.TempDir(), "state.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+}
+
+func TestBolt(t *testing.T) {
+	s, err := OpenBolt(filepath.Join(t.TempDir(), "state.bolt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStore(t, s)
+}
+
+func TestSQLiteReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.db")
+	s, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("trivia", "nick", 1); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	// the migrations aren't applied again
+	s, err = OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var points int
+	if found, err := s.Get("trivia", "nick", &points); err != nil || !found || points != 1 {
+		t.Errorf("after reopening: %d, found %v, err %v", points, found, err)
+	}
+}
+
+func TestOpenDirImportsJSONState(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "state.json")
+	if err := os.WriteFile(old, []byte(`{"trivia":{"nick":5}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := OpenDir(dir, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var points int
+	if found, err := s.Get("trivia", "nick", &points); err != nil || !found || points != 5 {
+		t.Errorf("imported %d, found %v, err %v", points, found, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "state.db")); err != nil {
+		t.Errorf("not kept in the data directory: %v", err)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("state.json is still there to be imported again: %v", err)
+	}
+}
+
+func TestOpenUnknownBackend(t *testing.T) {
+	if _, err := Open("etcd", ""); err == nil {
+		t.Error("no error for an unknown backend")
+	}
+}
@@ -1,20 +1,42 @@
-package main
+package wutbot
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/ergochat/irc-go/ircevent"
 	"github.com/ergochat/irc-go/ircmsg"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"pratyush/wutbot/internal/bot"
+	"pratyush/wutbot/internal/commands"
+	"pratyush/wutbot/internal/fetch"
+	"pratyush/wutbot/internal/httpfixture"
+	"pratyush/wutbot/internal/integrations"
+	"pratyush/wutbot/internal/netdial"
+	"pratyush/wutbot/internal/storage"
 )
 
 type empty struct{}
 
 const (
+	// workers for fetches, summaries and chat answers
 	concurrencyLimit = 128
 
 	IRCv3TimestampFormat = "2006-01-02T15:04:05.000Z"
@@ -26,23 +48,80 @@ const (
 
 type Bot struct {
 	ircevent.Connection
-	TwitterBearerToken string
-	Owner              string
-	semaphore          chan empty
-	userAgent          string
-}
-
-func (b *Bot) tryAcquireSemaphore() bool {
-	select {
-	case b.semaphore <- empty{}:
-		return true
-	default:
-		return false
-	}
-}
-
-func (b *Bot) releaseSemaphore() {
-	<-b.semaphore
+	Owner            string
+	workers          *workerPool
+	userAgent        string
+	config           *FileConfig
+	configMutex      sync.RWMutex
+	triggers         map[string][]trigger
+	commands         *commands.Mux
+	polls            *pollManager
+	trivia           *triviaManager
+	store            storage.Store
+	ignores          *ignoreList
+	httpClient       *http.Client
+	nickAccounts     *nickAccounts
+	fetcher          *fetch.Fetcher
+	llm              *llmClient
+	summarizeLimiter *rateLimiter
+	chat             *chatManager
+	markov           *markovManager
+	servers          *serverRotation
+	ipPreference     netdial.Preference // for the IRC connection
+	rejoin           *rejoinManager
+	sendQueue        *bot.SendQueue
+	joined           *joinedChannels
+	connectAttempts  int32 // since the last successful registration
+	batchCounter     uint64
+	history          *historyTracker
+	delivery         *deliveryStats
+	maxMessageAge    time.Duration
+	sts              *stsState
+	sasl             *saslState
+	scram            *scramState
+	nickserv         *nickServ
+	owner            *ownerPresence
+	pendingJoins     *pendingJoins
+	bots             *botTracker
+	chanModes        *channelModes
+	logTail          *logTail
+	caps             *capTracker
+	admins           []string
+	hosts            *hostLookups
+	topics           *topicRotation
+	chanLog          *channelLogger
+	dataDir          string
+	stats            *statsTracker
+	httpMux          *http.ServeMux
+	feeds            *feedPoller
+	webhooks         map[string]*webhook
+	relays           []*relay
+	responses        map[string][]response
+	githubToken      string
+	twitterToken     string
+	omdbKey          string
+	tmdbKey          string
+	health           *healthState
+	baseLogger       *slog.Logger
+	logLevels        *logLevels
+	stopping         *shutdownState
+	panics           *panicTracker
+	errorReports     *errorReporter
+	stopTracing      func() // flushes spans
+	started          time.Time
+	handlersMutex    sync.RWMutex
+	handlers         []Handler
+	plugins          []*plugin
+	scripts          *scriptManager
+	events           *eventBus
+	watches          *watchList
+	matrix           *integrations.Matrix
+	xmpp             *integrations.XMPP
+	discord          *discordBridge
+	lastLinks        *lastLinks
+	sharedFetches    *sharedFetches
+	geocoder         *geocoder
+	httpListen       string
 }
 
 // func (irc *Bot) checkErr(err error, message string) (fatal bool) {
@@ -68,18 +147,75 @@ func (irc *Bot) handleOwnerCommand(target, command string) {
 	switch strings.ToLower(f[0]) {
 	case "abuse":
 		if len(f) > 1 {
-			irc.Privmsg(target, fmt.Sprintf("%s isn't a real programmer", f[1]))
+			if text := irc.respond(responseAbuse, responseData{Nick: irc.Owner, Channel: target, Target: f[1]}); text != "" {
+				irc.Privmsg(target, text)
+			}
 		}
+	case "purgemarkov":
+		if len(f) > 1 {
+			if err := irc.markov.purge(f[1]); err != nil {
+				irc.Privmsg(target, fmt.Sprintf("couldn't purge: %v", err))
+			} else {
+				irc.Privmsg(target, fmt.Sprintf("forgot everything I learned in %s", f[1]))
+			}
+		}
+	case "lag":
+		irc.Privmsg(target, irc.delivery.String())
+	case "key":
+		irc.handleKeyCommand(target, f[1:])
+	case "mode":
+		irc.handleModeCommand(target, f[1:])
+	case "topic":
+		irc.handleTopicCommand(target, f[1:])
+	case "auto":
+		irc.handleAutoCommand(target, f[1:])
+	case "links":
+		irc.handleLinksCommand(target, f[1:])
+	case "feed":
+		irc.handleFeedCommand(target, f[1:])
+	case "follow":
+		irc.handleFollowCommand(target, f[1:])
+	case "loglevel":
+		irc.handleLogLevelCommand(target, f[1:])
+	case "audit":
+		irc.handleAuditCommand(target, f[1:])
+	case "ignore":
+		irc.handleIgnoreCommand(target, f[1:])
+	case "unignore":
+		irc.handleUnignoreCommand(target, f[1:])
+	case "watch":
+		irc.handleWatchCommand(target, f[1:], false)
+	case "unwatch":
+		irc.handleWatchCommand(target, f[1:], true)
+	case "plugins":
+		irc.handlePluginsCommand(target)
+	case "scripts":
+		irc.handleScriptsCommand(target)
 	case "quit":
 		irc.Quit()
 	}
 }
 
+// handleChannelMessage runs the command or Handler a channel message is
+// for, if any, and publishes it. source is where it was sent, if not on IRC.
+func (irc *Bot) handleChannelMessage(ctx context.Context, e ircmsg.Message, target, msgid, message, source string) {
+	_, account := e.GetTag("account")
+	m := messageEvent{ctx: ctx, channel: target, nick: e.Nick(), account: account, msgid: msgid, text: message, time: messageTime(e), source: source}
+	if cmd, ok := commands.Parse(e, target, msgid, message); ok && irc.commands.Dispatch(cmd) {
+		m.command, m.handled = cmd.Name, true
+	} else {
+		m.handled = irc.runHandlers(ctx, Message{
+			Channel: target, Nick: e.Nick(), Account: account, MsgID: msgid, Text: message, Time: m.time,
+		})
+	}
+	publish(irc, &irc.events.messages, m)
+}
+
 func (irc *Bot) sendReplyNotice(target, msgid, text string) {
 	if msgid == "" {
 		irc.Notice(target, text)
 	} else {
-		irc.SendWithTags(map[string]string{replyTagName: msgid}, "NOTICE", target, text)
+		irc.SendWithTags(map[string]string{replyTagName: msgid}, irc.noticeCommand(target), target, text)
 	}
 }
 
@@ -93,92 +229,586 @@ func ownerMatches(e ircmsg.Message, owner string) bool {
 	return false
 }
 
-func newBot() *Bot {
-	err := godotenv.Load(".env")
-	if err != nil {
-		log.Fatalf("Some error occured. Err: %s", err)
-	}
-	// required:
-	nick := os.Getenv("WUTBOT_NICK")
-	server := os.Getenv("WUTBOT_SERVER")
+// configFromEnv reads the bot's settings from the environment.
+func configFromEnv() (config Config, err error) {
+	// required (host:port, or a comma-delimited list to fail over between):
+	config.Nick = os.Getenv("WUTBOT_NICK")
+	config.Servers = os.Getenv("WUTBOT_SERVER")
 	// required (comma-delimited list of channels)
-	channels := os.Getenv("WUTBOT_CHANNELS")
+	config.Channels = strings.Split(os.Getenv("WUTBOT_CHANNELS"), ",")
 	// SASL is optional:
-	saslLogin := os.Getenv("WUTBOT_SASL_LOGIN")
-	saslPassword := os.Getenv("WUTBOT_SASL_PASSWORD")
+	config.SASLLogin = os.Getenv("WUTBOT_SASL_LOGIN")
+	config.SASLPassword = os.Getenv("WUTBOT_SASL_PASSWORD")
+	// PLAIN by default, or SCRAM-SHA-256 where the server supports it:
+	config.SASLMech = os.Getenv("WUTBOT_SASL_MECH")
+	// with a client certificate, SASL EXTERNAL is preferred (falling back to PLAIN):
+	config.TLSCert = os.Getenv("WUTBOT_TLS_CERT")
+	config.TLSKey = os.Getenv("WUTBOT_TLS_KEY")
+	// NickServ identification, for networks without SASL (optional):
+	config.NickServPassword = os.Getenv("WUTBOT_NICKSERV_PASSWORD")
+	config.NickServNick = os.Getenv("WUTBOT_NICKSERV_NICK")
+	config.NickServCommand = os.Getenv("WUTBOT_NICKSERV_COMMAND") // e.g. "IDENTIFY {{.Account}} {{.Password}}"
+	config.NickServSuccess = os.Getenv("WUTBOT_NICKSERV_SUCCESS") // regex matched against NickServ's notices
+	// WEBIRC, when connecting on behalf of a gateway (all but the hostname are required):
+	config.WebIRCPassword = os.Getenv("WUTBOT_WEBIRC_PASSWORD")
+	config.WebIRCGateway = os.Getenv("WUTBOT_WEBIRC_GATEWAY")
+	config.WebIRCHostname = os.Getenv("WUTBOT_WEBIRC_HOSTNAME")
+	config.WebIRCIP = os.Getenv("WUTBOT_WEBIRC_IP")
 	// owner is optional (if unset, WUTBOT won't accept any owner commands)
-	owner := os.Getenv("WUTBOT_OWNER_ACCOUNT")
+	config.Owner = os.Getenv("WUTBOT_OWNER_ACCOUNT")
+	// comma-delimited accounts that may use moderation commands, besides the owner
+	config.Admins = strings.FieldsFunc(os.Getenv("WUTBOT_ADMIN_ACCOUNTS"), func(r rune) bool { return r == ',' || r == ' ' })
+	// the nick to watch for and deliver notifications to (defaults to the account name)
+	config.OwnerNick = os.Getenv("WUTBOT_OWNER_NICK")
 	// more optional settings
-	version := os.Getenv("WUTBOT_VERSION")
+	config.Version = os.Getenv("WUTBOT_VERSION")
+	config.Debug = os.Getenv("WUTBOT_DEBUG") != ""
+	// log output: "text" (the default) or "json", from this level up ("debug" with
+	// WUTBOT_DEBUG), with per-module levels like "links=debug,sasl=warn"
+	config.LogFormat = os.Getenv("WUTBOT_LOG_FORMAT")
+	config.LogLevel = os.Getenv("WUTBOT_LOG_LEVEL")
+	config.LogModules = os.Getenv("WUTBOT_LOG_MODULES")
+	config.InsecureSkipVerify = os.Getenv("WUTBOT_INSECURE_SKIP_VERIFY") != ""
+	// for self-signed servers, a safer alternative to that: comma-delimited
+	// "sha256/<base64>" public key hashes or hex certificate fingerprints
+	config.TLSPins = strings.Split(os.Getenv("WUTBOT_TLS_PINS"), ",")
+	// plaintext is upgraded to TLS if the server advertises an STS policy
+	config.Plaintext = os.Getenv("WUTBOT_PLAINTEXT") != ""
+	config.UserAgent = os.Getenv("WUTBOT_USER_AGENT")
+	// e.g. "en-GB, en;q=0.8", so that sites don't guess our language from where we are
+	config.AcceptLanguage = os.Getenv("WUTBOT_ACCEPT_LANGUAGE")
+	// look up the hosts of links with this rather than the system resolver:
+	// "https://dns.example/dns-query" (DNS over HTTPS) or "tls://dns.example"
+	config.DNSResolver = os.Getenv("WUTBOT_DNS_RESOLVER")
+	// for hosts with broken IPv6 (or IPv4), connect to the IRC server and to
+	// links' hosts over "ipv4" or "ipv6" first, or "race" them
+	config.IPPreference = os.Getenv("WUTBOT_IP_PREFERENCE")
+	// for offline development: answer fetches from the responses saved in this
+	// directory, or with WUTBOT_HTTP_FIXTURE_MODE=record, fetch and save them
+	if dir := os.Getenv("WUTBOT_HTTP_FIXTURES"); dir != "" {
+		mode, err := httpfixture.ParseMode(os.Getenv("WUTBOT_HTTP_FIXTURE_MODE"))
+		if err != nil {
+			return config, fmt.Errorf("invalid WUTBOT_HTTP_FIXTURE_MODE: %w", err)
+		}
+		config.FetchClient = fetch.NewClient()
+		config.FetchClient.Transport = &httpfixture.Transport{Dir: dir, Mode: mode, Next: config.FetchClient.Transport}
+	}
+	config.DataDir, config.StoreBackend, config.StoreURL = storeSettings()
+	// channel logs, for channels with "log" set; rotated at this size (in bytes)
+	// or age, whichever comes first
+	config.LogDir = os.Getenv("WUTBOT_LOG_DIR")
+	config.LogMaxSize, _ = strconv.ParseInt(os.Getenv("WUTBOT_LOG_MAX_SIZE"), 10, 64)
+	config.LogRotation, _ = time.ParseDuration(os.Getenv("WUTBOT_LOG_ROTATION"))
+	// optional HTTP listener for /metrics, /healthz, /readyz and webhooks, e.g. "127.0.0.1:8080"
+	config.HTTPListen = os.Getenv("WUTBOT_HTTP_LISTEN")
+	// serve Go profiles under /debug/pprof/ on the HTTP listener; keep it private
+	config.Pprof = os.Getenv("WUTBOT_PPROF") != ""
+	// PM the owner when a panic is recovered from (they're always logged)
+	config.NotifyPanics = os.Getenv("WUTBOT_NOTIFY_PANICS") != ""
+	// enables the admin dashboard at /admin/, behind HTTP basic auth
+	// (WUTBOT_DASHBOARD_USER defaults to "admin"); use TLS in front of it
+	config.DashboardUser = os.Getenv("WUTBOT_DASHBOARD_USER")
+	config.DashboardPassword = os.Getenv("WUTBOT_DASHBOARD_PASSWORD")
+	// optional error reporting of panics and repeatedly failing feeds, follows
+	// and release checks: to Sentry, and/or as JSON POSTed to a URL
+	config.SentryDSN = os.Getenv("WUTBOT_SENTRY_DSN")
+	config.ErrorWebhook = os.Getenv("WUTBOT_ERROR_WEBHOOK")
+	// enables GitHub webhooks at /github, announced to the channels in the config's "github"
+	config.GitHubSecret = os.Getenv("WUTBOT_GITHUB_SECRET")
+	// for following Twitter accounts (Mastodon doesn't need one)
+	config.TwitterBearerToken = os.Getenv("WUTBOT_TWITTER_BEARER_TOKEN")
+	// optional, for a higher GitHub API rate limit when watching releases
+	config.GitHubToken = os.Getenv("WUTBOT_GITHUB_TOKEN")
+	// a bot token, for relaying Discord messages back to channels mirrored with
+	// the config's "discord" (which only needs a webhook the other way)
+	config.DiscordToken = os.Getenv("WUTBOT_DISCORD_TOKEN")
+	// optional OpenAI-compatible endpoint for !summarize and chat, e.g. https://api.openai.com/v1
+	config.LLMURL = os.Getenv("WUTBOT_LLM_URL")
+	config.LLMAPIKey = os.Getenv("WUTBOT_LLM_API_KEY")
+	config.LLMModel = os.Getenv("WUTBOT_LLM_MODEL")
+	// a Nominatim instance for titling map links, if not the public one
+	config.NominatimURL = os.Getenv("WUTBOT_NOMINATIM_URL")
+	// for !movie and titling IMDb links; a TMDB key can be a v3 API key or a read access token
+	config.OMDBAPIKey = os.Getenv("WUTBOT_OMDB_API_KEY")
+	config.TMDBAPIKey = os.Getenv("WUTBOT_TMDB_API_KEY")
+	config.PollDuration, _ = time.ParseDuration(os.Getenv("WUTBOT_POLL_DURATION"))
+	config.RejoinDelay, _ = time.ParseDuration(os.Getenv("WUTBOT_REJOIN_DELAY"))
+	// outgoing messages: up to WUTBOT_FLOOD_BURST at once, then one per WUTBOT_FLOOD_INTERVAL
+	config.FloodBurst, _ = strconv.Atoi(os.Getenv("WUTBOT_FLOOD_BURST"))
+	config.FloodInterval, _ = time.ParseDuration(os.Getenv("WUTBOT_FLOOD_INTERVAL"))
+	// ignore messages whose server-time is older than this (negative to disable)
+	if value := os.Getenv("WUTBOT_MAX_MESSAGE_AGE"); value != "" {
+		if config.MaxMessageAge, err = time.ParseDuration(value); err != nil {
+			return config, fmt.Errorf("invalid WUTBOT_MAX_MESSAGE_AGE: %w", err)
+		}
+		if config.MaxMessageAge == 0 {
+			config.MaxMessageAge = -1
+		}
+	}
+	// comma-delimited programs that add commands and link titles (see plugins.go)
+	config.Plugins = strings.Split(os.Getenv("WUTBOT_PLUGINS"), ",")
+	// Starlark scripts (see scripts.go), "scripts" by default; reloaded when they change
+	config.ScriptsDir = os.Getenv("WUTBOT_SCRIPTS_DIR")
+	// optional Matrix account, e.g. https://matrix.example.org and @wutbot:example.org,
+	// and the rooms (comma-delimited IDs or aliases) to join with it
+	config.MatrixHomeserver = os.Getenv("WUTBOT_MATRIX_HOMESERVER")
+	config.MatrixUserID = os.Getenv("WUTBOT_MATRIX_USER_ID")
+	config.MatrixAccessToken = os.Getenv("WUTBOT_MATRIX_ACCESS_TOKEN")
+	config.MatrixRooms = strings.Split(os.Getenv("WUTBOT_MATRIX_ROOMS"), ",")
+	// optional XMPP account (e.g. wutbot@example.org) that the owner's JID can
+	// give owner commands to, and that notifications go to while they're off IRC;
+	// the server is found with SRV unless WUTBOT_XMPP_SERVER (host:port) is set
+	config.XMPPJID = os.Getenv("WUTBOT_XMPP_JID")
+	config.XMPPPassword = os.Getenv("WUTBOT_XMPP_PASSWORD")
+	config.XMPPServer = os.Getenv("WUTBOT_XMPP_SERVER")
+	config.XMPPOwner = os.Getenv("WUTBOT_XMPP_OWNER")
+	// optional JSON file for per-channel settings (triggers etc.)
+	config.ConfigFile = os.Getenv("WUTBOT_CONFIG")
+	// any of the passwords, tokens etc. above can instead be "vault:<path>#<field>",
+	// read from Vault (with VAULT_ADDR and VAULT_TOKEN), or "keyring:<name>", read
+	// from the OS keyring (see "wutbot secret")
+	return config, resolveSecrets(&config)
+}
+
+// New sets up a bot; Run connects it.
+func New(c Config) (*Bot, error) {
+	version := c.Version
 	if version == "" {
 		version = "github.com/ergochat/irc-go"
 	}
-	debug := os.Getenv("WUTBOT_DEBUG") != ""
-	insecure := os.Getenv("WUTBOT_INSECURE_SKIP_VERIFY") != ""
-	userAgent := os.Getenv("WUTBOT_USER_AGENT")
+	ownerNick := c.OwnerNick
+	if ownerNick == "" {
+		ownerNick = c.Owner
+	}
+	logLevel := c.LogLevel
+	if logLevel == "" && c.Debug {
+		logLevel = "debug"
+	}
+	userAgent := c.UserAgent
 	if userAgent == "" {
 		userAgent = defaultUserAgent
 	}
+	dataDir := c.DataDir
+	if dataDir == "" {
+		dataDir = "data"
+	}
+	logDir := c.LogDir
+	if logDir == "" {
+		logDir = filepath.Join(dataDir, "logs")
+	}
+	scriptsDir := c.ScriptsDir
+	if scriptsDir == "" {
+		scriptsDir = "scripts"
+	}
+	dashboardUser := c.DashboardUser
+	if dashboardUser == "" {
+		dashboardUser = "admin"
+	}
+	maxMessageAge := c.MaxMessageAge
+	if maxMessageAge == 0 {
+		maxMessageAge = defaultMaxMessageAge
+	}
+	logOutput := c.LogOutput
+	if logOutput == nil {
+		logOutput = os.Stdout
+	}
+	ipPreference, err := netdial.ParsePreference(c.IPPreference)
+	if err != nil {
+		return nil, err
+	}
+	fetchClient := c.FetchClient
+	if fetchClient == nil {
+		var resolver fetch.Resolver
+		if c.DNSResolver != "" {
+			if resolver, err = fetch.NewResolver(c.DNSResolver); err != nil {
+				return nil, fmt.Errorf("invalid DNS resolver: %w", err)
+			}
+		}
+		fetchClient = fetch.NewClientWithOptions(fetch.ClientOptions{Resolver: resolver, IPPreference: ipPreference})
+	}
+	saslMech := strings.ToUpper(c.SASLMech)
+	logLevels, err := parseLogLevels(logLevel, c.LogModules)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level: %w", err)
+	}
+	logTail := new(logTail)
+	logHandler, err := newLogHandler(io.MultiWriter(logOutput, logTail), c.LogFormat, logLevels)
+	if err != nil {
+		return nil, err
+	}
+	config, err := loadConfig(c.ConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load config: %w", err)
+	}
+	triggers, err := compileTriggers(config)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load config: %w", err)
+	}
+	bots, err := newBotTracker(config)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load config: %w", err)
+	}
+	webhooks, err := compileWebhooks(config)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load config: %w", err)
+	}
+	relays, err := compileRelays(config)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load config: %w", err)
+	}
+	responses, err := compileResponses(config)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load config: %w", err)
+	}
+	errorReports, err := newErrorReporter(c.SentryDSN, c.ErrorWebhook)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Sentry DSN: %w", err)
+	}
+	nickserv, err := newNickServ(c.NickServNick, c.NickServCommand, c.NickServSuccess, c.SASLLogin, c.NickServPassword)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't configure NickServ: %w", err)
+	}
+	certs, err := loadClientCertificate(c.TLSCert, c.TLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load client certificate: %w", err)
+	}
+	pins, err := parsePins(c.TLSPins)
+	if err != nil {
+		return nil, err
+	}
+	matrix, err := integrations.NewMatrix(c.MatrixHomeserver, c.MatrixUserID, c.MatrixAccessToken, c.MatrixRooms)
+	if err != nil {
+		return nil, err
+	}
+	xmpp, err := integrations.NewXMPP(c.XMPPJID, c.XMPPPassword, c.XMPPServer, c.XMPPOwner)
+	if err != nil {
+		return nil, err
+	}
+	var webirc []string
+	if c.WebIRCPassword != "" {
+		webircIP, webircHostname := c.WebIRCIP, c.WebIRCHostname
+		if c.WebIRCGateway == "" || net.ParseIP(webircIP) == nil {
+			return nil, errors.New("WEBIRC needs a gateway and a valid IP")
+		}
+		if strings.HasPrefix(webircIP, ":") {
+			// e.g. ::1 would be taken for a trailing parameter
+			webircIP = "0" + webircIP
+		}
+		if webircHostname == "" {
+			webircHostname = webircIP
+		}
+		webirc = []string{c.WebIRCPassword, c.WebIRCGateway, webircHostname, webircIP}
+	}
+	if saslMech != "" && saslMech != "PLAIN" && saslMech != scramMech {
+		return nil, fmt.Errorf("unsupported SASL mechanism %s", saslMech)
+	}
+	store, err := storage.OpenDir(dataDir, c.StoreBackend, c.StoreURL)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open state database: %w", err)
+	}
+
+	ignores, err := loadIgnoreList(store)
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("couldn't load the ignore list: %w", err)
+	}
+
+	var last lastServer
+	store.Get(stateBucket, lastServerStateKey, &last)
+	rotation := newServerRotation(c.Servers, last)
+	if rotation.Current() == "" {
+		store.Close()
+		return nil, errors.New("a server is required")
+	}
 
-	var tlsconf *tls.Config
-	if insecure {
-		tlsconf = &tls.Config{InsecureSkipVerify: true}
+	tlsconf := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify, Certificates: certs}
+	if len(pins) != 0 {
+		pinTLSConfig(tlsconf, pins)
 	}
 
+	httpClient := newHTTPClient()
 	irc := &Bot{
 		Connection: ircevent.Connection{
-			Server:       server,
-			Nick:         nick,
-			UseTLS:       true,
-			TLSConfig:    tlsconf,
-			RequestCaps:  []string{"server-time", "message-tags", "account-tag"},
-			SASLLogin:    saslLogin, // SASL will be enabled automatically if these are set
-			SASLPassword: saslPassword,
+			Server:    rotation.Current(),
+			Nick:      c.Nick,
+			UseTLS:    !c.Plaintext,
+			TLSConfig: tlsconf,
+			RequestCaps: []string{
+				"server-time", "message-tags", "account-tag", "batch",
+				bot.MultilineCap, chathistoryCap, "echo-message", "labeled-response",
+				"multi-prefix", "cap-notify", "extended-join",
+			},
+			SASLLogin:    c.SASLLogin, // SASL will be enabled automatically if these are set
+			SASLPassword: c.SASLPassword,
+			UseSASL:      certs != nil,
+			// if SASL isn't available, we can still identify with NickServ
+			SASLOptional: nickserv != nil,
+			WebIRC:       webirc,
 			QuitMessage:  version,
-			Debug:        debug,
+			Debug:        c.Debug,
+			Log:          slog.NewLogLogger(logHandler.WithAttrs([]slog.Attr{slog.String("module", "irc")}), slog.LevelInfo),
 		},
-		Owner:     owner,
-		userAgent: userAgent,
-		semaphore: make(chan empty, concurrencyLimit),
+		Owner:        c.Owner,
+		userAgent:    userAgent,
+		workers:      newWorkerPool(),
+		config:       config,
+		triggers:     triggers,
+		polls:        newPollManager(c.PollDuration),
+		trivia:       newTriviaManager(),
+		store:        store,
+		ignores:      ignores,
+		httpClient:   httpClient,
+		nickAccounts: newNickAccounts(),
+		fetcher:      &fetch.Fetcher{Client: fetchClient, UserAgent: userAgent, Languages: c.AcceptLanguage, Sites: fetchSites(config)},
+		llm:          newLLMClient(c.LLMURL, c.LLMAPIKey, c.LLMModel),
+
+		summarizeLimiter: newRateLimiter(summarizeLimit, summarizeWindow),
+		chat:             newChatManager(),
+		markov:           newMarkovManager(filepath.Join(dataDir, "markov")),
+		joined:           newJoinedChannels(),
+		servers:          rotation,
+		ipPreference:     ipPreference,
+		rejoin:           newRejoinManager(c.RejoinDelay),
+		sendQueue:        bot.NewSendQueue(c.FloodBurst, c.FloodInterval),
+		history:          newHistoryTracker(),
+		delivery:         new(deliveryStats),
+		maxMessageAge:    maxMessageAge,
+		sts:              &stsState{upgrades: make(map[string]string), plaintext: c.Plaintext},
+		sasl:             &saslState{external: certs != nil, scram: saslMech == scramMech},
+		scram:            new(scramState),
+		nickserv:         nickserv,
+		owner:            newOwnerPresence(ownerNick),
+		pendingJoins:     newPendingJoins(),
+		bots:             bots,
+		chanModes:        newChannelModes(),
+		logTail:          logTail,
+		caps:             new(capTracker),
+		admins:           c.Admins,
+		hosts:            newHostLookups(),
+		topics:           newTopicRotation(),
+		chanLog:          newChannelLogger(logDir, c.LogMaxSize, c.LogRotation),
+		dataDir:          dataDir,
+		stats:            newStatsTracker(store),
+		httpMux:          http.NewServeMux(),
+		feeds:            new(feedPoller),
+		webhooks:         webhooks,
+		relays:           relays,
+		responses:        responses,
+		githubToken:      c.GitHubToken,
+		twitterToken:     c.TwitterBearerToken,
+		omdbKey:          c.OMDBAPIKey,
+		tmdbKey:          c.TMDBAPIKey,
+		health:           newHealthState(),
+		baseLogger:       slog.New(logHandler),
+		logLevels:        logLevels,
+		stopping:         newShutdownState(),
+		panics:           newPanicTracker(c.NotifyPanics),
+		errorReports:     errorReports,
+		stopTracing:      func() {},
+		started:          time.Now(),
+		httpListen:       c.HTTPListen,
+		plugins:          newPlugins(c.Plugins),
+		scripts:          newScriptManager(scriptsDir),
+		events:           newEventBus(),
+		watches:          new(watchList),
+		matrix:           matrix,
+		xmpp:             xmpp,
+		discord:          newDiscordBridge(&integrations.Discord{Token: c.DiscordToken, UserAgent: userAgent, Client: httpClient}),
+		lastLinks:        &lastLinks{links: make(map[string]lastLink)},
+		sharedFetches:    &sharedFetches{fetches: make(map[string]*sharedFetch)},
+		geocoder:         newGeocoder(c.NominatimURL),
+	}
+	irc.commands = irc.newCommandMux()
+	irc.RegisterHandler(irc.handlePluginCommand)
+	irc.RegisterHandler(irc.handleScriptMessage)
+	if certs != nil {
+		irc.SASLMech = "EXTERNAL"
+	}
+	irc.DialContext = irc.dialWithSASLMech(irc.dialWithBackoff(irc.dialRotation((&net.Dialer{}).DialContext)))
+	irc.httpMux.HandleFunc("/metrics", irc.handleMetrics)
+	irc.httpMux.HandleFunc("/healthz", irc.handleHealthz)
+	irc.httpMux.HandleFunc("/readyz", irc.handleReadyz)
+	if c.GitHubSecret != "" {
+		irc.httpMux.HandleFunc("/github", irc.handleGitHubWebhook(c.GitHubSecret))
+	}
+	irc.httpMux.HandleFunc("/hook/", irc.handleWebhook)
+	if c.DashboardPassword != "" {
+		irc.httpMux.Handle("/admin/", irc.handleDashboard(dashboardUser, c.DashboardPassword))
+	}
+	if c.Pprof {
+		handlePprof(irc.httpMux)
 	}
 
 	irc.AddConnectCallback(func(e ircmsg.Message) {
+		atomic.StoreInt32(&irc.connectAttempts, 0)
+		if err := irc.store.Put(stateBucket, lastServerStateKey, irc.servers.Last()); err != nil {
+			irc.logger("servers").Error("couldn't save last server", "err", err)
+		}
 		if botMode := irc.ISupport()["BOT"]; botMode != "" {
 			irc.Send("MODE", irc.CurrentNick(), "+"+botMode)
 		}
-		for _, channel := range strings.Split(channels, ",") {
-			irc.Join(strings.TrimSpace(channel))
+		irc.identifyWithNickServ()
+		// rejoin anything we were in before a reconnect, as well as the configured channels
+		toJoin := append([]string(nil), c.Channels...)
+		toJoin = append(toJoin, irc.joined.List()...)
+		seen := make(map[string]bool)
+		for _, channel := range toJoin {
+			channel = strings.TrimSpace(channel)
+			if channel != "" && !seen[strings.ToLower(channel)] {
+				seen[strings.ToLower(channel)] = true
+				irc.joinChannel(channel)
+			}
+		}
+	})
+	irc.AddDisconnectCallback(func(e ircmsg.Message) {
+		irc.sendQueue.Discard()
+		// the next server may advertise a different limit, or none
+		irc.sendQueue.SetServerRate(0, 0)
+	})
+	irc.AddCallback(ircevent.RPL_ISUPPORT, irc.handleRateLimitISupport)
+	irc.subscribeModules()
+	irc.publishJoins()
+	irc.publishParts()
+	irc.AddCallback("PART", func(e ircmsg.Message) {
+		if len(e.Params) != 0 && e.Nick() == irc.CurrentNick() {
+			irc.joined.Remove(e.Params[0])
+			irc.handleSelfPart(e.Params[0])
 		}
 	})
+	irc.AddCallback("KICK", func(e ircmsg.Message) {
+		if len(e.Params) > 1 && e.Params[1] == irc.CurrentNick() {
+			irc.joined.Remove(e.Params[0])
+			irc.notifyOwner("kicked from " + e.Params[0] + " by " + e.Nick() + ": " + e.Params[len(e.Params)-1])
+			irc.scheduleRejoin(e.Params[0])
+		}
+	})
+	irc.AddCallback("QUIT", irc.handleNickFreed)
+	irc.AddCallback("NICK", irc.handleNickFreed)
+	irc.setupNickServCallbacks()
+	irc.watchOwner()
+	irc.watchBots()
+	irc.watchChannelModes()
+	irc.watchCaps()
+	irc.watchHosts()
+	irc.watchChannelLogs()
+	irc.watchHealth()
+	irc.watchConnectionContext()
+	irc.notifySystemd()
+	irc.scheduleStoredUnbans()
+	irc.AddCallback(ircevent.ERR_BADCHANNELKEY, irc.handleJoinFailure)
+	irc.AddCallback(ircevent.ERR_INVITEONLYCHAN, irc.handleJoinFailure)
+	irc.AddCallback("KILL", func(e ircmsg.Message) {
+		// the server will disconnect us; reconnecting rejoins everything
+		irc.logger("irc").Warn("killed", "by", e.Nick(), "reason", strings.Join(e.Params, " "))
+	})
 	irc.AddCallback("PRIVMSG", func(e ircmsg.Message) {
 		target, message := e.Params[0], e.Params[1]
+		if e.Nick() == irc.CurrentNick() {
+			// unlabeled echo-message of our own output
+			return
+		}
+		if irc.isStale(e) || irc.isBot(e) || irc.isIgnored(e) {
+			return
+		}
+		if prefixes, channel := irc.stripStatusPrefix(target); prefixes != "" && irc.isChannel(channel) {
+			// only meant for some of the channel's members: don't answer
+			// (in public) or learn from it
+			return
+		}
 		_, msgid := e.GetTag("msgid")
+		ctx, span := tracer.Start(irc.connectionContext(), "PRIVMSG", trace.WithAttributes(
+			attribute.String("irc.target", target), attribute.String("irc.nick", e.Nick()), attribute.String("irc.msgid", msgid),
+		))
+		defer span.End()
 		fromOwner := ownerMatches(e, irc.Owner)
-		if !strings.HasPrefix(target, "#") && !fromOwner {
+		if ownerNick, online := irc.ownerOnline(); fromOwner && !online && strings.EqualFold(e.Nick(), ownerNick) {
+			irc.setOwnerOnline(true)
+		}
+		if !irc.isChannel(target) && !fromOwner {
 			return
 		}
 
-		if fromOwner {
+		if fromOwner && !irc.isChannel(target) && irc.handleDCCChat(e.Nick(), message) {
+			return
+		}
+		if fromOwner && strings.HasPrefix(message, irc.Nick) {
+			irc.audit(auditEntry{
+				Nick: e.Nick(), Account: irc.Owner, Channel: target, Command: strings.TrimLeft(strings.TrimPrefix(message, irc.Nick), ": "),
+			})
 			irc.handleOwnerCommand(e.Params[0], message)
 		} else if strings.HasPrefix(message, irc.Nick) {
-			irc.sendReplyNotice(e.Params[0], msgid, "don't @ me, mortal")
+			if irc.chatEnabled(target) {
+				irc.handleChatMention(target, e.Nick(), msgid, message)
+			} else if !irc.handleMarkovMention(target, msgid, message) {
+				if text := irc.respond(responseMention, responseData{Nick: e.Nick(), Channel: target}); text != "" {
+					irc.sendReplyNotice(e.Params[0], msgid, text)
+				}
+			}
+		} else if irc.isChannel(target) {
+			irc.handleChannelMessage(ctx, e, target, msgid, message, "")
 		}
 	})
+	irc.AddCallback("TAGMSG", func(e ircmsg.Message) {
+		if len(e.Params) == 0 || !irc.isChannel(e.Params[0]) || irc.isStale(e) || irc.isBot(e) || irc.isIgnored(e) {
+			return
+		}
+		if e.Nick() == irc.CurrentNick() {
+			// echo of our own reaction
+			return
+		}
+		react, _ := e.GetTag(reactTagName)
+		unreact, _ := e.GetTag(unreactTagName)
+		if react || unreact {
+			irc.handlePollReaction(e, e.Params[0])
+		}
+	})
+	irc.AddCallback("CAP", irc.handleSTSAdvertisement)
+	irc.AddCallback("CAP", irc.handleSASLMechanisms)
+	irc.AddCallback(ircevent.ERR_SASLFAIL, irc.handleSASLFailure)
+	irc.AddCallback("AUTHENTICATE", irc.handleSCRAMAuthenticate)
+	irc.AddCallback(ircevent.RPL_SASLMECHS, irc.handleSASLFailure)
+	irc.AddBatchCallback(irc.handleHistoryBatch)
+	irc.AddBatchCallback(irc.handlePlaybackBatch)
 	irc.AddCallback("INVITE", func(e ircmsg.Message) {
 		fromOwner := ownerMatches(e, irc.Owner)
+		if ownerNick, online := irc.ownerOnline(); fromOwner && !online && strings.EqualFold(e.Nick(), ownerNick) {
+			irc.setOwnerOnline(true)
+		}
 		if fromOwner {
-			irc.Join(e.Params[1])
+			irc.pendingJoins.remove(e.Params[1])
+			irc.joinChannel(e.Params[1])
 		}
 	})
 
-	return irc
+	return irc, nil
 }
 
-func main() {
-	irc := newBot()
-	err := irc.Connect()
+// Main is the wutbot command: a maintenance subcommand, or else the bot,
+// configured from the environment, until it's signalled to stop.
+func Main() {
+	if len(os.Args) > 1 {
+		runSubcommand(os.Args[1], os.Args[2:])
+		return
+	}
+	err := godotenv.Load(".env")
+	if err != nil {
+		log.Fatalf("Some error occured. Err: %s", err)
+	}
+	config, err := configFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	irc, err := New(config)
 	if err != nil {
 		log.Fatal(err)
 	}
-	irc.Loop()
+	// anything still using the log package goes through it too
+	slog.SetDefault(irc.baseLogger)
+	if irc.stopTracing, err = initTracing(); err != nil {
+		log.Fatalf("Couldn't set up tracing: %v", err)
+	}
+	go irc.handleSignals()
+	if err := irc.Run(context.Background()); err != nil {
+		log.Fatal(err)
+	}
 }
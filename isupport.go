@@ -0,0 +1,75 @@
+package wutbot
+
+import (
+	"strings"
+)
+
+const (
+	// RFC 1459's channel types, for servers that don't send CHANTYPES
+	defaultChanTypes = "#&"
+)
+
+// isChannel reports whether target is a channel name, according to the
+// server's CHANTYPES, or one of our Matrix rooms.
+func (irc *Bot) isChannel(target string) bool {
+	if _, isRoom := irc.matrix.RoomID(target); isRoom {
+		return true
+	}
+	chanTypes, ok := irc.ISupport()["CHANTYPES"]
+	if !ok {
+		chanTypes = defaultChanTypes
+	}
+	return target != "" && strings.IndexByte(chanTypes, target[0]) != -1
+}
+
+// stripStatusPrefix splits a STATUSMSG target like "@#chan" into the
+// membership prefixes and the channel.
+func (irc *Bot) stripStatusPrefix(target string) (prefixes, channel string) {
+	statusMsg := irc.ISupport()["STATUSMSG"]
+	channel = strings.TrimLeft(target, statusMsg)
+	return target[:len(target)-len(channel)], channel
+}
+
+// prefixModes returns the membership modes ("ov") and their prefixes
+// ("@+") from the server's PREFIX.
+func (irc *Bot) prefixModes() (modes, prefixes string) {
+	prefix, ok := irc.ISupport()["PREFIX"]
+	if !ok {
+		prefix = "(ov)@+"
+	}
+	if !strings.HasPrefix(prefix, "(") {
+		return "", ""
+	}
+	modes, prefixes, _ = strings.Cut(prefix[1:], ")")
+	if len(modes) != len(prefixes) {
+		return "", ""
+	}
+	return
+}
+
+// modeTakesParam reports whether a channel mode letter takes a parameter
+// when set (or unset), according to PREFIX and CHANMODES.
+func (irc *Bot) modeTakesParam(mode byte, adding bool) bool {
+	if modes, _ := irc.prefixModes(); strings.IndexByte(modes, mode) != -1 {
+		return true
+	}
+	chanModes, ok := irc.ISupport()["CHANMODES"]
+	if !ok {
+		chanModes = "b,k,l,imnpst"
+	}
+	types := strings.Split(chanModes, ",")
+	for i, modes := range types {
+		if strings.IndexByte(modes, mode) == -1 {
+			continue
+		}
+		switch i {
+		case 0, 1:
+			return true
+		case 2:
+			return adding
+		default:
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package wutbot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+const (
+	// keys supplied by the owner at runtime, keyed by casefolded channel
+	channelKeysBucket = "channel-keys"
+)
+
+// pendingJoins are channels we couldn't get into, waiting for a key or
+// an invite from the owner.
+type pendingJoins struct {
+	sync.Mutex
+	channels map[string]bool // casefolded
+}
+
+func newPendingJoins() *pendingJoins {
+	return &pendingJoins{channels: make(map[string]bool)}
+}
+
+func (p *pendingJoins) add(channel string) (added bool) {
+	p.Lock()
+	defer p.Unlock()
+	key := strings.ToLower(channel)
+	added = !p.channels[key]
+	p.channels[key] = true
+	return
+}
+
+func (p *pendingJoins) remove(channel string) {
+	p.Lock()
+	delete(p.channels, strings.ToLower(channel))
+	p.Unlock()
+}
+
+func (irc *Bot) channelKey(channel string) string {
+	var key string
+	if found, _ := irc.store.Get(channelKeysBucket, strings.ToLower(channel), &key); found {
+		return key
+	}
+	return irc.getConfig().Channels[strings.ToLower(channel)].Key
+}
+
+// joinChannel joins a channel, with its key if we know one.
+func (irc *Bot) joinChannel(channel string) {
+	if key := irc.channelKey(channel); key != "" {
+		irc.Send("JOIN", channel, key)
+	} else {
+		irc.Join(channel)
+	}
+}
+
+// handleJoinFailure asks the owner for help getting into a channel
+// that needs a key or an invite.
+func (irc *Bot) handleJoinFailure(e ircmsg.Message) {
+	if len(e.Params) < 3 {
+		return
+	}
+	channel, reason := e.Params[1], e.Params[2]
+	irc.logger("joins").Warn("couldn't join", "channel", channel, "reason", reason)
+	if !irc.pendingJoins.add(channel) {
+		return
+	}
+	if e.Command == ircevent.ERR_BADCHANNELKEY {
+		irc.notifyOwner(fmt.Sprintf("couldn't join %s (%s); tell me the key with \"%s key %s <key>\"", channel, reason, irc.Nick, channel))
+	} else {
+		irc.notifyOwner(fmt.Sprintf("couldn't join %s (%s); invite me and I'll try again", channel, reason))
+	}
+}
+
+// handleKeyCommand is the owner's "key <channel> [<key>]"; without a key,
+// it forgets the one we had.
+func (irc *Bot) handleKeyCommand(target string, args []string) {
+	if len(args) == 0 {
+		irc.Privmsg(target, "usage: key <channel> [<key>]")
+		return
+	}
+	channel := args[0]
+	var err error
+	if len(args) > 1 {
+		err = irc.store.Put(channelKeysBucket, strings.ToLower(channel), args[1])
+	} else {
+		err = irc.store.Delete(channelKeysBucket, strings.ToLower(channel))
+	}
+	if err != nil {
+		irc.Privmsg(target, fmt.Sprintf("couldn't save the key: %v", err))
+		return
+	}
+	if len(args) > 1 {
+		irc.pendingJoins.remove(channel)
+		irc.joinChannel(channel)
+	}
+}
@@ -0,0 +1,179 @@
+package wutbot
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pratyush/wutbot/internal/storage"
+)
+
+const (
+	// archived links, keyed by "<time> <url>" so that keys sort by time
+	linkArchiveBucket = "links:"
+	linkKeyTimeFormat = "2006-01-02T15:04:05.000000000Z"
+	// how many recent links the owner command shows
+	recentLinksCount = 5
+)
+
+// archivedLink is a link posted in a channel, and what fetching it found.
+type archivedLink struct {
+	Channel string    `json:"channel"`
+	URL     string    `json:"url"`
+	Poster  string    `json:"poster"`
+	Account string    `json:"account,omitempty"`
+	Time    time.Time `json:"time"`
+	MsgID   string    `json:"msgid,omitempty"` // of the message it was posted in
+	Title   string    `json:"title,omitempty"`
+	Status  string    `json:"status"`
+	// where it was posted, if not on IRC: sourceMatrix or sourceDiscord
+	Source string `json:"source,omitempty"`
+}
+
+func linkStatus(err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	return "ok"
+}
+
+func (irc *Bot) archiveLink(link archivedLink) {
+	key := link.Time.UTC().Format(linkKeyTimeFormat) + " " + link.URL
+	if err := irc.store.Put(linkArchiveBucket+strings.ToLower(link.Channel), key, link); err != nil {
+		irc.logger("links").Error("couldn't archive link", "channel", link.Channel, "url", link.URL, "err", err)
+	}
+}
+
+// archivedLinks returns a channel's links posted in [from, to), oldest first;
+// zero times leave that end open.
+func archivedLinks(s storage.Store, channel string, from, to time.Time) (links []archivedLink, err error) {
+	bucket := linkArchiveBucket + strings.ToLower(channel)
+	keys, err := s.Keys(bucket)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		stamp, _, _ := strings.Cut(key, " ")
+		if !from.IsZero() && stamp < from.UTC().Format(linkKeyTimeFormat) {
+			continue
+		}
+		if !to.IsZero() && stamp >= to.UTC().Format(linkKeyTimeFormat) {
+			break
+		}
+		var link archivedLink
+		if found, err := s.Get(bucket, key, &link); err != nil {
+			return nil, err
+		} else if found {
+			links = append(links, link)
+		}
+	}
+	return
+}
+
+// parseDateRange parses the optional start and end of a date range, as
+// dates (the end being inclusive) or RFC 3339 times.
+func parseDateRange(args []string) (from, to time.Time, err error) {
+	parse := func(value string, end bool) (time.Time, error) {
+		if t, err := time.Parse("2006-01-02", value); err == nil {
+			if end {
+				t = t.AddDate(0, 0, 1)
+			}
+			return t, nil
+		}
+		return time.Parse(time.RFC3339, value)
+	}
+	if len(args) > 0 && args[0] != "" {
+		if from, err = parse(args[0], false); err != nil {
+			return
+		}
+	}
+	if len(args) > 1 && args[1] != "" {
+		to, err = parse(args[1], true)
+	}
+	return
+}
+
+func writeLinks(w io.Writer, format string, links []archivedLink) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if links == nil {
+			links = []archivedLink{}
+		}
+		return enc.Encode(links)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"time", "channel", "poster", "account", "url", "title", "status"})
+		for _, l := range links {
+			cw.Write([]string{l.Time.UTC().Format(time.RFC3339), l.Channel, l.Poster, l.Account, l.URL, l.Title, l.Status})
+		}
+		cw.Flush()
+		return cw.Error()
+	default:
+		return fmt.Errorf("unknown format %s (json or csv)", format)
+	}
+}
+
+// handleLinksCommand is the owner's "links <channel> [<from> [<to>]]", which
+// shows the latest links, and "links export <channel> json|csv [<from> [<to>]]",
+// which writes them to a file in the data directory.
+func (irc *Bot) handleLinksCommand(target string, args []string) {
+	export := len(args) != 0 && args[0] == "export"
+	if export {
+		args = args[1:]
+	}
+	if len(args) == 0 || (export && len(args) < 2) {
+		irc.Privmsg(target, "usage: links <channel> [<from> [<to>]] | links export <channel> json|csv [<from> [<to>]]")
+		return
+	}
+	channel, args := args[0], args[1:]
+	var format string
+	if export {
+		format, args = args[0], args[1:]
+	}
+	from, to, err := parseDateRange(args)
+	if err != nil {
+		irc.Privmsg(target, fmt.Sprintf("invalid date: %v", err))
+		return
+	}
+	links, err := archivedLinks(irc.store, channel, from, to)
+	if err != nil {
+		irc.Privmsg(target, fmt.Sprintf("couldn't read the archive: %v", err))
+		return
+	}
+	if !export {
+		irc.Privmsg(target, fmt.Sprintf("%d links archived for %s", len(links), channel))
+		if len(links) > recentLinksCount {
+			links = links[len(links)-recentLinksCount:]
+		}
+		for _, l := range links {
+			irc.Privmsg(target, fmt.Sprintf("%s <%s> %s %s", l.Time.UTC().Format("2006-01-02 15:04"), l.Poster, l.URL, l.Title))
+		}
+		return
+	}
+	path := filepath.Join(irc.dataDir, fmt.Sprintf("links-%s-%s.%s", logFileName(channel), time.Now().UTC().Format("20060102-150405"), format))
+	if err := writeLinksFile(path, format, links); err != nil {
+		irc.Privmsg(target, fmt.Sprintf("couldn't export: %v", err))
+		return
+	}
+	irc.Privmsg(target, fmt.Sprintf("exported %d links to %s", len(links), path))
+}
+
+func writeLinksFile(path, format string, links []archivedLink) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if err := writeLinks(f, format, links); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
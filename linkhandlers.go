@@ -0,0 +1,32 @@
+package wutbot
+
+import (
+	"context"
+	"net/url"
+)
+
+// A linkHandler titles the links it knows better than their pages do,
+// returning ok if it handled the link. Plugins and scripts still get the
+// first say.
+type linkHandler func(ctx context.Context, irc *Bot, u *url.URL) (title string, ok bool, err error)
+
+var linkHandlers = []linkHandler{
+	searchTitle,
+	geoTitle,
+	bookTitle,
+	movieTitle,
+}
+
+// builtinTitle gets a link's title from the first handler for it.
+func (irc *Bot) builtinTitle(ctx context.Context, link string) (title string, ok bool, err error) {
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", false, nil
+	}
+	for _, handler := range linkHandlers {
+		if title, ok, err = handler(ctx, irc, u); ok {
+			return title, ok, err
+		}
+	}
+	return "", false, nil
+}
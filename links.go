@@ -0,0 +1,149 @@
+package wutbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"pratyush/wutbot/internal/fetch"
+)
+
+const (
+	// don't let one message tie up the fetchers
+	maxLinksPerMessage = 3
+	// a title that takes longer than this to get to isn't worth announcing
+	linkDeadline = 30 * time.Second
+)
+
+// fetchContext has fetches ask for the channel's languages.
+func (irc *Bot) fetchContext(ctx context.Context, channel string) context.Context {
+	config := irc.getConfig()
+	languages := channelOption(config, channel, func(c ChannelConfig) *string { return c.AcceptLanguage })
+	if languages == "" {
+		languages = channelOption(config, channel, func(c ChannelConfig) *string { return c.Language })
+	}
+	return fetch.WithAcceptLanguage(ctx, languages)
+}
+
+// linkHost is the sanitized host of a link, for messages about it.
+func linkHost(link string) string {
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return fetch.Sanitize(u.Hostname())
+}
+
+func (irc *Bot) titlesEnabled(channel string) bool {
+	return !channelOption(irc.getConfig(), channel, func(c ChannelConfig) *bool { return c.NoTitles })
+}
+
+// publishLinks publishes the links in a message, unless its sender opted
+// out.
+func (irc *Bot) publishLinks(m messageEvent) {
+	if irc.optedOut(m.account) {
+		return
+	}
+	_, span := tracer.Start(m.ctx, "parse")
+	urls := fetch.ExtractURLs(m.text)
+	for _, u := range append(extractGeoURIs(m.text), extractISBNs(m.text)...) {
+		if !slices.Contains(urls, u) {
+			urls = append(urls, u)
+		}
+	}
+	span.SetAttributes(attribute.Int("links", len(urls)))
+	span.End()
+	if len(urls) > maxLinksPerMessage {
+		urls = urls[:maxLinksPerMessage]
+	}
+	for _, u := range urls {
+		link := archivedLink{Channel: m.channel, Poster: m.nick, Account: m.account, Time: m.time, MsgID: m.msgid, URL: u, Source: m.source}
+		publish(irc, &irc.events.links, linkEvent{ctx: m.ctx, link: link})
+	}
+}
+
+// announceLink fetches a URL in the background, archives it and announces
+// its title (as a reply to the message it was posted in), prefixed with
+// marker if it's non-empty.
+func (irc *Bot) announceLink(ctx context.Context, link archivedLink, marker string) {
+	err := irc.workers.submit(ctx, link.Channel, "link fetch", linkDeadline, func(ctx context.Context) {
+		irc.withTyping(link.Channel, func() { irc.fetchAndAnnounce(ctx, link, marker) })
+	})
+	if err != nil {
+		irc.logger("links").Warn("too busy, dropping link", "channel", link.Channel, "url", link.URL)
+	}
+}
+
+func (irc *Bot) fetchAndAnnounce(ctx context.Context, link archivedLink, marker string) {
+	ctx, span := tracer.Start(ctx, "link", trace.WithAttributes(attribute.String("url.full", link.URL)))
+	defer span.End()
+	window := irc.duplicateWindow(link.Channel)
+	shared := irc.fetchShared(irc.fetchContext(ctx, link.Channel), link, window)
+	p, err := shared.page, shared.err
+	title, format := "", "Title: %s (%s)"
+	if p != nil {
+		title = p.Title
+		switch {
+		case p.Image != nil:
+			title, format = irc.describeImage(link.Channel, p.Image), "Image: %s (%s)"
+		case p.Media != nil:
+			title, format = describeMedia(p.Media)
+		case p.TextPreview != "":
+			title, format = p.TextPreview, "Text: %s (%s)"
+		case p.JSONPreview != nil:
+			title, format = irc.describeJSON(link.Channel, p.JSONPreview), "JSON: %s (%s)"
+		}
+		link.Title = title
+	}
+	link.Status = linkStatus(err)
+	publish(irc, &irc.events.titles, titleEvent{link: link, page: p, err: err})
+	if err != nil {
+		if !errors.Is(err, fetch.ErrNotHTML) && !errors.Is(err, fetch.ErrTooLarge) {
+			irc.logger("links").Info("couldn't fetch", "channel", link.Channel, "url", link.URL, "err", err)
+			irc.fetchFailed("link "+linkHost(link.URL), err, map[string]string{
+				"channel": link.Channel, "url": link.URL, "kind": irc.describeFetchError("", err),
+			})
+		}
+		if problem := fetch.CertProblem(err); problem != "" && irc.certWarningDays(link.Channel) != 0 {
+			text := fmt.Sprintf(irc.translate(link.Channel, "⚠ %s has an invalid certificate: %s"), linkHost(link.URL), irc.certProblemText(link.Channel, problem))
+			irc.sendReplyNotice(link.Channel, link.MsgID, text)
+			return
+		}
+		irc.reportFetchError(link, err)
+		return
+	}
+	irc.fetchSucceeded("link " + linkHost(link.URL))
+	if title == "" {
+		return
+	}
+	irc.lastLinks.set(link.Channel, lastLink{url: fetch.Sanitize(p.URL.String()), title: title, description: p.Description})
+	announced := title
+	if limit := irc.maxTitleRunes(link.Channel); limit > 0 {
+		announced = truncateRunes(announced, limit)
+	}
+	text := fmt.Sprintf(irc.translate(link.Channel, format), announced, fetch.Sanitize(p.URL.Hostname()))
+	if elsewhere := irc.announcedElsewhere(shared, link.Channel, window); len(elsewhere) != 0 {
+		switch channelOption(irc.getConfig(), link.Channel, func(c ChannelConfig) *string { return c.Duplicates }) {
+		case "suppress":
+			return
+		case "compress":
+			text = fmt.Sprintf(irc.translate(link.Channel, "also in %s: %s"), strings.Join(elsewhere, ", "), truncateRunes(title, compressedTitleRunes))
+		}
+	}
+	if warning := irc.certWarning(link.Channel, p.CertExpires); warning != "" {
+		text += " " + warning
+	}
+	if marker != "" {
+		text = marker + " " + text
+	}
+	_, sendSpan := tracer.Start(ctx, "send")
+	irc.sendReplyNotice(link.Channel, link.MsgID, text)
+	sendSpan.End()
+}
@@ -0,0 +1,89 @@
+package wutbot
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	llmTimeout = 60 * time.Second
+)
+
+var (
+	errLLMNotConfigured = errors.New("no LLM endpoint is configured")
+)
+
+// llmClient talks to an OpenAI-compatible chat completions API.
+type llmClient struct {
+	baseURL string // e.g. https://api.openai.com/v1
+	apiKey  string
+	model   string
+	client  *http.Client
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func newLLMClient(baseURL, apiKey, model string) *llmClient {
+	if baseURL == "" {
+		return nil
+	}
+	return &llmClient{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		model:   model,
+		client:  &http.Client{Timeout: llmTimeout},
+	}
+}
+
+// complete returns the model's reply to the conversation.
+func (c *llmClient) complete(ctx context.Context, messages []chatMessage, maxTokens int) (string, error) {
+	if c == nil {
+		return "", errLLMNotConfigured
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"model":      c.model,
+		"messages":   messages,
+		"max_tokens": maxTokens,
+	})
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/chat/completions", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("LLM endpoint returned %s", resp.Status)
+	}
+	var response struct {
+		Choices []struct {
+			Message chatMessage `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxAPIResponseBytes)).Decode(&response); err != nil {
+		return "", err
+	}
+	if len(response.Choices) == 0 {
+		return "", errors.New("LLM endpoint returned no choices")
+	}
+	return strings.TrimSpace(response.Choices[0].Message.Content), nil
+}
@@ -0,0 +1,152 @@
+package wutbot
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// logLevels holds the minimum level to log, overall and per module; the
+// owner can change them at runtime.
+type logLevels struct {
+	sync.RWMutex
+	base    slog.Level
+	modules map[string]slog.Level
+}
+
+func (l *logLevels) level(module string) slog.Level {
+	l.RLock()
+	defer l.RUnlock()
+	if level, ok := l.modules[module]; ok {
+		return level
+	}
+	return l.base
+}
+
+// set changes a module's level, or the overall level if module is empty.
+func (l *logLevels) set(module string, level slog.Level) {
+	l.Lock()
+	defer l.Unlock()
+	if module == "" {
+		l.base = level
+	} else {
+		l.modules[module] = level
+	}
+}
+
+func (l *logLevels) String() string {
+	l.RLock()
+	defer l.RUnlock()
+	parts := []string{l.base.String()}
+	var modules []string
+	for module := range l.modules {
+		modules = append(modules, module)
+	}
+	sort.Strings(modules)
+	for _, module := range modules {
+		parts = append(parts, module+"="+l.modules[module].String())
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseLogLevels parses a default level and comma-separated module levels,
+// e.g. "info" and "links=debug,sasl=warn".
+func parseLogLevels(base, modules string) (*logLevels, error) {
+	levels := &logLevels{modules: make(map[string]slog.Level)}
+	if base != "" {
+		if err := levels.base.UnmarshalText([]byte(base)); err != nil {
+			return nil, err
+		}
+	}
+	for _, entry := range strings.FieldsFunc(modules, func(r rune) bool { return r == ',' || r == ' ' }) {
+		module, value, ok := strings.Cut(entry, "=")
+		var level slog.Level
+		if !ok {
+			return nil, fmt.Errorf("expected module=level, got %s", entry)
+		}
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			return nil, err
+		}
+		levels.modules[module] = level
+	}
+	return levels, nil
+}
+
+// moduleHandler filters records by the level of the module the logger was
+// made for (its "module" attribute).
+type moduleHandler struct {
+	inner  slog.Handler
+	levels *logLevels
+	module string
+}
+
+func (h *moduleHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.levels.level(h.module)
+}
+
+func (h *moduleHandler) Handle(ctx context.Context, r slog.Record) error {
+	return h.inner.Handle(ctx, r)
+}
+
+func (h *moduleHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	module := h.module
+	for _, attr := range attrs {
+		if attr.Key == "module" {
+			module = attr.Value.String()
+		}
+	}
+	return &moduleHandler{inner: h.inner.WithAttrs(attrs), levels: h.levels, module: module}
+}
+
+func (h *moduleHandler) WithGroup(name string) slog.Handler {
+	return &moduleHandler{inner: h.inner.WithGroup(name), levels: h.levels, module: h.module}
+}
+
+// newLogHandler writes text or JSON ("json") records to w.
+func newLogHandler(w io.Writer, format string, levels *logLevels) (slog.Handler, error) {
+	// moduleHandler does the filtering
+	options := &slog.HandlerOptions{Level: slog.LevelDebug - 4}
+	var inner slog.Handler
+	switch format {
+	case "", "text":
+		inner = slog.NewTextHandler(w, options)
+	case "json":
+		inner = slog.NewJSONHandler(w, options)
+	default:
+		return nil, fmt.Errorf("unknown log format %s", format)
+	}
+	return &moduleHandler{inner: inner, levels: levels}, nil
+}
+
+// logger returns the logger for one part of the bot, e.g. "links".
+func (irc *Bot) logger(module string) *slog.Logger {
+	return irc.baseLogger.With("module", module)
+}
+
+// handleLogLevelCommand is the owner's "loglevel [[<module>] <level>]".
+func (irc *Bot) handleLogLevelCommand(target string, args []string) {
+	var module, value string
+	switch len(args) {
+	case 0:
+		irc.Privmsg(target, "log levels: "+irc.logLevels.String())
+		return
+	case 1:
+		value = args[0]
+	case 2:
+		module, value = args[0], args[1]
+	default:
+		irc.Privmsg(target, "usage: loglevel [[<module>] debug|info|warn|error]")
+		return
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		irc.Privmsg(target, err.Error())
+		return
+	}
+	irc.logLevels.set(module, level)
+	irc.Privmsg(target, "log levels: "+irc.logLevels.String())
+}
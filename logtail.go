@@ -0,0 +1,37 @@
+package wutbot
+
+import (
+	"strings"
+	"sync"
+)
+
+const (
+	logTailLines = 200
+)
+
+// logTail keeps the most recent log lines in memory for the admin console.
+type logTail struct {
+	sync.Mutex
+	lines []string
+}
+
+func (lt *logTail) Write(p []byte) (int, error) {
+	lt.Lock()
+	defer lt.Unlock()
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		lt.lines = append(lt.lines, line)
+	}
+	if len(lt.lines) > logTailLines {
+		lt.lines = append([]string(nil), lt.lines[len(lt.lines)-logTailLines:]...)
+	}
+	return len(p), nil
+}
+
+func (lt *logTail) Tail(n int) []string {
+	lt.Lock()
+	defer lt.Unlock()
+	if n > len(lt.lines) {
+		n = len(lt.lines)
+	}
+	return append([]string(nil), lt.lines[len(lt.lines)-n:]...)
+}
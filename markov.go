@@ -0,0 +1,227 @@
+package wutbot
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"pratyush/wutbot/internal/commands"
+)
+
+const (
+	// save a channel's model after this many newly learned lines
+	markovSaveInterval = 25
+	markovMaxWords     = 30
+	// chance of babbling in response to a mention
+	markovMentionChance = 0.3
+	// a line needs at least this many words to be worth learning
+	markovMinWords = 3
+)
+
+// markovChain is a word-level chain with two words of context.
+type markovChain struct {
+	// "word1 word2" -> next word -> count; the empty string marks start and end
+	Next map[string]map[string]int `json:"next"`
+
+	unsaved int
+}
+
+type markovManager struct {
+	sync.Mutex
+	dir    string
+	chains map[string]*markovChain // keyed by casefolded channel, loaded lazily
+}
+
+func newMarkovManager(dir string) *markovManager {
+	return &markovManager{
+		dir:    dir,
+		chains: make(map[string]*markovChain),
+	}
+}
+
+func markovKey(a, b string) string {
+	return a + " " + b
+}
+
+func (mm *markovManager) path(channel string) string {
+	// channel names can contain characters that aren't safe in file names
+	return filepath.Join(mm.dir, hex.EncodeToString([]byte(strings.ToLower(channel)))+".json")
+}
+
+// chain returns the channel's chain, loading it from disk if necessary.
+// Call with the lock held.
+func (mm *markovManager) chain(channel string) *markovChain {
+	key := strings.ToLower(channel)
+	if chain, ok := mm.chains[key]; ok {
+		return chain
+	}
+	chain := &markovChain{Next: make(map[string]map[string]int)}
+	if data, err := os.ReadFile(mm.path(channel)); err == nil {
+		json.Unmarshal(data, chain)
+		if chain.Next == nil {
+			chain.Next = make(map[string]map[string]int)
+		}
+	}
+	mm.chains[key] = chain
+	return chain
+}
+
+func (mm *markovManager) save(channel string, chain *markovChain) error {
+	data, err := json.Marshal(chain)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(mm.dir, 0700); err != nil {
+		return err
+	}
+	path := mm.path(channel)
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+	chain.unsaved = 0
+	return os.Rename(path+".tmp", path)
+}
+
+func (mm *markovManager) learn(channel, line string) error {
+	words := strings.Fields(line)
+	if len(words) < markovMinWords {
+		return nil
+	}
+	mm.Lock()
+	defer mm.Unlock()
+	chain := mm.chain(channel)
+	a, b := "", ""
+	for _, word := range append(words, "") {
+		key := markovKey(a, b)
+		if chain.Next[key] == nil {
+			chain.Next[key] = make(map[string]int)
+		}
+		chain.Next[key][word]++
+		a, b = b, word
+	}
+	chain.unsaved++
+	if chain.unsaved >= markovSaveInterval {
+		return mm.save(channel, chain)
+	}
+	return nil
+}
+
+// babble generates a line, starting from seed if the chain knows it.
+func (mm *markovManager) babble(channel, seed string) string {
+	mm.Lock()
+	defer mm.Unlock()
+	chain := mm.chain(channel)
+	a, b := "", ""
+	var words []string
+	if seed != "" {
+		if _, ok := chain.Next[markovKey("", seed)]; ok {
+			b = seed
+			words = append(words, seed)
+		}
+	}
+	for len(words) < markovMaxWords {
+		word := pickWeighted(chain.Next[markovKey(a, b)])
+		if word == "" {
+			break
+		}
+		words = append(words, word)
+		a, b = b, word
+	}
+	return strings.Join(words, " ")
+}
+
+func (mm *markovManager) purge(channel string) error {
+	mm.Lock()
+	defer mm.Unlock()
+	delete(mm.chains, strings.ToLower(channel))
+	err := os.Remove(mm.path(channel))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// flush saves every chain with unsaved changes
+func (mm *markovManager) flush() (err error) {
+	mm.Lock()
+	defer mm.Unlock()
+	for channel, chain := range mm.chains {
+		if chain.unsaved != 0 {
+			if saveErr := mm.save(channel, chain); saveErr != nil {
+				err = saveErr
+			}
+		}
+	}
+	return
+}
+
+func pickWeighted(choices map[string]int) string {
+	total := 0
+	for _, count := range choices {
+		total += count
+	}
+	if total == 0 {
+		return ""
+	}
+	n := rand.Intn(total)
+	for choice, count := range choices {
+		if n < count {
+			return choice
+		}
+		n -= count
+	}
+	return ""
+}
+
+func (irc *Bot) markovEnabled(channel string) bool {
+	return channelOption(irc.getConfig(), channel, func(c ChannelConfig) *bool { return c.Markov })
+}
+
+func (irc *Bot) handleMarkovLearn(target, message string) {
+	if !irc.markovEnabled(target) {
+		return
+	}
+	if err := irc.markov.learn(target, message); err != nil {
+		irc.logger("markov").Error("couldn't save markov model", "channel", target, "err", err)
+	}
+}
+
+// handleMarkovMention occasionally babbles in response to a mention,
+// returning false if it didn't.
+func (irc *Bot) handleMarkovMention(target, msgid, message string) bool {
+	if !irc.markovEnabled(target) || rand.Float64() >= markovMentionChance {
+		return false
+	}
+	var seed string
+	text := strings.TrimLeft(strings.TrimPrefix(message, irc.Nick), ":, ")
+	if words := strings.Fields(text); len(words) != 0 {
+		seed = words[rand.Intn(len(words))]
+	}
+	line := irc.markov.babble(target, seed)
+	if line == "" {
+		return false
+	}
+	irc.sendReplyNotice(target, msgid, line)
+	return true
+}
+
+func (irc *Bot) handleBabbleCommand(cmd commands.Command) {
+	if !irc.markovEnabled(cmd.Target) {
+		irc.replyf(cmd, "babbling isn't enabled in this channel")
+		return
+	}
+	var seed string
+	if len(cmd.Args) != 0 {
+		seed = cmd.Args[0]
+	}
+	if line := irc.markov.babble(cmd.Target, seed); line != "" {
+		irc.reply(cmd, line)
+	} else {
+		irc.replyf(cmd, "I haven't learned enough yet")
+	}
+}
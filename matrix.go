@@ -0,0 +1,61 @@
+package wutbot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"pratyush/wutbot/internal/integrations"
+)
+
+// The Matrix rooms the client is configured with are served as if they
+// were channels: their messages go through the same commands, Handlers and
+// link titles, and their settings are the config file's channels, keyed by
+// the room's name as configured. Senders' user IDs stand in for IRC
+// accounts, so admins can be given as user IDs.
+
+// runMatrix handles the rooms' messages until we're shutting down.
+func (irc *Bot) runMatrix() {
+	irc.matrix.Run(irc.stopping.ctx, integrations.MatrixHandlerFunc(irc.handleMatrixMessage), irc.logger("matrix"))
+}
+
+func (irc *Bot) handleMatrixMessage(room string, ev *integrations.MatrixEvent) {
+	e := matrixIRCMessage(room, ev)
+	if irc.isStale(e) || irc.isIgnored(e) {
+		return
+	}
+	irc.safely("matrix message", func() {
+		ctx, span := tracer.Start(irc.stopping.ctx, "matrix message")
+		defer span.End()
+		irc.handleChannelMessage(ctx, e, room, ev.EventID, ev.Content.Body, sourceMatrix)
+	})
+}
+
+// matrixIRCMessage dresses a room message up as a PRIVMSG, with the
+// sender's localpart as their nick and their user ID as their account.
+func matrixIRCMessage(room string, ev *integrations.MatrixEvent) ircmsg.Message {
+	localpart, server, _ := strings.Cut(strings.TrimPrefix(ev.Sender, "@"), ":")
+	tags := map[string]string{
+		"account": ev.Sender,
+		"msgid":   ev.EventID,
+		"time":    time.UnixMilli(ev.Timestamp).UTC().Format(IRCv3TimestampFormat),
+	}
+	return ircmsg.MakeMessage(tags, localpart+"!"+localpart+"@"+server, "PRIVMSG", room, ev.Content.Body)
+}
+
+// queueMatrixMessage is queueMessage for Matrix rooms. Only PRIVMSGs and
+// NOTICEs are sent (as text and notices, a reply tag becoming a reply);
+// anything else, like typing notifications or reactions, is dropped.
+func (irc *Bot) queueMatrixMessage(roomID string, tags map[string]string, command string, params []string) error {
+	if (command != "PRIVMSG" && command != "NOTICE") || len(params) != 2 {
+		return nil
+	}
+	if roomID == "" {
+		return fmt.Errorf("haven't joined %s yet", params[0])
+	}
+	return irc.matrix.Queue(integrations.MatrixMessage{
+		RoomID: roomID, Text: irc.outgoingText(params[1]), Notice: command == "NOTICE", ReplyTo: tags[replyTagName],
+	})
+}
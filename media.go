@@ -0,0 +1,59 @@
+package wutbot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"pratyush/wutbot/internal/fetch"
+)
+
+// describeImage is what's announced for a direct image link: its format
+// and dimensions, and in channels with "image-details", which camera took
+// it and when.
+func (irc *Bot) describeImage(channel string, img *fetch.Image) string {
+	parts := []string{fmt.Sprintf("%s %d×%d", strings.ToUpper(img.Format), img.Width, img.Height)}
+	if channelOption(irc.getConfig(), channel, func(c ChannelConfig) *bool { return c.ImageDetails }) {
+		if img.Camera != "" {
+			parts = append(parts, img.Camera)
+		}
+		if !img.Taken.IsZero() {
+			parts = append(parts, img.Taken.Format("2006-01-02 15:04"))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+var mediaFormats = map[string]string{"mp4": "MP4", "webm": "WebM", "matroska": "Matroska"}
+
+// describeMedia is what's announced for a direct audio or video link, and
+// the format to announce it with.
+func describeMedia(m *fetch.Media) (description, format string) {
+	parts := []string{mediaFormats[m.Format]}
+	if m.Duration > 0 {
+		parts = append(parts, formatMediaDuration(m.Duration))
+	}
+	format = "Audio: %s (%s)"
+	if m.Video != "" {
+		format = "Video: %s (%s)"
+		if m.Width > 0 && m.Height > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d×%d", m.Video, m.Width, m.Height))
+		} else {
+			parts = append(parts, m.Video)
+		}
+	}
+	if m.Audio != "" {
+		parts = append(parts, m.Audio)
+	}
+	return strings.Join(parts, ", "), format
+}
+
+// formatMediaDuration formats a duration like a player would: 3:05, or
+// 1:02:03.
+func formatMediaDuration(d time.Duration) string {
+	seconds := int(d.Round(time.Second) / time.Second)
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
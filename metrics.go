@@ -0,0 +1,114 @@
+package wutbot
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// metricsWriter writes the Prometheus text exposition format.
+type metricsWriter struct {
+	w       io.Writer
+	written map[string]bool
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// sample writes one sample, preceded by the metric's HELP and TYPE the
+// first time; labels alternate names and values.
+func (m *metricsWriter) sample(name, kind, help string, value float64, labels ...string) {
+	if !m.written[name] {
+		m.written[name] = true
+		fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	}
+	var pairs []string
+	for i := 0; i+1 < len(labels); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1])))
+	}
+	if len(pairs) != 0 {
+		name += "{" + strings.Join(pairs, ",") + "}"
+	}
+	fmt.Fprintf(m.w, "%s %v\n", name, value)
+}
+
+func (irc *Bot) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	m := &metricsWriter{w: w, written: make(map[string]bool)}
+
+	connected := 0.0
+	if irc.Connected() {
+		connected = 1
+	}
+	m.sample("wutbot_connected", "gauge", "Whether the bot is connected to IRC.", connected)
+	m.sample("wutbot_start_time_seconds", "gauge", "When the bot started, in Unix time.", float64(irc.started.Unix()))
+	irc.delivery.Lock()
+	confirmed, unconfirmed := irc.delivery.confirmed, irc.delivery.unconfirmed
+	irc.delivery.Unlock()
+	m.sample("wutbot_deliveries_total", "counter", "Sent messages by whether the server echoed them.", float64(confirmed), "result", "confirmed")
+	m.sample("wutbot_deliveries_total", "counter", "", float64(unconfirmed), "result", "unconfirmed")
+	work := irc.workers.stats()
+	m.sample("wutbot_work_queued", "gauge", "Background jobs waiting for a worker.", float64(work.queued))
+	m.sample("wutbot_work_busy", "gauge", "Workers running a job.", float64(work.busy))
+	m.sample("wutbot_work_completed_total", "counter", "Background jobs run.", float64(work.completed))
+	for _, reason := range []string{dropFull, dropExpired, dropCancelled} {
+		m.sample("wutbot_work_dropped_total", "counter", "Background jobs dropped: the queue was full, or they expired or were cancelled in it.", float64(work.dropped[reason]), "reason", reason)
+	}
+	panics := irc.panics.snapshot()
+	if len(panics) == 0 {
+		m.sample("wutbot_panics_total", "counter", "Panics recovered from, by where they happened.", 0)
+	}
+	for _, where := range sortedKeys(panics) {
+		m.sample("wutbot_panics_total", "counter", "Panics recovered from, by where they happened.", float64(panics[where]), "in", where)
+	}
+
+	// samples of a metric have to be grouped together
+	type channelStats struct {
+		channel string
+		total   *userStats
+		users   map[string]*userStats
+	}
+	var all []channelStats
+	joined := irc.joined.List()
+	sort.Strings(joined)
+	for _, channel := range joined {
+		if total := irc.stats.get(channel, statsTotalKey); total != nil {
+			users := make(map[string]*userStats)
+			irc.stats.each(channel, func(account string, u *userStats) {
+				users[account] = &userStats{Messages: u.Messages, Links: u.Links}
+			})
+			all = append(all, channelStats{channel, total, users})
+		}
+	}
+	for _, c := range all {
+		m.sample("wutbot_messages_total", "counter", "Channel messages seen.", float64(c.total.Messages), "channel", c.channel)
+	}
+	for _, c := range all {
+		m.sample("wutbot_links_total", "counter", "Links posted in channels.", float64(c.total.Links), "channel", c.channel)
+	}
+	for _, c := range all {
+		for _, name := range sortedKeys(c.total.Commands) {
+			m.sample("wutbot_commands_total", "counter", "Channel commands used.", float64(c.total.Commands[name]), "channel", c.channel, "command", name)
+		}
+	}
+	for _, c := range all {
+		for _, account := range sortedKeys(c.users) {
+			m.sample("wutbot_user_messages_total", "counter", "Channel messages seen, by account.", float64(c.users[account].Messages), "channel", c.channel, "account", account)
+		}
+	}
+	for _, c := range all {
+		for _, account := range sortedKeys(c.users) {
+			m.sample("wutbot_user_links_total", "counter", "Links posted in channels, by account.", float64(c.users[account].Links), "channel", c.channel, "account", account)
+		}
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
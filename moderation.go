@@ -0,0 +1,229 @@
+package wutbot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"pratyush/wutbot/internal/commands"
+)
+
+const (
+	// pending timed unbans, keyed by "<channel> <mode> <mask>"
+	unbanBucket = "unbans"
+	// if we can't unban when it's due, try again this often
+	unbanRetryInterval = 5 * time.Minute
+	hostWhoxToken      = "131"
+)
+
+// hostLookups resolves nicks to hostnames with WHO, for banmasks.
+type hostLookups struct {
+	sync.Mutex
+	pending map[string][]func(host string) // keyed by casefolded nick
+}
+
+func newHostLookups() *hostLookups {
+	return &hostLookups{pending: make(map[string][]func(string))}
+}
+
+func (irc *Bot) isAdmin(account string) bool {
+	if account == "" {
+		return false
+	}
+	if account == irc.Owner {
+		return true
+	}
+	for _, admin := range irc.admins {
+		if account == admin {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupHost calls f with nick's hostname, or "" if they aren't online.
+func (irc *Bot) lookupHost(nick string, f func(host string)) {
+	irc.hosts.Lock()
+	key := strings.ToLower(nick)
+	irc.hosts.pending[key] = append(irc.hosts.pending[key], f)
+	first := len(irc.hosts.pending[key]) == 1
+	irc.hosts.Unlock()
+	if !first {
+		return
+	}
+	if _, ok := irc.ISupport()["WHOX"]; ok {
+		irc.Send("WHO", nick, "%tnh,"+hostWhoxToken)
+	} else {
+		irc.Send("WHO", nick)
+	}
+}
+
+func (irc *Bot) resolveHost(nick, host string) {
+	irc.hosts.Lock()
+	key := strings.ToLower(nick)
+	callbacks := irc.hosts.pending[key]
+	delete(irc.hosts.pending, key)
+	irc.hosts.Unlock()
+	for _, f := range callbacks {
+		f(host)
+	}
+}
+
+func (irc *Bot) watchHosts() {
+	irc.AddCallback(ircevent.RPL_WHOREPLY, func(e ircmsg.Message) {
+		// <me> <channel> <user> <host> <server> <nick> ...
+		if len(e.Params) >= 6 {
+			irc.resolveHost(e.Params[5], e.Params[3])
+		}
+	})
+	irc.AddCallback(ircevent.RPL_WHOSPCRPL, func(e ircmsg.Message) {
+		// <me> <token> <host> <nick>
+		if len(e.Params) == 4 && e.Params[1] == hostWhoxToken {
+			irc.resolveHost(e.Params[3], e.Params[2])
+		}
+	})
+	irc.AddCallback(ircevent.RPL_ENDOFWHO, func(e ircmsg.Message) {
+		// anyone still pending wasn't found
+		if len(e.Params) >= 2 {
+			irc.resolveHost(e.Params[1], "")
+		}
+	})
+}
+
+func banmask(host string) string {
+	return "*!*@" + host
+}
+
+// quietMode returns the mode change that quiets mask, which differs
+// between server implementations.
+func (irc *Bot) quietMode(mask string) (mode, param string, err error) {
+	isupport := irc.ISupport()
+	prefixModes, _ := irc.prefixModes()
+	listModes, _, _ := strings.Cut(isupport["CHANMODES"], ",")
+	if strings.IndexByte(listModes, 'q') != -1 && strings.IndexByte(prefixModes, 'q') == -1 {
+		// charybdis/solanum
+		return "q", mask, nil
+	}
+	if extban, ok := isupport["EXTBAN"]; ok {
+		prefix, types, _ := strings.Cut(extban, ",")
+		if strings.IndexByte(types, 'q') != -1 {
+			// unrealircd
+			return "b", prefix + "q:" + mask, nil
+		}
+		if strings.IndexByte(types, 'm') != -1 {
+			// inspircd
+			return "b", prefix + "m:" + mask, nil
+		}
+	}
+	return "", "", fmt.Errorf("this server doesn't support quiets")
+}
+
+// parseModerationArgs splits "<nick> [<duration>] [<reason>...]".
+func parseModerationArgs(args []string) (nick string, duration time.Duration, reason string) {
+	nick, args = args[0], args[1:]
+	if len(args) != 0 {
+		if d, err := time.ParseDuration(args[0]); err == nil && d > 0 {
+			duration, args = d, args[1:]
+		}
+	}
+	return nick, duration, strings.Join(args, " ")
+}
+
+// handleModerationCommand is !kick, !ban, !unban and !quiet, for admins
+// in channels where we have ops.
+func (irc *Bot) handleModerationCommand(cmd commands.Command) {
+	if !irc.requireAdmin(cmd) {
+		return
+	}
+	if len(cmd.Args) == 0 {
+		irc.replyf(cmd, "usage: !%s <nick> [<duration>] [<reason>]", cmd.Name)
+		return
+	}
+	if !irc.chanModes.hasOps(cmd.Target) {
+		irc.replyf(cmd, "I need ops for that")
+		return
+	}
+	nick, duration, reason := parseModerationArgs(cmd.Args)
+	if reason == "" {
+		reason = "requested by " + cmd.Nick
+	}
+	if cmd.Name == "kick" {
+		irc.Send("KICK", cmd.Target, nick, reason)
+		return
+	}
+	if cmd.Name == "unban" && strings.ContainsAny(nick, "!@") {
+		irc.Send("MODE", cmd.Target, "-b", nick)
+		return
+	}
+	irc.lookupHost(nick, func(host string) {
+		if host == "" {
+			irc.replyf(cmd, "%s isn't online", nick)
+			return
+		}
+		mode, mask := "b", banmask(host)
+		if cmd.Name == "quiet" {
+			var err error
+			if mode, mask, err = irc.quietMode(mask); err != nil {
+				irc.reply(cmd, err.Error())
+				return
+			}
+		}
+		if cmd.Name == "unban" {
+			irc.Send("MODE", cmd.Target, "-"+mode, mask)
+			return
+		}
+		irc.Send("MODE", cmd.Target, "+"+mode, mask)
+		if cmd.Name == "ban" {
+			irc.Send("KICK", cmd.Target, nick, reason)
+		}
+		if duration != 0 {
+			irc.scheduleUnban(cmd.Target, mode, mask, time.Now().Add(duration))
+		}
+	})
+}
+
+func (irc *Bot) scheduleUnban(channel, mode, mask string, at time.Time) {
+	key := strings.Join([]string{channel, mode, mask}, " ")
+	if err := irc.store.Put(unbanBucket, key, at); err != nil {
+		irc.logger("moderation").Error("couldn't save timed unban", "channel", channel, "err", err)
+	}
+	time.AfterFunc(time.Until(at), func() { irc.expireBan(key) })
+}
+
+// scheduleStoredUnbans picks the timed unbans back up after a restart.
+func (irc *Bot) scheduleStoredUnbans() {
+	keys, err := irc.store.Keys(unbanBucket)
+	if err != nil {
+		irc.logger("moderation").Error("couldn't read timed unbans", "err", err)
+	}
+	for _, key := range keys {
+		var at time.Time
+		if found, err := irc.store.Get(unbanBucket, key, &at); found && err == nil {
+			key := key
+			time.AfterFunc(time.Until(at), func() { irc.expireBan(key) })
+		}
+	}
+}
+
+func (irc *Bot) expireBan(key string) {
+	var at time.Time
+	if found, _ := irc.store.Get(unbanBucket, key, &at); !found || time.Now().Before(at) {
+		// already done, or replaced by a later one
+		return
+	}
+	f := strings.SplitN(key, " ", 3)
+	if len(f) != 3 {
+		irc.store.Delete(unbanBucket, key)
+		return
+	}
+	if !irc.Connected() || !irc.chanModes.hasOps(f[0]) {
+		time.AfterFunc(unbanRetryInterval, func() { irc.expireBan(key) })
+		return
+	}
+	irc.Send("MODE", f[0], "-"+f[1], f[2])
+	irc.store.Delete(unbanBucket, key)
+}
@@ -0,0 +1,53 @@
+package wutbot
+
+import (
+	"strings"
+	"sync"
+
+	"pratyush/wutbot/internal/commands"
+)
+
+// !more shows at most this much of a description
+const maxMoreDescriptionRunes = 400
+
+// lastLinks remembers the full title and description of the last link
+// announced in each channel, for !more.
+type lastLinks struct {
+	sync.Mutex
+	links map[string]lastLink // casefolded channel -> link
+}
+
+type lastLink struct {
+	url, title, description string
+}
+
+func (l *lastLinks) set(channel string, link lastLink) {
+	l.Lock()
+	defer l.Unlock()
+	l.links[strings.ToLower(channel)] = link
+}
+
+func (l *lastLinks) get(channel string) (link lastLink, ok bool) {
+	l.Lock()
+	defer l.Unlock()
+	link, ok = l.links[strings.ToLower(channel)]
+	return
+}
+
+// maxTitleRunes is how long a title can be announced in the channel, or 0
+// for no limit.
+func (irc *Bot) maxTitleRunes(channel string) int {
+	return channelOption(irc.getConfig(), channel, func(c ChannelConfig) *int { return c.MaxTitleLength })
+}
+
+func (irc *Bot) handleMoreCommand(cmd commands.Command) {
+	link, ok := irc.lastLinks.get(cmd.Target)
+	if !ok {
+		irc.replyf(cmd, "no links here yet")
+		return
+	}
+	irc.replyf(cmd, "%s (%s)", link.title, link.url)
+	if link.description != "" {
+		irc.reply(cmd, truncateRunes(link.description, maxMoreDescriptionRunes))
+	}
+}
@@ -0,0 +1,254 @@
+package wutbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"pratyush/wutbot/internal/commands"
+	"pratyush/wutbot/internal/fetch"
+)
+
+const (
+	omdbAPI       = "https://www.omdbapi.com/"
+	tmdbAPI       = "https://api.themoviedb.org/3"
+	movieDeadline = 15 * time.Second
+)
+
+var (
+	errNoMovieAPI = errors.New("no OMDb or TMDB API key")
+	imdbTitle     = regexp.MustCompile(`^/title/(tt\d+)(?:/|$)`)
+)
+
+// movie is what OMDb or TMDB says about a movie or series.
+type movie struct {
+	Title  string
+	Year   string // for series, e.g. "2008–2013" from OMDb
+	Series bool
+	Rating float64 // out of 10, or 0 if it hasn't been rated
+	Genres []string
+}
+
+func (m *movie) String() string {
+	s := m.Title
+	switch {
+	case m.Series && m.Year != "":
+		s += " (TV series, " + m.Year + ")"
+	case m.Series:
+		s += " (TV series)"
+	case m.Year != "":
+		s += " (" + m.Year + ")"
+	}
+	if m.Rating > 0 {
+		s += " · " + strconv.FormatFloat(m.Rating, 'f', 1, 64) + "/10"
+	}
+	if len(m.Genres) != 0 {
+		s += " · " + strings.Join(m.Genres, ", ")
+	}
+	return s
+}
+
+// findMovie looks a movie or series up by its IMDb ID or, if that's "", its
+// title, with OMDb if we have a key for it and TMDB if not. It returns nil
+// if there's no such thing.
+func (irc *Bot) findMovie(ctx context.Context, imdbID, title string) (*movie, error) {
+	switch {
+	case irc.omdbKey != "":
+		m, err := irc.omdbMovie(ctx, imdbID, title)
+		return m, redactKey(err, irc.omdbKey)
+	case irc.tmdbKey != "":
+		m, err := irc.tmdbMovie(ctx, imdbID, title)
+		return m, redactKey(err, irc.tmdbKey)
+	}
+	return nil, errNoMovieAPI
+}
+
+// redactKey keeps an API key that's part of a request's URL out of errors
+// about it.
+func redactKey(err error, key string) error {
+	if err == nil || !strings.Contains(err.Error(), key) {
+		return err
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), key, "REDACTED"))
+}
+
+func (irc *Bot) omdbMovie(ctx context.Context, imdbID, title string) (*movie, error) {
+	query := url.Values{"apikey": {irc.omdbKey}}
+	if imdbID != "" {
+		query.Set("i", imdbID)
+	} else {
+		query.Set("t", title)
+	}
+	var result struct {
+		Response   string
+		Error      string
+		Title      string
+		Year       string
+		Type       string
+		Genre      string
+		IMDBRating string `json:"imdbRating"`
+	}
+	if err := irc.getJSON(ctx, omdbAPI+"?"+query.Encode(), &result); err != nil {
+		return nil, fmt.Errorf("OMDb: %w", err)
+	}
+	if result.Response != "True" {
+		if strings.Contains(strings.ToLower(result.Error), "not found") || strings.Contains(strings.ToLower(result.Error), "incorrect imdb id") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("OMDb: %s", result.Error)
+	}
+	m := &movie{Title: result.Title, Year: result.Year, Series: result.Type == "series"}
+	m.Rating, _ = strconv.ParseFloat(result.IMDBRating, 64) // "N/A" if it hasn't one
+	for _, genre := range strings.Split(result.Genre, ",") {
+		if genre = strings.TrimSpace(genre); genre != "" && genre != "N/A" {
+			m.Genres = append(m.Genres, genre)
+		}
+	}
+	return m, nil
+}
+
+// tmdbGet gets from the TMDB API with either kind of credential it takes:
+// a read access token (a JWT), or an API key.
+func (irc *Bot) tmdbGet(ctx context.Context, path string, query url.Values, result interface{}) error {
+	token := ""
+	if strings.Count(irc.tmdbKey, ".") == 2 {
+		token = irc.tmdbKey
+	} else {
+		query.Set("api_key", irc.tmdbKey)
+	}
+	if len(query) != 0 {
+		path += "?" + query.Encode()
+	}
+	if err := irc.getJSONWithToken(ctx, tmdbAPI+path, token, result); err != nil {
+		return fmt.Errorf("TMDB: %w", err)
+	}
+	return nil
+}
+
+func (irc *Bot) tmdbMovie(ctx context.Context, imdbID, title string) (*movie, error) {
+	var kind string
+	var id int
+	if imdbID != "" {
+		var found struct {
+			Movies []struct {
+				ID int `json:"id"`
+			} `json:"movie_results"`
+			Series []struct {
+				ID int `json:"id"`
+			} `json:"tv_results"`
+		}
+		if err := irc.tmdbGet(ctx, "/find/"+url.PathEscape(imdbID), url.Values{"external_source": {"imdb_id"}}, &found); err != nil {
+			return nil, err
+		}
+		switch {
+		case len(found.Movies) != 0:
+			kind, id = "movie", found.Movies[0].ID
+		case len(found.Series) != 0:
+			kind, id = "tv", found.Series[0].ID
+		}
+	} else {
+		var found struct {
+			Results []struct {
+				ID        int    `json:"id"`
+				MediaType string `json:"media_type"`
+			} `json:"results"`
+		}
+		if err := irc.tmdbGet(ctx, "/search/multi", url.Values{"query": {title}}, &found); err != nil {
+			return nil, err
+		}
+		for _, result := range found.Results {
+			// not people
+			if result.MediaType == "movie" || result.MediaType == "tv" {
+				kind, id = result.MediaType, result.ID
+				break
+			}
+		}
+	}
+	if id == 0 {
+		return nil, nil
+	}
+
+	var details struct {
+		Title        string  `json:"title"`
+		Name         string  `json:"name"`
+		ReleaseDate  string  `json:"release_date"`
+		FirstAirDate string  `json:"first_air_date"`
+		VoteAverage  float64 `json:"vote_average"`
+		Genres       []struct {
+			Name string `json:"name"`
+		} `json:"genres"`
+	}
+	if err := irc.tmdbGet(ctx, "/"+kind+"/"+strconv.Itoa(id), url.Values{}, &details); err != nil {
+		return nil, err
+	}
+	m := &movie{Title: details.Title, Series: kind == "tv", Rating: details.VoteAverage}
+	date := details.ReleaseDate
+	if m.Series {
+		m.Title, date = details.Name, details.FirstAirDate
+	}
+	// dates are YYYY-MM-DD
+	if len(date) >= 4 {
+		m.Year = date[:4]
+	}
+	for _, genre := range details.Genres {
+		m.Genres = append(m.Genres, genre.Name)
+	}
+	return m, nil
+}
+
+// movieTitle titles IMDb links with what OMDb or TMDB says about the movie
+// or series. Without a key for either, or if they don't know it, it's left
+// to the page's title.
+func movieTitle(ctx context.Context, irc *Bot, u *url.URL) (string, bool, error) {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if host != "imdb.com" && host != "m.imdb.com" {
+		return "", false, nil
+	}
+	match := imdbTitle.FindStringSubmatch(u.Path)
+	if match == nil {
+		return "", false, nil
+	}
+	m, err := irc.findMovie(ctx, match[1], "")
+	switch {
+	case errors.Is(err, errNoMovieAPI):
+		return "", false, nil
+	case err != nil:
+		return "", true, err
+	case m == nil:
+		return "", false, nil
+	}
+	return m.String(), true, nil
+}
+
+// handleMovieCommand is !movie <title>, which looks a movie or series up.
+func (irc *Bot) handleMovieCommand(cmd commands.Command) {
+	title := strings.TrimSpace(strings.Join(cmd.Args, " "))
+	if title == "" {
+		irc.replyf(cmd, "usage: !movie <title>")
+		return
+	}
+	if irc.omdbKey == "" && irc.tmdbKey == "" {
+		irc.replyf(cmd, "movie lookups aren't set up")
+		return
+	}
+	err := irc.workers.submit(irc.connectionContext(), cmd.Target, "movie", movieDeadline, func(ctx context.Context) {
+		m, err := irc.findMovie(ctx, "", title)
+		switch {
+		case err != nil:
+			irc.logger("movies").Warn("couldn't look up movie", "title", title, "err", err)
+			irc.replyf(cmd, "couldn't look that up, try again later")
+		case m == nil:
+			irc.replyf(cmd, "nothing found for %s", fetch.Sanitize(title))
+		default:
+			irc.reply(cmd, fetch.Sanitize(m.String()))
+		}
+	})
+	if err != nil {
+		irc.replyf(cmd, "too busy, try again later")
+	}
+}
@@ -0,0 +1,22 @@
+package wutbot
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"pratyush/wutbot/internal/bot"
+)
+
+// multilineBatch wraps the pieces of a long message in a draft/multiline
+// batch, returning nil if the cap isn't available or they won't fit
+// within the server's limits.
+func (irc *Bot) multilineBatch(tags map[string]string, command, target string, pieces []string) []ircmsg.Message {
+	limits, ok := bot.ParseMultilineLimits(irc.AcknowledgedCaps())
+	if !ok {
+		return nil
+	}
+	batchID := strconv.FormatUint(atomic.AddUint64(&irc.batchCounter, 1), 36)
+	return limits.Batch(batchID, tags, command, target, pieces)
+}
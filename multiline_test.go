@@ -0,0 +1,25 @@
+package wutbot
+
+import (
+	"testing"
+
+	"pratyush/wutbot/internal/bot"
+)
+
+func TestMultilineBatchLimit(t *testing.T) {
+	irc := &Bot{caps: &capTracker{acked: map[string]string{"batch": "", bot.MultilineCap: "max-bytes=10"}}}
+	tests := []struct {
+		pieces []string
+		fits   bool
+	}{
+		{[]string{"0123456789"}, true},
+		{[]string{"01234", "5678"}, true},
+		// with the space before the second piece, that's 11 bytes
+		{[]string{"01234", "56789"}, false},
+	}
+	for _, tt := range tests {
+		if batch := irc.multilineBatch(nil, "PRIVMSG", "#chan", tt.pieces); (batch != nil) != tt.fits {
+			t.Errorf("%q: batched %v, want %v", tt.pieces, batch != nil, tt.fits)
+		}
+	}
+}
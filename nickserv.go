@@ -0,0 +1,128 @@
+package wutbot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"text/template"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+const (
+	defaultNickServNick    = "NickServ"
+	defaultNickServCommand = "IDENTIFY {{.Account}} {{.Password}}"
+	defaultNickServSuccess = `(?i)you are now (identified|logged in)|password accepted`
+)
+
+// nickServ identifies with services on networks without SASL.
+type nickServ struct {
+	nick     string
+	command  *template.Template
+	success  *regexp.Regexp
+	account  string
+	password string
+	loggedIn int32 // set by RPL_LOGGEDIN or a NickServ success notice
+}
+
+// nickServData is what the IDENTIFY command template is executed against.
+type nickServData struct {
+	Nick     string
+	Account  string
+	Password string
+}
+
+func newNickServ(nick, command, success, account, password string) (*nickServ, error) {
+	if password == "" {
+		return nil, nil
+	}
+	if nick == "" {
+		nick = defaultNickServNick
+	}
+	if command == "" {
+		command = defaultNickServCommand
+	}
+	if success == "" {
+		success = defaultNickServSuccess
+	}
+	tmpl, err := template.New("nickserv").Option("missingkey=zero").Parse(command)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NickServ command: %w", err)
+	}
+	successRegex, err := regexp.Compile(success)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NickServ success pattern: %w", err)
+	}
+	return &nickServ{
+		nick:     nick,
+		command:  tmpl,
+		success:  successRegex,
+		account:  account,
+		password: password,
+	}, nil
+}
+
+func (irc *Bot) identifyWithNickServ() {
+	ns := irc.nickserv
+	if ns == nil || atomic.LoadInt32(&ns.loggedIn) != 0 {
+		return
+	}
+	account := ns.account
+	if account == "" {
+		account = irc.Nick
+	}
+	var buf strings.Builder
+	err := ns.command.Execute(&buf, nickServData{Nick: irc.CurrentNick(), Account: account, Password: ns.password})
+	if err != nil {
+		irc.logger("nickserv").Error("couldn't build NickServ command", "err", err)
+		return
+	}
+	// straight to the server: this shouldn't be split or sit behind other output
+	irc.Connection.Privmsg(ns.nick, buf.String())
+}
+
+func (irc *Bot) setupNickServCallbacks() {
+	if irc.nickserv == nil {
+		return
+	}
+	irc.AddCallback(ircevent.RPL_LOGGEDIN, func(e ircmsg.Message) {
+		atomic.StoreInt32(&irc.nickserv.loggedIn, 1)
+	})
+	irc.AddCallback(ircevent.RPL_LOGGEDOUT, func(e ircmsg.Message) {
+		atomic.StoreInt32(&irc.nickserv.loggedIn, 0)
+	})
+	irc.AddDisconnectCallback(func(e ircmsg.Message) {
+		atomic.StoreInt32(&irc.nickserv.loggedIn, 0)
+	})
+	irc.AddCallback("NOTICE", func(e ircmsg.Message) {
+		if !strings.EqualFold(e.Nick(), irc.nickserv.nick) || len(e.Params) < 2 {
+			return
+		}
+		if irc.nickserv.success.MatchString(e.Params[1]) {
+			atomic.StoreInt32(&irc.nickserv.loggedIn, 1)
+			irc.logger("nickserv").Info("identified", "service", irc.nickserv.nick)
+		}
+	})
+	// some services only accept IDENTIFY for the nick we're using, so
+	// identify again once we've taken our nick back
+	irc.AddCallback("NICK", func(e ircmsg.Message) {
+		if len(e.Params) == 0 || e.Params[0] != irc.Nick || e.Nick() == irc.Nick {
+			return
+		}
+		if e.Nick() == irc.CurrentNick() || e.Params[0] == irc.CurrentNick() {
+			irc.identifyWithNickServ()
+		}
+	})
+}
+
+// handleNickFreed takes our preferred nick back when whoever had it
+// leaves or changes nick.
+func (irc *Bot) handleNickFreed(e ircmsg.Message) {
+	current := irc.CurrentNick()
+	if current == "" || strings.EqualFold(current, irc.Nick) || !strings.EqualFold(e.Nick(), irc.Nick) {
+		return
+	}
+	irc.Send("NICK", irc.Nick)
+}
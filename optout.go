@@ -0,0 +1,89 @@
+package wutbot
+
+import (
+	"strings"
+	"time"
+
+	"pratyush/wutbot/internal/commands"
+)
+
+const (
+	// accounts whose links we leave alone, mapped to when they opted out
+	optOutBucket = "optouts"
+)
+
+func (irc *Bot) optedOut(account string) bool {
+	if account == "" {
+		return false
+	}
+	found, _ := irc.store.Get(optOutBucket, strings.ToLower(account), new(time.Time))
+	return found
+}
+
+// forgetLinks deletes the archived links an account posted, returning how
+// many there were.
+func (irc *Bot) forgetLinks(account string) (deleted int) {
+	buckets, err := irc.store.Buckets()
+	if err != nil {
+		irc.logger("links").Error("couldn't list archives", "account", account, "err", err)
+	}
+	for _, bucket := range buckets {
+		if !strings.HasPrefix(bucket, linkArchiveBucket) {
+			continue
+		}
+		keys, err := irc.store.Keys(bucket)
+		if err != nil {
+			irc.logger("links").Error("couldn't read archive", "account", account, "bucket", bucket, "err", err)
+			continue
+		}
+		for _, key := range keys {
+			var link archivedLink
+			if found, err := irc.store.Get(bucket, key, &link); !found || err != nil || !strings.EqualFold(link.Account, account) {
+				continue
+			}
+			if err := irc.store.Delete(bucket, key); err != nil {
+				irc.logger("links").Error("couldn't delete archived link", "account", account, "url", link.URL, "err", err)
+				continue
+			}
+			deleted++
+		}
+	}
+	return
+}
+
+// handleOptOutCommand is "!optout", which stops us fetching or archiving
+// the links someone posts, and deletes the ones we archived.
+func (irc *Bot) handleOptOutCommand(cmd commands.Command) {
+	if cmd.Account == "" {
+		irc.replyf(cmd, "you need to be logged in to opt out")
+		return
+	}
+	if err := irc.store.Put(optOutBucket, strings.ToLower(cmd.Account), time.Now()); err != nil {
+		irc.logger("links").Error("couldn't save opt-out", "account", cmd.Account, "err", err)
+		irc.replyf(cmd, "couldn't save that, try again later")
+		return
+	}
+	if deleted := irc.forgetLinks(cmd.Account); deleted > 0 {
+		irc.replyf(cmd, "your links won't be fetched or archived (!optin to undo); deleted %d archived links", deleted)
+	} else {
+		irc.replyf(cmd, "your links won't be fetched or archived (!optin to undo)")
+	}
+}
+
+// handleOptInCommand is "!optin", which undoes "!optout".
+func (irc *Bot) handleOptInCommand(cmd commands.Command) {
+	if cmd.Account == "" {
+		irc.replyf(cmd, "you need to be logged in to opt in")
+		return
+	}
+	if !irc.optedOut(cmd.Account) {
+		irc.replyf(cmd, "you haven't opted out")
+		return
+	}
+	if err := irc.store.Delete(optOutBucket, strings.ToLower(cmd.Account)); err != nil {
+		irc.logger("links").Error("couldn't delete opt-out", "account", cmd.Account, "err", err)
+		irc.replyf(cmd, "couldn't save that, try again later")
+		return
+	}
+	irc.replyf(cmd, "your links will be fetched and archived again")
+}
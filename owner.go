@@ -0,0 +1,171 @@
+package wutbot
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+const (
+	// without MONITOR, poll with ISON this often
+	ownerPollInterval = time.Minute
+	// keep at most this many notifications for an offline owner
+	maxOwnerNotifications = 50
+	// arbitrary WHOX query token, to recognize our replies
+	ownerWhoxToken = "146"
+)
+
+// ownerPresence tracks whether the owner is online (by nick, confirmed by
+// account), and holds notifications for them until they are.
+type ownerPresence struct {
+	sync.Mutex
+	nick      string
+	highlight *regexp.Regexp
+	online    bool
+	pending   []string
+}
+
+func newOwnerPresence(nick string) *ownerPresence {
+	if nick == "" {
+		return nil
+	}
+	return &ownerPresence{
+		nick:      nick,
+		highlight: regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(nick) + `\b`),
+	}
+}
+
+func (irc *Bot) ownerOnline() (nick string, online bool) {
+	if irc.owner == nil {
+		return "", false
+	}
+	irc.owner.Lock()
+	defer irc.owner.Unlock()
+	return irc.owner.nick, irc.owner.online
+}
+
+// notifyOwner PMs the owner, or while they're offline sends the message
+// over XMPP or holds it until they're back, and posts it to any sinks for
+// owner notifications.
+func (irc *Bot) notifyOwner(text string) {
+	irc.alert(alertOwner, "", "", text)
+	if _, online := irc.ownerOnline(); !online && irc.xmpp.Connected() {
+		if irc.xmpp.Send(irc.xmpp.Owner(), text) == nil {
+			return
+		}
+	}
+	if irc.owner == nil {
+		return
+	}
+	irc.owner.Lock()
+	if !irc.owner.online {
+		text = time.Now().UTC().Format("[15:04 UTC] ") + text
+		irc.owner.pending = append(irc.owner.pending, text)
+		if len(irc.owner.pending) > maxOwnerNotifications {
+			irc.owner.pending = irc.owner.pending[len(irc.owner.pending)-maxOwnerNotifications:]
+		}
+		irc.owner.Unlock()
+		return
+	}
+	nick := irc.owner.nick
+	irc.owner.Unlock()
+	irc.Privmsg(nick, text)
+}
+
+func (irc *Bot) setOwnerOnline(online bool) {
+	irc.owner.Lock()
+	wasOnline := irc.owner.online
+	irc.owner.online = online
+	var pending []string
+	if online && !wasOnline {
+		pending = irc.owner.pending
+		irc.owner.pending = nil
+	}
+	nick := irc.owner.nick
+	irc.owner.Unlock()
+	for _, text := range pending {
+		irc.Privmsg(nick, text)
+	}
+}
+
+// checkOwner confirms that whoever is using the owner's nick is logged
+// into the owner's account before we deliver anything to them.
+func (irc *Bot) checkOwner(nick string) {
+	if _, ok := irc.ISupport()["WHOX"]; ok {
+		irc.Send("WHO", nick, "%tna,"+ownerWhoxToken)
+	} else if irc.nickAccounts.Get(nick) == irc.Owner {
+		irc.setOwnerOnline(true)
+	}
+}
+
+// handleOwnerHighlight holds channel messages mentioning the owner while
+// they're away, unless they're watched (and so forwarded anyway).
+func (irc *Bot) handleOwnerHighlight(target, nick, message string) {
+	ownerNick, online := irc.ownerOnline()
+	if ownerNick == "" || online || !irc.owner.highlight.MatchString(message) || irc.watchMatches(message) {
+		return
+	}
+	irc.notifyOwner(target + " <" + nick + "> " + message)
+}
+
+func (irc *Bot) watchOwner() {
+	if irc.owner == nil {
+		return
+	}
+	irc.AddConnectCallback(func(e ircmsg.Message) {
+		if _, ok := irc.ISupport()["MONITOR"]; ok {
+			irc.Send("MONITOR", "+", irc.owner.nick)
+		} else {
+			irc.Send("ISON", irc.owner.nick)
+		}
+	})
+	irc.AddDisconnectCallback(func(e ircmsg.Message) {
+		irc.owner.Lock()
+		irc.owner.online = false
+		irc.owner.Unlock()
+	})
+	irc.AddCallback(ircevent.RPL_MONONLINE, func(e ircmsg.Message) {
+		for _, target := range strings.Split(e.Params[len(e.Params)-1], ",") {
+			if nick, _, _ := strings.Cut(target, "!"); strings.EqualFold(nick, irc.owner.nick) {
+				irc.checkOwner(nick)
+			}
+		}
+	})
+	irc.AddCallback(ircevent.RPL_MONOFFLINE, func(e ircmsg.Message) {
+		for _, nick := range strings.Split(e.Params[len(e.Params)-1], ",") {
+			if strings.EqualFold(nick, irc.owner.nick) {
+				irc.setOwnerOnline(false)
+			}
+		}
+	})
+	irc.AddCallback(ircevent.RPL_ISON, func(e ircmsg.Message) {
+		for _, nick := range strings.Fields(e.Params[len(e.Params)-1]) {
+			if strings.EqualFold(nick, irc.owner.nick) {
+				if _, online := irc.ownerOnline(); !online {
+					irc.checkOwner(nick)
+				}
+				return
+			}
+		}
+		irc.setOwnerOnline(false)
+	})
+	irc.AddCallback(ircevent.RPL_WHOSPCRPL, func(e ircmsg.Message) {
+		// <me> <token> <nick> <account>
+		if len(e.Params) == 4 && e.Params[1] == ownerWhoxToken && strings.EqualFold(e.Params[2], irc.owner.nick) {
+			irc.setOwnerOnline(e.Params[3] == irc.Owner)
+		}
+	})
+	go func() {
+		ticker := time.NewTicker(ownerPollInterval)
+		defer ticker.Stop()
+		for irc.tick(ticker) {
+			if _, ok := irc.ISupport()["MONITOR"]; irc.Connected() && !ok {
+				irc.Send("ISON", irc.owner.nick)
+			}
+		}
+	}()
+}
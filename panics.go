@@ -0,0 +1,101 @@
+package wutbot
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+const (
+	// tell the owner about at most one panic this often
+	panicNotifyInterval = 10 * time.Minute
+)
+
+// panicTracker counts recovered panics by where they happened.
+type panicTracker struct {
+	sync.Mutex
+	counts       map[string]int
+	notify       bool
+	lastNotified time.Time
+}
+
+func newPanicTracker(notify bool) *panicTracker {
+	return &panicTracker{counts: make(map[string]int), notify: notify}
+}
+
+func (p *panicTracker) snapshot() map[string]int {
+	p.Lock()
+	defer p.Unlock()
+	counts := make(map[string]int, len(p.counts))
+	for where, n := range p.counts {
+		counts[where] = n
+	}
+	return counts
+}
+
+// recoverPanic, deferred, stops a panic from taking down the whole bot:
+// it's logged with its stack, counted, and optionally sent to the owner.
+func (irc *Bot) recoverPanic(where string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := string(debug.Stack())
+	irc.logger("panic").Error("recovered from panic", "in", where, "panic", fmt.Sprint(r), "stack", stack)
+	irc.reportError(errorReport{
+		Kind: "panic", Message: fmt.Sprintf("panic in %s: %v", where, r), Context: map[string]string{"in": where}, Stack: stack,
+	}, where+" "+fmt.Sprint(r))
+	p := irc.panics
+	p.Lock()
+	p.counts[where]++
+	notify := p.notify && time.Since(p.lastNotified) >= panicNotifyInterval
+	if notify {
+		p.lastNotified = time.Now()
+	}
+	p.Unlock()
+	if notify {
+		irc.notifyOwner(fmt.Sprintf("recovered from a panic in %s: %v", where, r))
+	}
+}
+
+// safely runs f, recovering from a panic; for the bodies of loops that
+// should carry on.
+func (irc *Bot) safely(where string, f func()) {
+	defer irc.recoverPanic(where)
+	f()
+}
+
+// AddCallback shadows ircevent's, which would only log a panic.
+func (irc *Bot) AddCallback(command string, callback func(ircmsg.Message)) ircevent.CallbackID {
+	return irc.Connection.AddCallback(command, func(e ircmsg.Message) {
+		defer irc.recoverPanic(command + " callback")
+		callback(e)
+	})
+}
+
+func (irc *Bot) AddConnectCallback(callback func(ircmsg.Message)) ircevent.CallbackID {
+	return irc.Connection.AddConnectCallback(func(e ircmsg.Message) {
+		defer irc.recoverPanic("connect callback")
+		callback(e)
+	})
+}
+
+func (irc *Bot) AddDisconnectCallback(callback func(ircmsg.Message)) ircevent.CallbackID {
+	return irc.Connection.AddDisconnectCallback(func(e ircmsg.Message) {
+		defer irc.recoverPanic("disconnect callback")
+		callback(e)
+	})
+}
+
+func (irc *Bot) AddBatchCallback(callback func(*ircevent.Batch) bool) ircevent.CallbackID {
+	return irc.Connection.AddBatchCallback(func(batch *ircevent.Batch) (handled bool) {
+		// a batch that panicked part way through shouldn't be handled again line by line
+		handled = true
+		defer irc.recoverPanic("batch callback")
+		return callback(batch)
+	})
+}
@@ -0,0 +1,66 @@
+package wutbot
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const spkiPinPrefix = "sha256/"
+
+var errPinMismatch = errors.New("the server's certificate doesn't match any pin")
+
+// certPin is the SHA-256 hash of a certificate, or of its public key.
+type certPin struct {
+	spki bool
+	hash []byte
+}
+
+// parsePins accepts "sha256/<base64>" for a hash of the public key (as
+// printed by e.g. `openssl x509 -pubkey | openssl pkey -pubin -outform der |
+// openssl dgst -sha256 -binary | base64`), or the certificate's SHA-256
+// fingerprint in hex, with or without colons.
+func parsePins(pins []string) (result []certPin, err error) {
+	for _, pin := range pins {
+		if pin = strings.TrimSpace(pin); pin == "" {
+			continue
+		}
+		var p certPin
+		if encoded, ok := strings.CutPrefix(pin, spkiPinPrefix); ok {
+			p.spki = true
+			p.hash, err = base64.StdEncoding.DecodeString(encoded)
+		} else {
+			p.hash, err = hex.DecodeString(strings.ReplaceAll(pin, ":", ""))
+		}
+		if err != nil || len(p.hash) != sha256.Size {
+			return nil, fmt.Errorf("invalid certificate pin %s", pin)
+		}
+		result = append(result, p)
+	}
+	return
+}
+
+// pinTLSConfig trusts the server's certificate if it matches one of the
+// pins, instead of checking it against the system's CAs.
+func pinTLSConfig(conf *tls.Config, pins []certPin) {
+	conf.InsecureSkipVerify = true
+	conf.VerifyConnection = func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errPinMismatch
+		}
+		leaf := state.PeerCertificates[0]
+		certHash := sha256.Sum256(leaf.Raw)
+		spkiHash := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+		for _, pin := range pins {
+			if pin.spki && bytes.Equal(pin.hash, spkiHash[:]) || !pin.spki && bytes.Equal(pin.hash, certHash[:]) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w (its public key is %s%s)", errPinMismatch, spkiPinPrefix, base64.StdEncoding.EncodeToString(spkiHash[:]))
+	}
+}
@@ -0,0 +1,37 @@
+package wutbot
+
+import (
+	"time"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+const (
+	zncPlaybackBatchType = "znc.in/playback"
+
+	// messages older than this (by server-time) are bouncer playback, not live traffic
+	defaultMaxMessageAge = 5 * time.Minute
+)
+
+// isStale reports whether a message's server-time is too old to respond to.
+// Messages without server-time are always live.
+func (irc *Bot) isStale(e ircmsg.Message) bool {
+	if irc.maxMessageAge <= 0 {
+		return false
+	}
+	if present, _ := e.GetTag("time"); !present {
+		return false
+	}
+	return time.Since(messageTime(e)) > irc.maxMessageAge
+}
+
+// handlePlaybackBatch swallows ZNC buffer playback, so that attaching
+// through a bouncer doesn't refetch everything in the buffer.
+func (irc *Bot) handlePlaybackBatch(batch *ircevent.Batch) bool {
+	if len(batch.Params) < 2 || batch.Params[1] != zncPlaybackBatchType {
+		return false
+	}
+	irc.logger("playback").Debug("ignoring bouncer playback", "lines", len(batch.Items))
+	return true
+}
@@ -0,0 +1,377 @@
+package wutbot
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"pratyush/wutbot/internal/commands"
+	"pratyush/wutbot/internal/fetch"
+)
+
+// Plugins are external programs that add channel commands and link titles.
+// They speak JSON, one object per line: on stdout, a plugin first registers
+//
+//	{"type": "register", "commands": ["weather"], "urls": ["^https?://example\\.com/"]}
+//
+// (the URLs being regexes), and then gets requests on stdin like
+//
+//	{"id": 1, "type": "command", "command": "weather", "args": ["paris"], "channel": "#x", "nick": "n", "account": "a"}
+//	{"id": 2, "type": "url", "url": "https://example.com/1", "channel": "#x", "nick": "n"}
+//
+// which it answers, in any order, with {"type": "response", "id": 1, "lines": [...]}
+// or {"type": "response", "id": 2, "title": "..."}, or with "error" set. Anything
+// it writes to stderr is logged. It's restarted if it exits.
+
+const (
+	pluginTimeout = 10 * time.Second
+	// replies longer than this are cut short
+	maxPluginLines       = 5
+	maxPluginMessageSize = 1 << 20
+	// requests waiting to be written to a plugin that's slow to read them
+	maxPluginQueue   = 64
+	minPluginRestart = time.Second
+	maxPluginRestart = 5 * time.Minute
+	// a plugin that ran this long before exiting is restarted straightaway
+	pluginStableAfter = time.Minute
+)
+
+var errPluginNotRunning = errors.New("plugin isn't running")
+
+type pluginRequest struct {
+	ID      uint64   `json:"id"`
+	Type    string   `json:"type"`
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	URL     string   `json:"url,omitempty"`
+	Channel string   `json:"channel"`
+	Nick    string   `json:"nick"`
+	Account string   `json:"account,omitempty"`
+}
+
+type pluginMessage struct {
+	Type     string   `json:"type"`
+	Commands []string `json:"commands"`
+	URLs     []string `json:"urls"`
+	ID       uint64   `json:"id"`
+	Lines    []string `json:"lines"`
+	Title    string   `json:"title"`
+	Error    string   `json:"error"`
+}
+
+type plugin struct {
+	sync.Mutex
+	path     string
+	name     string
+	requests chan pluginRequest // to its stdin; nil unless it's running
+	nextID   uint64
+	pending  map[uint64]chan pluginMessage
+	commands map[string]bool
+	urls     []*regexp.Regexp
+}
+
+func newPlugins(paths []string) (plugins []*plugin) {
+	for _, path := range paths {
+		if path = strings.TrimSpace(path); path != "" {
+			plugins = append(plugins, &plugin{path: path, name: filepath.Base(path)})
+		}
+	}
+	return
+}
+
+// call sends a request and waits for the plugin's response.
+func (p *plugin) call(ctx context.Context, req pluginRequest) (pluginMessage, error) {
+	p.Lock()
+	if p.requests == nil {
+		p.Unlock()
+		return pluginMessage{}, errPluginNotRunning
+	}
+	p.nextID++
+	req.ID = p.nextID
+	response := make(chan pluginMessage, 1)
+	p.pending[req.ID] = response
+	requests := p.requests
+	p.Unlock()
+	defer func() {
+		p.Lock()
+		delete(p.pending, req.ID)
+		p.Unlock()
+	}()
+	// a plugin that's stopped reading mustn't hold anything else up
+	select {
+	case requests <- req:
+	case <-ctx.Done():
+		return pluginMessage{}, ctx.Err()
+	}
+	select {
+	case resp, ok := <-response:
+		if !ok {
+			return pluginMessage{}, errPluginNotRunning
+		}
+		if resp.Error != "" {
+			return resp, errors.New(resp.Error)
+		}
+		return resp, nil
+	case <-ctx.Done():
+		return pluginMessage{}, ctx.Err()
+	}
+}
+
+func (p *plugin) handles(command string) bool {
+	p.Lock()
+	defer p.Unlock()
+	return p.commands[command]
+}
+
+func (p *plugin) matchesURL(u string) bool {
+	p.Lock()
+	defer p.Unlock()
+	for _, re := range p.urls {
+		if re.MatchString(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// register takes a plugin's commands and URL patterns, replacing any it
+// registered before.
+func (p *plugin) register(msg pluginMessage) error {
+	names := make(map[string]bool)
+	for _, name := range msg.Commands {
+		names[strings.ToLower(strings.TrimPrefix(name, commands.Prefix))] = true
+	}
+	var urls []*regexp.Regexp
+	for _, pattern := range msg.URLs {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid URL pattern %q: %w", pattern, err)
+		}
+		urls = append(urls, re)
+	}
+	p.Lock()
+	defer p.Unlock()
+	p.commands, p.urls = names, urls
+	return nil
+}
+
+// runPlugin keeps a plugin running, restarting it with a backoff, until
+// we're shutting down.
+func (irc *Bot) runPlugin(p *plugin) {
+	logger := irc.logger("plugins").With("plugin", p.name)
+	delay := minPluginRestart
+	for irc.stopping.ctx.Err() == nil {
+		started := time.Now()
+		if err := irc.runPluginOnce(p); err != nil && irc.stopping.ctx.Err() == nil {
+			logger.Warn("plugin stopped", "err", err)
+		}
+		if time.Since(started) > pluginStableAfter {
+			delay = minPluginRestart
+		}
+		select {
+		case <-irc.stopping.ctx.Done():
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxPluginRestart)
+	}
+}
+
+func (irc *Bot) runPluginOnce(p *plugin) error {
+	logger := irc.logger("plugins").With("plugin", p.name)
+	cmd := exec.CommandContext(irc.stopping.ctx, p.path)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			logger.Info(scanner.Text())
+		}
+	}()
+	requests, done := make(chan pluginRequest, maxPluginQueue), make(chan struct{})
+	p.Lock()
+	p.requests, p.pending = requests, make(map[uint64]chan pluginMessage)
+	p.Unlock()
+	go p.writeRequests(stdin, requests, done)
+	logger.Info("started plugin", "pid", cmd.Process.Pid)
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(nil, maxPluginMessageSize)
+	for scanner.Scan() {
+		var msg pluginMessage
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			logger.Warn("invalid message from plugin", "err", err)
+			continue
+		}
+		switch msg.Type {
+		case "register":
+			if err := p.register(msg); err != nil {
+				logger.Warn("couldn't register", "err", err)
+			} else {
+				logger.Info("registered", "commands", msg.Commands, "urls", msg.URLs)
+			}
+		case "response":
+			p.Lock()
+			if response := p.pending[msg.ID]; response != nil {
+				response <- msg
+				delete(p.pending, msg.ID)
+			}
+			p.Unlock()
+		default:
+			logger.Warn("unknown message type from plugin", "type", msg.Type)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		// e.g. a line that's too long: it won't be making sense from here on
+		cmd.Process.Kill()
+	}
+
+	close(done)
+	p.Lock()
+	// unblocking the writer if the plugin stopped reading
+	stdin.Close()
+	for _, response := range p.pending {
+		close(response)
+	}
+	p.requests, p.pending, p.commands, p.urls = nil, nil, nil, nil
+	p.Unlock()
+	return cmd.Wait()
+}
+
+// writeRequests writes requests to a plugin's stdin until it exits, failing
+// any it can't write.
+func (p *plugin) writeRequests(stdin io.Writer, requests <-chan pluginRequest, done <-chan struct{}) {
+	encoder := json.NewEncoder(stdin)
+	for {
+		select {
+		case req := <-requests:
+			if err := encoder.Encode(req); err != nil {
+				p.Lock()
+				if response := p.pending[req.ID]; response != nil {
+					response <- pluginMessage{Type: "response", ID: req.ID, Error: err.Error()}
+					delete(p.pending, req.ID)
+				}
+				p.Unlock()
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func (irc *Bot) startPlugins() {
+	for _, p := range irc.plugins {
+		go func(p *plugin) {
+			defer irc.recoverPanic("plugin " + p.name)
+			irc.runPlugin(p)
+		}(p)
+	}
+}
+
+// handlePluginCommand is the Handler for the commands plugins registered.
+func (irc *Bot) handlePluginCommand(ctx context.Context, bot *Bot, m Message) bool {
+	name, args, ok := commands.Split(m.Text)
+	if !ok {
+		return false
+	}
+	for _, p := range irc.plugins {
+		if !p.handles(name) {
+			continue
+		}
+		req := pluginRequest{Type: "command", Command: name, Args: args, Channel: m.Channel, Nick: m.Nick, Account: m.Account}
+		err := irc.workers.submit(ctx, m.Channel, "plugin "+p.name, pluginTimeout, func(ctx context.Context) {
+			resp, err := p.call(ctx, req)
+			if err != nil {
+				irc.logger("plugins").Warn("plugin command failed", "plugin", p.name, "command", name, "err", err)
+				irc.Reply(m, fmt.Sprintf("%s failed", name))
+				return
+			}
+			if len(resp.Lines) > maxPluginLines {
+				resp.Lines = resp.Lines[:maxPluginLines]
+			}
+			for _, line := range resp.Lines {
+				if line = fetch.Sanitize(line); line != "" {
+					irc.Reply(m, line)
+				}
+			}
+		})
+		if err != nil {
+			irc.Reply(m, "too busy, try again later")
+		}
+		return true
+	}
+	return false
+}
+
+// fetchLink gets a link's title from the first plugin or script that
+// handles the URL, or by fetching it.
+func (irc *Bot) fetchLink(ctx context.Context, link archivedLink) (*fetch.Page, error) {
+	handled, title, err := false, "", error(nil)
+	for _, p := range irc.plugins {
+		if p.matchesURL(link.URL) {
+			var resp pluginMessage
+			if resp, err = p.call(ctx, pluginRequest{Type: "url", URL: link.URL, Channel: link.Channel, Nick: link.Poster, Account: link.Account}); err != nil {
+				err = fmt.Errorf("plugin %s: %w", p.name, err)
+			}
+			handled, title = true, resp.Title
+			break
+		}
+	}
+	if !handled {
+		title, handled, err = irc.scriptTitle(ctx, link.URL)
+	}
+	if !handled {
+		title, handled, err = irc.builtinTitle(ctx, link.URL)
+	}
+	if !handled {
+		return irc.fetcher.Fetch(ctx, link.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(link.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &fetch.Page{URL: u, Title: fetch.Sanitize(title)}, nil
+}
+
+// handlePluginsCommand is the owner's "plugins", which lists them and
+// what they registered.
+func (irc *Bot) handlePluginsCommand(target string) {
+	if len(irc.plugins) == 0 {
+		irc.Privmsg(target, "no plugins")
+		return
+	}
+	for _, p := range irc.plugins {
+		p.Lock()
+		status := "not running"
+		if p.requests != nil {
+			status = fmt.Sprintf("running, %d commands, %d URL patterns", len(p.commands), len(p.urls))
+		}
+		p.Unlock()
+		irc.Privmsg(target, fmt.Sprintf("%s (%s): %s", p.name, p.path, status))
+	}
+}
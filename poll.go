@@ -0,0 +1,210 @@
+package wutbot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"pratyush/wutbot/internal/commands"
+)
+
+const (
+	defaultPollDuration = 5 * time.Minute
+	maxPollOptions      = 10
+)
+
+// keycap emoji, so that reacting with e.g. 2️⃣ votes for option 2
+var keycapVotes = []string{"1️⃣", "2️⃣", "3️⃣", "4️⃣", "5️⃣", "6️⃣", "7️⃣", "8️⃣", "9️⃣", "🔟"}
+
+type poll struct {
+	question string
+	options  []string
+	creator  string         // account
+	votes    map[string]int // account to option index
+	timer    *time.Timer
+}
+
+type pollManager struct {
+	sync.Mutex
+	duration time.Duration
+	polls    map[string]*poll // keyed by casefolded channel
+}
+
+func newPollManager(duration time.Duration) *pollManager {
+	if duration <= 0 {
+		duration = defaultPollDuration
+	}
+	return &pollManager{
+		duration: duration,
+		polls:    make(map[string]*poll),
+	}
+}
+
+func (irc *Bot) handlePollCommand(cmd commands.Command) {
+	if len(cmd.Args) == 1 && (cmd.Args[0] == "close" || cmd.Args[0] == "end") {
+		irc.closePoll(cmd)
+		return
+	}
+	if len(cmd.Args) < 3 {
+		irc.replyf(cmd, `usage: !poll "question" option1 option2 ...`)
+		return
+	}
+	if cmd.Account == "" {
+		irc.replyf(cmd, "you need to be logged in to start a poll")
+		return
+	}
+	if len(cmd.Args)-1 > maxPollOptions {
+		irc.replyf(cmd, "polls can have at most %d options", maxPollOptions)
+		return
+	}
+
+	p := &poll{
+		question: cmd.Args[0],
+		options:  cmd.Args[1:],
+		creator:  cmd.Account,
+		votes:    make(map[string]int),
+	}
+	key := strings.ToLower(cmd.Target)
+	pm := irc.polls
+	pm.Lock()
+	if _, exists := pm.polls[key]; exists {
+		pm.Unlock()
+		irc.replyf(cmd, "there's already a poll running in this channel")
+		return
+	}
+	pm.polls[key] = p
+	p.timer = time.AfterFunc(pm.duration, func() { irc.finishPoll(cmd.Target, p) })
+	pm.Unlock()
+
+	var options []string
+	for i, option := range p.options {
+		options = append(options, fmt.Sprintf("%d) %s", i+1, option))
+	}
+	irc.Notice(cmd.Target, fmt.Sprintf("Poll: %s — %s", p.question, strings.Join(options, " ")))
+	irc.Notice(cmd.Target, fmt.Sprintf("Vote with !vote <number> (or react with the number); results in %v", pm.duration))
+}
+
+func (irc *Bot) handleVoteCommand(cmd commands.Command) {
+	if len(cmd.Args) != 1 {
+		irc.replyf(cmd, "usage: !vote <number>")
+		return
+	}
+	choice, err := strconv.Atoi(cmd.Args[0])
+	if err != nil {
+		irc.replyf(cmd, "usage: !vote <number>")
+		return
+	}
+	if cmd.Account == "" {
+		irc.replyf(cmd, "you need to be logged in to vote")
+		return
+	}
+	if errMsg := irc.recordVote(cmd.Target, cmd.Account, choice); errMsg != "" {
+		irc.reply(cmd, errMsg)
+	} else {
+		irc.react(cmd.Target, cmd.MsgID, reactionDone)
+	}
+}
+
+// handlePollReaction counts a keycap-number reaction sent in a channel with
+// a running poll, and takes the vote back if the reaction is removed.
+func (irc *Bot) handlePollReaction(e ircmsg.Message, target string) {
+	_, account := e.GetTag("account")
+	if account == "" || account == "*" {
+		return
+	}
+	reacted, reaction := e.GetTag(reactTagName)
+	if !reacted {
+		_, reaction = e.GetTag(unreactTagName)
+	}
+	for i, keycap := range keycapVotes {
+		if reaction != keycap {
+			continue
+		}
+		if reacted {
+			irc.recordVote(target, account, i+1)
+		} else {
+			irc.withdrawVote(target, account, i+1)
+		}
+		return
+	}
+}
+
+// withdrawVote removes a 1-indexed vote, if that's what the account voted for.
+func (irc *Bot) withdrawVote(channel, account string, choice int) {
+	pm := irc.polls
+	pm.Lock()
+	defer pm.Unlock()
+	if p, ok := pm.polls[strings.ToLower(channel)]; ok {
+		if vote, voted := p.votes[account]; voted && vote == choice-1 {
+			delete(p.votes, account)
+		}
+	}
+}
+
+// recordVote records a 1-indexed vote, returning a message for the voter (in
+// the channel's language) if the vote was refused.
+func (irc *Bot) recordVote(channel, account string, choice int) (errMsg string) {
+	pm := irc.polls
+	pm.Lock()
+	defer pm.Unlock()
+	p, ok := pm.polls[strings.ToLower(channel)]
+	if !ok {
+		return irc.translate(channel, "there's no poll running in this channel")
+	}
+	if choice < 1 || choice > len(p.options) {
+		return fmt.Sprintf(irc.translate(channel, "pick an option between 1 and %d"), len(p.options))
+	}
+	if _, voted := p.votes[account]; voted {
+		return irc.translate(channel, "you already voted in this poll")
+	}
+	p.votes[account] = choice - 1
+	return ""
+}
+
+func (irc *Bot) closePoll(cmd commands.Command) {
+	pm := irc.polls
+	pm.Lock()
+	p, ok := pm.polls[strings.ToLower(cmd.Target)]
+	pm.Unlock()
+	if !ok {
+		irc.replyf(cmd, "there's no poll running in this channel")
+		return
+	}
+	if cmd.Account == "" || (cmd.Account != p.creator && cmd.Account != irc.Owner) {
+		irc.replyf(cmd, "only the poll's creator can close it")
+		return
+	}
+	if p.timer.Stop() {
+		irc.finishPoll(cmd.Target, p)
+	}
+}
+
+func (irc *Bot) finishPoll(channel string, p *poll) {
+	pm := irc.polls
+	pm.Lock()
+	key := strings.ToLower(channel)
+	if pm.polls[key] != p {
+		pm.Unlock()
+		return
+	}
+	delete(pm.polls, key)
+	counts := make([]int, len(p.options))
+	for _, choice := range p.votes {
+		counts[choice]++
+	}
+	pm.Unlock()
+
+	if len(p.votes) == 0 {
+		irc.Notice(channel, fmt.Sprintf("Poll closed: %s — no votes were cast", p.question))
+		return
+	}
+	var results []string
+	for i, option := range p.options {
+		results = append(results, fmt.Sprintf("%s: %d", option, counts[i]))
+	}
+	irc.Notice(channel, fmt.Sprintf("Poll results: %s — %s", p.question, strings.Join(results, ", ")))
+}
@@ -0,0 +1,32 @@
+package wutbot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"pratyush/wutbot/internal/fetch"
+)
+
+// describeJSON is what's announced for a JSON link: an object's keys, or
+// how many elements an array has (and its objects' keys).
+func (irc *Bot) describeJSON(channel string, p *fetch.JSONPreview) string {
+	count := strconv.Itoa(p.Count)
+	if p.Partial {
+		count += "+"
+	}
+	switch p.Kind {
+	case "object":
+		keys := strings.Join(p.Keys, ", ")
+		if p.Count > len(p.Keys) || p.Partial {
+			keys += ", …"
+		}
+		return "{" + keys + "}"
+	case "array":
+		if p.Keys != nil {
+			return fmt.Sprintf("%s × {%s}", count, strings.Join(p.Keys, ", "))
+		}
+		return fmt.Sprintf(irc.translate(channel, "%s items"), count)
+	}
+	return p.Value
+}
@@ -0,0 +1,48 @@
+package wutbot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"pratyush/wutbot/internal/cron"
+)
+
+// quietHours returns the channel's own quiet hours if it has any, or else
+// the "*" entry's.
+func quietHours(c *FileConfig, channel string) []QuietHoursConfig {
+	if chanConfig, ok := c.Channels[strings.ToLower(channel)]; ok && len(chanConfig.QuietHours) != 0 {
+		return chanConfig.QuietHours
+	}
+	return c.Channels["*"].QuietHours
+}
+
+// compileQuietHours parses the schedules and time zones of quiet hours,
+// so that they aren't every time they're checked.
+func compileQuietHours(quiet []QuietHoursConfig) error {
+	for i, q := range quiet {
+		schedule, err := cron.Parse(q.Cron)
+		if err != nil {
+			return fmt.Errorf("invalid quiet hours %d: %w", i+1, err)
+		}
+		loc, err := time.LoadLocation(q.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid quiet hours %d: %w", i+1, err)
+		}
+		quiet[i].schedule, quiet[i].location = schedule, loc
+	}
+	return nil
+}
+
+// isQuiet reports whether it's the channel's quiet hours, when we don't
+// announce titles, feeds, follows, releases, webhooks, GitHub events or
+// scheduled messages (but still answer commands).
+func (irc *Bot) isQuiet(channel string) bool {
+	now := time.Now()
+	for _, q := range quietHours(irc.getConfig(), channel) {
+		if q.schedule != nil && q.schedule.Matches(now.In(q.location)) {
+			return true
+		}
+	}
+	return false
+}
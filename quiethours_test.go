@@ -0,0 +1,38 @@
+package wutbot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestQuietHours(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(path, []byte(`{"channels": {
+		"*": {"quiet-hours": [{"cron": "* * * * *", "timezone": "Europe/Berlin"}]},
+		"#never": {"quiet-hours": [{"cron": "0 0 31 2 *"}]}
+	}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	irc := &Bot{config: config}
+	if !irc.isQuiet("#chan") {
+		t.Error("the wildcard's quiet hours didn't apply")
+	}
+	if irc.isQuiet("#never") {
+		t.Error("quiet on February 31st")
+	}
+	if err := irc.setChannelOption("#never", "quiet-hours", `[{"cron": "* * * * *"}]`); err != nil {
+		t.Fatal(err)
+	}
+	if !irc.isQuiet("#never") {
+		t.Error("quiet hours set at runtime didn't apply")
+	}
+	if err := irc.setChannelOption("#never", "quiet-hours", `[{"cron": "* * * * *", "timezone": "Mars/Olympus_Mons"}]`); err == nil {
+		t.Error("accepted an unknown time zone")
+	}
+}
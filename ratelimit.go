@@ -0,0 +1,43 @@
+package wutbot
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimiter allows up to `limit` events per sliding window for each key.
+type rateLimiter struct {
+	sync.Mutex
+	limit  int
+	window time.Duration
+	events map[string][]time.Time
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{
+		limit:  limit,
+		window: window,
+		events: make(map[string][]time.Time),
+	}
+}
+
+// allow records an event for key, returning false if it exceeds the limit.
+func (r *rateLimiter) allow(key string) bool {
+	key = strings.ToLower(key)
+	now := time.Now()
+	r.Lock()
+	defer r.Unlock()
+	recent := r.events[key][:0]
+	for _, t := range r.events[key] {
+		if now.Sub(t) < r.window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= r.limit {
+		r.events[key] = recent
+		return false
+	}
+	r.events[key] = append(recent, now)
+	return true
+}
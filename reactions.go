@@ -0,0 +1,21 @@
+package wutbot
+
+const (
+	reactTagName   = "+draft/react"
+	unreactTagName = "+draft/unreact"
+
+	reactionDone = "✅"
+)
+
+// react sends a reaction to the message with the given msgid, if the
+// server lets us send client tags; it reports whether it could.
+func (irc *Bot) react(target, msgid, reaction string) bool {
+	if msgid == "" {
+		return false
+	}
+	if _, ok := irc.AcknowledgedCaps()["message-tags"]; !ok {
+		return false
+	}
+	irc.SendWithTags(map[string]string{replyTagName: msgid, reactTagName: reaction}, "TAGMSG", target)
+	return true
+}
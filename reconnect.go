@@ -0,0 +1,111 @@
+package wutbot
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ergochat/irc-go/ircevent"
+)
+
+const (
+	minReconnectDelay = 5 * time.Second
+	maxReconnectDelay = 10 * time.Minute
+)
+
+// reconnectDelay is a jittered exponential backoff after `failures`
+// consecutive failed connection attempts.
+func reconnectDelay(failures int32) time.Duration {
+	delay := minReconnectDelay
+	for i := int32(1); i < failures && delay < maxReconnectDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxReconnectDelay {
+		delay = maxReconnectDelay
+	}
+	// somewhere between half and all of it, so a netsplit doesn't
+	// bring every bot back at the same instant
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// dialWithBackoff wraps a dial function so that each connection attempt
+// pushes back the next one, and moves on to the next server if the previous
+// attempt failed. ircevent's Loop reads ReconnectFreq from the same
+// goroutine that dials, and the connect callback resets the count.
+func (irc *Bot) dialWithBackoff(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		attempts := atomic.AddInt32(&irc.connectAttempts, 1)
+		irc.ReconnectFreq = reconnectDelay(attempts)
+		if attempts > 1 {
+			irc.servers.Advance()
+		}
+		return dial(ctx, network, addr)
+	}
+}
+
+// connectWithRetry makes the initial connection, retrying with backoff
+// (ircevent's Loop can only take over once a connection has succeeded).
+func (irc *Bot) connectWithRetry() error {
+	for {
+		err := irc.Connect()
+		if err == nil {
+			return nil
+		}
+		if errors.Is(err, ircevent.ClientHasQuit) {
+			return err
+		}
+		delay := reconnectDelay(atomic.LoadInt32(&irc.connectAttempts))
+		irc.logger("servers").Warn("couldn't connect, retrying", "err", err, "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-irc.stopping.ctx.Done():
+			return irc.stopping.ctx.Err()
+		}
+	}
+}
+
+// joinedChannels tracks the channels we're in, so that channels joined at
+// runtime (e.g. by invite) are rejoined after a reconnect.
+type joinedChannels struct {
+	sync.Mutex
+	channels map[string]string // casefolded name -> name
+}
+
+func newJoinedChannels() *joinedChannels {
+	return &joinedChannels{channels: make(map[string]string)}
+}
+
+func (j *joinedChannels) Add(channel string) {
+	j.Lock()
+	j.channels[strings.ToLower(channel)] = channel
+	j.Unlock()
+}
+
+func (j *joinedChannels) Remove(channel string) {
+	j.Lock()
+	delete(j.channels, strings.ToLower(channel))
+	j.Unlock()
+}
+
+func (j *joinedChannels) Contains(channel string) bool {
+	j.Lock()
+	defer j.Unlock()
+	_, ok := j.channels[strings.ToLower(channel)]
+	return ok
+}
+
+func (j *joinedChannels) List() (result []string) {
+	j.Lock()
+	defer j.Unlock()
+	for _, channel := range j.channels {
+		result = append(result, channel)
+	}
+	sort.Strings(result)
+	return
+}
@@ -0,0 +1,95 @@
+package wutbot
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRejoinDelay = 10 * time.Second
+	maxRejoinDelay     = 30 * time.Minute
+	// kicks further apart than this don't count towards the backoff
+	rejoinKickWindow = time.Hour
+)
+
+type kickRecord struct {
+	count    int
+	lastKick time.Time
+}
+
+// rejoinManager schedules rejoins after being kicked or removed,
+// backing off if the same channel keeps kicking us.
+type rejoinManager struct {
+	sync.Mutex
+	delay   time.Duration
+	kicks   map[string]*kickRecord // keyed by casefolded channel
+	parting map[string]bool        // channels we're leaving on purpose
+}
+
+func newRejoinManager(delay time.Duration) *rejoinManager {
+	if delay <= 0 {
+		delay = defaultRejoinDelay
+	}
+	return &rejoinManager{
+		delay:   delay,
+		kicks:   make(map[string]*kickRecord),
+		parting: make(map[string]bool),
+	}
+}
+
+// nextDelay records a kick and returns how long to wait before rejoining.
+func (rm *rejoinManager) nextDelay(channel string) time.Duration {
+	rm.Lock()
+	defer rm.Unlock()
+	key := strings.ToLower(channel)
+	record := rm.kicks[key]
+	if record == nil || time.Since(record.lastKick) > rejoinKickWindow {
+		record = new(kickRecord)
+		rm.kicks[key] = record
+	}
+	record.count++
+	record.lastKick = time.Now()
+	delay := rm.delay
+	for i := 1; i < record.count && delay < maxRejoinDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRejoinDelay {
+		delay = maxRejoinDelay
+	}
+	return delay
+}
+
+// partChannel leaves a channel without triggering an automatic rejoin.
+func (irc *Bot) partChannel(channel string) {
+	irc.rejoin.Lock()
+	irc.rejoin.parting[strings.ToLower(channel)] = true
+	irc.rejoin.Unlock()
+	irc.Part(channel)
+}
+
+// handleSelfPart is called when we leave a channel; a PART we didn't ask
+// for means we were REMOVEd.
+func (irc *Bot) handleSelfPart(channel string) {
+	key := strings.ToLower(channel)
+	irc.rejoin.Lock()
+	intentional := irc.rejoin.parting[key]
+	delete(irc.rejoin.parting, key)
+	irc.rejoin.Unlock()
+	if !intentional {
+		irc.scheduleRejoin(channel)
+	}
+}
+
+func (irc *Bot) scheduleRejoin(channel string) {
+	if channelOption(irc.getConfig(), channel, func(c ChannelConfig) *bool { return c.NoRejoin }) {
+		return
+	}
+	delay := irc.rejoin.nextDelay(channel)
+	irc.logger("joins").Info("removed, rejoining", "channel", channel, "delay", delay)
+	time.AfterFunc(delay, func() {
+		if irc.Connected() {
+			irc.joinChannel(channel)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package wutbot
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"unicode/utf8"
+)
+
+const (
+	defaultRelayFormat = "<{{.Nick}}> {{.Text}}"
+	// inserted in relayed nicks, so that they don't highlight anyone
+	zeroWidthSpace = "\u200b"
+)
+
+// relay copies messages between channels, which can be Matrix rooms.
+// Our own messages are never published, so what we relay isn't relayed
+// back; other relay bots are ignored like any other.
+type relay struct {
+	channels  []string
+	format    *template.Template
+	joins     bool
+	highlight bool
+}
+
+func compileRelays(config *FileConfig) (relays []*relay, err error) {
+	for i, rc := range config.Relays {
+		if len(rc.Channels) < 2 {
+			return nil, fmt.Errorf("relay %d needs at least two channels", i+1)
+		}
+		format := rc.Format
+		if format == "" {
+			format = defaultRelayFormat
+		}
+		tmpl, err := template.New(fmt.Sprintf("relay %d", i+1)).Parse(format)
+		if err != nil {
+			return nil, fmt.Errorf("invalid format for relay %d: %w", i+1, err)
+		}
+		relays = append(relays, &relay{channels: rc.Channels, format: tmpl, joins: rc.Joins, highlight: rc.Highlight})
+	}
+	return
+}
+
+// targets returns the relay's other channels, if channel is one of them.
+func (r *relay) targets(channel string) (targets []string) {
+	found := false
+	for _, c := range r.channels {
+		if strings.EqualFold(c, channel) {
+			found = true
+		} else {
+			targets = append(targets, c)
+		}
+	}
+	if !found {
+		return nil
+	}
+	return
+}
+
+// firstChannelOf reports whether channel is the first of the relay's
+// channels that nick is in, so that their quit is relayed once.
+func (r *relay) firstChannelOf(cl *channelLogger, channel, nick string) bool {
+	for _, c := range r.channels {
+		if strings.EqualFold(c, channel) {
+			return true
+		}
+		if cl.isMember(c, nick) {
+			return false
+		}
+	}
+	return false
+}
+
+func (r *relay) nick(nick string) string {
+	if r.highlight || nick == "" {
+		return nick
+	}
+	_, size := utf8.DecodeRuneInString(nick)
+	return nick[:size] + zeroWidthSpace + nick[size:]
+}
+
+func (irc *Bot) relayMessage(m messageEvent) {
+	for _, r := range irc.relays {
+		targets := r.targets(m.channel)
+		if len(targets) == 0 {
+			continue
+		}
+		var text strings.Builder
+		err := r.format.Execute(&text, struct{ Nick, Channel, Text string }{r.nick(m.nick), m.channel, m.text})
+		if err != nil {
+			irc.logger("relay").Warn("couldn't format relayed message", "channel", m.channel, "err", err)
+			continue
+		}
+		for _, target := range targets {
+			irc.Privmsg(target, text.String())
+		}
+	}
+}
+
+func (irc *Bot) relayJoin(j joinEvent) {
+	if j.self {
+		return
+	}
+	for _, r := range irc.relays {
+		if r.joins {
+			for _, target := range r.targets(j.channel) {
+				irc.Notice(target, fmt.Sprintf("*** %s joined %s", r.nick(j.nick), j.channel))
+			}
+		}
+	}
+}
+
+func (irc *Bot) relayPart(p partEvent) {
+	if p.self {
+		return
+	}
+	for _, r := range irc.relays {
+		if !r.joins || (p.quit && !r.firstChannelOf(irc.chanLog, p.channel, p.nick)) {
+			continue
+		}
+		for _, target := range r.targets(p.channel) {
+			switch {
+			case p.quit && irc.chanLog.isMember(target, p.nick):
+				// they saw it for themselves
+			case p.quit:
+				irc.Notice(target, fmt.Sprintf("*** %s quit (%s)", r.nick(p.nick), p.reason))
+			case p.reason != "":
+				irc.Notice(target, fmt.Sprintf("*** %s left %s (%s)", r.nick(p.nick), p.channel, p.reason))
+			default:
+				irc.Notice(target, fmt.Sprintf("*** %s left %s", r.nick(p.nick), p.channel))
+			}
+		}
+	}
+}
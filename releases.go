@@ -0,0 +1,227 @@
+package wutbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"pratyush/wutbot/internal/commands"
+	"pratyush/wutbot/internal/fetch"
+)
+
+const (
+	// watched repositories, keyed by "<casefolded channel> <casefolded owner/repo>"
+	releasesBucket = "releases"
+
+	releasePollInterval = 15 * time.Minute
+	maxReleaseSnippet   = 120
+	githubAPI           = "https://api.github.com"
+)
+
+var githubRepoRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+type releaseWatch struct {
+	Channel string `json:"channel"`
+	Repo    string `json:"repo"`
+	LastID  int64  `json:"last-id"` // the newest release we've announced
+	ETag    string `json:"etag,omitempty"`
+}
+
+func (w *releaseWatch) key() string {
+	return strings.ToLower(w.Channel) + " " + strings.ToLower(w.Repo)
+}
+
+type githubRelease struct {
+	ID         int64  `json:"id"`
+	TagName    string `json:"tag_name"`
+	Name       string `json:"name"`
+	Body       string `json:"body"`
+	HTMLURL    string `json:"html_url"`
+	Draft      bool   `json:"draft"`
+	Prerelease bool   `json:"prerelease"`
+}
+
+// fetchReleases returns the repository's latest releases, newest first, or
+// nil if they haven't changed since the last check.
+func (irc *Bot) fetchReleases(ctx context.Context, w *releaseWatch) (releases []githubRelease, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", githubAPI+"/repos/"+w.Repo+"/releases?per_page=10", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", irc.userAgent)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	if irc.githubToken != "" {
+		req.Header.Set("Authorization", "Bearer "+irc.githubToken)
+	}
+	if w.ETag != "" {
+		// unchanged responses don't count against the rate limit
+		req.Header.Set("If-None-Match", w.ETag)
+	}
+	resp, err := irc.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub returned %s", resp.Status)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxAPIResponseBytes)).Decode(&releases); err != nil {
+		return nil, err
+	}
+	w.ETag = resp.Header.Get("ETag")
+	return releases, nil
+}
+
+// releaseSnippet is the first line of the release notes, skipping headings.
+func releaseSnippet(body string) string {
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimLeft(line, "*-> "))
+		if runes := []rune(line); len(runes) > maxReleaseSnippet {
+			line = string(runes[:maxReleaseSnippet]) + "…"
+		}
+		return line
+	}
+	return ""
+}
+
+func formatRelease(repo string, r githubRelease) string {
+	name := r.TagName
+	if r.Name != "" && r.Name != r.TagName {
+		name += " (" + r.Name + ")"
+	}
+	text := fmt.Sprintf("[%s] released %s", repo, name)
+	if r.Prerelease {
+		text += " [pre-release]"
+	}
+	if snippet := releaseSnippet(r.Body); snippet != "" {
+		text += ": " + snippet
+	}
+	return fetch.Sanitize(text + " " + r.HTMLURL)
+}
+
+// checkReleases announces new releases, or with announce unset, just
+// catches up to them.
+func (irc *Bot) checkReleases(ctx context.Context, w releaseWatch, announce bool) error {
+	releases, err := irc.fetchReleases(ctx, &w)
+	if err != nil {
+		return err
+	}
+	var fresh []githubRelease
+	newest := w.LastID
+	for _, r := range releases {
+		if r.Draft || r.ID <= w.LastID {
+			continue
+		}
+		fresh = append(fresh, r)
+		if r.ID > newest {
+			newest = r.ID
+		}
+	}
+	if announce {
+		sort.Slice(fresh, func(i, j int) bool { return fresh[i].ID < fresh[j].ID })
+		for _, r := range fresh {
+			text := formatRelease(w.Repo, r)
+			irc.Notice(w.Channel, text)
+			irc.alert(alertRelease, w.Repo, w.Channel, text)
+		}
+	}
+	w.LastID = newest
+	return irc.store.Put(releasesBucket, w.key(), w)
+}
+
+func (irc *Bot) pollReleases() {
+	ticker := time.NewTicker(releasePollInterval)
+	defer ticker.Stop()
+	for irc.tick(ticker) {
+		if !irc.Connected() {
+			continue
+		}
+		keys, err := irc.store.Keys(releasesBucket)
+		if err != nil {
+			irc.logger("releases").Error("couldn't list watched repos", "err", err)
+		}
+		for _, key := range keys {
+			var w releaseWatch
+			if found, err := irc.store.Get(releasesBucket, key, &w); !found || err != nil || irc.isQuiet(w.Channel) {
+				continue
+			}
+			irc.safely("releases check", func() {
+				if err := irc.checkReleases(irc.connectionContext(), w, true); err != nil {
+					irc.logger("releases").Warn("couldn't check releases", "repo", w.Repo, "err", err)
+					irc.fetchFailed("releases "+w.Repo, err, map[string]string{"channel": w.Channel, "repo": w.Repo})
+				} else {
+					irc.fetchSucceeded("releases " + w.Repo)
+				}
+			})
+		}
+	}
+}
+
+// handleReleasesCommand is "!releases add|del <owner/repo>" and
+// "!releases [list]", for admins, in the channel to announce to.
+func (irc *Bot) handleReleasesCommand(cmd commands.Command) {
+	usage := "usage: !releases add|del <owner/repo> | !releases list"
+	if len(cmd.Args) == 0 || strings.ToLower(cmd.Args[0]) == "list" {
+		keys, err := irc.store.Keys(releasesBucket)
+		if err != nil {
+			irc.logger("releases").Error("couldn't list watched repos", "err", err)
+			irc.replyf(cmd, "couldn't read the list, try again later")
+			return
+		}
+		var repos []string
+		for _, key := range keys {
+			var w releaseWatch
+			if found, _ := irc.store.Get(releasesBucket, key, &w); found && strings.EqualFold(w.Channel, cmd.Target) {
+				repos = append(repos, w.Repo)
+			}
+		}
+		if len(repos) == 0 {
+			irc.replyf(cmd, "not watching any releases here")
+		} else {
+			irc.replyf(cmd, "watching releases of %s", strings.Join(repos, ", "))
+		}
+		return
+	}
+	if !irc.requireAdmin(cmd) {
+		return
+	}
+	if len(cmd.Args) != 2 || !githubRepoRegex.MatchString(cmd.Args[1]) {
+		irc.reply(cmd, irc.translate(cmd.Target, usage))
+		return
+	}
+	w := releaseWatch{Channel: cmd.Target, Repo: cmd.Args[1]}
+	switch strings.ToLower(cmd.Args[0]) {
+	case "add":
+		go func() {
+			defer irc.recoverPanic("releases add")
+			// what's already released isn't news
+			if err := irc.checkReleases(irc.connectionContext(), w, false); err != nil {
+				irc.replyf(cmd, "couldn't get the releases of %s: %v", w.Repo, err)
+				return
+			}
+			irc.replyf(cmd, "watching releases of %s", w.Repo)
+		}()
+	case "del":
+		if found, _ := irc.store.Get(releasesBucket, w.key(), new(releaseWatch)); !found {
+			irc.replyf(cmd, "not watching %s", w.Repo)
+			return
+		}
+		irc.store.Delete(releasesBucket, w.key())
+		irc.replyf(cmd, "stopped watching %s", w.Repo)
+	default:
+		irc.reply(cmd, irc.translate(cmd.Target, usage))
+	}
+}
@@ -0,0 +1,111 @@
+package wutbot
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// Canned responses are templates of .Nick (who we're answering), .Channel
+// and, for "abuse", .Target; one is picked at random, by weight, and
+// translated into the channel's language if its catalog has it.
+const (
+	// answers mentions that nothing else (chat, markov) answered
+	responseMention = "mention"
+	// the owner's "abuse <nick>"
+	responseAbuse = "abuse"
+)
+
+var defaultResponses = map[string][]ResponseConfig{
+	responseMention: {{Text: "don't @ me, mortal"}},
+	responseAbuse:   {{Text: "{{.Target}} isn't a real programmer"}},
+}
+
+type response struct {
+	text     string
+	template *template.Template
+	weight   int
+}
+
+type responseData struct {
+	Nick, Channel, Target string
+}
+
+// compileResponses compiles the default responses, replaced by kind by
+// those from the responses file and then the config's own.
+func compileResponses(config *FileConfig) (map[string][]response, error) {
+	phrases := make(map[string][]ResponseConfig)
+	for kind, list := range defaultResponses {
+		phrases[kind] = list
+	}
+	if config.ResponsesFile != "" {
+		data, err := os.ReadFile(config.ResponsesFile)
+		if err != nil {
+			return nil, err
+		}
+		var fromFile map[string][]ResponseConfig
+		if err := json.Unmarshal(data, &fromFile); err != nil {
+			return nil, fmt.Errorf("couldn't parse %s: %w", config.ResponsesFile, err)
+		}
+		for kind, list := range fromFile {
+			phrases[strings.ToLower(kind)] = list
+		}
+	}
+	for kind, list := range config.Responses {
+		phrases[strings.ToLower(kind)] = list
+	}
+	result := make(map[string][]response, len(phrases))
+	for kind, list := range phrases {
+		if _, ok := defaultResponses[kind]; !ok {
+			return nil, fmt.Errorf("unknown response kind %s", kind)
+		}
+		for i, rc := range list {
+			weight := rc.Weight
+			if weight == 0 {
+				weight = 1
+			} else if weight < 0 {
+				return nil, fmt.Errorf("%s response %d has a negative weight", kind, i+1)
+			}
+			tmpl, err := template.New(fmt.Sprintf("%s response %d", kind, i+1)).Parse(rc.Text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s response %d: %w", kind, i+1, err)
+			}
+			result[kind] = append(result[kind], response{text: rc.Text, template: tmpl, weight: weight})
+		}
+	}
+	return result, nil
+}
+
+// respond picks one of the responses of a kind, returning "" if there are
+// none (so that it goes unanswered).
+func (irc *Bot) respond(kind string, data responseData) string {
+	responses := irc.responses[kind]
+	total := 0
+	for _, r := range responses {
+		total += r.weight
+	}
+	if total == 0 {
+		return ""
+	}
+	n := rand.Intn(total)
+	for _, r := range responses {
+		if n -= r.weight; n < 0 {
+			tmpl := r.template
+			if translated := irc.translate(data.Channel, r.text); translated != r.text {
+				if t, err := template.New(tmpl.Name()).Parse(translated); err == nil {
+					tmpl = t
+				}
+			}
+			var text strings.Builder
+			if err := tmpl.Execute(&text, data); err != nil {
+				irc.logger("responses").Warn("couldn't format response", "kind", kind, "err", err)
+				return ""
+			}
+			return text.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,15 @@
+package wutbot
+
+import (
+	"strings"
+)
+
+// outgoingText fixes up anything the server would reject: line breaks
+// always, and invalid UTF-8 if it advertises UTF8ONLY.
+func (irc *Bot) outgoingText(text string) string {
+	text = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ", "\x00", "").Replace(text)
+	if _, ok := irc.ISupport()["UTF8ONLY"]; ok {
+		text = strings.ToValidUTF8(text, "\uFFFD")
+	}
+	return text
+}
@@ -0,0 +1,111 @@
+package wutbot
+
+import (
+	"crypto/tls"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+// saslState is what we've learned about the server's mechanisms, from
+// which the mechanism for each connection is chosen as it's made. The
+// callbacks only record what they see, so the mechanism doesn't change
+// under a connection that's authenticating.
+type saslState struct {
+	sync.Mutex
+	external bool // a client certificate is configured
+	scram    bool // SCRAM-SHA-256 is configured
+
+	noExternal bool   // the server rejected EXTERNAL, or didn't offer it
+	noSCRAM    bool   // the server didn't offer SCRAM
+	mech       string // the current connection's
+}
+
+func loadClientCertificate(certFile, keyFile string) ([]tls.Certificate, error) {
+	if certFile == "" {
+		return nil, nil
+	}
+	if keyFile == "" {
+		// the key may be in the same PEM file
+		keyFile = certFile
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return []tls.Certificate{cert}, nil
+}
+
+func (irc *Bot) canFallBackToPlain() bool {
+	return irc.SASLLogin != "" && irc.SASLPassword != ""
+}
+
+// chooseSASLMech picks the mechanism for the next connection: EXTERNAL
+// with a client certificate, otherwise SCRAM if it's configured, or PLAIN.
+// EXTERNAL falls back to PLAIN if we have a password, and SCRAM does under
+// TLS, once the server has shown it doesn't support them. Call with the
+// lock held.
+func (irc *Bot) chooseSASLMech() string {
+	s := irc.sasl
+	switch {
+	case s.external && (!s.noExternal || !irc.canFallBackToPlain()):
+		return "EXTERNAL"
+	case s.scram && (!s.noSCRAM || !irc.UseTLS):
+		return scramMech
+	}
+	return "PLAIN"
+}
+
+// currentSASLMech is the mechanism the current connection authenticates with.
+func (irc *Bot) currentSASLMech() string {
+	irc.sasl.Lock()
+	defer irc.sasl.Unlock()
+	return irc.sasl.mech
+}
+
+// handleSASLMechanisms notes which of our mechanisms the server doesn't
+// support (in CAP LS); we'll use another from the next connection.
+func (irc *Bot) handleSASLMechanisms(e ircmsg.Message) {
+	value, found := advertisedCap(e, "sasl")
+	// an empty value means the server didn't list its mechanisms
+	if !found || value == "" {
+		return
+	}
+	offered := strings.Split(value, ",")
+	irc.sasl.Lock()
+	defer irc.sasl.Unlock()
+	if irc.sasl.external && !containsFold(offered, "EXTERNAL") {
+		irc.sasl.noExternal = true
+	}
+	if irc.sasl.scram && !containsFold(offered, scramMech) && !irc.sasl.noSCRAM {
+		irc.logger("sasl").Warn("server doesn't support SCRAM", "mechanism", scramMech)
+		irc.sasl.noSCRAM = true
+	}
+}
+
+// handleSASLFailure falls back to PLAIN when the server rejects EXTERNAL.
+// ircevent has already given up on this connection, so like any other
+// fallback, it takes effect when we reconnect.
+func (irc *Bot) handleSASLFailure(e ircmsg.Message) {
+	irc.sasl.Lock()
+	defer irc.sasl.Unlock()
+	if irc.sasl.mech == "EXTERNAL" {
+		irc.sasl.noExternal = true
+	}
+	if next := irc.chooseSASLMech(); next != irc.sasl.mech {
+		irc.logger("sasl").Warn("falling back to another mechanism", "mechanism", irc.sasl.mech, "next", next)
+		// not the server's fault, so don't back off or move to the next server
+		atomic.StoreInt32(&irc.connectAttempts, 0)
+	}
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package wutbot
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	"github.com/ergochat/irc-go/ircevent"
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+func newSASLBot(sasl *saslState, password string, useTLS bool) *Bot {
+	return &Bot{
+		Connection: ircevent.Connection{SASLLogin: "wutbot", SASLPassword: password, UseTLS: useTLS},
+		sasl:       sasl,
+		baseLogger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+// connect is what dialWithSASLMech does as each connection is made.
+func connect(irc *Bot) string {
+	irc.sasl.Lock()
+	defer irc.sasl.Unlock()
+	irc.sasl.mech = irc.chooseSASLMech()
+	return irc.sasl.mech
+}
+
+func TestSASLFallback(t *testing.T) {
+	capLS := ircmsg.MakeMessage(nil, "irc.example.com", "CAP", "*", "LS", "sasl=PLAIN multi-prefix")
+	fail := ircmsg.MakeMessage(nil, "irc.example.com", ircevent.ERR_SASLFAIL, "wutbot", "SASL authentication failed")
+	tests := []struct {
+		name            string
+		external, scram bool
+		password        string
+		useTLS          bool
+		// the mechanisms of the first connection, and of the next
+		first, next string
+	}{
+		{"PLAIN", false, false, "hunter2", true, "PLAIN", "PLAIN"},
+		{"EXTERNAL to PLAIN", true, false, "hunter2", true, "EXTERNAL", "PLAIN"},
+		{"EXTERNAL without a password", true, false, "", true, "EXTERNAL", "EXTERNAL"},
+		{"SCRAM to PLAIN", false, true, "hunter2", true, scramMech, "PLAIN"},
+		{"SCRAM without TLS", false, true, "hunter2", false, scramMech, scramMech},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			irc := newSASLBot(&saslState{external: tt.external, scram: tt.scram}, tt.password, tt.useTLS)
+			if got := connect(irc); got != tt.first {
+				t.Errorf("first connection: %s, want %s", got, tt.first)
+			}
+			irc.handleSASLMechanisms(capLS)
+			if got := irc.currentSASLMech(); got != tt.first {
+				t.Errorf("CAP LS changed the mechanism mid-connection to %s", got)
+			}
+			irc.handleSASLFailure(fail)
+			if got := connect(irc); got != tt.next {
+				t.Errorf("next connection: %s, want %s", got, tt.next)
+			}
+		})
+	}
+}
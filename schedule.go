@@ -0,0 +1,182 @@
+package wutbot
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"pratyush/wutbot/internal/commands"
+	"pratyush/wutbot/internal/cron"
+)
+
+const (
+	// scheduled announcements, keyed by ID
+	schedulesBucket = "schedules"
+)
+
+type scheduledJob struct {
+	ID       string `json:"-"`
+	Channel  string `json:"channel"`
+	Cron     string `json:"cron"`
+	Text     string `json:"text"`
+	Timezone string `json:"timezone"`
+	Creator  string `json:"creator,omitempty"`
+}
+
+// schedules returns the jobs from the config file (with IDs "config-<n>")
+// followed by the stored ones.
+func (irc *Bot) schedules() (jobs []scheduledJob, err error) {
+	for i, sc := range irc.getConfig().Schedules {
+		jobs = append(jobs, scheduledJob{
+			ID: fmt.Sprintf("config-%d", i+1), Channel: sc.Channel, Cron: sc.Cron, Text: sc.Text, Timezone: sc.Timezone,
+		})
+	}
+	ids, err := irc.store.Keys(schedulesBucket)
+	if err != nil {
+		return jobs, err
+	}
+	var stored []scheduledJob
+	for _, id := range ids {
+		var job scheduledJob
+		if found, err := irc.store.Get(schedulesBucket, id, &job); found && err == nil {
+			job.ID = id
+			stored = append(stored, job)
+		}
+	}
+	sort.Slice(stored, func(i, j int) bool {
+		a, _ := strconv.Atoi(stored[i].ID)
+		b, _ := strconv.Atoi(stored[j].ID)
+		return a < b
+	})
+	return append(jobs, stored...), nil
+}
+
+// runSchedules posts each job's text at the minutes its schedule matches;
+// minutes missed while disconnected, or in the channel's quiet hours, are
+// skipped.
+func (irc *Bot) runSchedules() {
+	for {
+		now := time.Now()
+		next := now.Truncate(time.Minute).Add(time.Minute)
+		select {
+		case <-time.After(time.Until(next)):
+		case <-irc.stopping.ctx.Done():
+			return
+		}
+		if !irc.Connected() {
+			continue
+		}
+		// the configured jobs still run if the stored ones can't be read
+		jobs, err := irc.schedules()
+		if err != nil {
+			irc.logger("schedule").Error("couldn't read schedules", "err", err)
+		}
+		for _, job := range jobs {
+			schedule, err := cron.Parse(job.Cron)
+			if err != nil {
+				continue
+			}
+			loc, err := time.LoadLocation(job.Timezone)
+			if err != nil {
+				loc = time.UTC
+			}
+			if schedule.Matches(next.In(loc)) && !irc.isQuiet(job.Channel) {
+				irc.Notice(job.Channel, job.Text)
+			}
+		}
+	}
+}
+
+// handleScheduleCommand is "!schedule add <channel> <schedule> <text> [<timezone>]",
+// "!schedule list [<channel>]" and "!schedule del <id>", for admins.
+func (irc *Bot) handleScheduleCommand(cmd commands.Command) {
+	usage := `usage: !schedule add <channel> "<minute hour day month weekday>" "<text>" [<timezone>] | !schedule list [<channel>] | !schedule del <id>`
+	if !irc.requireAdmin(cmd) {
+		return
+	}
+	if len(cmd.Args) == 0 {
+		irc.reply(cmd, irc.translate(cmd.Target, usage))
+		return
+	}
+	switch strings.ToLower(cmd.Args[0]) {
+	case "add":
+		if len(cmd.Args) < 4 || len(cmd.Args) > 5 || !irc.isChannel(cmd.Args[1]) {
+			irc.reply(cmd, irc.translate(cmd.Target, usage))
+			return
+		}
+		job := scheduledJob{Channel: cmd.Args[1], Cron: cmd.Args[2], Text: cmd.Args[3], Timezone: "UTC", Creator: cmd.Account}
+		if _, err := cron.Parse(job.Cron); err != nil {
+			irc.reply(cmd, err.Error())
+			return
+		}
+		if len(cmd.Args) == 5 {
+			loc, err := resolveTimezone(cmd.Args[4])
+			if err != nil {
+				irc.reply(cmd, err.Error())
+				return
+			}
+			job.Timezone = loc.String()
+		} else if loc, ok := irc.userTimezone(cmd.Account); ok {
+			job.Timezone = loc.String()
+		}
+		keys, err := irc.store.Keys(schedulesBucket)
+		if err != nil {
+			irc.replyf(cmd, "couldn't save: %v", err)
+			return
+		}
+		id := 1
+		for _, key := range keys {
+			if n, err := strconv.Atoi(key); err == nil && n >= id {
+				id = n + 1
+			}
+		}
+		job.ID = strconv.Itoa(id)
+		if err := irc.store.Put(schedulesBucket, job.ID, job); err != nil {
+			irc.replyf(cmd, "couldn't save: %v", err)
+			return
+		}
+		irc.replyf(cmd, "scheduled as %s (%s, %s)", job.ID, job.Cron, job.Timezone)
+	case "list":
+		jobs, err := irc.schedules()
+		if err != nil {
+			irc.logger("schedule").Error("couldn't read schedules", "err", err)
+			irc.replyf(cmd, "couldn't read the list, try again later")
+			return
+		}
+		var lines []string
+		for _, job := range jobs {
+			if len(cmd.Args) > 1 && !strings.EqualFold(job.Channel, cmd.Args[1]) {
+				continue
+			}
+			lines = append(lines, fmt.Sprintf("%s: %s %q (%s) in %s", job.ID, job.Cron, job.Text, job.Timezone, job.Channel))
+		}
+		if len(lines) == 0 {
+			irc.replyf(cmd, "nothing is scheduled")
+		}
+		for _, line := range lines {
+			irc.reply(cmd, line)
+		}
+	case "del":
+		if len(cmd.Args) != 2 {
+			irc.reply(cmd, irc.translate(cmd.Target, usage))
+			return
+		}
+		if strings.HasPrefix(cmd.Args[1], "config-") {
+			irc.replyf(cmd, "that one is in the config file")
+			return
+		}
+		if found, _ := irc.store.Get(schedulesBucket, cmd.Args[1], new(scheduledJob)); !found {
+			irc.replyf(cmd, "no schedule %s", cmd.Args[1])
+			return
+		}
+		if err := irc.store.Delete(schedulesBucket, cmd.Args[1]); err != nil {
+			irc.replyf(cmd, "couldn't delete: %v", err)
+			return
+		}
+		irc.replyf(cmd, "deleted")
+	default:
+		irc.reply(cmd, irc.translate(cmd.Target, usage))
+	}
+}
@@ -0,0 +1,219 @@
+package wutbot
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ergochat/irc-go/ircmsg"
+	"github.com/ergochat/irc-go/ircutils"
+)
+
+const (
+	scramMech = "SCRAM-SHA-256"
+)
+
+var errSCRAMServer = errors.New("invalid SCRAM message from server")
+
+// scramClient is one SCRAM-SHA-256 exchange (RFC 5802, RFC 7677).
+type scramClient struct {
+	user, password string
+	step           int
+	clientNonce    string
+	clientFirst    string // client-first-message-bare
+	serverSig      []byte
+}
+
+func newSCRAMClient(user, password string) *scramClient {
+	nonce := make([]byte, 18)
+	rand.Read(nonce)
+	return &scramClient{
+		user:        user,
+		password:    password,
+		clientNonce: base64.RawStdEncoding.EncodeToString(nonce),
+	}
+}
+
+// next returns our response to a server challenge, or done once the
+// server's signature has been verified.
+func (c *scramClient) next(challenge []byte) (response []byte, done bool, err error) {
+	c.step++
+	switch c.step {
+	case 1:
+		user := strings.NewReplacer("=", "=3D", ",", "=2C").Replace(c.user)
+		c.clientFirst = "n=" + user + ",r=" + c.clientNonce
+		return []byte("n,," + c.clientFirst), false, nil
+	case 2:
+		serverFirst := string(challenge)
+		attrs := scramAttributes(serverFirst)
+		nonce, salt64, iter64 := attrs["r"], attrs["s"], attrs["i"]
+		if !strings.HasPrefix(nonce, c.clientNonce) || len(nonce) == len(c.clientNonce) {
+			return nil, false, errSCRAMServer
+		}
+		salt, err := base64.StdEncoding.DecodeString(salt64)
+		if err != nil {
+			return nil, false, errSCRAMServer
+		}
+		iterations, err := strconv.Atoi(iter64)
+		if err != nil || iterations < 1 {
+			return nil, false, errSCRAMServer
+		}
+		salted := scramHi([]byte(c.password), salt, iterations)
+		clientKey := scramHMAC(salted, []byte("Client Key"))
+		storedKey := sha256.Sum256(clientKey)
+		// "biws" is base64("n,,"): no channel binding
+		clientFinal := "c=biws,r=" + nonce
+		authMessage := []byte(c.clientFirst + "," + serverFirst + "," + clientFinal)
+		proof := scramHMAC(storedKey[:], authMessage)
+		for i := range proof {
+			proof[i] ^= clientKey[i]
+		}
+		c.serverSig = scramHMAC(scramHMAC(salted, []byte("Server Key")), authMessage)
+		return []byte(clientFinal + ",p=" + base64.StdEncoding.EncodeToString(proof)), false, nil
+	case 3:
+		attrs := scramAttributes(string(challenge))
+		if e, ok := attrs["e"]; ok {
+			return nil, false, errors.New("SCRAM authentication failed: " + e)
+		}
+		sig, err := base64.StdEncoding.DecodeString(attrs["v"])
+		if err != nil || !hmac.Equal(sig, c.serverSig) {
+			return nil, false, errSCRAMServer
+		}
+		return nil, true, nil
+	}
+	return nil, false, errSCRAMServer
+}
+
+func scramAttributes(message string) map[string]string {
+	result := make(map[string]string)
+	for _, attr := range strings.Split(message, ",") {
+		if k, v, ok := strings.Cut(attr, "="); ok {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func scramHMAC(key, data []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// scramHi is PBKDF2 with HMAC-SHA-256, producing a single block.
+func scramHi(password, salt []byte, iterations int) []byte {
+	u := scramHMAC(password, append(append([]byte(nil), salt...), 0, 0, 0, 1))
+	result := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		u = scramHMAC(password, u)
+		for j := range result {
+			result[j] ^= u[j]
+		}
+	}
+	return result
+}
+
+// scramState is the exchange in progress on the current connection.
+type scramState struct {
+	sync.Mutex
+	client *scramClient
+	buf    ircutils.SASLBuffer
+}
+
+// dialWithSASLMech chooses each connection's mechanism as it's made, which
+// is the one point between ircevent's Connect validating its configuration
+// and it authenticating. ircevent only knows PLAIN and EXTERNAL, so for
+// SCRAM it's set back to PLAIN when the connection closes, so that the
+// next Connect doesn't refuse it.
+func (irc *Bot) dialWithSASLMech(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return conn, err
+		}
+		irc.sasl.Lock()
+		defer irc.sasl.Unlock()
+		mech := irc.chooseSASLMech()
+		irc.sasl.mech, irc.SASLMech = mech, mech
+		if mech != scramMech {
+			return conn, nil
+		}
+		irc.scram.Lock()
+		irc.scram.client = newSCRAMClient(irc.SASLLogin, irc.SASLPassword)
+		irc.scram.buf.Clear()
+		irc.scram.Unlock()
+		return &closeHookConn{Conn: conn, onClose: func() {
+			irc.sasl.Lock()
+			irc.SASLMech = "PLAIN"
+			irc.sasl.Unlock()
+		}}, nil
+	}
+}
+
+type closeHookConn struct {
+	net.Conn
+	once    sync.Once
+	onClose func()
+}
+
+func (c *closeHookConn) Close() error {
+	c.once.Do(c.onClose)
+	return c.Conn.Close()
+}
+
+// handleSCRAMAuthenticate answers the server's AUTHENTICATE challenges;
+// ircevent handles the numerics that end the exchange.
+func (irc *Bot) handleSCRAMAuthenticate(e ircmsg.Message) {
+	if irc.currentSASLMech() != scramMech || len(e.Params) == 0 {
+		return
+	}
+	irc.scram.Lock()
+	defer irc.scram.Unlock()
+	if irc.scram.client == nil {
+		return
+	}
+	var challenge []byte
+	if irc.scram.client.step != 0 {
+		done, output, err := irc.scram.buf.Add(e.Params[0])
+		if !done {
+			return
+		}
+		if err != nil {
+			irc.abortSCRAM(err)
+			return
+		}
+		challenge = output
+	}
+	response, done, err := irc.scram.client.next(challenge)
+	if err != nil {
+		irc.abortSCRAM(err)
+		return
+	}
+	if done {
+		irc.scram.client = nil
+		irc.Send("AUTHENTICATE", "+")
+		return
+	}
+	for _, line := range ircutils.EncodeSASLResponse(response) {
+		irc.Send("AUTHENTICATE", line)
+	}
+}
+
+// abortSCRAM gives up on an exchange that went wrong on our side, or
+// that the server got wrong. The server answers the abort with
+// ERR_SASLABORTED, which ircevent doesn't handle, so we end the
+// registration as it does on ERR_SASLFAIL. Call with the lock held.
+func (irc *Bot) abortSCRAM(err error) {
+	irc.logger("sasl").Error("SCRAM failed", "err", err)
+	irc.scram.client = nil
+	irc.Send("AUTHENTICATE", "*")
+	irc.SendRaw("CAP END")
+	irc.SendRaw("QUIT")
+}
@@ -0,0 +1,61 @@
+package wutbot
+
+import (
+	"testing"
+)
+
+// the example exchange in RFC 7677, section 3
+const (
+	rfc7677ServerFirst = "r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"
+	rfc7677ClientFinal = "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ="
+	rfc7677ServerFinal = "v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="
+)
+
+func newRFC7677Client() *scramClient {
+	c := newSCRAMClient("user", "pencil")
+	c.clientNonce = "rOprNGfwEbeRWgbNEkqO"
+	return c
+}
+
+func TestSCRAM(t *testing.T) {
+	c := newRFC7677Client()
+	steps := []struct{ challenge, response string }{
+		{"", "n,,n=user,r=rOprNGfwEbeRWgbNEkqO"},
+		{rfc7677ServerFirst, rfc7677ClientFinal},
+	}
+	for _, step := range steps {
+		response, done, err := c.next([]byte(step.challenge))
+		if err != nil || done {
+			t.Fatalf("%q: done %v, err %v", step.challenge, done, err)
+		}
+		if string(response) != step.response {
+			t.Fatalf("%q: got %q, want %q", step.challenge, response, step.response)
+		}
+	}
+	if _, done, err := c.next([]byte(rfc7677ServerFinal)); !done || err != nil {
+		t.Errorf("server-final: done %v, err %v", done, err)
+	}
+}
+
+func TestSCRAMRejectsTheServer(t *testing.T) {
+	tests := []struct{ name, serverFirst, serverFinal string }{
+		{"nonce isn't ours", "r=someoneelse,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096", ""},
+		{"nonce not extended", "r=rOprNGfwEbeRWgbNEkqO,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096", ""},
+		{"no iterations", "r=rOprNGfwEbeRWgbNEkqO%hvY,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=0", ""},
+		{"wrong signature", rfc7677ServerFirst, "v=AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="},
+		{"error", rfc7677ServerFirst, "e=invalid-proof"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newRFC7677Client()
+			c.next(nil)
+			_, _, err := c.next([]byte(tt.serverFirst))
+			if err == nil && tt.serverFinal != "" {
+				_, _, err = c.next([]byte(tt.serverFinal))
+			}
+			if err == nil {
+				t.Error("accepted")
+			}
+		})
+	}
+}
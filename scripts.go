@@ -0,0 +1,442 @@
+package wutbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/starlarkstruct"
+
+	"pratyush/wutbot/internal/commands"
+	"pratyush/wutbot/internal/fetch"
+)
+
+// Scripts are Starlark files (*.star) in the scripts directory, reloaded
+// when they change. At the top level, a script registers what it handles:
+//
+//	command(name, fn)   fn(msg, args) returns a reply: a string, a list of lines, or None
+//	on_message(fn)      fn(msg) for every channel message that isn't a command
+//	url(pattern, fn)    fn(url) returns the title of links matching the regex
+//
+// where msg has channel, nick, account and text. Scripts can't reach the
+// filesystem or network, except with these (a few times per call):
+//
+//	send(channel, text)   to a channel we're in
+//	http_get(url)         returns the body, from public addresses only
+//	kv_get(key), kv_set(key, value), kv_delete(key)   strings kept for the script
+
+const (
+	// followed by the script's file name
+	scriptKVBucket = "script:"
+
+	scriptCheckInterval = 5 * time.Second
+	scriptDeadline      = 10 * time.Second
+	maxScriptSteps      = 10_000_000
+	maxScriptFetches    = 3
+	maxScriptSends      = 5
+	maxScriptLines      = 5
+	maxScriptBodyBytes  = 1 << 20
+)
+
+var errScriptLimit = errors.New("limit reached")
+
+type scriptURLHandler struct {
+	pattern *regexp.Regexp
+	fn      starlark.Callable
+}
+
+type script struct {
+	name     string
+	modified time.Time
+	err      error // from the last attempt to load it
+	commands map[string]starlark.Callable
+	hooks    []starlark.Callable
+	urls     []scriptURLHandler
+}
+
+type scriptManager struct {
+	sync.RWMutex
+	dir     string
+	scripts map[string]*script // by file name
+}
+
+func newScriptManager(dir string) *scriptManager {
+	return &scriptManager{dir: dir, scripts: make(map[string]*script)}
+}
+
+func (m *scriptManager) list() (scripts []*script) {
+	m.RLock()
+	defer m.RUnlock()
+	for _, s := range m.scripts {
+		scripts = append(scripts, s)
+	}
+	sort.Slice(scripts, func(i, j int) bool { return scripts[i].name < scripts[j].name })
+	return
+}
+
+// watchScripts loads the scripts, then reloads any that change.
+func (irc *Bot) watchScripts() {
+	irc.safely("script reload", irc.reloadScripts)
+	ticker := time.NewTicker(scriptCheckInterval)
+	defer ticker.Stop()
+	for irc.tick(ticker) {
+		irc.safely("script reload", irc.reloadScripts)
+	}
+}
+
+func (irc *Bot) reloadScripts() {
+	m := irc.scripts
+	files, _ := filepath.Glob(filepath.Join(m.dir, "*.star"))
+	present := make(map[string]bool)
+	for _, path := range files {
+		name := filepath.Base(path)
+		present[name] = true
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		m.RLock()
+		old := m.scripts[name]
+		m.RUnlock()
+		if old != nil && old.modified.Equal(info.ModTime()) {
+			continue
+		}
+		s, err := irc.loadScript(path)
+		m.Lock()
+		if err != nil {
+			irc.logger("scripts").Error("couldn't load script", "script", name, "err", err)
+			// keep running the version that worked
+			failed := &script{name: name}
+			if old != nil {
+				*failed = *old
+			}
+			failed.modified, failed.err = info.ModTime(), err
+			m.scripts[name] = failed
+		} else {
+			irc.logger("scripts").Info("loaded script", "script", name)
+			s.modified = info.ModTime()
+			m.scripts[name] = s
+		}
+		m.Unlock()
+	}
+	m.Lock()
+	for name := range m.scripts {
+		if !present[name] {
+			irc.logger("scripts").Info("unloaded script", "script", name)
+			delete(m.scripts, name)
+		}
+	}
+	m.Unlock()
+}
+
+func (irc *Bot) loadScript(path string) (*script, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &script{name: filepath.Base(path), commands: make(map[string]starlark.Callable)}
+	loading := true
+	register := func(name string, f func(args starlark.Tuple, kwargs []starlark.Tuple) error) *starlark.Builtin {
+		return starlark.NewBuiltin(name, func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if !loading {
+				return nil, fmt.Errorf("%s: only at the top level of a script", name)
+			}
+			return starlark.None, f(args, kwargs)
+		})
+	}
+	predeclared := irc.scriptBuiltins(s.name)
+	predeclared["command"] = register("command", func(args starlark.Tuple, kwargs []starlark.Tuple) error {
+		var name string
+		var fn starlark.Callable
+		if err := starlark.UnpackArgs("command", args, kwargs, "name", &name, "fn", &fn); err != nil {
+			return err
+		}
+		s.commands[strings.ToLower(strings.TrimPrefix(name, commands.Prefix))] = fn
+		return nil
+	})
+	predeclared["on_message"] = register("on_message", func(args starlark.Tuple, kwargs []starlark.Tuple) error {
+		var fn starlark.Callable
+		if err := starlark.UnpackArgs("on_message", args, kwargs, "fn", &fn); err != nil {
+			return err
+		}
+		s.hooks = append(s.hooks, fn)
+		return nil
+	})
+	predeclared["url"] = register("url", func(args starlark.Tuple, kwargs []starlark.Tuple) error {
+		var pattern string
+		var fn starlark.Callable
+		if err := starlark.UnpackArgs("url", args, kwargs, "pattern", &pattern, "fn", &fn); err != nil {
+			return err
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		s.urls = append(s.urls, scriptURLHandler{pattern: re, fn: fn})
+		return nil
+	})
+	thread := irc.scriptThread(s.name)
+	thread.SetLocal("context", context.Background())
+	globals, err := starlark.ExecFile(thread, path, src, predeclared)
+	loading = false
+	if err != nil {
+		return nil, err
+	}
+	// the handlers are called concurrently, so nothing they share may change
+	globals.Freeze()
+	for _, fn := range s.commands {
+		fn.Freeze()
+	}
+	for _, fn := range s.hooks {
+		fn.Freeze()
+	}
+	for _, u := range s.urls {
+		u.fn.Freeze()
+	}
+	return s, nil
+}
+
+func (irc *Bot) scriptThread(name string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: name,
+		Print: func(thread *starlark.Thread, msg string) {
+			irc.logger("scripts").Info(msg, "script", name)
+		},
+	}
+	thread.SetMaxExecutionSteps(maxScriptSteps)
+	return thread
+}
+
+// callScript calls fn with limits on its running time and what it can do.
+func (irc *Bot) callScript(ctx context.Context, name string, fn starlark.Callable, args ...starlark.Value) (starlark.Value, error) {
+	thread := irc.scriptThread(name)
+	thread.SetLocal("context", ctx)
+	stop := context.AfterFunc(ctx, func() { thread.Cancel(ctx.Err().Error()) })
+	defer stop()
+	return starlark.Call(thread, fn, args, nil)
+}
+
+// scriptBuiltins is the API a script gets.
+func (irc *Bot) scriptBuiltins(name string) starlark.StringDict {
+	bucket := scriptKVBucket + name
+	// counts a thread's uses of something, failing past max
+	limit := func(thread *starlark.Thread, key string, max int) error {
+		n, _ := thread.Local(key).(int)
+		if n >= max {
+			return errScriptLimit
+		}
+		thread.SetLocal(key, n+1)
+		return nil
+	}
+	return starlark.StringDict{
+		"send": starlark.NewBuiltin("send", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var channel, text string
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "channel", &channel, "text", &text); err != nil {
+				return nil, err
+			}
+			if !irc.joined.Contains(channel) {
+				return nil, fmt.Errorf("send: not in %s", channel)
+			}
+			if err := limit(thread, "sends", maxScriptSends); err != nil {
+				return nil, fmt.Errorf("send: %w", err)
+			}
+			irc.Notice(channel, fetch.Sanitize(text))
+			return starlark.None, nil
+		}),
+		"http_get": starlark.NewBuiltin("http_get", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var rawURL string
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "url", &rawURL); err != nil {
+				return nil, err
+			}
+			if err := limit(thread, "fetches", maxScriptFetches); err != nil {
+				return nil, fmt.Errorf("http_get: %w", err)
+			}
+			ctx, _ := thread.Local("context").(context.Context)
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			body, err := irc.scriptGet(ctx, rawURL)
+			if err != nil {
+				return nil, fmt.Errorf("http_get: %w", err)
+			}
+			return starlark.String(body), nil
+		}),
+		"kv_get": starlark.NewBuiltin("kv_get", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var key string
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key); err != nil {
+				return nil, err
+			}
+			var value string
+			found, err := irc.store.Get(bucket, key, &value)
+			if err != nil {
+				return nil, fmt.Errorf("kv_get: %w", err)
+			}
+			if !found {
+				return starlark.None, nil
+			}
+			return starlark.String(value), nil
+		}),
+		"kv_set": starlark.NewBuiltin("kv_set", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var key, value string
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key, "value", &value); err != nil {
+				return nil, err
+			}
+			if err := irc.store.Put(bucket, key, value); err != nil {
+				return nil, fmt.Errorf("kv_set: %w", err)
+			}
+			return starlark.None, nil
+		}),
+		"kv_delete": starlark.NewBuiltin("kv_delete", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var key string
+			if err := starlark.UnpackArgs(b.Name(), args, kwargs, "key", &key); err != nil {
+				return nil, err
+			}
+			if err := irc.store.Delete(bucket, key); err != nil {
+				return nil, fmt.Errorf("kv_delete: %w", err)
+			}
+			return starlark.None, nil
+		}),
+	}
+}
+
+// scriptGet is http_get: like fetching a link, it can't reach private addresses.
+func (irc *Bot) scriptGet(ctx context.Context, rawURL string) (string, error) {
+	if !strings.HasPrefix(rawURL, "http://") && !strings.HasPrefix(rawURL, "https://") {
+		return "", errors.New("only http(s) URLs")
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := irc.fetcher.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", &fetch.StatusError{Code: resp.StatusCode, Status: resp.Status}
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxScriptBodyBytes))
+	return string(body), err
+}
+
+func scriptMessage(m Message) starlark.Value {
+	return starlarkstruct.FromStringDict(starlarkstruct.Default, starlark.StringDict{
+		"channel": starlark.String(m.Channel),
+		"nick":    starlark.String(m.Nick),
+		"account": starlark.String(m.Account),
+		"text":    starlark.String(m.Text),
+	})
+}
+
+// scriptLines converts what a command returned to the lines to reply with.
+func scriptLines(v starlark.Value) (lines []string) {
+	switch v := v.(type) {
+	case starlark.String:
+		lines = []string{string(v)}
+	case starlark.Indexable:
+		for i := 0; i < v.Len(); i++ {
+			if s, ok := starlark.AsString(v.Index(i)); ok {
+				lines = append(lines, s)
+			}
+		}
+	}
+	if len(lines) > maxScriptLines {
+		lines = lines[:maxScriptLines]
+	}
+	return
+}
+
+// handleScriptMessage is the Handler for scripts' commands and message hooks.
+func (irc *Bot) handleScriptMessage(ctx context.Context, bot *Bot, m Message) bool {
+	scripts := irc.scripts.list()
+	if name, args, ok := commands.Split(m.Text); ok {
+		for _, s := range scripts {
+			fn := s.commands[name]
+			if fn == nil {
+				continue
+			}
+			argList := make([]starlark.Value, len(args))
+			for i, arg := range args {
+				argList[i] = starlark.String(arg)
+			}
+			err := irc.workers.submit(ctx, m.Channel, "script "+s.name, scriptDeadline, func(ctx context.Context) {
+				result, err := irc.callScript(ctx, s.name, fn, scriptMessage(m), starlark.NewList(argList))
+				if err != nil {
+					irc.logger("scripts").Warn("script command failed", "script", s.name, "command", name, "err", err)
+					irc.Reply(m, fmt.Sprintf("%s failed", name))
+					return
+				}
+				for _, line := range scriptLines(result) {
+					if line = fetch.Sanitize(line); line != "" {
+						irc.Reply(m, line)
+					}
+				}
+			})
+			if err != nil {
+				irc.Reply(m, "too busy, try again later")
+			}
+			return true
+		}
+	}
+	for _, s := range scripts {
+		if len(s.hooks) == 0 {
+			continue
+		}
+		s := s
+		irc.workers.submit(ctx, m.Channel, "script "+s.name, scriptDeadline, func(ctx context.Context) {
+			for _, fn := range s.hooks {
+				if _, err := irc.callScript(ctx, s.name, fn, scriptMessage(m)); err != nil {
+					irc.logger("scripts").Warn("script hook failed", "script", s.name, "err", err)
+				}
+			}
+		})
+	}
+	return false
+}
+
+// scriptTitle gets a link's title from the first script with a matching
+// URL handler.
+func (irc *Bot) scriptTitle(ctx context.Context, u string) (title string, ok bool, err error) {
+	for _, s := range irc.scripts.list() {
+		for _, h := range s.urls {
+			if !h.pattern.MatchString(u) {
+				continue
+			}
+			result, err := irc.callScript(ctx, s.name, h.fn, starlark.String(u))
+			if err != nil {
+				return "", true, fmt.Errorf("script %s: %w", s.name, err)
+			}
+			title, _ := starlark.AsString(result)
+			return title, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+// handleScriptsCommand is the owner's "scripts", which lists the loaded
+// scripts and whether they loaded.
+func (irc *Bot) handleScriptsCommand(target string) {
+	scripts := irc.scripts.list()
+	if len(scripts) == 0 {
+		irc.Privmsg(target, fmt.Sprintf("no scripts in %s", irc.scripts.dir))
+		return
+	}
+	for _, s := range scripts {
+		status := fmt.Sprintf("%d commands, %d hooks, %d URL handlers", len(s.commands), len(s.hooks), len(s.urls))
+		if s.err != nil {
+			status += "; couldn't reload: " + s.err.Error()
+		}
+		irc.Privmsg(target, fmt.Sprintf("%s: %s", s.name, status))
+	}
+}
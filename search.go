@@ -0,0 +1,55 @@
+package wutbot
+
+import (
+	"context"
+	"net/url"
+	"strings"
+)
+
+// searchTitle titles search result links with what was searched for,
+// rather than the results page's title.
+func searchTitle(_ context.Context, _ *Bot, u *url.URL) (string, bool, error) {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	query := u.Query()
+	var engine, q string
+	switch {
+	case isGoogleHost(host) && u.Path == "/search":
+		engine, q = "Google", query.Get("q")
+		switch query.Get("tbm") {
+		case "isch":
+			engine = "Google Images"
+		case "vid":
+			engine = "Google Videos"
+		case "nws":
+			engine = "Google News"
+		}
+	case (host == "duckduckgo.com" || host == "html.duckduckgo.com" || host == "lite.duckduckgo.com") && (u.Path == "" || u.Path == "/" || u.Path == "/html" || u.Path == "/html/" || u.Path == "/lite" || u.Path == "/lite/"):
+		engine, q = "DuckDuckGo", query.Get("q")
+	case (host == "youtube.com" || host == "m.youtube.com") && u.Path == "/results":
+		engine, q = "YouTube", query.Get("search_query")
+	case host == "bing.com" && u.Path == "/search":
+		engine, q = "Bing", query.Get("q")
+	default:
+		return "", false, nil
+	}
+	if q = strings.TrimSpace(q); q == "" {
+		// the engine's home page, or something else on it
+		return "", false, nil
+	}
+	return engine + " search: " + q, true, nil
+}
+
+// isGoogleHost is whether host is google.com or a country's Google, like
+// google.co.uk.
+func isGoogleHost(host string) bool {
+	name, tld, ok := strings.Cut(host, ".")
+	if !ok || name != "google" {
+		return false
+	}
+	for _, label := range strings.Split(tld, ".") {
+		if len(label) < 2 || len(label) > 3 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package wutbot
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"pratyush/wutbot/internal/secrets"
+)
+
+const (
+	// the OS keyring service our secrets are kept under
+	keyringService = "wutbot"
+	secretsTimeout = 30 * time.Second
+)
+
+// secretsResolver resolves "vault:<path>#<field>" references, given VAULT_ADDR
+// and VAULT_TOKEN, and "keyring:<name>" ones.
+func secretsResolver() (secrets.Resolver, error) {
+	resolver := secrets.Resolver{"vault": nil, "keyring": secrets.Keyring{Service: keyringService}}
+	vault, err := secrets.VaultFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	if vault != nil {
+		resolver["vault"] = vault
+	}
+	return resolver, nil
+}
+
+// resolveSecrets replaces any credentials in config that are references
+// to a secrets store with the secrets.
+func resolveSecrets(config *Config) error {
+	credentials := map[string]*string{
+		"WUTBOT_SASL_PASSWORD":        &config.SASLPassword,
+		"WUTBOT_NICKSERV_PASSWORD":    &config.NickServPassword,
+		"WUTBOT_WEBIRC_PASSWORD":      &config.WebIRCPassword,
+		"WUTBOT_DASHBOARD_PASSWORD":   &config.DashboardPassword,
+		"WUTBOT_GITHUB_SECRET":        &config.GitHubSecret,
+		"WUTBOT_SENTRY_DSN":           &config.SentryDSN,
+		"WUTBOT_ERROR_WEBHOOK":        &config.ErrorWebhook,
+		"WUTBOT_TWITTER_BEARER_TOKEN": &config.TwitterBearerToken,
+		"WUTBOT_GITHUB_TOKEN":         &config.GitHubToken,
+		"WUTBOT_OMDB_API_KEY":         &config.OMDBAPIKey,
+		"WUTBOT_TMDB_API_KEY":         &config.TMDBAPIKey,
+		"WUTBOT_DISCORD_TOKEN":        &config.DiscordToken,
+		"WUTBOT_LLM_API_KEY":          &config.LLMAPIKey,
+		"WUTBOT_MATRIX_ACCESS_TOKEN":  &config.MatrixAccessToken,
+		"WUTBOT_XMPP_PASSWORD":        &config.XMPPPassword,
+	}
+	var resolver secrets.Resolver
+	ctx, cancel := context.WithTimeout(context.Background(), secretsTimeout)
+	defer cancel()
+	for name, value := range credentials {
+		if !strings.HasPrefix(*value, "vault:") && !strings.HasPrefix(*value, "keyring:") {
+			continue
+		}
+		if resolver == nil {
+			var err error
+			if resolver, err = secretsResolver(); err != nil {
+				return err
+			}
+		}
+		secret, err := resolver.Resolve(ctx, *value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		*value = secret
+	}
+	return nil
+}
+
+// secretCommand is "wutbot secret <name>", which saves a secret read from
+// standard input in the OS keyring, for use as "keyring:<name>".
+func secretCommand(args []string) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: wutbot secret <name> < secret")
+		os.Exit(2)
+	}
+	secret, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	if secret = strings.TrimRight(secret, "\r\n"); secret == "" {
+		log.Fatal("No secret given")
+	}
+	if err := (secrets.Keyring{Service: keyringService}).Set(args[0], secret); err != nil {
+		log.Fatalf("Couldn't save the secret: %v", err)
+	}
+	fmt.Printf("saved; use keyring:%s\n", args[0])
+}
@@ -0,0 +1,107 @@
+package wutbot
+
+import (
+	"strings"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"pratyush/wutbot/internal/bot"
+)
+
+// handleRateLimitISupport reconfigures the send queue for the flood limit
+// in an RPL_ISUPPORT, if it has one.
+func (irc *Bot) handleRateLimitISupport(e ircmsg.Message) {
+	if len(e.Params) < 3 {
+		return
+	}
+	// the nick, then the tokens, then "are supported by this server"
+	for _, token := range e.Params[1 : len(e.Params)-1] {
+		name, value, _ := strings.Cut(token, "=")
+		negated := strings.HasPrefix(name, "-")
+		name = strings.TrimPrefix(name, "-")
+		for _, known := range bot.RateLimitTokens {
+			if !strings.EqualFold(name, known) {
+				continue
+			}
+			if negated {
+				irc.sendQueue.SetServerRate(0, 0)
+			} else if burst, interval, ok := bot.ParseRateLimit(value); ok {
+				irc.sendQueue.SetServerRate(burst, interval)
+			} else {
+				irc.logger("sendqueue").Warn("ignoring the server's rate limit", "token", token)
+			}
+		}
+	}
+}
+
+// runSendQueue sends everything queued, paced, labelling what it can.
+func (irc *Bot) runSendQueue() {
+	irc.sendQueue.Run(bot.SenderFunc(irc.sendTracked), irc.logger("sendqueue"))
+}
+
+func (irc *Bot) queueMessage(tags map[string]string, command string, params ...string) (err error) {
+	if len(params) != 0 {
+		if roomID, isRoom := irc.matrix.RoomID(params[0]); isRoom {
+			return irc.queueMatrixMessage(roomID, tags, command, params)
+		}
+		if irc.xmpp.IsOwner(params[0]) {
+			return irc.queueXMPPMessage(command, params)
+		}
+	}
+	if command == "PRIVMSG" || command == "NOTICE" || command == "TAGMSG" {
+		if len(params) != 0 && irc.isChannel(params[0]) && !irc.chanModes.canSpeak(params[0]) {
+			irc.logger("sendqueue").Info("not sending", "target", params[0], "err", errMuted)
+			return errMuted
+		}
+	}
+	var units [][]ircmsg.Message
+	if (command == "PRIVMSG" || command == "NOTICE") && len(params) == 2 {
+		target, text := params[0], irc.outgoingText(params[1])
+		var batch []ircmsg.Message
+		maxBytes := bot.MaxMessageBytes(irc.CurrentNick(), command, target)
+		if len(text) > maxBytes {
+			// leave room for the space that's restored on concatenation
+			batch = irc.multilineBatch(tags, command, target, bot.SplitMessage(text, maxBytes-1))
+		}
+		if batch != nil {
+			units = append(units, batch)
+		} else {
+			for _, line := range bot.SplitForSending(text, maxBytes) {
+				units = append(units, []ircmsg.Message{ircmsg.MakeMessage(tags, "", command, target, line)})
+			}
+		}
+	} else {
+		units = append(units, []ircmsg.Message{ircmsg.MakeMessage(tags, "", command, params...)})
+	}
+	for _, unit := range units {
+		if err = irc.sendQueue.Enqueue(unit); err != nil {
+			irc.logger("sendqueue").Warn("dropping message", "err", err)
+			return
+		}
+	}
+	return
+}
+
+// Privmsg, Notice and SendWithTags shadow the ircevent methods so that
+// everything the bot says goes through the send queue.
+
+func (irc *Bot) Privmsg(target, message string) error {
+	return irc.queueMessage(nil, "PRIVMSG", target, message)
+}
+
+// Notice sends a PRIVMSG instead to channels configured that way.
+func (irc *Bot) Notice(target, message string) error {
+	return irc.queueMessage(nil, irc.noticeCommand(target), target, message)
+}
+
+// noticeCommand is what we send NOTICEs to target as.
+func (irc *Bot) noticeCommand(target string) string {
+	if irc.isChannel(target) && channelOption(irc.getConfig(), target, func(c ChannelConfig) *string { return c.Messages }) == "privmsg" {
+		return "PRIVMSG"
+	}
+	return "NOTICE"
+}
+
+func (irc *Bot) SendWithTags(tags map[string]string, command string, params ...string) error {
+	return irc.queueMessage(tags, command, params...)
+}
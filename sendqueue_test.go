@@ -0,0 +1,47 @@
+package wutbot
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+
+	"pratyush/wutbot/internal/bot"
+)
+
+func TestServerRateLimit(t *testing.T) {
+	isupport := func(tokens ...string) ircmsg.Message {
+		params := append(append([]string{"wutbot"}, tokens...), "are supported by this server")
+		return ircmsg.MakeMessage(nil, "irc.example.com", "005", params...)
+	}
+	tests := []struct {
+		name           string
+		configBurst    int
+		configInterval time.Duration
+		tokens         []string
+		burst          int
+		interval       time.Duration
+	}{
+		{"no hint", 0, 0, []string{"CHANTYPES=#"}, bot.DefaultFloodBurst, bot.DefaultFloodInterval},
+		{"hint", 0, 0, []string{"RATELIMIT=10/5"}, 10, 500 * time.Millisecond},
+		{"draft hint", 0, 0, []string{"draft/RATELIMIT=3/9"}, 3, 3 * time.Second},
+		{"bad hint", 0, 0, []string{"RATELIMIT=lots"}, bot.DefaultFloodBurst, bot.DefaultFloodInterval},
+		{"negated", 0, 0, []string{"RATELIMIT=10/5", "-RATELIMIT"}, bot.DefaultFloodBurst, bot.DefaultFloodInterval},
+		{"configured", 2, time.Second, []string{"RATELIMIT=10/5"}, 2, time.Second},
+		{"configured burst", 2, 0, []string{"RATELIMIT=10/5"}, 2, 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			irc := &Bot{
+				sendQueue:  bot.NewSendQueue(tt.configBurst, tt.configInterval),
+				baseLogger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			irc.handleRateLimitISupport(isupport(tt.tokens...))
+			if burst, interval := irc.sendQueue.Rate(); burst != tt.burst || interval != tt.interval {
+				t.Errorf("got %d every %v, want %d every %v", burst, interval, tt.burst, tt.interval)
+			}
+		})
+	}
+}
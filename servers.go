@@ -0,0 +1,136 @@
+package wutbot
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+
+	"pratyush/wutbot/internal/netdial"
+)
+
+const (
+	stateBucket        = "state"
+	lastServerStateKey = "last-server"
+)
+
+// serverRotation is the list of configured server endpoints; on connection
+// failure we move on to the next one.
+type serverRotation struct {
+	sync.Mutex
+	servers []string // host:port
+	current int
+	// the resolved address that last worked, tried first next time
+	lastAddr string
+	// what we actually dialed most recently (the port may differ due to STS)
+	dialedHost, dialedPort string
+}
+
+type lastServer struct {
+	Server  string `json:"server"`
+	Address string `json:"address"`
+}
+
+func newServerRotation(servers string, last lastServer) *serverRotation {
+	r := new(serverRotation)
+	for _, server := range strings.Split(servers, ",") {
+		if server = strings.TrimSpace(server); server != "" {
+			r.servers = append(r.servers, server)
+		}
+	}
+	for i, server := range r.servers {
+		if server == last.Server {
+			r.current = i
+			r.lastAddr = last.Address
+		}
+	}
+	return r
+}
+
+func (r *serverRotation) Current() string {
+	r.Lock()
+	defer r.Unlock()
+	if len(r.servers) == 0 {
+		return ""
+	}
+	return r.servers[r.current]
+}
+
+func (r *serverRotation) Advance() {
+	r.Lock()
+	defer r.Unlock()
+	if len(r.servers) != 0 {
+		r.current = (r.current + 1) % len(r.servers)
+		r.lastAddr = ""
+	}
+}
+
+func (r *serverRotation) Last() lastServer {
+	r.Lock()
+	defer r.Unlock()
+	return lastServer{Server: r.servers[r.current], Address: r.lastAddr}
+}
+
+func (r *serverRotation) CurrentHostPort() (host, port string) {
+	r.Lock()
+	defer r.Unlock()
+	return r.dialedHost, r.dialedPort
+}
+
+func (r *serverRotation) setDialed(host, port string) {
+	r.Lock()
+	r.dialedHost, r.dialedPort = host, port
+	r.Unlock()
+}
+
+func (r *serverRotation) setLastAddr(addr string) {
+	r.Lock()
+	r.lastAddr = addr
+	r.Unlock()
+}
+
+// dialRotation dials the current server, trying each address it resolves
+// to (starting with the one that last worked).
+func (irc *Bot) dialRotation(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, _ string) (net.Conn, error) {
+		server := irc.servers.Current()
+		host, port, err := net.SplitHostPort(server)
+		if err != nil {
+			return nil, err
+		}
+		// ircevent checks UseTLS after we return the connection
+		port, irc.UseTLS = irc.stsTarget(host, port)
+		irc.servers.setDialed(host, port)
+		// ircevent set ServerName from the first server it saw; keep it in sync
+		if irc.TLSConfig != nil && (!irc.TLSConfig.InsecureSkipVerify || irc.TLSConfig.VerifyConnection != nil) {
+			irc.TLSConfig.ServerName = host
+		}
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		ips := make([]net.IP, len(addrs))
+		for i, addr := range addrs {
+			ips[i] = addr.IP
+		}
+		ips = irc.ipPreference.Sort(ips)
+		// the address that worked last time goes first, whatever the preference
+		last := irc.servers.Last().Address
+		for i, ip := range ips {
+			if ip.String() == last {
+				copy(ips[1:i+1], ips[:i])
+				ips[0] = ip
+			}
+		}
+		conn, ip, err := irc.ipPreference.Dial(ctx, dial, network, ips, port)
+		if err != nil {
+			if errors.Is(err, netdial.ErrNoAddresses) {
+				err = errors.New("no addresses found for " + host)
+			}
+			return nil, err
+		}
+		irc.servers.setLastAddr(ip.String())
+		return conn, nil
+	}
+}
@@ -0,0 +1,129 @@
+package wutbot
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+const (
+	// how long to wait for shutdown before exiting regardless
+	shutdownTimeout = 10 * time.Second
+	// of that, how long the send queue gets to drain
+	sendQueueDrainTimeout = 5 * time.Second
+)
+
+// shutdownState cancels in-flight work when we're asked to stop, and makes
+// sure the state is saved exactly once, however we stop.
+type shutdownState struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	saved  sync.Once
+
+	// a child of ctx for the current connection, cancelled when it's lost
+	connMutex  sync.Mutex
+	conn       context.Context
+	connCancel context.CancelFunc
+}
+
+func newShutdownState() *shutdownState {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &shutdownState{ctx: ctx, cancel: cancel}
+	s.conn, s.connCancel = context.WithCancel(ctx)
+	return s
+}
+
+// connectionContext is for work that's pointless once we've disconnected,
+// such as answering a message: it's cancelled then, or when shutting down.
+func (irc *Bot) connectionContext() context.Context {
+	s := irc.stopping
+	s.connMutex.Lock()
+	defer s.connMutex.Unlock()
+	return s.conn
+}
+
+// tick waits for a ticker's next tick, returning false if we start
+// shutting down first.
+func (irc *Bot) tick(ticker *time.Ticker) bool {
+	select {
+	case <-ticker.C:
+		return true
+	case <-irc.stopping.ctx.Done():
+		return false
+	}
+}
+
+func (irc *Bot) watchConnectionContext() {
+	s := irc.stopping
+	irc.AddConnectCallback(func(e ircmsg.Message) {
+		s.connMutex.Lock()
+		defer s.connMutex.Unlock()
+		if s.conn.Err() != nil {
+			s.conn, s.connCancel = context.WithCancel(s.ctx)
+		}
+	})
+	irc.AddDisconnectCallback(func(e ircmsg.Message) {
+		s.connMutex.Lock()
+		defer s.connMutex.Unlock()
+		s.connCancel()
+	})
+}
+
+// handleSignals shuts down on SIGINT or SIGTERM; a second signal exits
+// straightaway.
+func (irc *Bot) handleSignals() {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals
+	irc.logger("main").Info("shutting down", "signal", sig.String())
+	go func() {
+		select {
+		case <-signals:
+		case <-time.After(shutdownTimeout):
+			irc.logger("main").Warn("shutdown timed out")
+		}
+		irc.saveState()
+		os.Exit(1)
+	}()
+	irc.shutdown("shutting down (" + sig.String() + ")")
+}
+
+// shutdown cancels fetches, gives the send queue a chance to drain and
+// QUITs; Loop returns once the connection closes.
+func (irc *Bot) shutdown(reason string) {
+	irc.stopping.cancel()
+	sdNotify("STOPPING=1")
+	if irc.Connected() {
+		irc.sendQueue.Wait(sendQueueDrainTimeout)
+	}
+	irc.QuitMessage = reason
+	irc.Quit()
+	// if the server doesn't close the connection (or we were between
+	// reconnects), close it ourselves
+	time.AfterFunc(shutdownTimeout-sendQueueDrainTimeout, irc.Reconnect)
+	if !irc.Connected() {
+		irc.Reconnect()
+	}
+}
+
+// saveState flushes everything kept in memory and closes the store.
+func (irc *Bot) saveState() {
+	irc.stopping.saved.Do(func() {
+		if err := irc.markov.flush(); err != nil {
+			irc.logger("markov").Error("couldn't save markov models", "err", err)
+		}
+		irc.chanLog.close()
+		if err := irc.stats.flush(); err != nil {
+			irc.logger("stats").Error("couldn't save stats", "err", err)
+		}
+		if err := irc.store.Close(); err != nil {
+			irc.logger("main").Error("couldn't close the store", "err", err)
+		}
+		irc.stopTracing()
+	})
+}
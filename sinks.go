@@ -0,0 +1,87 @@
+package wutbot
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Alert kinds, as given in a sink's "alerts", alone or as "<kind>:<name>"
+// for one webhook route, repository, feed URL or followed account.
+const (
+	alertFeed    = "feed"
+	alertRelease = "release"
+	alertFollow  = "follow"
+	alertWebhook = "webhook"
+	alertGitHub  = "github"
+	alertOwner   = "owner"
+)
+
+var alertKinds = []string{alertFeed, alertRelease, alertFollow, alertWebhook, alertGitHub, alertOwner}
+
+// slackEscaper escapes what Slack would otherwise take for formatting, like
+// <!channel> or a <url|label> link.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func validateSinks(sinks map[string]SinkConfig) error {
+	for name, sink := range sinks {
+		if sink.URL == "" {
+			return fmt.Errorf("sink %s needs a URL", name)
+		}
+		for _, alert := range sink.Alerts {
+			kind, _, _ := strings.Cut(alert, ":")
+			known := false
+			for _, k := range alertKinds {
+				known = known || k == kind
+			}
+			if !known {
+				return fmt.Errorf("sink %s: unknown alert %s", name, alert)
+			}
+		}
+	}
+	return nil
+}
+
+func (sink *SinkConfig) wants(kind, name, channel string) bool {
+	if channel != "" && len(sink.Channels) != 0 {
+		found := false
+		for _, c := range sink.Channels {
+			found = found || strings.EqualFold(c, channel)
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, alert := range sink.Alerts {
+		if alert == kind || (name != "" && strings.EqualFold(alert, kind+":"+name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// alert posts what we announced (or sent the owner) to the Slack or
+// Mattermost incoming webhooks that want it.
+func (irc *Bot) alert(kind, name, channel string, lines ...string) {
+	if len(lines) == 0 {
+		return
+	}
+	for sinkName, sink := range irc.getConfig().Sinks {
+		if !sink.wants(kind, name, channel) {
+			continue
+		}
+		text := strings.Join(lines, "\n")
+		if channel != "" {
+			text = "[" + channel + "] " + text
+		}
+		body := map[string]string{"text": slackEscaper.Replace(text)}
+		if sink.Username != "" {
+			body["username"] = sink.Username
+		}
+		go func(sinkName, url string) {
+			defer irc.recoverPanic("sink " + sinkName)
+			if err := irc.postJSON(url, nil, body); err != nil {
+				irc.logger("sinks").Warn("couldn't post alert", "sink", sinkName, "kind", kind, "err", err)
+			}
+		}(sinkName, sink.URL)
+	}
+}
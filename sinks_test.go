@@ -0,0 +1,35 @@
+package wutbot
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestAlertEscapesForSlack(t *testing.T) {
+	texts := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		texts <- body["text"]
+	}))
+	defer server.Close()
+	irc := &Bot{
+		config:     &FileConfig{Sinks: map[string]SinkConfig{"slack": {URL: server.URL, Alerts: []string{alertFeed}}}},
+		httpClient: server.Client(),
+		baseLogger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	irc.alert(alertFeed, "https://example.com/feed", "#chan", "Q&A: <!channel> and <https://example.com|this>")
+	select {
+	case text := <-texts:
+		if want := "[#chan] Q&amp;A: &lt;!channel&gt; and &lt;https://example.com|this&gt;"; text != want {
+			t.Errorf("posted %q, want %q", text, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was posted")
+	}
+}
@@ -0,0 +1,221 @@
+package wutbot
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"pratyush/wutbot/internal/commands"
+	"pratyush/wutbot/internal/fetch"
+	"pratyush/wutbot/internal/storage"
+)
+
+const (
+	// per-account counters, keyed by account; the channel's totals are under "*"
+	statsBucket     = "stats:"
+	statsTotalKey   = "*"
+	statsSaveEvery  = time.Minute
+	statsTopCommand = 3
+)
+
+type userStats struct {
+	Messages int            `json:"messages"`
+	Links    int            `json:"links"`
+	Commands map[string]int `json:"commands,omitempty"`
+
+	dirty bool
+}
+
+func (u *userStats) commandCount() (n int) {
+	for _, count := range u.Commands {
+		n += count
+	}
+	return
+}
+
+// statsTracker counts messages, links and commands per channel and account,
+// saving them periodically.
+type statsTracker struct {
+	sync.Mutex
+	store    storage.Store
+	channels map[string]map[string]*userStats // casefolded channel -> account, loaded lazily
+}
+
+func newStatsTracker(store storage.Store) *statsTracker {
+	return &statsTracker{store: store, channels: make(map[string]map[string]*userStats)}
+}
+
+// channel returns a channel's counters, loading them if necessary. Call
+// with the lock held.
+func (st *statsTracker) channel(channel string) map[string]*userStats {
+	key := strings.ToLower(channel)
+	if users, ok := st.channels[key]; ok {
+		return users
+	}
+	accounts, err := st.store.Keys(statsBucket + key)
+	if err != nil {
+		// counted, but not kept or saved over the stored counts; they're
+		// loaded again next time
+		return make(map[string]*userStats)
+	}
+	users := make(map[string]*userStats)
+	for _, account := range accounts {
+		u := new(userStats)
+		if found, err := st.store.Get(statsBucket+key, account, u); found && err == nil {
+			users[account] = u
+		}
+	}
+	st.channels[key] = users
+	return users
+}
+
+// update applies f to the channel's totals, and the account's if there is one.
+func (st *statsTracker) update(channel, account string, f func(*userStats)) {
+	st.Lock()
+	defer st.Unlock()
+	users := st.channel(channel)
+	for _, key := range []string{statsTotalKey, account} {
+		if key == "" {
+			continue
+		}
+		u := users[key]
+		if u == nil {
+			u = new(userStats)
+			users[key] = u
+		}
+		f(u)
+		u.dirty = true
+	}
+}
+
+// recordMessageStats counts a channel message, and the command it was.
+func (irc *Bot) recordMessageStats(m messageEvent) {
+	irc.stats.recordMessage(m.channel, m.account, len(fetch.ExtractURLs(m.text)))
+	if m.command != "" {
+		irc.stats.recordCommand(m.channel, m.account, m.command)
+	}
+}
+
+func (st *statsTracker) recordMessage(channel, account string, links int) {
+	st.update(channel, account, func(u *userStats) {
+		u.Messages++
+		u.Links += links
+	})
+}
+
+func (st *statsTracker) recordCommand(channel, account, name string) {
+	st.update(channel, account, func(u *userStats) {
+		if u.Commands == nil {
+			u.Commands = make(map[string]int)
+		}
+		u.Commands[name]++
+	})
+}
+
+// get returns a copy of the counters, or nil if there are none.
+func (st *statsTracker) get(channel, account string) *userStats {
+	st.Lock()
+	defer st.Unlock()
+	u := st.channel(channel)[account]
+	if u == nil {
+		return nil
+	}
+	result := *u
+	result.Commands = make(map[string]int, len(u.Commands))
+	for name, count := range u.Commands {
+		result.Commands[name] = count
+	}
+	return &result
+}
+
+// each calls f with every account's counters in a channel (not the totals).
+func (st *statsTracker) each(channel string, f func(account string, u *userStats)) {
+	st.Lock()
+	defer st.Unlock()
+	for account, u := range st.channel(channel) {
+		if account != statsTotalKey {
+			f(account, u)
+		}
+	}
+}
+
+// flush saves every changed counter.
+func (st *statsTracker) flush() (err error) {
+	st.Lock()
+	defer st.Unlock()
+	for channel, users := range st.channels {
+		for account, u := range users {
+			if !u.dirty {
+				continue
+			}
+			if putErr := st.store.Put(statsBucket+channel, account, u); putErr != nil {
+				err = putErr
+			} else {
+				u.dirty = false
+			}
+		}
+	}
+	return
+}
+
+func (irc *Bot) saveStats() {
+	ticker := time.NewTicker(statsSaveEvery)
+	defer ticker.Stop()
+	for irc.tick(ticker) {
+		if err := irc.stats.flush(); err != nil {
+			irc.logger("stats").Error("couldn't save stats", "err", err)
+		}
+	}
+}
+
+func formatUserStats(u *userStats) string {
+	text := fmt.Sprintf("%d messages, %d links, %d commands", u.Messages, u.Links, u.commandCount())
+	type entry struct {
+		name  string
+		count int
+	}
+	var top []entry
+	for name, count := range u.Commands {
+		top = append(top, entry{name, count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		return top[i].count > top[j].count || (top[i].count == top[j].count && top[i].name < top[j].name)
+	})
+	if len(top) > statsTopCommand {
+		top = top[:statsTopCommand]
+	}
+	var names []string
+	for _, e := range top {
+		names = append(names, fmt.Sprintf("!%s %d", e.name, e.count))
+	}
+	if len(names) != 0 {
+		text += " (" + strings.Join(names, ", ") + ")"
+	}
+	return text
+}
+
+// handleStatsCommand is "!stats [<account>]": the channel's counters, and
+// those of the account (the sender's by default).
+func (irc *Bot) handleStatsCommand(cmd commands.Command) {
+	account := cmd.Account
+	if len(cmd.Args) != 0 {
+		account = cmd.Args[0]
+	}
+	if len(cmd.Args) == 0 || account == "" {
+		if total := irc.stats.get(cmd.Target, statsTotalKey); total != nil {
+			irc.replyf(cmd, "%s: %s", cmd.Target, formatUserStats(total))
+		} else {
+			irc.replyf(cmd, "no stats yet")
+		}
+	}
+	if account == "" {
+		return
+	}
+	if u := irc.stats.get(cmd.Target, account); u != nil {
+		irc.replyf(cmd, "%s: %s", account, formatUserStats(u))
+	} else if len(cmd.Args) != 0 {
+		irc.replyf(cmd, "no stats for %s", account)
+	}
+}
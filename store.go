@@ -0,0 +1,17 @@
+package wutbot
+
+import (
+	"os"
+)
+
+// storeSettings reads where the persistent state is kept from the environment.
+func storeSettings() (dataDir, backend, location string) {
+	// persistent state (trivia scores etc.) is kept here:
+	dataDir = os.Getenv("WUTBOT_DATA_DIR")
+	if dataDir == "" {
+		dataDir = "data"
+	}
+	// where to keep it: sqlite (the default) or bolt, in the data directory unless
+	// WUTBOT_STORE_URL gives another path, or redis, with a redis:// WUTBOT_STORE_URL
+	return dataDir, os.Getenv("WUTBOT_STORE"), os.Getenv("WUTBOT_STORE_URL")
+}
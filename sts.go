@@ -0,0 +1,105 @@
+package wutbot
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+const (
+	stsBucket = "sts"
+)
+
+// stsPolicy is a server's promise to keep offering TLS on Port until Expires.
+type stsPolicy struct {
+	Port    string    `json:"port"`
+	Expires time.Time `json:"expires"`
+}
+
+type stsState struct {
+	sync.Mutex
+	// upgrades advertised over plaintext, keyed by host; these are
+	// only trusted once we've connected securely
+	upgrades  map[string]string
+	plaintext bool // the configuration asked for plaintext
+}
+
+// advertisedCap returns the value of a capability offered in CAP LS or NEW.
+func advertisedCap(e ircmsg.Message, capName string) (value string, found bool) {
+	if len(e.Params) < 3 || (e.Params[1] != "LS" && e.Params[1] != "NEW") {
+		return
+	}
+	for _, token := range strings.Fields(e.Params[len(e.Params)-1]) {
+		if name, v, _ := strings.Cut(token, "="); name == capName {
+			return v, true
+		}
+	}
+	return
+}
+
+// stsTarget returns the port to connect to host on, and whether to use TLS,
+// taking any STS policy or pending upgrade into account.
+func (irc *Bot) stsTarget(host, port string) (string, bool) {
+	var policy stsPolicy
+	if found, err := irc.store.Get(stsBucket, strings.ToLower(host), &policy); found && err == nil && time.Now().Before(policy.Expires) {
+		// refuse to downgrade while the policy lasts
+		return policy.Port, true
+	}
+	irc.sts.Lock()
+	defer irc.sts.Unlock()
+	if upgradePort, ok := irc.sts.upgrades[strings.ToLower(host)]; ok {
+		return upgradePort, true
+	}
+	return port, !irc.sts.plaintext
+}
+
+// handleSTSAdvertisement looks for the sts cap in CAP LS/NEW.
+func (irc *Bot) handleSTSAdvertisement(e ircmsg.Message) {
+	value, found := advertisedCap(e, "sts")
+	if !found {
+		return
+	}
+	params := make(map[string]string)
+	for _, param := range strings.Split(value, ",") {
+		k, v, _ := strings.Cut(param, "=")
+		params[k] = v
+	}
+
+	host, port := irc.servers.CurrentHostPort()
+	host = strings.ToLower(host)
+	if !irc.UseTLS {
+		// plaintext: the only thing to do is upgrade to the advertised port
+		if upgradePort := params["port"]; upgradePort != "" {
+			irc.logger("sts").Info("server advertised STS, reconnecting with TLS", "host", host, "port", upgradePort)
+			irc.sts.Lock()
+			irc.sts.upgrades[host] = upgradePort
+			irc.sts.Unlock()
+			// this isn't a failure, so don't back off or move to the next server
+			atomic.StoreInt32(&irc.connectAttempts, 0)
+			irc.Reconnect()
+		}
+		return
+	}
+	duration, err := strconv.Atoi(params["duration"])
+	if err != nil {
+		return
+	}
+	irc.sts.Lock()
+	delete(irc.sts.upgrades, host)
+	irc.sts.Unlock()
+	if duration == 0 {
+		err = irc.store.Delete(stsBucket, host)
+	} else {
+		err = irc.store.Put(stsBucket, host, stsPolicy{
+			Port:    port,
+			Expires: time.Now().Add(time.Duration(duration) * time.Second),
+		})
+	}
+	if err != nil {
+		irc.logger("sts").Error("couldn't save STS policy", "err", err)
+	}
+}
@@ -0,0 +1,88 @@
+package wutbot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"pratyush/wutbot/internal/commands"
+	"pratyush/wutbot/internal/fetch"
+)
+
+const (
+	summarizeLimit  = 3
+	summarizeWindow = 10 * time.Minute
+	// give up on a summary that hasn't started by then
+	summarizeDeadline = 2 * time.Minute
+
+	// how much article text we send, and how much summary we accept back
+	maxSummaryInputRunes = 12000
+	maxSummaryTokens     = 120
+	maxSummaryRunes      = 350
+
+	summarizePrompt = "Summarize the following article in one or two plain sentences. Reply with the summary only."
+)
+
+func (irc *Bot) handleSummarizeCommand(cmd commands.Command) {
+	if len(cmd.Args) != 1 {
+		irc.replyf(cmd, "usage: !summarize <url>")
+		return
+	}
+	if irc.llm == nil {
+		irc.replyf(cmd, "summaries aren't enabled")
+		return
+	}
+	if !irc.summarizeLimiter.allow(cmd.Target) {
+		irc.replyf(cmd, "slow down, too many summaries in this channel")
+		return
+	}
+	err := irc.workers.submit(irc.connectionContext(), cmd.Target, "summarize", summarizeDeadline, func(ctx context.Context) {
+		irc.withTyping(cmd.Target, func() {
+			summary, err := irc.summarize(irc.fetchContext(ctx, cmd.Target), cmd.Args[0])
+			if err != nil {
+				irc.logger("summarize").Warn("couldn't summarize", "channel", cmd.Target, "url", cmd.Args[0], "msgid", cmd.MsgID, "err", err)
+				irc.replyf(cmd, "couldn't summarize that: %v", err)
+				return
+			}
+			irc.reply(cmd, summary)
+		})
+	})
+	if err != nil {
+		irc.replyf(cmd, "too busy, try again later")
+	}
+}
+
+func (irc *Bot) summarize(ctx context.Context, url string) (string, error) {
+	p, err := irc.fetcher.Fetch(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	text := p.Text
+	if text == "" {
+		text = p.Description
+	}
+	if text == "" {
+		return "", fmt.Errorf("no article text found")
+	}
+	input := truncateRunes(text, maxSummaryInputRunes)
+	if p.Title != "" {
+		input = "Title: " + p.Title + "\n\n" + input
+	}
+	summary, err := irc.llm.complete(ctx, []chatMessage{
+		{Role: "system", Content: summarizePrompt},
+		{Role: "user", Content: input},
+	}, maxSummaryTokens)
+	if err != nil {
+		return "", err
+	}
+	return truncateRunes(fetch.CollapseWhitespace(summary), maxSummaryRunes), nil
+}
+
+// truncateRunes shortens s to at most n runes, marking the cut with an ellipsis.
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
@@ -0,0 +1,94 @@
+package wutbot
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ergochat/irc-go/ircmsg"
+)
+
+const (
+	systemdStatusInterval = time.Minute
+)
+
+// sdNotify sends a state update to systemd (see sd_notify(3)); it does
+// nothing unless we were started by a Type=notify unit.
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// net handles the "@" of abstract sockets itself
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval is how often systemd expects to hear from us, or zero
+// if WatchdogSec isn't set.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+func (irc *Bot) systemdStatus() string {
+	report := irc.healthReport()
+	switch {
+	case report.Registered:
+		return fmt.Sprintf("STATUS=connected to %s as %s, in %d channels", report.Server, report.Nick, len(irc.joined.List()))
+	case report.Connected:
+		return "STATUS=registering"
+	default:
+		return "STATUS=reconnecting"
+	}
+}
+
+// notifySystemd reports readiness once we've registered, keeps the status
+// up to date, and pings the watchdog for as long as the connection looks
+// healthy, so that systemd restarts a wedged bot.
+func (irc *Bot) notifySystemd() {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+	logger := irc.logger("systemd")
+	irc.AddConnectCallback(func(e ircmsg.Message) {
+		if err := sdNotify("READY=1\n" + irc.systemdStatus()); err != nil {
+			logger.Warn("couldn't notify systemd", "err", err)
+		}
+	})
+	irc.AddDisconnectCallback(func(e ircmsg.Message) {
+		sdNotify(irc.systemdStatus())
+	})
+	interval := systemdStatusInterval
+	watchdog := watchdogInterval()
+	if watchdog != 0 && watchdog/2 < interval {
+		interval = watchdog / 2
+	}
+	go func() {
+		lastStatus := time.Now()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for irc.tick(ticker) {
+			if watchdog != 0 && irc.healthReport().Healthy {
+				sdNotify("WATCHDOG=1")
+			}
+			if time.Since(lastStatus) >= systemdStatusInterval {
+				sdNotify(irc.systemdStatus())
+				lastStatus = time.Now()
+			}
+		}
+	}()
+}
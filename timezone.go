@@ -0,0 +1,159 @@
+package wutbot
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	// embed the zone database so this works in containers without /usr/share/zoneinfo
+	_ "time/tzdata"
+
+	"pratyush/wutbot/internal/commands"
+)
+
+const (
+	timezoneBucket = "timezones"
+
+	timeFormat = "Mon 2 Jan 15:04 MST"
+)
+
+// zone regions, for resolving a bare city name like "Berlin"
+var tzRegions = []string{
+	"Europe", "America", "Asia", "Africa", "Australia", "Pacific", "Atlantic", "Indian", "Antarctica",
+	"America/Argentina", "America/Indiana", "America/Kentucky", "America/North_Dakota",
+}
+
+// cities that don't have a zone of their own
+var tzAliases = map[string]string{
+	"delhi":         "Asia/Kolkata",
+	"new delhi":     "Asia/Kolkata",
+	"mumbai":        "Asia/Kolkata",
+	"bangalore":     "Asia/Kolkata",
+	"bengaluru":     "Asia/Kolkata",
+	"beijing":       "Asia/Shanghai",
+	"san francisco": "America/Los_Angeles",
+	"seattle":       "America/Los_Angeles",
+	"washington":    "America/New_York",
+	"boston":        "America/New_York",
+	"munich":        "Europe/Berlin",
+	"sydney":        "Australia/Sydney",
+	"utc":           "UTC",
+}
+
+// nickAccounts remembers which account each nick was last seen using,
+// so that users can be looked up by nick.
+type nickAccounts struct {
+	sync.Mutex
+	accounts map[string]string // casefolded nick -> account
+}
+
+func newNickAccounts() *nickAccounts {
+	return &nickAccounts{accounts: make(map[string]string)}
+}
+
+func (n *nickAccounts) Set(nick, account string) {
+	if account == "" || account == "*" {
+		return
+	}
+	n.Lock()
+	n.accounts[strings.ToLower(nick)] = account
+	n.Unlock()
+}
+
+func (n *nickAccounts) Get(nick string) string {
+	n.Lock()
+	defer n.Unlock()
+	return n.accounts[strings.ToLower(nick)]
+}
+
+// resolveTimezone accepts a zone name ("Europe/Berlin"), abbreviation ("EST")
+// or a city name ("berlin", "new york").
+func resolveTimezone(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("no timezone given")
+	}
+	if alias, ok := tzAliases[strings.ToLower(name)]; ok {
+		return time.LoadLocation(alias)
+	}
+	if strings.Contains(name, "/") || strings.ToUpper(name) == name {
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc, nil
+		}
+	}
+	city := titleCaseCity(name)
+	for _, region := range tzRegions {
+		if loc, err := time.LoadLocation(region + "/" + city); err == nil {
+			return loc, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown timezone or city: %s", name)
+}
+
+// titleCaseCity converts "new york" to "New_York", as used in zone names.
+func titleCaseCity(name string) string {
+	words := strings.Fields(strings.ToLower(name))
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
+	}
+	return strings.Join(words, "_")
+}
+
+func (irc *Bot) userTimezone(account string) (loc *time.Location, ok bool) {
+	if account == "" {
+		return nil, false
+	}
+	var name string
+	if found, err := irc.store.Get(timezoneBucket, account, &name); !found || err != nil {
+		return nil, false
+	}
+	loc, err := time.LoadLocation(name)
+	return loc, err == nil
+}
+
+func (irc *Bot) handleTimeCommand(cmd commands.Command) {
+	now := time.Now()
+	if len(cmd.Args) == 0 {
+		if loc, ok := irc.userTimezone(cmd.Account); ok {
+			irc.replyf(cmd, "%s: %s", loc, now.In(loc).Format(timeFormat))
+		} else {
+			irc.replyf(cmd, "UTC: %s (set your timezone with !settz)", now.UTC().Format(timeFormat))
+		}
+		return
+	}
+	query := strings.Join(cmd.Args, " ")
+	if len(cmd.Args) == 1 {
+		if loc, ok := irc.userTimezone(irc.nickAccounts.Get(query)); ok {
+			irc.replyf(cmd, "%s (%s): %s", query, loc, now.In(loc).Format(timeFormat))
+			return
+		}
+	}
+	loc, err := resolveTimezone(query)
+	if err != nil {
+		irc.reply(cmd, err.Error())
+		return
+	}
+	irc.replyf(cmd, "%s: %s", loc, now.In(loc).Format(timeFormat))
+}
+
+func (irc *Bot) handleSetTimezoneCommand(cmd commands.Command) {
+	if cmd.Account == "" {
+		irc.replyf(cmd, "you need to be logged in to set a timezone")
+		return
+	}
+	if len(cmd.Args) == 0 {
+		irc.replyf(cmd, "usage: !settz <timezone|city>, e.g. !settz Europe/Berlin")
+		return
+	}
+	loc, err := resolveTimezone(strings.Join(cmd.Args, " "))
+	if err != nil {
+		irc.reply(cmd, err.Error())
+		return
+	}
+	if err := irc.store.Put(timezoneBucket, cmd.Account, loc.String()); err != nil {
+		irc.logger("timezone").Error("couldn't save timezone", "account", cmd.Account, "err", err)
+		irc.replyf(cmd, "couldn't save your timezone")
+		return
+	}
+	irc.replyf(cmd, "your timezone is now %s", loc)
+}
@@ -0,0 +1,75 @@
+package wutbot
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	topicCheckInterval   = time.Minute
+	defaultTopicInterval = 24 * time.Hour
+)
+
+// topicRotation remembers where each channel is in its list of topics.
+type topicRotation struct {
+	sync.Mutex
+	next    map[string]int       // keyed by casefolded channel
+	changed map[string]time.Time // when we last set each topic
+}
+
+func newTopicRotation() *topicRotation {
+	return &topicRotation{next: make(map[string]int), changed: make(map[string]time.Time)}
+}
+
+// rotateTopics sets the next configured topic in each channel whose
+// interval is up, where we have ops to do so.
+func (irc *Bot) rotateTopics() {
+	ticker := time.NewTicker(topicCheckInterval)
+	defer ticker.Stop()
+	for irc.tick(ticker) {
+		if !irc.Connected() {
+			continue
+		}
+		for channel, chanConfig := range irc.getConfig().Channels {
+			if len(chanConfig.Topics) == 0 || channel == "*" || !irc.chanModes.hasOps(channel) {
+				continue
+			}
+			interval, err := time.ParseDuration(chanConfig.TopicInterval)
+			if err != nil || interval <= 0 {
+				interval = defaultTopicInterval
+			}
+			irc.topics.Lock()
+			due := time.Since(irc.topics.changed[channel]) >= interval
+			var topic string
+			if due {
+				i := irc.topics.next[channel] % len(chanConfig.Topics)
+				topic = chanConfig.Topics[i]
+				irc.topics.next[channel] = i + 1
+				irc.topics.changed[channel] = time.Now()
+			}
+			irc.topics.Unlock()
+			if due {
+				irc.Send("TOPIC", channel, topic)
+			}
+		}
+	}
+}
+
+// handleModeCommand is the owner's "mode <channel> <modes> [<params>...]".
+func (irc *Bot) handleModeCommand(target string, args []string) {
+	if len(args) < 2 || !irc.isChannel(args[0]) {
+		irc.Privmsg(target, "usage: mode <channel> <modes> [<params>...]")
+		return
+	}
+	irc.Send("MODE", args...)
+}
+
+// handleTopicCommand is the owner's "topic <channel> <text>".
+func (irc *Bot) handleTopicCommand(target string, args []string) {
+	if len(args) < 2 || !irc.isChannel(args[0]) {
+		irc.Privmsg(target, "usage: topic <channel> <text>")
+		return
+	}
+	irc.Send("TOPIC", args[0], strings.Join(args[1:], " "))
+}
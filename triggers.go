@@ -0,0 +1,85 @@
+package wutbot
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+const (
+	// don't let a single message set off a flood of trigger responses
+	maxTriggerResponses = 3
+)
+
+type trigger struct {
+	pattern  *regexp.Regexp
+	response *template.Template
+}
+
+// triggerData is what trigger response templates are executed against, e.g.
+// "{{.Nick}}: https://jira.example.com/browse/{{index .Match 0}}"
+type triggerData struct {
+	Nick    string
+	Channel string
+	Match   []string          // the full match, followed by the capture groups
+	Groups  map[string]string // named capture groups
+}
+
+// compileTriggers compiles the triggers in the config, keyed like FileConfig.Channels.
+func compileTriggers(config *FileConfig) (map[string][]trigger, error) {
+	result := make(map[string][]trigger)
+	for channel, chanConfig := range config.Channels {
+		for i, tc := range chanConfig.Triggers {
+			pattern, err := regexp.Compile(tc.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trigger pattern %d for %s: %w", i, channel, err)
+			}
+			response, err := template.New(tc.Pattern).Option("missingkey=zero").Parse(tc.Response)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trigger response %d for %s: %w", i, channel, err)
+			}
+			result[channel] = append(result[channel], trigger{pattern: pattern, response: response})
+		}
+	}
+	return result, nil
+}
+
+func (irc *Bot) channelTriggers(channel string) (result []trigger) {
+	result = append(result, irc.triggers["*"]...)
+	result = append(result, irc.triggers[strings.ToLower(channel)]...)
+	return
+}
+
+func (irc *Bot) handleTriggers(target, nick, msgid, message string) {
+	responses := 0
+	for _, t := range irc.channelTriggers(target) {
+		match := t.pattern.FindStringSubmatch(message)
+		if match == nil {
+			continue
+		}
+		data := triggerData{
+			Nick:    nick,
+			Channel: target,
+			Match:   match,
+			Groups:  make(map[string]string),
+		}
+		for i, name := range t.pattern.SubexpNames() {
+			if name != "" {
+				data.Groups[name] = match[i]
+			}
+		}
+		var buf strings.Builder
+		if err := t.response.Execute(&buf, data); err != nil {
+			irc.logger("triggers").Error("couldn't execute trigger template", "channel", target, "pattern", t.pattern.String(), "msgid", msgid, "err", err)
+			continue
+		}
+		if response := strings.TrimSpace(buf.String()); response != "" {
+			irc.sendReplyNotice(target, msgid, response)
+			responses++
+			if responses == maxTriggerResponses {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package wutbot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"pratyush/wutbot/internal/commands"
+)
+
+const (
+	openTriviaURL = "https://opentdb.com/api.php?amount=1&encode=url3986"
+
+	triviaHintInterval = 15 * time.Second
+	triviaMaxHints     = 2
+	triviaPause        = 5 * time.Second
+	// stop a game nobody is playing
+	triviaMaxUnanswered = 3
+	triviaTopCount      = 5
+
+	triviaScoresBucket = "trivia-scores:"
+)
+
+type triviaQuestion struct {
+	category string
+	question string
+	answer   string
+	boolean  bool
+}
+
+type triviaWinner struct {
+	nick    string
+	account string
+}
+
+type triviaGame struct {
+	channel  string
+	stop     chan empty
+	answered chan triviaWinner
+
+	sync.Mutex
+	answer string // normalized; empty if no question is open
+}
+
+type triviaManager struct {
+	sync.Mutex
+	games map[string]*triviaGame // keyed by casefolded channel
+}
+
+func newTriviaManager() *triviaManager {
+	return &triviaManager{games: make(map[string]*triviaGame)}
+}
+
+func (irc *Bot) handleTriviaCommand(cmd commands.Command) {
+	if !channelOption(irc.getConfig(), cmd.Target, func(c ChannelConfig) *bool { return c.Trivia }) {
+		irc.replyf(cmd, "trivia isn't enabled in this channel")
+		return
+	}
+	subcommand := ""
+	if len(cmd.Args) != 0 {
+		subcommand = strings.ToLower(cmd.Args[0])
+	}
+	key := strings.ToLower(cmd.Target)
+	tm := irc.trivia
+	switch subcommand {
+	case "start":
+		tm.Lock()
+		if _, running := tm.games[key]; running {
+			tm.Unlock()
+			irc.replyf(cmd, "trivia is already running")
+			return
+		}
+		game := &triviaGame{
+			channel:  cmd.Target,
+			stop:     make(chan empty),
+			answered: make(chan triviaWinner, 1),
+		}
+		tm.games[key] = game
+		tm.Unlock()
+		go irc.runTrivia(game)
+	case "stop":
+		tm.Lock()
+		game, running := tm.games[key]
+		delete(tm.games, key)
+		tm.Unlock()
+		if !running {
+			irc.replyf(cmd, "trivia isn't running")
+			return
+		}
+		close(game.stop)
+	case "top":
+		irc.reply(cmd, irc.triviaTopScores(cmd.Target))
+	default:
+		irc.replyf(cmd, "usage: !trivia start|stop|top")
+	}
+}
+
+// handleTriviaAnswer checks a channel message against the open trivia question.
+func (irc *Bot) handleTriviaAnswer(target, nick, account, message string) {
+	irc.trivia.Lock()
+	game := irc.trivia.games[strings.ToLower(target)]
+	irc.trivia.Unlock()
+	if game == nil {
+		return
+	}
+	game.Lock()
+	defer game.Unlock()
+	if game.answer == "" || normalizeTriviaAnswer(message) != game.answer {
+		return
+	}
+	game.answer = ""
+	// the buffer only ever holds the one winner per question, but this
+	// mustn't block the message loop with the game locked if that changes
+	select {
+	case game.answered <- triviaWinner{nick: nick, account: account}:
+	default:
+	}
+}
+
+func (irc *Bot) runTrivia(game *triviaGame) {
+	defer irc.recoverPanic("trivia")
+	defer func() {
+		irc.trivia.Lock()
+		if irc.trivia.games[strings.ToLower(game.channel)] == game {
+			delete(irc.trivia.games, strings.ToLower(game.channel))
+		}
+		irc.trivia.Unlock()
+	}()
+
+	irc.Notice(game.channel, "Trivia time! Answer in the channel; !trivia stop to end the game")
+	unanswered := 0
+	for {
+		q, err := irc.fetchTriviaQuestion(irc.connectionContext())
+		if err != nil {
+			irc.logger("trivia").Warn("couldn't fetch trivia question", "channel", game.channel, "err", err)
+			irc.Notice(game.channel, "Couldn't get a trivia question, stopping")
+			return
+		}
+		if !irc.askTriviaQuestion(game, q) {
+			return
+		}
+		unanswered++
+		select {
+		case winner := <-game.answered:
+			unanswered = 0
+			irc.announceTriviaWinner(game.channel, winner, q.answer)
+		default:
+		}
+		if unanswered == triviaMaxUnanswered {
+			irc.Notice(game.channel, "Nobody's playing, stopping trivia")
+			return
+		}
+		select {
+		case <-game.stop:
+			return
+		case <-time.After(triviaPause):
+		}
+	}
+}
+
+// askTriviaQuestion posts the question and its hints, returning false if
+// the game was stopped. A winning answer is left in game.answered.
+func (irc *Bot) askTriviaQuestion(game *triviaGame, q triviaQuestion) (ok bool) {
+	question := fmt.Sprintf("[%s] %s", q.category, q.question)
+	if q.boolean {
+		question += " (True/False)"
+	}
+	game.Lock()
+	game.answer = normalizeTriviaAnswer(q.answer)
+	game.Unlock()
+	defer func() {
+		game.Lock()
+		game.answer = ""
+		game.Unlock()
+	}()
+	irc.Notice(game.channel, question)
+
+	ticker := time.NewTicker(triviaHintInterval)
+	defer ticker.Stop()
+	for hints := 1; ; hints++ {
+		select {
+		case <-game.stop:
+			return false
+		case winner := <-game.answered:
+			// put it back for the caller
+			game.answered <- winner
+			return true
+		case <-ticker.C:
+			if hints > triviaMaxHints || q.boolean {
+				irc.Notice(game.channel, fmt.Sprintf("Time's up! The answer was: %s", q.answer))
+				return true
+			}
+			irc.Notice(game.channel, fmt.Sprintf("Hint: %s", triviaHint(q.answer, hints)))
+		}
+	}
+}
+
+func (irc *Bot) announceTriviaWinner(channel string, winner triviaWinner, answer string) {
+	if winner.account == "" {
+		irc.Notice(channel, fmt.Sprintf("%s got it: %s (log in to keep score)", winner.nick, answer))
+		return
+	}
+	bucket := triviaScoresBucket + strings.ToLower(channel)
+	var score int
+	if _, err := irc.store.Get(bucket, winner.account, &score); err != nil {
+		irc.logger("trivia").Error("couldn't read trivia score", "channel", channel, "err", err)
+	}
+	score++
+	if err := irc.store.Put(bucket, winner.account, score); err != nil {
+		irc.logger("trivia").Error("couldn't save trivia score", "channel", channel, "err", err)
+	}
+	irc.Notice(channel, fmt.Sprintf("%s got it: %s (score: %d)", winner.nick, answer, score))
+}
+
+func (irc *Bot) triviaTopScores(channel string) string {
+	type entry struct {
+		account string
+		score   int
+	}
+	bucket := triviaScoresBucket + strings.ToLower(channel)
+	accounts, err := irc.store.Keys(bucket)
+	if err != nil {
+		irc.logger("trivia").Error("couldn't read scores", "channel", channel, "err", err)
+		return "couldn't read the scores"
+	}
+	var entries []entry
+	for _, account := range accounts {
+		var score int
+		if found, err := irc.store.Get(bucket, account, &score); found && err == nil {
+			entries = append(entries, entry{account, score})
+		}
+	}
+	if len(entries) == 0 {
+		return "nobody has scored yet"
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].score > entries[j].score })
+	if len(entries) > triviaTopCount {
+		entries = entries[:triviaTopCount]
+	}
+	var result []string
+	for i, e := range entries {
+		result = append(result, fmt.Sprintf("%d. %s (%d)", i+1, e.account, e.score))
+	}
+	return strings.Join(result, ", ")
+}
+
+func (irc *Bot) fetchTriviaQuestion(ctx context.Context) (q triviaQuestion, err error) {
+	var response struct {
+		ResponseCode int `json:"response_code"`
+		Results      []struct {
+			Type          string `json:"type"`
+			Category      string `json:"category"`
+			Question      string `json:"question"`
+			CorrectAnswer string `json:"correct_answer"`
+		} `json:"results"`
+	}
+	if err = irc.getJSON(ctx, openTriviaURL, &response); err != nil {
+		return
+	}
+	if response.ResponseCode != 0 || len(response.Results) == 0 {
+		return q, errors.New("no questions returned")
+	}
+	result := response.Results[0]
+	q.boolean = result.Type == "boolean"
+	for field, value := range map[*string]string{
+		&q.category: result.Category,
+		&q.question: result.Question,
+		&q.answer:   result.CorrectAnswer,
+	} {
+		if *field, err = url.QueryUnescape(value); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func normalizeTriviaAnswer(answer string) string {
+	var buf strings.Builder
+	for _, r := range strings.ToLower(answer) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			buf.WriteRune(r)
+		}
+	}
+	return buf.String()
+}
+
+// triviaHint masks the answer, revealing the first `revealed` letters of each word.
+func triviaHint(answer string, revealed int) string {
+	var buf strings.Builder
+	pos := 0
+	for _, r := range answer {
+		switch {
+		case r == ' ':
+			pos = 0
+			buf.WriteRune(r)
+		case !(unicode.IsLetter(r) || unicode.IsDigit(r)):
+			buf.WriteRune(r)
+		case pos < revealed:
+			pos++
+			buf.WriteRune(r)
+		default:
+			pos++
+			buf.WriteRune('_')
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,29 @@
+package wutbot
+
+import (
+	"time"
+)
+
+const (
+	// only show the indicator for fetches slower than this
+	typingDelay = time.Second
+)
+
+func (irc *Bot) sendTyping(target, state string) {
+	if _, ok := irc.AcknowledgedCaps()["message-tags"]; !ok {
+		return
+	}
+	// +typing is the ratified name; some clients still only know the draft one
+	irc.SendWithTags(map[string]string{"+typing": state, "+draft/typing": state}, "TAGMSG", target)
+}
+
+// withTyping runs work (which should send its own reply), showing a typing
+// indicator in target if it takes longer than typingDelay.
+func (irc *Bot) withTyping(target string, work func()) {
+	timer := time.AfterFunc(typingDelay, func() { irc.sendTyping(target, "active") })
+	work()
+	if !timer.Stop() {
+		// the indicator went out, so clear it
+		irc.sendTyping(target, "done")
+	}
+}
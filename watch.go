@@ -0,0 +1,152 @@
+package wutbot
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// the owner's watch words and /regexes/, mapped to when they were added
+	watchesBucket = "watches"
+	// matches this close together are forwarded together
+	watchBatchDelay = 10 * time.Second
+	// forward at most this many matches at once, summarizing the rest
+	maxWatchBatch = 5
+)
+
+// watchList is the owner's watches, compiled.
+type watchList struct {
+	sync.Mutex
+	loaded   bool
+	patterns map[string]*regexp.Regexp
+	batch    []string // matches waiting for the batch to be forwarded
+}
+
+// compileWatch compiles "/regex/" (case-insensitive) or a word.
+func compileWatch(watch string) (*regexp.Regexp, error) {
+	if len(watch) > 2 && strings.HasPrefix(watch, "/") && strings.HasSuffix(watch, "/") {
+		return regexp.Compile("(?i)" + watch[1:len(watch)-1])
+	}
+	return regexp.Compile(`(?i)\b` + regexp.QuoteMeta(watch) + `\b`)
+}
+
+// watchMatches returns whether any of the owner's watches match text.
+func (irc *Bot) watchMatches(text string) bool {
+	w := irc.watches
+	w.Lock()
+	defer w.Unlock()
+	if !w.loaded {
+		watches, err := irc.store.Keys(watchesBucket)
+		if err != nil {
+			irc.logger("watch").Error("couldn't read watches", "err", err)
+			return false
+		}
+		w.patterns = make(map[string]*regexp.Regexp)
+		for _, watch := range watches {
+			if re, err := compileWatch(watch); err == nil {
+				w.patterns[watch] = re
+			}
+		}
+		w.loaded = true
+	}
+	for _, re := range w.patterns {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleOwnerWatches forwards channel messages that match the owner's
+// watches, batched, and held until they're online.
+func (irc *Bot) handleOwnerWatches(m messageEvent) {
+	ownerNick, _ := irc.ownerOnline()
+	if ownerNick == "" || strings.EqualFold(m.nick, ownerNick) || !irc.watchMatches(m.text) {
+		return
+	}
+	text := fmt.Sprintf("%s <%s> %s", m.channel, m.nick, m.text)
+	if m.msgid != "" {
+		text += " (msgid " + m.msgid + ")"
+	}
+	w := irc.watches
+	w.Lock()
+	defer w.Unlock()
+	if len(w.batch) == 0 {
+		time.AfterFunc(watchBatchDelay, irc.forwardWatches)
+	}
+	w.batch = append(w.batch, text)
+}
+
+func (irc *Bot) forwardWatches() {
+	defer irc.recoverPanic("watch forwarding")
+	w := irc.watches
+	w.Lock()
+	batch := w.batch
+	w.batch = nil
+	w.Unlock()
+	if len(batch) > maxWatchBatch {
+		batch = append(batch[:maxWatchBatch-1], fmt.Sprintf("and %d more watched messages", len(batch)-maxWatchBatch+1))
+	}
+	for _, text := range batch {
+		irc.notifyOwner(text)
+	}
+}
+
+// handleWatchCommand is the owner's "watch [<word>|/<regex>/]", listing the
+// watches with no argument, and "unwatch <word>|/<regex>/".
+func (irc *Bot) handleWatchCommand(target string, args []string, remove bool) {
+	w := irc.watches
+	if len(args) == 0 && !remove {
+		watches, err := irc.store.Keys(watchesBucket)
+		if err != nil {
+			irc.Privmsg(target, fmt.Sprintf("couldn't read watches: %v", err))
+			return
+		}
+		sort.Strings(watches)
+		if len(watches) == 0 {
+			irc.Privmsg(target, "not watching for anything")
+		} else {
+			irc.Privmsg(target, "watching for: "+strings.Join(watches, ", "))
+		}
+		return
+	}
+	if len(args) == 0 {
+		irc.Privmsg(target, "usage: unwatch <word>|/<regex>/")
+		return
+	}
+	watch := strings.Join(args, " ")
+	if remove {
+		if found, _ := irc.store.Get(watchesBucket, watch, new(time.Time)); !found {
+			irc.Privmsg(target, fmt.Sprintf("not watching for %s", watch))
+			return
+		}
+		if err := irc.store.Delete(watchesBucket, watch); err != nil {
+			irc.Privmsg(target, fmt.Sprintf("couldn't delete: %v", err))
+			return
+		}
+		w.Lock()
+		delete(w.patterns, watch)
+		w.Unlock()
+		irc.Privmsg(target, "done")
+		return
+	}
+	re, err := compileWatch(watch)
+	if err != nil {
+		irc.Privmsg(target, fmt.Sprintf("invalid regex: %v", err))
+		return
+	}
+	if err := irc.store.Put(watchesBucket, watch, time.Now()); err != nil {
+		irc.Privmsg(target, fmt.Sprintf("couldn't save: %v", err))
+		return
+	}
+	w.Lock()
+	if w.loaded {
+		w.patterns[watch] = re
+	}
+	w.Unlock()
+	irc.Privmsg(target, fmt.Sprintf("watching for %s", watch))
+}
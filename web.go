@@ -0,0 +1,48 @@
+package wutbot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	httpTimeout = 15 * time.Second
+
+	// cap on the size of API responses we're willing to read
+	maxAPIResponseBytes = 1 << 20
+)
+
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: httpTimeout}
+}
+
+// getJSON fetches url and decodes the JSON response into result.
+func (irc *Bot) getJSON(ctx context.Context, url string, result interface{}) error {
+	return irc.getJSONWithToken(ctx, url, "", result)
+}
+
+// getJSONWithToken is getJSON for APIs that take a bearer token.
+func (irc *Bot) getJSONWithToken(ctx context.Context, url, token string, result interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", irc.userAgent)
+	req.Header.Set("Accept", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := irc.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxAPIResponseBytes)).Decode(result)
+}
@@ -0,0 +1,139 @@
+package wutbot
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"pratyush/wutbot/internal/fetch"
+)
+
+const (
+	defaultWebhookRate = 10
+	webhookRateWindow  = time.Minute
+	// lines relayed from a single request
+	maxWebhookLines = 5
+)
+
+type webhook struct {
+	name     string
+	token    string
+	channel  string
+	template *template.Template // nil for the default
+	limiter  *rateLimiter
+}
+
+// compileWebhooks compiles the webhook templates in the config, keyed by route name.
+func compileWebhooks(config *FileConfig) (map[string]*webhook, error) {
+	result := make(map[string]*webhook)
+	for name, wc := range config.Webhooks {
+		if wc.Token == "" || wc.Channel == "" {
+			return nil, fmt.Errorf("webhook %s needs a token and a channel", name)
+		}
+		var tmpl *template.Template
+		if wc.Template != "" {
+			var err error
+			if tmpl, err = template.New(name).Option("missingkey=zero").Parse(wc.Template); err != nil {
+				return nil, fmt.Errorf("invalid template for webhook %s: %w", name, err)
+			}
+		}
+		rate := wc.RateLimit
+		if rate <= 0 {
+			rate = defaultWebhookRate
+		}
+		result[name] = &webhook{
+			name:     name,
+			token:    wc.Token,
+			channel:  wc.Channel,
+			template: tmpl,
+			limiter:  newRateLimiter(rate, webhookRateWindow),
+		}
+	}
+	return result, nil
+}
+
+// handleWebhook relays POSTs to /hook/<name> to the route's channel.
+func (irc *Bot) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	hook := irc.webhooks[strings.TrimPrefix(r.URL.Path, "/hook/")]
+	if hook == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(hook.token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	if !hook.limiter.allow(hook.name) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxAPIResponseBytes))
+	if err != nil {
+		http.Error(w, "payload too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	var data interface{} = string(body)
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "application/json" {
+		if err := json.Unmarshal(body, &data); err != nil {
+			http.Error(w, "invalid JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	var buf strings.Builder
+	if hook.template != nil {
+		if err := hook.template.Execute(&buf, data); err != nil {
+			http.Error(w, fmt.Sprintf("template failed: %v", err), http.StatusBadRequest)
+			return
+		}
+	} else {
+		buf.WriteString(defaultWebhookText(data))
+	}
+	var lines []string
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if line = strings.TrimSpace(fetch.Sanitize(line)); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 0 {
+		http.Error(w, "nothing to send", http.StatusBadRequest)
+		return
+	}
+	if len(lines) > maxWebhookLines {
+		lines = append(lines[:maxWebhookLines-1], fmt.Sprintf("(%d more lines)", len(lines)-maxWebhookLines+1))
+	}
+	// the sinks still get what the channel doesn't
+	if !irc.isQuiet(hook.channel) {
+		for _, line := range lines {
+			irc.Notice(hook.channel, line)
+		}
+	}
+	irc.alert(alertWebhook, hook.name, hook.channel, lines...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// defaultWebhookText is a plain text body, or a JSON one's "text" or
+// "message" field.
+func defaultWebhookText(data interface{}) string {
+	switch data := data.(type) {
+	case string:
+		return data
+	case map[string]interface{}:
+		for _, field := range []string{"text", "message"} {
+			if text, ok := data[field].(string); ok {
+				return text
+			}
+		}
+	}
+	return ""
+}
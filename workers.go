@@ -0,0 +1,141 @@
+package wutbot
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// queued jobs in all, and per channel, beyond which new ones are refused
+	maxQueuedJobs        = 512
+	maxQueuedChannelJobs = 32
+
+	dropFull      = "full"
+	dropExpired   = "expired"
+	dropCancelled = "cancelled"
+)
+
+var errBusy = errors.New("too busy")
+
+type job struct {
+	name   string
+	ctx    context.Context
+	cancel context.CancelFunc
+	run    func(ctx context.Context)
+}
+
+// workerPool runs background work (fetches, summaries, chat answers) on a
+// fixed number of workers. Jobs are queued per channel and the channels
+// served in turn, so that one busy channel can't starve the others; a job
+// still queued at its deadline is dropped, since its answer would be stale.
+type workerPool struct {
+	sync.Mutex
+	wake      *sync.Cond
+	queues    map[string][]*job // casefolded channel -> jobs, oldest first
+	order     []string          // channels with queued jobs, in the order they're served
+	queued    int
+	busy      int
+	completed int
+	dropped   map[string]int // reason -> count
+}
+
+func newWorkerPool() *workerPool {
+	p := &workerPool{
+		queues:  make(map[string][]*job),
+		dropped: make(map[string]int),
+	}
+	p.wake = sync.NewCond(&p.Mutex)
+	return p
+}
+
+// submit queues run to be done for channel within timeout, with a context
+// that's cancelled at the deadline (or with ctx), or returns errBusy if the
+// queue (or the channel's share of it) is full.
+func (p *workerPool) submit(ctx context.Context, channel, name string, timeout time.Duration, run func(ctx context.Context)) error {
+	key := strings.ToLower(channel)
+	p.Lock()
+	defer p.Unlock()
+	if p.queued >= maxQueuedJobs || len(p.queues[key]) >= maxQueuedChannelJobs {
+		p.dropped[dropFull]++
+		return errBusy
+	}
+	if len(p.queues[key]) == 0 {
+		p.order = append(p.order, key)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	p.queues[key] = append(p.queues[key], &job{name: name, ctx: ctx, cancel: cancel, run: run})
+	p.queued++
+	p.wake.Signal()
+	return nil
+}
+
+// next waits for a job, taking the oldest one of the channel whose turn it is.
+func (p *workerPool) next() *job {
+	p.Lock()
+	defer p.Unlock()
+	for {
+		for p.queued == 0 {
+			p.wake.Wait()
+		}
+		key := p.order[0]
+		j := p.queues[key][0]
+		p.queues[key] = p.queues[key][1:]
+		p.queued--
+		p.order = p.order[1:]
+		if len(p.queues[key]) != 0 {
+			p.order = append(p.order, key)
+		} else {
+			delete(p.queues, key)
+		}
+		if err := j.ctx.Err(); err != nil {
+			j.cancel()
+			if err == context.DeadlineExceeded {
+				p.dropped[dropExpired]++
+			} else {
+				p.dropped[dropCancelled]++
+			}
+			continue
+		}
+		p.busy++
+		return j
+	}
+}
+
+func (p *workerPool) done() {
+	p.Lock()
+	p.busy--
+	p.completed++
+	p.Unlock()
+}
+
+type workerStats struct {
+	queued, busy, completed int
+	dropped                 map[string]int
+}
+
+func (p *workerPool) stats() workerStats {
+	p.Lock()
+	defer p.Unlock()
+	dropped := make(map[string]int, len(p.dropped))
+	for reason, n := range p.dropped {
+		dropped[reason] = n
+	}
+	return workerStats{queued: p.queued, busy: p.busy, completed: p.completed, dropped: dropped}
+}
+
+// runWorkers starts the pool's workers.
+func (irc *Bot) runWorkers(n int) {
+	for i := 0; i < n; i++ {
+		go func() {
+			for {
+				j := irc.workers.next()
+				irc.safely(j.name, func() { j.run(j.ctx) })
+				j.cancel()
+				irc.workers.done()
+			}
+		}()
+	}
+}
@@ -0,0 +1,36 @@
+package wutbot
+
+import (
+	"strings"
+
+	"pratyush/wutbot/internal/integrations"
+)
+
+// The XMPP gateway lets the owner use the owner commands from a chat
+// client, and gets them their notifications there while away from IRC.
+
+// runXMPP keeps the gateway connected until we're shutting down.
+func (irc *Bot) runXMPP() {
+	irc.xmpp.Run(irc.stopping.ctx, integrations.XMPPHandlerFunc(irc.handleXMPPMessage), irc.logger("xmpp"))
+}
+
+// handleXMPPMessage runs a message from the owner as an owner command.
+func (irc *Bot) handleXMPPMessage(from, body string) {
+	irc.safely("xmpp message", func() {
+		irc.audit(auditEntry{Nick: from, Account: irc.Owner, Channel: "XMPP", Command: strings.TrimLeft(strings.TrimPrefix(body, irc.Nick), ": ")})
+		if !strings.HasPrefix(body, irc.Nick) {
+			body = irc.Nick + " " + body
+		}
+		// replies come back through queueMessage
+		irc.handleOwnerCommand(from, body)
+	})
+}
+
+// queueXMPPMessage is queueMessage for the owner's JID: only PRIVMSGs and
+// NOTICEs are sent.
+func (irc *Bot) queueXMPPMessage(command string, params []string) error {
+	if (command != "PRIVMSG" && command != "NOTICE") || len(params) != 2 {
+		return nil
+	}
+	return irc.xmpp.Send(params[0], params[1])
+}